@@ -2,8 +2,27 @@ package browser
 
 import (
 	"context"
+	"time"
 )
 
 type Browser interface {
 	Browse(cxt context.Context) chan *LocalAssetFile
 }
+
+// DateRange limits the browsing to the assets captured between After (included) and Before (excluded).
+// The browsers use it to skip assets as early as possible. A zero DateRange selects all assets.
+type DateRange struct {
+	After, Before time.Time
+}
+
+func (r DateRange) IsSet() bool {
+	return !r.After.IsZero() || !r.Before.IsZero()
+}
+
+// InRange reports whether the date is in the range. An unknown date is in the range.
+func (r DateRange) InRange(d time.Time) bool {
+	if d.IsZero() {
+		return true
+	}
+	return (r.After.IsZero() || d.Compare(r.After) >= 0) && (r.Before.IsZero() || d.Before(r.Before))
+}
@@ -6,29 +6,125 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/exiftool"
 	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/gen"
 	"github.com/simulot/immich-go/immich/metadata"
 	"github.com/simulot/immich-go/logger"
 )
 
 type LocalAssetBrowser struct {
-	fsyss  []fs.FS
-	albums map[string]string
-	log    *logger.Journal
+	fsyss     []fs.FS
+	albums    map[string]string
+	log       *logger.Journal
+	dateRange browser.DateRange     // only assets captured in this range are browsed
+	excluded  fshelper.PathPatterns // files and folders to be ignored
+	skipExif  bool                  // don't read the date of capture in the files
+	sidecars  bool                  // attach the XMP files found next to the assets
+
+	verifyMime bool // check that the extensions match the content, and recognize the unknown extensions
+	fixMime    bool // upload the files with the extension of their content when it doesn't match
+
+	sidecarTypes []string // extensions of the files attached to the assets having the same name
+	motionPhotos int      // photos embedding their video
+
+	exifTool *exiftool.Tool // reads the metadata instead of the Go readers, nil when not used
 }
 
+// DefaultSidecarTypes are the extensions of the files written by the phones and the cameras next to the assets:
+// Apple edits, thumbnails, low resolution videos and clip metadata
+var DefaultSidecarTypes = []string{".aae", ".thm", ".lrv", ".xml"}
+
 func NewLocalFiles(ctx context.Context, log *logger.Journal, fsyss ...fs.FS) (*LocalAssetBrowser, error) {
 	return &LocalAssetBrowser{
-		fsyss:  fsyss,
-		albums: map[string]string{},
-		log:    log,
+		fsyss:    fsyss,
+		albums:   map[string]string{},
+		log:      log,
+		sidecars: true,
+
+		sidecarTypes: DefaultSidecarTypes,
 	}, nil
 }
 
+// SetDateRange limits the browsing to the assets captured in the range.
+// The date found in the file name, or the file's modification time are used
+// to skip files before reading their metadata.
+func (la *LocalAssetBrowser) SetDateRange(r browser.DateRange) *LocalAssetBrowser {
+	la.dateRange = r
+	return la
+}
+
+// SetExcludedPaths sets the patterns of files and folders to ignore.
+// Excluded folders aren't read.
+func (la *LocalAssetBrowser) SetExcludedPaths(p fshelper.PathPatterns) *LocalAssetBrowser {
+	la.excluded = p
+	return la
+}
+
+// SetSkipExif disables the reading of the metadata of the files.
+// The date of capture is then given by the file name or the modification time only.
+func (la *LocalAssetBrowser) SetSkipExif(skip bool) *LocalAssetBrowser {
+	la.skipExif = skip
+	return la
+}
+
+// SetSidecarFromFile tells if the XMP files found next to the assets are uploaded with them.
+// The date of capture and the GPS position given by the XMP file take precedence over the
+// ones found in the file name or in the file.
+func (la *LocalAssetBrowser) SetSidecarFromFile(use bool) *LocalAssetBrowser {
+	la.sidecars = use
+	return la
+}
+
+// SetSidecarTypes sets the extensions of the files that aren't assets, but are attached
+// to the asset having the same name, like IMG_0001.AAE for IMG_0001.HEIC
+func (la *LocalAssetBrowser) SetSidecarTypes(exts []string) *LocalAssetBrowser {
+	la.sidecarTypes = exts
+	return la
+}
+
+// SetExifTool reads the dates of capture, the GPS positions and the dimensions with exiftool.
+// The files of each folder are given to exiftool in batches, the Go readers being used for the
+// files that exiftool can't read, or that aren't on the local disk.
+func (la *LocalAssetBrowser) SetExifTool(t *exiftool.Tool) *LocalAssetBrowser {
+	la.exifTool = t
+	return la
+}
+
+// SetVerifyMime checks that the extension of each file matches the format recognized in its first bytes,
+// and recognizes the files having an unknown extension. With fix, the files whose content doesn't match
+// the extension are uploaded with the extension of the content, they are only reported otherwise.
+// The files without extension are always recognized by their content.
+func (la *LocalAssetBrowser) SetVerifyMime(verify, fix bool) *LocalAssetBrowser {
+	la.verifyMime = verify
+	la.fixMime = verify && fix
+	return la
+}
+
+func (la *LocalAssetBrowser) isSidecarType(ext string) bool {
+	return slices.Contains(la.sidecarTypes, ext)
+}
+
+// modTimeMargin covers the time zone differences between the modification time and the date of capture
+const modTimeMargin = 24 * time.Hour
+
+// outOfRange reports whether the file is certainly out of the date range.
+// A file can't be captured after its last modification.
+func (la *LocalAssetBrowser) outOfRange(f *browser.LocalAssetFile, modTime time.Time) bool {
+	if !la.dateRange.IsSet() {
+		return false
+	}
+	if !f.DateTaken.IsZero() {
+		return !la.dateRange.InRange(f.DateTaken)
+	}
+	return !la.dateRange.After.IsZero() && !modTime.IsZero() && modTime.Add(modTimeMargin).Before(la.dateRange.After)
+}
+
 var toOldDate = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
 
 func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAssetFile {
@@ -50,7 +146,11 @@ func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAsse
 						return ctx.Err()
 					default:
 						if d.IsDir() {
-							return la.handleFolder(ctx, fsys, fileChan, name)
+							if name != "." && la.excluded.Match(name) {
+								la.log.Debug("folder excluded: %s", name)
+								return fs.SkipDir
+							}
+							return la.handleFolder(ctx, fsys, fileChan, name, nil)
 						}
 					}
 					return nil
@@ -68,17 +168,52 @@ func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAsse
 				}
 			}
 		}
-
+		if la.motionPhotos > 0 {
+			la.log.Info("%d motion photos detected", la.motionPhotos)
+		}
 	}(ctx)
 
 	return fileChan
 }
 
-func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileChan chan *browser.LocalAssetFile, folder string) error {
+// BrowseFiles browses the given files of fsys only, like Browse does for the whole file systems.
+// The other files of their folders are still used as sidecars.
+func (la *LocalAssetBrowser) BrowseFiles(ctx context.Context, fsys fs.FS, names []string) chan *browser.LocalAssetFile {
+	fileChan := make(chan *browser.LocalAssetFile)
+	go func() {
+		defer close(fileChan)
+		folders := map[string]map[string]bool{}
+		for _, name := range names {
+			dir, base := path.Split(name)
+			dir = path.Clean(dir)
+			if folders[dir] == nil {
+				folders[dir] = map[string]bool{}
+			}
+			folders[dir][base] = true
+		}
+		dirs := gen.MapKeys(folders)
+		slices.Sort(dirs)
+		for _, dir := range dirs {
+			err := la.handleFolder(ctx, fsys, fileChan, dir, folders[dir])
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case fileChan <- &browser.LocalAssetFile{Err: err}:
+				}
+			}
+		}
+	}()
+	return fileChan
+}
+
+// handleFolder sends the assets of the folder, only the ones named in selected when it isn't nil
+func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileChan chan *browser.LocalAssetFile, folder string, selected map[string]bool) error {
 	entries, err := fs.ReadDir(fsys, folder)
 	if err != nil {
 		return err
 	}
+	var infos map[string]exiftool.Info // metadata of the folder's files read by exiftool, by name
 
 	// fileMap := map[string][]fs.DirEntry{}
 	// for _, e := range entries {
@@ -94,11 +229,15 @@ func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileC
 	// }
 
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() || selected != nil && !selected[e.Name()] {
 			continue
 		}
 		fileName := path.Join(folder, e.Name())
 		la.log.AddEntry(fileName, logger.DISCOVERED_FILE, "")
+		if la.excluded.Match(fileName) {
+			la.log.AddEntry(fileName, logger.DISCARDED, "path excluded")
+			continue
+		}
 		name := e.Name()
 		ext := strings.ToLower(path.Ext(name))
 		if fshelper.IsMetadataExt(ext) {
@@ -107,12 +246,22 @@ func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileC
 		} else if fshelper.IsIgnoredExt(ext) {
 			la.log.AddEntry(fileName, logger.UNSUPPORTED, "")
 			continue
+		} else if la.isSidecarType(ext) {
+			la.log.AddEntry(fileName, logger.METADATA, "sidecar file")
+			continue
+		}
+		contentExt := la.contentExt(fsys, fileName, ext)
+		m, err := fshelper.MimeFromExt(ext)
+		if contentExt != "" {
+			m, err = fshelper.MimeFromExt(contentExt)
 		}
-		m, err := fshelper.MimeFromExt(strings.ToLower(ext))
 		if err != nil {
 			la.log.AddEntry(fileName, logger.UNSUPPORTED, "")
 			continue
 		}
+		if infos == nil {
+			infos = la.readExifTool(ctx, fsys, folder, entries)
+		}
 		ss := strings.Split(m[0], "/")
 		if ss[0] == "image" {
 			la.log.AddEntry(name, logger.SCANNED_IMAGE, "")
@@ -128,20 +277,50 @@ func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileC
 			Err:       err,
 			DateTaken: metadata.TakeTimeFromName(filepath.Base(name)),
 		}
+		if contentExt != "" {
+			f.SetContentExt(contentExt)
+		}
 
 		s, err := e.Info()
 		if err != nil {
 			f.Err = err
 		} else {
 			f.FileSize = int(s.Size())
+			if la.sidecars {
+				la.checkSidecar(fsys, &f, entries, folder, name)
+			}
+			la.attachSidecarFiles(&f, entries, folder, name)
+			if la.outOfRange(&f, s.ModTime()) {
+				la.log.AddEntry(fileName, logger.NOT_SELECTED, "asset excluded because the date of capture out of the date range")
+				continue
+			}
+			info, byTool := infos[name]
+			if byTool {
+				la.useExifTool(&f, info)
+			}
 			if f.DateTaken.IsZero() {
-				err = la.ReadMetadataFromFile(&f)
-				_ = err
+				if !la.skipExif && !byTool {
+					err = la.ReadMetadataFromFile(&f)
+					if err != nil {
+						la.log.Debug("can't read the metadata of %s: %s", fileName, err)
+					}
+				}
 				if f.DateTaken.Before(toOldDate) {
-					f.DateTaken = time.Now()
+					f.DateTaken = s.ModTime()
+				}
+				if la.outOfRange(&f, s.ModTime()) {
+					f.Close()
+					la.log.AddEntry(fileName, logger.NOT_SELECTED, "asset excluded because the date of capture out of the date range")
+					continue
+				}
+			}
+			if !la.skipExif {
+				if err := f.ReadMotionPhoto(); err != nil {
+					la.log.Debug("can't check if %s is a motion photo: %s", fileName, err)
+				} else if f.MotionPhoto {
+					la.motionPhotos++
 				}
 			}
-			la.checkSidecar(fsys, &f, entries, folder, name)
 		}
 		// Check if the context has been cancelled
 		select {
@@ -156,6 +335,37 @@ func (la *LocalAssetBrowser) handleFolder(ctx context.Context, fsys fs.FS, fileC
 	return nil
 }
 
+// contentExt recognizes the format of the file in its first bytes when the file has no extension,
+// and with -verify-mime when the extension is unknown or doesn't match the content.
+// It gives the extension to upload the file with, "" to keep the file's one.
+func (la *LocalAssetBrowser) contentExt(fsys fs.FS, name, ext string) string {
+	known := fshelper.IsKnownExt(ext)
+	if ext != "" && !la.verifyMime {
+		return ""
+	}
+	head, err := fshelper.ReadHead(fsys, name)
+	if err != nil {
+		la.log.Debug("can't read the content of %s: %s", name, err)
+		return ""
+	}
+	sniffed := fshelper.SniffExt(head)
+	switch {
+	case sniffed == "" || !fshelper.IsKnownExt(sniffed):
+		return ""
+	case !known:
+		la.log.AddEntry(name, logger.INFO, "format recognized by the content: "+sniffed)
+		return sniffed
+	case fshelper.ExtMatchesContent(ext, head):
+		return ""
+	case la.fixMime:
+		la.log.AddEntry(name, logger.MIME_MISMATCH, "the content is "+sniffed+", uploaded as "+sniffed)
+		return sniffed
+	default:
+		la.log.AddEntry(name, logger.MIME_MISMATCH, "the content is "+sniffed)
+		return ""
+	}
+}
+
 func (la *LocalAssetBrowser) checkSidecar(fsys fs.FS, f *browser.LocalAssetFile, entries []fs.DirEntry, dir, name string) bool {
 	assetBase := baseNames(name)
 
@@ -172,6 +382,7 @@ func (la *LocalAssetBrowser) checkSidecar(fsys fs.FS, f *browser.LocalAssetFile,
 					OnFSsys:  true,
 				}
 				la.log.AddEntry(name, logger.ASSOCIATED_META, "")
+				la.readSidecar(fsys, f)
 				return true
 			}
 
@@ -180,6 +391,53 @@ func (la *LocalAssetBrowser) checkSidecar(fsys fs.FS, f *browser.LocalAssetFile,
 	return false
 }
 
+// attachSidecarFiles attaches to the asset the files having a sidecar type and the same name
+func (la *LocalAssetBrowser) attachSidecarFiles(f *browser.LocalAssetFile, entries []fs.DirEntry, dir, name string) {
+	if len(la.sidecarTypes) == 0 {
+		return
+	}
+	assetBase := baseNames(name)
+	for _, e := range entries {
+		ext := strings.ToLower(path.Ext(e.Name()))
+		if e.IsDir() || !la.isSidecarType(ext) {
+			continue
+		}
+		for _, b := range assetBase {
+			m, err := path.Match(strings.ToLower(b)+ext, strings.ToLower(e.Name()))
+			if err == nil && m {
+				f.SidecarFiles = append(f.SidecarFiles, path.Join(dir, e.Name()))
+				la.log.AddEntry(f.FileName, logger.ASSOCIATED_META, e.Name())
+				break
+			}
+		}
+	}
+}
+
+// readSidecar gets the date of capture, the GPS position and the rating given by the XMP file.
+// They replace the ones found in the file name.
+func (la *LocalAssetBrowser) readSidecar(fsys fs.FS, f *browser.LocalAssetFile) {
+	r, err := fsys.Open(f.SideCar.FileName)
+	if err != nil {
+		la.log.Debug("can't open the sidecar %s: %s", f.SideCar.FileName, err)
+		return
+	}
+	defer r.Close()
+	md, err := metadata.ReadXMP(r)
+	if err != nil {
+		la.log.Debug("can't read the sidecar %s: %s", f.SideCar.FileName, err)
+		return
+	}
+	if !md.DateTaken.IsZero() {
+		f.DateTaken = md.DateTaken
+		f.SideCar.DateTaken = md.DateTaken
+	}
+	if md.Latitude != 0 || md.Longitude != 0 {
+		f.Latitude, f.Longitude, f.Altitude = md.Latitude, md.Longitude, md.Altitude
+		f.SideCar.Latitude, f.SideCar.Longitude, f.SideCar.Elevation = md.Latitude, md.Longitude, md.Altitude
+	}
+	f.SideCar.Rating = md.Rating
+}
+
 func baseNames(n string) []string {
 	n = escapeName(n)
 	names := []string{n}
@@ -214,13 +472,59 @@ func escapeName(n string) string {
 	return b.String()
 }
 
+// readExifTool reads the metadata of the assets of the folder with exiftool, in one run for the whole folder.
+// It returns an empty map when exiftool isn't used, or when the folder isn't on the local disk.
+func (la *LocalAssetBrowser) readExifTool(ctx context.Context, fsys fs.FS, folder string, entries []fs.DirEntry) map[string]exiftool.Info {
+	infos := map[string]exiftool.Info{}
+	if la.exifTool == nil || la.skipExif {
+		return infos
+	}
+	files := []string{}
+	names := map[string]string{} // asset names by path on the disk
+	for _, e := range entries {
+		ext := strings.ToLower(path.Ext(e.Name()))
+		if e.IsDir() || la.isSidecarType(ext) {
+			continue
+		}
+		if _, err := fshelper.MimeFromExt(ext); err != nil {
+			continue
+		}
+		p := fshelper.OSPath(fsys, path.Join(folder, e.Name()))
+		if p == "" {
+			return infos
+		}
+		files = append(files, p)
+		names[p] = e.Name()
+	}
+	read, err := la.exifTool.Read(ctx, files)
+	if err != nil {
+		la.log.Warning("can't read the metadata of the folder %s with exiftool, the files are read by immich-go: %s", folder, err)
+	}
+	for p, info := range read {
+		infos[names[p]] = info
+	}
+	return infos
+}
+
+// useExifTool completes the asset with the metadata read by exiftool.
+// The date found in the name or in the XMP sidecar is kept, as the position of the sidecar.
+func (la *LocalAssetBrowser) useExifTool(f *browser.LocalAssetFile, info exiftool.Info) {
+	if f.DateTaken.IsZero() {
+		f.DateTaken = info.DateTaken
+	}
+	if f.Latitude == 0 && f.Longitude == 0 {
+		f.Latitude, f.Longitude, f.Altitude = info.Latitude, info.Longitude, info.Altitude
+	}
+	f.Width, f.Height = info.Width, info.Height
+}
+
 func (la *LocalAssetBrowser) addAlbum(dir string) {
 	base := path.Base(dir)
 	la.albums[dir] = base
 }
 
 func (la *LocalAssetBrowser) ReadMetadataFromFile(a *browser.LocalAssetFile) error {
-	ext := strings.ToLower(path.Ext(a.FileName))
+	ext := strings.ToLower(a.Ext())
 
 	// Open the file
 	r, err := a.PartialSourceReader()
@@ -231,6 +535,7 @@ func (la *LocalAssetBrowser) ReadMetadataFromFile(a *browser.LocalAssetFile) err
 	m, err := metadata.GetFromReader(r, ext)
 	if err == nil {
 		a.DateTaken = m.DateTaken
+		a.Latitude, a.Longitude, a.Altitude = m.Latitude, m.Longitude, m.Altitude
 	}
 	return err
 }
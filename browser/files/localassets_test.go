@@ -3,18 +3,34 @@ package files_test
 import (
 	"context"
 	"errors"
+	"math"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/browser/files"
+	"github.com/simulot/immich-go/helpers/exiftool"
+	"github.com/simulot/immich-go/helpers/exiftool/fake"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/logger"
 
 	"github.com/kr/pretty"
 	"github.com/psanford/memfs"
 )
 
+func TestMain(m *testing.M) {
+	fake.Run()
+	os.Exit(m.Run())
+}
+
 type inMemFS struct {
 	*memfs.FS
 	err error
@@ -96,3 +112,475 @@ func TestLocalAssets(t *testing.T) {
 
 	}
 }
+
+func TestLocalAssetsDateRange(t *testing.T) {
+	old := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	recent := time.Date(2023, 9, 15, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"photos/20230801-001.jpg": &fstest.MapFile{Data: []byte("1"), ModTime: recent},
+		"photos/20230901-001.jpg": &fstest.MapFile{Data: []byte("2"), ModTime: recent},
+		"photos/old.jpg":          &fstest.MapFile{Data: []byte("3"), ModTime: old},
+		"photos/recent.jpg":       &fstest.MapFile{Data: []byte("4"), ModTime: recent},
+	}
+	tc := []struct {
+		name     string
+		r        browser.DateRange
+		expected []string
+	}{
+		{
+			name:     "no range",
+			expected: []string{"photos/20230801-001.jpg", "photos/20230901-001.jpg", "photos/old.jpg", "photos/recent.jpg"},
+		},
+		{
+			name: "2023-08",
+			r: browser.DateRange{
+				After:  time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+			},
+			// recent.jpg has no metadata, its modification time is out of the range
+			expected: []string{"photos/20230801-001.jpg"},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetDateRange(c.r)
+			results := []string{}
+			for a := range b.Browse(ctx) {
+				results = append(results, a.FileName)
+			}
+			sort.Strings(results)
+			if !reflect.DeepEqual(results, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, results)
+			}
+		})
+	}
+}
+
+func TestLocalAssetsExcludedPaths(t *testing.T) {
+	tc := []struct {
+		name     string
+		patterns []string
+		expected []string
+	}{
+		{
+			name:     "folder at any depth",
+			patterns: []string{"summer 2023"},
+			expected: []string{"root_01.jpg", "photos/photo_01.jpg", "photos/photo_02.cr3", "photos/photo_03.jpg"},
+		},
+		{
+			name:     "files",
+			patterns: []string{"*.cr3", "photos/photo_01.jpg"},
+			expected: []string{"root_01.jpg", "photos/photo_03.jpg", "photos/summer 2023/20230801-001.jpg", "photos/summer 2023/20230801-002.jpg"},
+		},
+		{
+			name:     "sub folders",
+			patterns: []string{"photos/**"},
+			expected: []string{"root_01.jpg"},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			fsys := generateFS()
+			if fsys.err != nil {
+				t.Fatal(fsys.err)
+			}
+			var p fshelper.PathPatterns
+			for _, s := range c.patterns {
+				if err := p.Set(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx := context.Background()
+			b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetExcludedPaths(p)
+			results := []string{}
+			for a := range b.Browse(ctx) {
+				results = append(results, a.FileName)
+			}
+			sort.Strings(c.expected)
+			sort.Strings(results)
+			if !reflect.DeepEqual(results, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, results)
+			}
+		})
+	}
+}
+
+func TestLocalAssetsExif(t *testing.T) {
+	jpg, err := os.ReadFile("../../immich/metadata/TEST_DATA/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	fsys := fstest.MapFS{
+		"photos/IMG_0001.jpg":     &fstest.MapFile{Data: jpg, ModTime: modTime},
+		"photos/20230801-001.jpg": &fstest.MapFile{Data: jpg, ModTime: modTime},
+		"photos/without-exif.jpg": &fstest.MapFile{Data: []byte("no exif"), ModTime: modTime},
+	}
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exifDate := time.Date(2023, 10, 6, 8, 31, 21, 0, local)
+	nameDate := time.Date(2023, 8, 1, 0, 0, 0, 0, local)
+
+	tc := []struct {
+		name     string
+		skipExif bool
+		expected map[string]time.Time
+		withGPS  []string
+	}{
+		{
+			name: "exif",
+			expected: map[string]time.Time{
+				"photos/IMG_0001.jpg":     exifDate,
+				"photos/20230801-001.jpg": nameDate,
+				"photos/without-exif.jpg": modTime,
+			},
+			withGPS: []string{"photos/IMG_0001.jpg"},
+		},
+		{
+			name:     "no-exif",
+			skipExif: true,
+			expected: map[string]time.Time{
+				"photos/IMG_0001.jpg":     modTime,
+				"photos/20230801-001.jpg": nameDate,
+				"photos/without-exif.jpg": modTime,
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetSkipExif(c.skipExif)
+			results := map[string]time.Time{}
+			for a := range b.Browse(ctx) {
+				results[a.FileName] = a.DateTaken
+				hasGPS := a.Latitude != 0 || a.Longitude != 0
+				if hasGPS != slices.Contains(c.withGPS, a.FileName) {
+					t.Errorf("%s: unexpected GPS position %f,%f", a.FileName, a.Latitude, a.Longitude)
+				}
+				a.Close()
+			}
+			if len(results) != len(c.expected) {
+				t.Errorf("expected %d files, got %v", len(c.expected), results)
+			}
+			for f, d := range c.expected {
+				if !results[f].Equal(d) {
+					t.Errorf("%s: expected date %s, got %s", f, d, results[f])
+				}
+			}
+		})
+	}
+}
+
+func TestLocalAssetsSidecars(t *testing.T) {
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		sidecar  string
+		date     time.Time
+		lat, lon float64
+	}
+	tc := []struct {
+		name     string
+		use      bool
+		expected map[string]result
+	}{
+		{
+			name: "sidecars",
+			use:  true,
+			expected: map[string]result{
+				// the date of the sidecar takes precedence over the file name
+				"20230801-001.jpg": {sidecar: "20230801-001.jpg.xmp", date: time.Date(2023, 10, 6, 8, 31, 21, 0, local), lat: 48.8584, lon: 2.2945},
+				"IMG_0002.JPG":     {sidecar: "IMG_0002.XMP", date: time.Date(2021, 4, 30, 18, 45, 12, 500_000_000, time.FixedZone("", -7*3600)), lat: 37.7799, lon: -122.42},
+				"IMG_0003.jpg":     {},
+			},
+		},
+		{
+			name: "ignored",
+			expected: map[string]result{
+				"20230801-001.jpg": {date: time.Date(2023, 8, 1, 0, 0, 0, 0, local)},
+				"IMG_0002.JPG":     {},
+				"IMG_0003.jpg":     {},
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), os.DirFS("TEST_DATA/sidecars"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetSidecarFromFile(c.use).SetSkipExif(true)
+			count := 0
+			for a := range b.Browse(ctx) {
+				count++
+				r, ok := c.expected[a.FileName]
+				if !ok {
+					t.Errorf("unexpected file %s", a.FileName)
+					continue
+				}
+				sidecar := ""
+				if a.SideCar != nil {
+					sidecar = a.SideCar.FileName
+				}
+				if sidecar != r.sidecar {
+					t.Errorf("%s: expected sidecar %q, got %q", a.FileName, r.sidecar, sidecar)
+				}
+				if !r.date.IsZero() && !a.DateTaken.Equal(r.date) {
+					t.Errorf("%s: expected date %s, got %s", a.FileName, r.date, a.DateTaken)
+				}
+				if math.Abs(a.Latitude-r.lat) > 1e-4 || math.Abs(a.Longitude-r.lon) > 1e-4 {
+					t.Errorf("%s: expected position %f,%f, got %f,%f", a.FileName, r.lat, r.lon, a.Latitude, a.Longitude)
+				}
+			}
+			if count != len(c.expected) {
+				t.Errorf("expected %d files, got %d", len(c.expected), count)
+			}
+		})
+	}
+}
+
+func TestLocalAssetsSidecarTypes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photos/IMG_0001.HEIC": &fstest.MapFile{Data: []byte("heic")},
+		"photos/IMG_0001.JPG":  &fstest.MapFile{Data: []byte("jpeg")},
+		"photos/IMG_0001.AAE":  &fstest.MapFile{Data: []byte("edits")},
+		"photos/GOPR0002.MP4":  &fstest.MapFile{Data: []byte("video")},
+		"photos/GOPR0002.THM":  &fstest.MapFile{Data: []byte("thumbnail")},
+		"photos/GOPR0002.LRV":  &fstest.MapFile{Data: []byte("low resolution")},
+		"photos/IMG_0003.jpg":  &fstest.MapFile{Data: []byte("jpeg")},
+		"photos/IMG_0003.dop":  &fstest.MapFile{Data: []byte("dxo")},
+		"photos/orphan.aae":    &fstest.MapFile{Data: []byte("edits")},
+		"photos/notes.txt":     &fstest.MapFile{Data: []byte("notes")},
+	}
+	ctx := context.Background()
+	j := logger.NewJournal(logger.NoLogger{})
+	b, err := files.NewLocalFiles(ctx, j, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSkipExif(true).SetSidecarTypes(append(slices.Clone(files.DefaultSidecarTypes), ".dop"))
+
+	expected := map[string][]string{
+		"photos/IMG_0001.HEIC": {"photos/IMG_0001.AAE"},
+		"photos/IMG_0001.JPG":  {"photos/IMG_0001.AAE"},
+		"photos/GOPR0002.MP4":  {"photos/GOPR0002.LRV", "photos/GOPR0002.THM"},
+		"photos/IMG_0003.jpg":  {"photos/IMG_0003.dop"},
+	}
+	results := map[string][]string{}
+	for a := range b.Browse(ctx) {
+		if a.Err != nil {
+			t.Fatal(a.Err)
+		}
+		results[a.FileName] = a.SidecarFiles
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+	if j.Count(logger.METADATA) != 5 || j.Count(logger.UNSUPPORTED) != 1 {
+		t.Errorf("expected 5 sidecar files and 1 unsupported file, got %d and %d", j.Count(logger.METADATA), j.Count(logger.UNSUPPORTED))
+	}
+}
+
+func TestLocalAssetsMotionPhotos(t *testing.T) {
+	for _, skipExif := range []bool{false, true} {
+		ctx := context.Background()
+		b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), os.DirFS("TEST_DATA/motion"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.SetSkipExif(skipExif)
+		motion := []string{}
+		for a := range b.Browse(ctx) {
+			if a.Err != nil {
+				t.Fatal(a.Err)
+			}
+			if a.MotionPhoto {
+				motion = append(motion, a.FileName)
+			}
+		}
+		sort.Strings(motion)
+		expected := []string{"20231006_083121.jpg", "PXL_20231006_063000139.MP.jpg"}
+		if skipExif {
+			// the files aren't read
+			expected = []string{}
+		}
+		if !reflect.DeepEqual(motion, expected) {
+			t.Errorf("skip exif %v: expected the motion photos %v, got %v", skipExif, expected, motion)
+		}
+	}
+}
+
+func TestLocalAssetsExifTool(t *testing.T) {
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe, runs := fake.Path(t)
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"photos/IMG_0001.jpg":     `{"DateTimeOriginal":"2023:10:06 08:31:21","GPSLatitude":48.8584,"GPSLongitude":2.2945,"ImageWidth":4000,"ImageHeight":3000}`,
+		"photos/20230801-002.jpg": `{"DateTimeOriginal":"2023:10:06 08:31:22"}`,
+		"photos/IMG_0003.jpg":     "unknown to exiftool",
+		"photos/IMG_0003.aae":     "sidecar",
+		"videos/MVI_0004.mp4":     `{"CreateDate":"2023:10:07 10:00:00","ImageWidth":1920,"ImageHeight":1080}`,
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsyss, err := fshelper.ParsePath([]string{dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool, err := exiftool.New(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		date          time.Time
+		lat           float64
+		width, height int
+	}
+	expected := map[string]result{
+		"photos/IMG_0001.jpg": {date: time.Date(2023, 10, 6, 8, 31, 21, 0, local), lat: 48.8584, width: 4000, height: 3000},
+		// the date of the name is kept
+		"photos/20230801-002.jpg": {date: time.Date(2023, 8, 1, 0, 0, 0, 0, local)},
+		// the Go readers are used for the files unknown to exiftool
+		"photos/IMG_0003.jpg": {},
+		"videos/MVI_0004.mp4": {date: time.Date(2023, 10, 7, 10, 0, 0, 0, local), width: 1920, height: 1080},
+	}
+	ctx := context.Background()
+	b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), fsyss...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetExifTool(tool)
+	count := 0
+	for a := range b.Browse(ctx) {
+		if a.Err != nil {
+			t.Fatal(a.Err)
+		}
+		count++
+		r, ok := expected[a.FileName]
+		if !ok {
+			t.Errorf("unexpected file %s", a.FileName)
+			continue
+		}
+		if !r.date.IsZero() && !a.DateTaken.Equal(r.date) {
+			t.Errorf("%s: expected the date %s, got %s", a.FileName, r.date, a.DateTaken)
+		}
+		if a.Latitude != r.lat || a.Width != r.width || a.Height != r.height {
+			t.Errorf("%s: expected %+v, got the latitude %f and %dx%d", a.FileName, r, a.Latitude, a.Width, a.Height)
+		}
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d files, got %d", len(expected), count)
+	}
+	// one run for each folder of assets
+	if n := fake.Runs(t, runs); n != 2 {
+		t.Errorf("expected 2 runs of exiftool, got %d", n)
+	}
+}
+
+func TestLocalAssetsVerifyMime(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0 jpeg")
+	png := []byte("\x89PNG\r\n\x1a\n png")
+	fsys := fstest.MapFS{
+		"photos/IMG_0001.jpg": &fstest.MapFile{Data: jpeg},
+		"photos/IMG_0002.jpg": &fstest.MapFile{Data: png},
+		"photos/IMG_0003":     &fstest.MapFile{Data: jpeg},
+		"photos/IMG_0004.bin": &fstest.MapFile{Data: png},
+		"photos/README":       &fstest.MapFile{Data: []byte("notes")},
+	}
+	for _, c := range []struct {
+		verify, fix bool
+		expected    map[string]string // titles by file
+		mismatches  int
+	}{
+		{
+			expected: map[string]string{"photos/IMG_0001.jpg": "IMG_0001.jpg", "photos/IMG_0002.jpg": "IMG_0002.jpg", "photos/IMG_0003": "IMG_0003.jpg"},
+		},
+		{
+			verify:     true,
+			expected:   map[string]string{"photos/IMG_0001.jpg": "IMG_0001.jpg", "photos/IMG_0002.jpg": "IMG_0002.jpg", "photos/IMG_0003": "IMG_0003.jpg", "photos/IMG_0004.bin": "IMG_0004.png"},
+			mismatches: 1,
+		},
+		{
+			verify: true, fix: true,
+			expected:   map[string]string{"photos/IMG_0001.jpg": "IMG_0001.jpg", "photos/IMG_0002.jpg": "IMG_0002.png", "photos/IMG_0003": "IMG_0003.jpg", "photos/IMG_0004.bin": "IMG_0004.png"},
+			mismatches: 1,
+		},
+	} {
+		ctx := context.Background()
+		j := logger.NewJournal(logger.NoLogger{})
+		b, err := files.NewLocalFiles(ctx, j, fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.SetSkipExif(true).SetVerifyMime(c.verify, c.fix)
+		titles := map[string]string{}
+		for a := range b.Browse(ctx) {
+			if a.Err != nil {
+				t.Fatal(a.Err)
+			}
+			titles[a.FileName] = a.Title
+			if _, err := fshelper.MimeFromExt(a.Ext()); err != nil {
+				t.Errorf("%s: %s", a.FileName, err)
+			}
+		}
+		if !reflect.DeepEqual(titles, c.expected) {
+			t.Errorf("verify %v, fix %v: expected %v, got %v", c.verify, c.fix, c.expected, titles)
+		}
+		if n := j.Count(logger.MIME_MISMATCH); n != c.mismatches {
+			t.Errorf("verify %v, fix %v: expected %d mismatches, got %d", c.verify, c.fix, c.mismatches, n)
+		}
+	}
+}
+
+func TestLocalAssetsBrowseFiles(t *testing.T) {
+	ctx := context.Background()
+	b, err := files.NewLocalFiles(ctx, logger.NewJournal(logger.NoLogger{}), os.DirFS("TEST_DATA/sidecars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetSkipExif(true)
+	fsys := os.DirFS("TEST_DATA/sidecars")
+	results := map[string]string{}
+	for a := range b.BrowseFiles(ctx, fsys, []string{"20230801-001.jpg", "IMG_0003.jpg"}) {
+		if a.Err != nil {
+			t.Fatal(a.Err)
+		}
+		results[a.FileName] = ""
+		if a.SideCar != nil {
+			results[a.FileName] = a.SideCar.FileName
+		}
+	}
+	// the sidecar of a browsed file is found even when it isn't given
+	expected := map[string]string{"20230801-001.jpg": "20230801-001.jpg.xmp", "IMG_0003.jpg": ""}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+}
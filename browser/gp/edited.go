@@ -0,0 +1,135 @@
+package gp
+
+import (
+	"path"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
+
+// EditedPolicy tells which version of a photo is imported when the takeout contains
+// the original and the edited version, like IMG_1234.jpg and IMG_1234-edited.jpg
+type EditedPolicy int
+
+const (
+	KeepBothVersions EditedPolicy = iota // import the original and the edited version
+	PreferEdited                         // import only the edited version
+	PreferOriginal                       // import only the original
+)
+
+// DefaultEditedSuffixes are the suffixes added by Google Photos to the edited photos, depending on the user's language
+var DefaultEditedSuffixes = []string{"-edited", "-bearbeitet", "-modifié", "-editado", "-modificato", "-bewerkt", "-redigerad", "-muokattu"}
+
+// SetEditedPolicy sets which version of edited photos is imported.
+// The suffixes identify the edited files. DefaultEditedSuffixes is used when none is given.
+func (to *Takeout) SetEditedPolicy(p EditedPolicy, suffixes []string) *Takeout {
+	to.editedPolicy = p
+	to.editedSuffixes = nil
+	for _, s := range suffixes {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			to.editedSuffixes = append(to.editedSuffixes, s)
+		}
+	}
+	if len(to.editedSuffixes) == 0 {
+		to.editedSuffixes = DefaultEditedSuffixes
+	}
+	return to
+}
+
+// editedOriginal returns the lower case name of the original of an edited file
+func (to *Takeout) editedOriginal(base string) (string, bool) {
+	ext := path.Ext(base)
+	name := strings.ToLower(strings.TrimSuffix(base, ext))
+	for _, s := range to.editedSuffixes {
+		if strings.HasSuffix(name, s) && len(name) > len(s) {
+			return strings.TrimSuffix(name, s) + strings.ToLower(ext), true
+		}
+	}
+	return "", false
+}
+
+// editedKey identifies a file by its lower case name and its year of capture
+type editedKey struct {
+	name string
+	year int
+}
+
+// pairEdited finds the originals and the edited versions present in the same folder,
+// and selects the files to be discarded according to the policy. A discarded file
+// is discarded in all folders, even where the selected version isn't present.
+//
+// The metadata of the discarded files are kept with the selected one to give their albums.
+func (to *Takeout) pairEdited() {
+	to.editedDiscarded = map[editedKey]string{}
+	to.editedPartners = map[editedKey][]*GoogleMetaData{}
+	if to.editedPolicy == KeepBothVersions {
+		return
+	}
+
+	// files having metadata by folder, for all walkers
+	folders := map[string]map[editedKey]*GoogleMetaData{}
+	for _, wc := range to.catalogs {
+		for dir, dc := range wc {
+			for base, fi := range dc.files {
+				if fi.md == nil {
+					continue
+				}
+				l := folders[dir]
+				if l == nil {
+					l = map[editedKey]*GoogleMetaData{}
+					folders[dir] = l
+				}
+				l[editedKey{name: strings.ToLower(base), year: fi.md.PhotoTakenTime.Time().Year()}] = fi.md
+			}
+		}
+	}
+
+	for _, l := range folders {
+		for edited := range l {
+			origName, ok := to.editedOriginal(edited.name)
+			if !ok {
+				continue
+			}
+			original := editedKey{name: origName, year: edited.year}
+			if _, ok := l[original]; !ok {
+				continue
+			}
+			keep, discard := edited, original
+			if to.editedPolicy == PreferOriginal {
+				keep, discard = original, edited
+			}
+			to.editedDiscarded[discard] = keep.name
+		}
+	}
+
+	// collect the metadata of the discarded files found in all folders
+	for _, l := range folders {
+		for k, md := range l {
+			if kept, ok := to.editedDiscarded[k]; ok {
+				keep := editedKey{name: kept, year: k.year}
+				to.editedPartners[keep] = append(to.editedPartners[keep], md)
+			}
+		}
+	}
+}
+
+// isEditedDiscarded reports whether the file is discarded because of the edited policy
+func (to *Takeout) isEditedDiscarded(name string, md *GoogleMetaData) bool {
+	kept, discarded := to.editedDiscarded[editedKey{name: strings.ToLower(path.Base(name)), year: md.PhotoTakenTime.Time().Year()}]
+	if discarded {
+		reason := "original discarded, the edited version is imported: "
+		if to.editedPolicy == PreferOriginal {
+			reason = "edited version discarded, the original is imported: "
+		}
+		to.jnl.AddEntry(name, logger.NOT_SELECTED, reason+kept)
+	}
+	return discarded
+}
+
+// editedAlbums adds to the asset the albums of the discarded versions
+func (to *Takeout) editedAlbums(a *browser.LocalAssetFile, md *GoogleMetaData) {
+	for _, pmd := range to.editedPartners[editedKey{name: strings.ToLower(path.Base(a.FileName)), year: md.PhotoTakenTime.Time().Year()}] {
+		to.addAlbums(a, pmd)
+	}
+}
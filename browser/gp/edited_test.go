@@ -0,0 +1,108 @@
+package gp
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/simulot/immich-go/logger"
+)
+
+func editedTakeout() *inMemFS {
+	return newInMemFS().
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_1234.jpg.json", "IMG_1234.jpg").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_1234.jpg", 10).
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_1234-edited.jpg", 11).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_5678.JPG.json", "IMG_5678.JPG").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_5678.JPG", 20).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_5678-bearbeitet.JPG.json", "IMG_5678-bearbeitet.JPG").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_5678-bearbeitet.JPG", 21).
+		addJSONAlbum("Takeout/Google Photos/Holiday/metadata.json", "Holiday").
+		addJSONImage("Takeout/Google Photos/Holiday/IMG_5678.JPG.json", "IMG_5678.JPG").
+		addImage("Takeout/Google Photos/Holiday/IMG_5678.JPG", 20).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_9999.jpg.json", "IMG_9999.jpg").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_9999.jpg", 30)
+}
+
+func TestEditedPolicy(t *testing.T) {
+	type result struct {
+		name   string
+		albums []string
+	}
+	tc := []struct {
+		name     string
+		policy   EditedPolicy
+		suffixes []string
+		results  []result
+	}{
+		{
+			name:   "keep both",
+			policy: KeepBothVersions,
+			results: []result{
+				{name: "IMG_1234-edited.jpg"},
+				{name: "IMG_1234.jpg"},
+				{name: "IMG_5678-bearbeitet.JPG"},
+				{name: "IMG_5678.JPG", albums: []string{"Holiday"}},
+				{name: "IMG_9999.jpg"},
+			},
+		},
+		{
+			name:   "prefer edited",
+			policy: PreferEdited,
+			results: []result{
+				{name: "IMG_1234-edited.jpg"},
+				{name: "IMG_5678-bearbeitet.JPG", albums: []string{"Holiday"}},
+				{name: "IMG_9999.jpg"},
+			},
+		},
+		{
+			name:   "prefer original",
+			policy: PreferOriginal,
+			results: []result{
+				{name: "IMG_1234.jpg"},
+				{name: "IMG_5678.JPG", albums: []string{"Holiday"}},
+				{name: "IMG_9999.jpg"},
+			},
+		},
+		{
+			name:     "prefer edited, custom suffixes",
+			policy:   PreferEdited,
+			suffixes: []string{"-Edited"},
+			results: []result{
+				{name: "IMG_1234-edited.jpg"},
+				{name: "IMG_5678-bearbeitet.JPG"},
+				{name: "IMG_5678.JPG", albums: []string{"Holiday"}},
+				{name: "IMG_9999.jpg"},
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			fsys := editedTakeout()
+			if fsys.err != nil {
+				t.Fatal(fsys.err)
+			}
+			ctx := context.Background()
+			to, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to.SetEditedPolicy(c.policy, c.suffixes)
+
+			results := []result{}
+			for a := range to.Browse(ctx) {
+				r := result{name: path.Base(a.FileName)}
+				for _, al := range a.Albums {
+					r.albums = append(r.albums, al.Name)
+				}
+				results = append(results, r)
+			}
+			sort.Slice(results, func(i, j int) bool { return results[i].name < results[j].name })
+			if !reflect.DeepEqual(results, c.results) {
+				t.Errorf("expected %v, got %v", c.results, results)
+			}
+		})
+	}
+}
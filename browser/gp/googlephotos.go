@@ -8,12 +8,14 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/simulot/immich-go/browser"
 
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/geocoding"
 	"github.com/simulot/immich-go/logger"
 )
 
@@ -23,7 +25,28 @@ type Takeout struct {
 	jsonByYear map[jsonKey]*GoogleMetaData // assets by year of capture and base name
 	uploaded   map[fileKey]any             // track files already uploaded
 	albums     map[string]string           // tack album names by folder
+	albumDescs map[string]string           // album descriptions by folder
+	shared     map[string]bool             // folders of the shared albums
 	jnl        *logger.Journal
+
+	editedPolicy    EditedPolicy                    // which version of edited photos is imported
+	editedSuffixes  []string                        // suffixes of edited files, in lower case
+	editedDiscarded map[editedKey]string            // files discarded because of the edited policy, with the imported one
+	editedPartners  map[editedKey][]*GoogleMetaData // metadata of the discarded versions, by imported file
+
+	dateRange browser.DateRange // only assets captured in this range are browsed
+
+	jsonOnly bool // the assets must have a date of capture in their JSON, the dates and positions come from the JSON only
+	orphans  int  // files refused because of a missing JSON, or of a JSON without date of capture with jsonOnly
+
+	albumFilter func(browser.LocalAlbum) bool // albums kept, nil to keep all assets and albums
+	keepNoAlbum bool                          // the assets without album are kept by the albumFilter
+
+	motionPhotos int // photos embedding their video
+
+	timeZone *time.Location            // zone of the dates of capture, nil for the local zone
+	geocoder *geocoding.Geocoder       // gives the zone of the GPS position, when set
+	zones    map[string]*time.Location // zones loaded by name
 }
 
 // walkerCatalog collects all directory catalogs
@@ -65,17 +88,74 @@ func NewTakeout(ctx context.Context, jnl *logger.Journal, fsyss ...fs.FS) (*Take
 		fsyss:      fsyss,
 		jsonByYear: map[jsonKey]*GoogleMetaData{},
 		albums:     map[string]string{},
+		albumDescs: map[string]string{},
+		shared:     map[string]bool{},
 		jnl:        jnl,
 	}
 	err := to.passOne(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if len(to.albums) > 0 {
+		shared := 0
+		for dir := range to.albums {
+			if to.shared[dir] {
+				shared++
+			}
+		}
+		to.jnl.Info("%d albums found: %d owned, %d shared", len(to.albums), len(to.albums)-shared, shared)
+	}
 
 	to.solvePuzzle(ctx)
 	return &to, err
 }
 
+// SetDateRange limits the browsing to the assets captured in the range.
+// The date of capture is given by the JSON files, assets out of the range are discarded before opening them.
+func (to *Takeout) SetDateRange(r browser.DateRange) *Takeout {
+	to.dateRange = r
+	return to
+}
+
+// SetJSONOnly makes the takeout strict: the assets whose JSON file is missing or has no date of capture
+// are refused, and the dates and the GPS positions come from the JSON files only.
+func (to *Takeout) SetJSONOnly(flag bool) *Takeout {
+	to.jsonOnly = flag
+	return to
+}
+
+// SetAlbumFilter keeps only the albums selected by the function, and the assets belonging to one of them.
+// The assets without album at all are kept when keepNoAlbum is set.
+func (to *Takeout) SetAlbumFilter(keep func(browser.LocalAlbum) bool, keepNoAlbum bool) *Takeout {
+	to.albumFilter = keep
+	to.keepNoAlbum = keepNoAlbum
+	return to
+}
+
+// selectAlbums removes the albums discarded by the album filter from the asset,
+// and tells if the asset is kept
+func (to *Takeout) selectAlbums(a *browser.LocalAssetFile) bool {
+	if to.albumFilter == nil {
+		return true
+	}
+	if len(a.Albums) == 0 {
+		return to.keepNoAlbum
+	}
+	a.Albums = slices.DeleteFunc(a.Albums, func(al browser.LocalAlbum) bool { return !to.albumFilter(al) })
+	return len(a.Albums) > 0
+}
+
+// JSONOnly tells if the dates and the GPS positions come from the JSON files only
+func (to *Takeout) JSONOnly() bool {
+	return to.jsonOnly
+}
+
+// Orphans gives the number of files refused because their JSON file is missing,
+// or because their JSON has no date of capture in strict mode
+func (to *Takeout) Orphans() int {
+	return to.orphans
+}
+
 // passOne scans all files in all walker to build the file catalog of the archive
 // metadata files content is read and kept
 
@@ -113,6 +193,10 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 			dir = strings.TrimSuffix(dir, "/")
 			ext := strings.ToLower(path.Ext(base))
 
+			if base == sharedAlbumComments {
+				// only the shared albums have comments
+				to.shared[dir] = true
+			}
 			if slices.Contains(uselessFiles, base) {
 				to.jnl.AddEntry(name, logger.DISCARDED, "Useless file")
 				return nil
@@ -136,6 +220,10 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 						to.jnl.AddEntry(name, logger.METADATA, "Asset Title: "+md.Title)
 					case md.isAlbum():
 						to.albums[dir] = md.Title
+						to.albumDescs[dir] = md.Description
+						if md.isShared() {
+							to.shared[dir] = true
+						}
 						to.jnl.AddEntry(name, logger.METADATA, "Album title: "+md.Title)
 					default:
 						to.jnl.AddEntry(name, logger.DISCARDED, "Unknown json file")
@@ -405,6 +493,7 @@ func matchForgottenDuplicates(jsonName string, fileName string) bool {
 
 func (to *Takeout) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 	to.uploaded = map[fileKey]any{}
+	to.pairEdited()
 	assetChan := make(chan *browser.LocalAssetFile)
 
 	go func() {
@@ -415,6 +504,9 @@ func (to *Takeout) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 				assetChan <- &browser.LocalAssetFile{Err: err}
 			}
 		}
+		if to.motionPhotos > 0 {
+			to.jnl.Info("%d motion photos detected", to.motionPhotos)
+		}
 	}()
 	return assetChan
 }
@@ -447,9 +539,22 @@ func (to *Takeout) passTwoWalk(ctx context.Context, w fs.FS, assetChan chan *bro
 		}
 
 		if f.md == nil {
+			to.orphans++
 			to.jnl.AddEntry(name, logger.ERROR, "JSON File not found for this file")
 			return nil
 		}
+		if to.jsonOnly && !f.md.PhotoTakenTime.isSet() {
+			to.orphans++
+			to.jnl.AddEntry(name, logger.ERROR, "the JSON file has no date of capture")
+			return nil
+		}
+		if to.isEditedDiscarded(name, f.md) {
+			return nil
+		}
+		if !to.dateRange.InRange(f.md.PhotoTakenTime.Time()) {
+			to.jnl.AddEntry(name, logger.NOT_SELECTED, "asset excluded because the date of capture out of the date range")
+			return nil
+		}
 		finfo, err := d.Info()
 		if err != nil {
 			to.jnl.Error("can't browse: %s", err)
@@ -466,6 +571,16 @@ func (to *Takeout) passTwoWalk(ctx context.Context, w fs.FS, assetChan chan *bro
 			return nil
 		}
 		a := to.googleMDToAsset(f.md, key, w, name)
+		to.editedAlbums(a, f.md)
+		if !to.selectAlbums(a) {
+			to.jnl.AddEntry(name, logger.NOT_SELECTED, "asset excluded because it isn't in a selected album")
+			return nil
+		}
+		if err := a.ReadMotionPhoto(); err != nil {
+			to.jnl.Debug("can't check if %s is a motion photo: %s", name, err)
+		} else if a.MotionPhoto {
+			to.motionPhotos++
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -502,22 +617,37 @@ func (to *Takeout) googleMDToAsset(md *GoogleMetaData, key fileKey, fsys fs.FS,
 		Archived:    md.Archived,
 		FromPartner: md.isPartner(),
 		Trashed:     md.Trashed,
-		DateTaken:   md.PhotoTakenTime.Time(),
+		DateTaken:   to.takenTime(md),
 		Favorite:    md.Favorited,
 		FSys:        fsys,
 	}
 
+	for _, p := range md.People {
+		if p.Name != "" {
+			a.People = append(a.People, p.Name)
+		}
+	}
+	to.addAlbums(&a, md)
+	return &a
+}
+
+// addAlbums adds the albums where the metadata has been found
+func (to *Takeout) addAlbums(a *browser.LocalAssetFile, md *GoogleMetaData) {
 	for _, p := range md.foundInPaths {
 		if album, exists := to.albums[p]; exists {
-			a.Albums = append(a.Albums, browser.LocalAlbum{Path: p, Name: album})
+			if !slices.ContainsFunc(a.Albums, func(al browser.LocalAlbum) bool { return al.Path == p }) {
+				a.Albums = append(a.Albums, browser.LocalAlbum{Path: p, Name: album, Description: to.albumDescs[p], Shared: to.shared[p]})
+			}
 		}
 	}
-	return &a
 }
 
+// sharedAlbumComments is the file of the comments of a shared album
+const sharedAlbumComments = "shared_album_comments.json"
+
 var uselessFiles = []string{
 	"archive_browser.html",
 	"print-subscriptions.json",
-	"shared_album_comments.json",
+	sharedAlbumComments,
 	"user-generated-memory-titles.json",
 }
@@ -1,6 +1,17 @@
 package gp
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
 
 func Test_matchEditedName(t *testing.T) {
 	tests := []struct {
@@ -121,3 +132,124 @@ func Test_matchForgottenDuplicates(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONOnly(t *testing.T) {
+	noDate := func(md *GoogleMetaData) { md.PhotoTakenTime.Timestamp = "" }
+	fsys := newInMemFS().
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_1234.jpg.json", "IMG_1234.jpg").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_1234.jpg", 10).
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_2222.jpg", 20).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_3333.jpg.json", "IMG_3333.jpg", noDate).
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_3333.jpg", 30)
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+
+	for _, c := range []struct {
+		jsonOnly bool
+		expected []string
+		orphans  int
+	}{
+		{jsonOnly: false, expected: []string{"IMG_1234.jpg", "IMG_3333.jpg"}, orphans: 1},
+		{jsonOnly: true, expected: []string{"IMG_1234.jpg"}, orphans: 2},
+	} {
+		ctx := context.Background()
+		to, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to.SetJSONOnly(c.jsonOnly)
+		names := []string{}
+		for a := range to.Browse(ctx) {
+			names = append(names, path.Base(a.FileName))
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, c.expected) || to.Orphans() != c.orphans {
+			t.Errorf("JSON only %v: expected %v and %d orphans, got %v and %d orphans", c.jsonOnly, c.expected, c.orphans, names, to.Orphans())
+		}
+	}
+}
+
+func TestSharedAlbums(t *testing.T) {
+	fsys := newInMemFS().
+		addJSONAlbum("Takeout/Google Photos/Family/metadata.json", "Family").
+		addJSONImage("Takeout/Google Photos/Family/IMG_0001.jpg.json", "IMG_0001.jpg").
+		addImage("Takeout/Google Photos/Family/IMG_0001.jpg", 10).
+		addFile("Takeout/Google Photos/Family by link/metadata.json", []byte(`{"title": "Family", "access": "protected", "date": {"timestamp": "0"}}`)).
+		addJSONImage("Takeout/Google Photos/Family by link/IMG_0002.jpg.json", "IMG_0002.jpg").
+		addImage("Takeout/Google Photos/Family by link/IMG_0002.jpg", 20).
+		addJSONAlbum("Takeout/Google Photos/Party/metadata.json", "Party").
+		addFile("Takeout/Google Photos/Party/shared_album_comments.json", []byte(`[]`)).
+		addJSONImage("Takeout/Google Photos/Party/IMG_0003.jpg.json", "IMG_0003.jpg").
+		addImage("Takeout/Google Photos/Party/IMG_0003.jpg", 30)
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+
+	ctx := context.Background()
+	to, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []string{}
+	for a := range to.Browse(ctx) {
+		for _, al := range a.Albums {
+			results = append(results, fmt.Sprintf("%s: %s shared:%v", path.Base(a.FileName), al.Name, al.Shared))
+		}
+	}
+	sort.Strings(results)
+	expected := []string{"IMG_0001.jpg: Family shared:false", "IMG_0002.jpg: Family shared:true", "IMG_0003.jpg: Party shared:true"}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %q, got %q", expected, results)
+	}
+}
+
+func TestAlbumFilter(t *testing.T) {
+	fsys := newInMemFS().
+		addJSONAlbum("Takeout/Google Photos/Trip Rome/metadata.json", "Trip Rome").
+		addJSONImage("Takeout/Google Photos/Trip Rome/IMG_0001.jpg.json", "IMG_0001.jpg").
+		addImage("Takeout/Google Photos/Trip Rome/IMG_0001.jpg", 10).
+		addJSONAlbum("Takeout/Google Photos/Family/metadata.json", "Family").
+		addJSONImage("Takeout/Google Photos/Family/IMG_0001.jpg.json", "IMG_0001.jpg").
+		addImage("Takeout/Google Photos/Family/IMG_0001.jpg", 10).
+		addJSONImage("Takeout/Google Photos/Family/IMG_0002.jpg.json", "IMG_0002.jpg").
+		addImage("Takeout/Google Photos/Family/IMG_0002.jpg", 20).
+		addJSONImage("Takeout/Google Photos/Photos from 2023/IMG_0003.jpg.json", "IMG_0003.jpg").
+		addImage("Takeout/Google Photos/Photos from 2023/IMG_0003.jpg", 30)
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	trip := func(al browser.LocalAlbum) bool { return strings.HasPrefix(al.Name, "Trip") }
+	notTrip := func(al browser.LocalAlbum) bool { return !trip(al) }
+
+	for _, c := range []struct {
+		name        string
+		keep        func(browser.LocalAlbum) bool
+		keepNoAlbum bool
+		expected    []string
+	}{
+		{name: "select", keep: trip, expected: []string{"IMG_0001.jpg: Trip Rome"}},
+		{name: "exclude", keep: notTrip, keepNoAlbum: true, expected: []string{"IMG_0001.jpg: Family", "IMG_0002.jpg: Family", "IMG_0003.jpg: "}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			to, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			to.SetAlbumFilter(c.keep, c.keepNoAlbum)
+			results := []string{}
+			for a := range to.Browse(ctx) {
+				names := []string{}
+				for _, al := range a.Albums {
+					names = append(names, al.Name)
+				}
+				results = append(results, path.Base(a.FileName)+": "+strings.Join(names, ", "))
+			}
+			sort.Strings(results)
+			if !reflect.DeepEqual(results, c.expected) {
+				t.Errorf("expected %q, got %q", c.expected, results)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ type GoogleMetaData struct {
 	Title              string         `json:"title"`
 	Description        string         `json:"description"`
 	Category           string         `json:"category"`
+	Access             string         `json:"access"`         // set on the albums shared by link or with other users
 	DatePresent        googIsPresent  `json:"date,omitempty"` // true when the file is a folder metadata
 	PhotoTakenTime     googTimeObject `json:"photoTakenTime"`
 	GeoDataExif        googGeoData    `json:"geoDataExif"`
@@ -20,6 +21,7 @@ type GoogleMetaData struct {
 	Archived           bool           `json:"archived,omitempty"`
 	URLPresent         googIsPresent  `json:"url,omitempty"`       // true when the file is an asset metadata
 	Favorited          bool           `json:"favorited,omitempty"` // true when starred in GP
+	People             []googPerson   `json:"people,omitempty"`    // persons recognized in the image
 	GooglePhotosOrigin struct {
 		FromPartnerSharing googIsPresent `json:"fromPartnerSharing,omitempty"` // true when this is a partner's asset
 	} `json:"googlePhotosOrigin"`
@@ -34,6 +36,11 @@ func (gmd GoogleMetaData) isAsset() bool {
 	return bool(gmd.URLPresent)
 }
 
+// isShared tells if the album is shared with other users, or by them
+func (gmd GoogleMetaData) isShared() bool {
+	return gmd.Access != ""
+}
+
 func (gmd GoogleMetaData) isPartner() bool {
 	return bool(gmd.GooglePhotosOrigin.FromPartnerSharing)
 }
@@ -65,6 +72,11 @@ func (p googIsPresent) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct{}{})
 }
 
+// googPerson is a person recognized by Google Photos
+type googPerson struct {
+	Name string `json:"name"`
+}
+
 // googGeoData contains GPS coordinates
 type googGeoData struct {
 	Latitude  float64 `json:"latitude"`
@@ -78,6 +90,12 @@ type googTimeObject struct {
 	// Formatted string    `json:"formatted"`
 }
 
+// isSet tells if the JSON gives a timestamp
+func (gt googTimeObject) isSet() bool {
+	ts, err := strconv.ParseInt(gt.Timestamp, 10, 64)
+	return err == nil && ts != 0
+}
+
 // Time return the time.Time of the epoch
 func (gt googTimeObject) Time() time.Time {
 	ts, _ := strconv.ParseInt(gt.Timestamp, 10, 64)
@@ -134,3 +134,105 @@ func TestPresentFields(t *testing.T) {
 	}
 
 }
+
+func TestArchivedTrashed(t *testing.T) {
+	tcs := []struct {
+		name     string
+		json     string
+		archived bool
+		trashed  bool
+	}{
+		{
+			name: "archived",
+			json: `{
+				"title": "PXL_20231006_063029647.jpg",
+				"description": "",
+				"imageViews": "3",
+				"creationTime": {
+				  "timestamp": "1697872351",
+				  "formatted": "21 oct. 2023, 07:12:31 UTC"
+				},
+				"photoTakenTime": {
+				  "timestamp": "1696573829",
+				  "formatted": "6 oct. 2023, 06:30:29 UTC"
+				},
+				"archived": true,
+				"url": "https://photos.google.com/photo/AAMKMAKZMAZMKAZMKZMAK",
+				"googlePhotosOrigin": {
+				  "mobileUpload": {
+					"deviceFolder": {
+					  "localFolderName": ""
+					},
+					"deviceType": "ANDROID_PHONE"
+				  }
+				}
+			  }`,
+			archived: true,
+		},
+		{
+			name: "trashed",
+			json: `{
+				"title": "PXL_20231006_063108407.jpg",
+				"description": "",
+				"imageViews": "0",
+				"photoTakenTime": {
+				  "timestamp": "1696573868",
+				  "formatted": "6 oct. 2023, 06:31:08 UTC"
+				},
+				"trashed": true,
+				"url": "https://photos.google.com/photo/AAMKMAKZMAZMKAZMKZMAK"
+			  }`,
+			trashed: true,
+		},
+		{
+			name: "regular",
+			json: `{
+				"title": "PXL_20231006_063000139.jpg",
+				"photoTakenTime": {
+				  "timestamp": "1696573800",
+				  "formatted": "6 oct. 2023, 06:30:00 UTC"
+				},
+				"url": "https://photos.google.com/photo/AAMKMAKZMAZMKAZMKZMAK"
+			  }`,
+		},
+	}
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			var md GoogleMetaData
+			err := json.NewDecoder(strings.NewReader(c.json)).Decode(&md)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if md.Archived != c.archived {
+				t.Errorf("expected archived to be %t, got %t", c.archived, md.Archived)
+			}
+			if md.Trashed != c.trashed {
+				t.Errorf("expected trashed to be %t, got %t", c.trashed, md.Trashed)
+			}
+		})
+	}
+}
+
+func TestPeople(t *testing.T) {
+	js := `{
+		"title": "IMG_1234.jpg",
+		"photoTakenTime": {
+		  "timestamp": "1696573800",
+		  "formatted": "6 oct. 2023, 06:30:00 UTC"
+		},
+		"people": [{
+		  "name": "Alice"
+		}, {
+		  "name": "Bob"
+		}],
+		"url": "https://photos.google.com/photo/AAMKMAKZMAZMKAZMKZMAK"
+	  }`
+	var md GoogleMetaData
+	err := json.NewDecoder(strings.NewReader(js)).Decode(&md)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(md.People) != 2 || md.People[0].Name != "Alice" || md.People[1].Name != "Bob" {
+		t.Errorf("unexpected people: %v", md.People)
+	}
+}
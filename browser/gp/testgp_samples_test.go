@@ -79,9 +79,13 @@ func (mfs *inMemFS) addJSONImage(name string, title string, modifiers ...jsonFn)
 }
 
 func (mfs *inMemFS) addJSONAlbum(file string, albumName string) *inMemFS {
+	return mfs.addJSONAlbumDescription(file, albumName, "")
+}
+
+func (mfs *inMemFS) addJSONAlbumDescription(file string, albumName string, description string) *inMemFS {
 	return mfs.addFile(file, []byte(`{
 		"title": "`+albumName+`",
-		"description": "",
+		"description": "`+description+`",
 		"access": "",
 		"date": {
 		  "timestamp": "0",
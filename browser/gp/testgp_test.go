@@ -5,7 +5,9 @@ import (
 	"path"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/logger"
 
 	"github.com/kr/pretty"
@@ -207,3 +209,49 @@ func TestAlbums(t *testing.T) {
 		})
 	}
 }
+
+func TestAlbumDescription(t *testing.T) {
+	fsys := newInMemFS().
+		addJSONAlbumDescription("Takeout/Google Photos/Holiday/metadata.json", "Holiday", "Summer in Brittany").
+		addJSONImage("Takeout/Google Photos/Holiday/IMG_0001.jpg.json", "IMG_0001.jpg").
+		addImage("Takeout/Google Photos/Holiday/IMG_0001.jpg", 10)
+	ctx := context.Background()
+	b, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums := []browser.LocalAlbum{}
+	for a := range b.Browse(ctx) {
+		albums = append(albums, a.Albums...)
+	}
+	expected := []browser.LocalAlbum{{Path: "Takeout/Google Photos/Holiday", Name: "Holiday", Description: "Summer in Brittany"}}
+	if !reflect.DeepEqual(albums, expected) {
+		t.Errorf("expected the albums %v, got %v", expected, albums)
+	}
+}
+
+func TestBrowseDateRange(t *testing.T) {
+	fsys := simpleAlbum()
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	ctx := context.Background()
+	b, err := NewTakeout(ctx, logger.NewJournal(logger.NoLogger{}), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetDateRange(browser.DateRange{
+		After:  time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local),
+		Before: time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local),
+	})
+
+	results := []fileResult{}
+	for a := range b.Browse(ctx) {
+		results = append(results, fileResult{name: path.Base(a.FileName), size: a.FileSize, title: a.Title})
+	}
+	expected := []fileResult{{name: "IMG_8172.jpg", size: 25, title: "IMG_8172.jpg"}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("difference\n")
+		pretty.Ldiff(t, expected, results)
+	}
+}
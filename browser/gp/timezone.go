@@ -0,0 +1,54 @@
+package gp
+
+import (
+	"time"
+
+	"github.com/simulot/immich-go/helpers/geocoding"
+)
+
+// SetTimeZone sets the time zone of the dates of capture.
+// The JSON files give the date of capture as an epoch, the zone gives the wall clock of the capture,
+// as written in the EXIF of the photos.
+// When auto is set, the zone of an asset having a GPS position is the zone of the nearest city,
+// loc is used for the others. A nil loc keeps the local time zone.
+func (to *Takeout) SetTimeZone(loc *time.Location, auto bool) *Takeout {
+	to.timeZone = loc
+	to.geocoder = nil
+	if auto {
+		to.geocoder = geocoding.NewGeocoder()
+		to.zones = map[string]*time.Location{}
+	}
+	return to
+}
+
+// takenTime gives the date of capture of the asset in its time zone
+func (to *Takeout) takenTime(md *GoogleMetaData) time.Time {
+	t := md.PhotoTakenTime.Time()
+	if to.geocoder != nil && (md.GeoDataExif.Latitude != 0 || md.GeoDataExif.Longitude != 0) {
+		if loc := to.positionZone(md.GeoDataExif.Latitude, md.GeoDataExif.Longitude); loc != nil {
+			return t.In(loc)
+		}
+	}
+	if to.timeZone != nil {
+		return t.In(to.timeZone)
+	}
+	return t
+}
+
+// positionZone gives the time zone of the nearest city, nil when unknown
+func (to *Takeout) positionZone(latitude, longitude float64) *time.Location {
+	c, ok := to.geocoder.Locate(latitude, longitude)
+	if !ok || c.TimeZone == "" {
+		return nil
+	}
+	loc, ok := to.zones[c.TimeZone]
+	if !ok {
+		var err error
+		loc, err = time.LoadLocation(c.TimeZone)
+		if err != nil {
+			loc = nil
+		}
+		to.zones[c.TimeZone] = loc
+	}
+	return loc
+}
@@ -0,0 +1,48 @@
+package gp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTakenTime(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	paris, _ := time.LoadLocation("Europe/Paris")
+	losAngeles, _ := time.LoadLocation("America/Los_Angeles")
+
+	tc := []struct {
+		name     string
+		loc      *time.Location
+		auto     bool
+		utc      time.Time
+		lat, lon float64
+		expected string
+	}{
+		{name: "before DST start", loc: newYork, utc: time.Date(2023, 3, 12, 6, 59, 59, 0, time.UTC), expected: "2023-03-12T01:59:59-05:00"},
+		{name: "after DST start", loc: newYork, utc: time.Date(2023, 3, 12, 7, 0, 0, 0, time.UTC), expected: "2023-03-12T03:00:00-04:00"},
+		{name: "before DST end", loc: paris, utc: time.Date(2023, 10, 29, 0, 59, 59, 0, time.UTC), expected: "2023-10-29T02:59:59+02:00"},
+		{name: "after DST end", loc: paris, utc: time.Date(2023, 10, 29, 1, 0, 0, 0, time.UTC), expected: "2023-10-29T02:00:00+01:00"},
+		{name: "negative offset, previous day", loc: losAngeles, utc: time.Date(2023, 7, 4, 3, 0, 0, 0, time.UTC), expected: "2023-07-03T20:00:00-07:00"},
+		{name: "auto, New York", loc: paris, auto: true, lat: 40.7484, lon: -73.9857, utc: time.Date(2023, 3, 12, 7, 0, 0, 0, time.UTC), expected: "2023-03-12T03:00:00-04:00"},
+		{name: "auto, Sydney", auto: true, lat: -33.8568, lon: 151.2153, utc: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), expected: "2023-01-01T11:00:00+11:00"},
+		{name: "auto without GPS", loc: losAngeles, auto: true, utc: time.Date(2023, 7, 4, 3, 0, 0, 0, time.UTC), expected: "2023-07-03T20:00:00-07:00"},
+		{name: "auto far from cities", loc: paris, auto: true, lat: 0, lon: -140, utc: time.Date(2023, 7, 4, 3, 0, 0, 0, time.UTC), expected: "2023-07-04T05:00:00+02:00"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			to := (&Takeout{}).SetTimeZone(c.loc, c.auto)
+			md := GoogleMetaData{}
+			md.PhotoTakenTime.Timestamp = strconv.FormatInt(c.utc.Unix(), 10)
+			md.GeoDataExif.Latitude = c.lat
+			md.GeoDataExif.Longitude = c.lon
+			got := to.takenTime(&md)
+			if s := got.Format(time.RFC3339); s != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, s)
+			}
+			if !got.Equal(c.utc) {
+				t.Errorf("the instant of capture has changed: %s", got.UTC())
+			}
+		})
+	}
+}
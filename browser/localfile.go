@@ -1,11 +1,14 @@
 package browser
 
 import (
+	"crypto/sha1"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -29,8 +32,10 @@ import (
 */
 
 type LocalAlbum struct {
-	Path string // As found in the files
-	Name string // As found in metadata
+	Path        string // As found in the files
+	Name        string // As found in metadata
+	Description string // As found in metadata
+	Shared      bool   // Shared with other users, or by them
 }
 
 type LocalAssetFile struct {
@@ -38,6 +43,7 @@ type LocalAssetFile struct {
 	FileName    string       // The asset's path in the fsys
 	Title       string       // Google Photos may a have title longer than the filename
 	Description string       // Google Photos description
+	People      []string     // Google Photos people in the image
 	Albums      []LocalAlbum // The asset's album, if any
 	Err         error        // keep errors encountered
 	SideCar     *metadata.SideCar
@@ -56,9 +62,19 @@ type LocalAssetFile struct {
 
 	// Live Photos
 	LivePhotoData string // Filename of MP4 file associated
+	MotionPhoto   bool   // The photo embeds its video, like the motion photos of Google and Samsung
 
-	FSys     fs.FS // Asset's file system
-	FileSize int   // File size in bytes
+	// Other files of the asset, like the .aae edits of Apple devices
+	SidecarFiles []string
+
+	FSys     fs.FS  // Asset's file system
+	FileSize int    // File size in bytes
+	Checksum string // base64 encoded SHA-1 of the file, computed on demand
+	StripGPS bool   // The GPS position is removed from the content of the JPEG files
+	Width    int    // Width in pixels, read on demand by ReadImageSize, 0 when unknown
+	Height   int    // Height in pixels, read on demand by ReadImageSize, 0 when unknown
+
+	ContentExt string // Extension of the format recognized in the content, used instead of the file's one when set
 
 	// buffer management
 	sourceFile fs.File   // the opened source file
@@ -81,6 +97,22 @@ func (l *LocalAssetFile) AddAlbum(album LocalAlbum) {
 	l.Albums = append(l.Albums, album)
 }
 
+// Ext gives the extension of the asset's format: the one recognized in the content when set,
+// the one of the file otherwise
+func (l *LocalAssetFile) Ext() string {
+	if l.ContentExt != "" {
+		return l.ContentExt
+	}
+	return path.Ext(l.FileName)
+}
+
+// SetContentExt uploads the asset with the extension of the format recognized in its content.
+// The title gets that extension in place of the file's one.
+func (l *LocalAssetFile) SetContentExt(ext string) {
+	l.ContentExt = ext
+	l.Title = strings.TrimSuffix(l.Title, path.Ext(l.FileName)) + ext
+}
+
 // Remove the temporary file
 func (l *LocalAssetFile) Remove() error {
 	if fsys, ok := l.FSys.(fshelper.Remover); ok {
@@ -89,10 +121,67 @@ func (l *LocalAssetFile) Remove() error {
 	return nil
 }
 
+// DeviceAssetID identifies the file by its name and its size.
+// It doesn't depend on the machine, so the same file gets the same ID whatever the machine running the import.
 func (l *LocalAssetFile) DeviceAssetID() string {
 	return fmt.Sprintf("%s-%d", strings.ToUpper(l.Title), l.FileSize)
 }
 
+// ComputeChecksum returns the SHA-1 of the file content, encoded in base64 like the immich server does.
+// The checksum is computed once and kept in the Checksum field.
+// With StripGPS, it's the checksum of the content without the GPS position, as uploaded.
+
+func (l *LocalAssetFile) ComputeChecksum() (string, error) {
+	if l.Checksum != "" {
+		return l.Checksum, nil
+	}
+	f, err := l.FSys.Open(l.FileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	r, err := l.stripGPS(f)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	l.Checksum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return l.Checksum, nil
+}
+
+// ReadImageSize reads the dimensions of the image from the header of the file into Width and Height.
+// They stay at 0 for the formats without a decoder, like the videos and the RAW files.
+func (l *LocalAssetFile) ReadImageSize() error {
+	if l.Width > 0 && l.Height > 0 || !metadata.CanReadImageSize(l.Ext()) {
+		return nil
+	}
+	f, err := l.FSys.Open(l.FileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	l.Width, l.Height, err = metadata.ImageSize(f)
+	return err
+}
+
+// ReadMotionPhoto sets MotionPhoto when the file is a JPEG or HEIC photo embedding a video
+func (l *LocalAssetFile) ReadMotionPhoto() error {
+	if !metadata.CanBeMotionPhoto(l.Ext()) {
+		return nil
+	}
+	f, err := l.FSys.Open(l.FileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	l.MotionPhoto, err = metadata.IsMotionPhoto(f)
+	return err
+}
+
 // PartialSourceReader open a reader on the current asset.
 // each byte read from it is saved into a temporary file.
 //
@@ -112,7 +201,7 @@ func (l *LocalAssetFile) PartialSourceReader() (reader io.Reader, err error) {
 			return nil, err
 		}
 		tempDir = filepath.Join(tempDir, "github.com/simulot/immich-go")
-		os.Mkdir(tempDir, 0700)
+		os.MkdirAll(tempDir, 0700)
 		l.tempFile, err = os.CreateTemp(tempDir, "")
 		if err != nil {
 			return nil, err
@@ -140,9 +229,25 @@ func (l *LocalAssetFile) Open() (fs.File, error) {
 	} else {
 		l.reader = l.sourceFile
 	}
+	l.reader, err = l.stripGPS(l.reader)
+	if err != nil {
+		return nil, err
+	}
 	return l, nil
 }
 
+// stripGPS removes the GPS position from the content of JPEG files when StripGPS is set
+func (l *LocalAssetFile) stripGPS(r io.Reader) (io.Reader, error) {
+	if !l.StripGPS || !metadata.CanStripGPS(l.Ext()) {
+		return r, nil
+	}
+	r, _, err := metadata.StripGPS(r)
+	if err != nil {
+		return nil, fmt.Errorf("can't remove the GPS position of %s: %w", l.FileName, err)
+	}
+	return r, nil
+}
+
 // Read
 func (l *LocalAssetFile) Read(b []byte) (int, error) {
 	return l.reader.Read(b)
@@ -0,0 +1,243 @@
+/*
+Remove the duplicated assets of the server, using the rules of the upload command.
+*/
+package cmddedupe
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/cmdupload"
+	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+	"github.com/simulot/immich-go/ui"
+)
+
+type iClient interface {
+	GetAllAssetsWithFilter(context.Context, *immich.GetAssetOptions, func(*immich.Asset)) error
+	DeleteAssets(context.Context, []string, bool) error
+	GetAssetAlbums(context.Context, string) ([]immich.AlbumSimplified, error)
+	AddAssetToAlbum(context.Context, string, []string) ([]immich.UpdateAlbumResult, error)
+}
+
+// KeepStrategy selects the asset kept in a group of duplicates
+type KeepStrategy string
+
+const (
+	KeepLargest KeepStrategy = "largest" // the largest file, supposed to be the best quality
+	KeepNewest  KeepStrategy = "newest"  // the most recently modified file
+)
+
+func (k *KeepStrategy) Set(s string) error {
+	switch v := KeepStrategy(strings.ToLower(strings.TrimSpace(s))); v {
+	case KeepLargest, KeepNewest:
+		*k = v
+		return nil
+	}
+	return fmt.Errorf("invalid value %q for -keep, expecting largest or newest", s)
+}
+
+func (k KeepStrategy) String() string {
+	return string(k)
+}
+
+type DedupeCmd struct {
+	client iClient
+	log    logger.Logger
+
+	DryRun    bool             // Report the duplicates without deleting them
+	Keep      KeepStrategy     // Asset kept in each group (Default: largest)
+	CheckSum  bool             // Group the assets having the same checksum, whatever their names (Default: FALSE)
+	DateRange immich.DateRange // Process only the assets taken in this range
+
+	DateTolerance time.Duration // Difference accepted between the dates of capture of copies (Default: 5m)
+}
+
+func NewDedupeCmd(ctx context.Context, ic iClient, log logger.Logger, args []string) (*DedupeCmd, error) {
+	cmd := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	validRange := immich.DateRange{}
+	validRange.Set("1850-01-04,2030-01-01")
+	app := DedupeCmd{
+		client:    ic,
+		log:       log,
+		Keep:      KeepLargest,
+		DateRange: validRange,
+	}
+	cmd.BoolFunc("dry-run", "Report the groups of duplicates without deleting them", myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.Var(&app.Keep, "keep", "Asset kept in each group of duplicates: largest or newest (default: largest)")
+	cmd.BoolFunc("checksum", "Group also the assets having the same content, whatever their names (default: FALSE)", myflag.BoolFlagFn(&app.CheckSum, false))
+	cmd.Var(&app.DateRange, "date", "Process only documents having a capture date in that range.")
+	cmd.DurationVar(&app.DateTolerance, "date-tolerance", cmdupload.DefaultDateTolerance, "Difference accepted between the dates of capture of copies, 0 requires the same second")
+	err := cmd.Parse(args)
+	return &app, err
+}
+
+func DedupeCommand(ctx context.Context, ic iClient, log logger.Logger, args []string) error {
+	app, err := NewDedupeCmd(ctx, ic, log, args)
+	if err != nil {
+		return err
+	}
+	return app.Run(ctx)
+}
+
+func (app *DedupeCmd) Run(ctx context.Context) error {
+	var assets []*immich.Asset
+	app.log.MessageContinue(logger.OK, "Get server's assets...")
+	err := app.client.GetAllAssetsWithFilter(ctx, nil, func(a *immich.Asset) {
+		if a.IsTrashed || !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
+			return
+		}
+		assets = append(assets, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.log.MessageTerminate(logger.OK, "%d received", len(assets))
+
+	groups := app.groups(assets)
+	app.log.OK("%d group(s) of duplicates", len(groups))
+
+	deleted, freed := 0, 0
+	for _, g := range groups {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		keep, others := app.selectKept(g)
+		app.log.OK("There are %d copies of the asset %s, taken on %s", len(g), fileName(keep), keep.ExifInfo.DateTimeOriginal.Format("2006-01-02 15:04:05"))
+		app.log.OK("  keep   %s", describe(keep))
+		ids := []string{}
+		for _, a := range others {
+			app.log.OK("  delete %s", describe(a))
+			ids = append(ids, a.ID)
+		}
+		if app.DryRun {
+			continue
+		}
+		err = app.moveAlbums(ctx, keep, others)
+		if err != nil {
+			app.log.Error("Can't update the albums of %s: %s", fileName(keep), err)
+			continue
+		}
+		err = app.client.DeleteAssets(ctx, ids, false)
+		if err != nil {
+			app.log.Error("Can't delete the copies of %s: %s", fileName(keep), err)
+			continue
+		}
+		deleted += len(ids)
+		for _, a := range others {
+			freed += a.ExifInfo.FileSizeInByte
+		}
+	}
+	if app.DryRun {
+		app.log.OK("Dry run mode, no asset deleted")
+		return nil
+	}
+	app.log.OK("%d asset(s) moved to the trash, %s freed", deleted, ui.FormatBytes(freed))
+	return nil
+}
+
+// groups puts together the copies of the same asset. Assets having the same name are
+// compared like the upload command does, the checksum joins assets having different names.
+func (app *DedupeCmd) groups(assets []*immich.Asset) [][]*immich.Asset {
+	parent := make([]int, len(assets))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		parent[find(j)] = find(i)
+	}
+
+	byName := map[string][]int{}
+	byChecksum := map[string]int{}
+	for i, a := range assets {
+		n := strings.ToUpper(fileName(a))
+		for _, j := range byName[n] {
+			if cmdupload.CompareAssets(a, assets[j], app.DateTolerance) != cmdupload.NotOnServer {
+				union(j, i)
+			}
+		}
+		byName[n] = append(byName[n], i)
+		if app.CheckSum && a.Checksum != "" {
+			if j, ok := byChecksum[a.Checksum]; ok {
+				union(j, i)
+			} else {
+				byChecksum[a.Checksum] = i
+			}
+		}
+	}
+
+	byRoot := map[int][]*immich.Asset{}
+	roots := []int{}
+	for i, a := range assets {
+		r := find(i)
+		if _, ok := byRoot[r]; !ok {
+			roots = append(roots, r)
+		}
+		byRoot[r] = append(byRoot[r], a)
+	}
+	groups := [][]*immich.Asset{}
+	for _, r := range roots {
+		if len(byRoot[r]) > 1 {
+			groups = append(groups, byRoot[r])
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i][0].ExifInfo.DateTimeOriginal.Before(groups[j][0].ExifInfo.DateTimeOriginal.Time)
+	})
+	return groups
+}
+
+// selectKept gives the asset to keep according to the strategy, and the others
+func (app *DedupeCmd) selectKept(g []*immich.Asset) (*immich.Asset, []*immich.Asset) {
+	l := append([]*immich.Asset{}, g...)
+	sort.SliceStable(l, func(i, j int) bool {
+		if app.Keep == KeepNewest && !l[i].FileModifiedAt.Equal(l[j].FileModifiedAt.Time) {
+			return l[i].FileModifiedAt.After(l[j].FileModifiedAt.Time)
+		}
+		return l[i].ExifInfo.FileSizeInByte > l[j].ExifInfo.FileSizeInByte
+	})
+	return l[0], l[1:]
+}
+
+// moveAlbums adds the kept asset into the albums of the deleted ones
+func (app *DedupeCmd) moveAlbums(ctx context.Context, keep *immich.Asset, others []*immich.Asset) error {
+	albums := map[string]string{}
+	for _, a := range others {
+		l, err := app.client.GetAssetAlbums(ctx, a.ID)
+		if err != nil {
+			return err
+		}
+		for _, al := range l {
+			albums[al.ID] = al.AlbumName
+		}
+	}
+	for id, name := range albums {
+		app.log.OK("  add %s to the album %s", fileName(keep), name)
+		_, err := app.client.AddAssetToAlbum(ctx, id, []string{keep.ID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fileName(a *immich.Asset) string {
+	return a.OriginalFileName + path.Ext(a.OriginalPath)
+}
+
+func describe(a *immich.Asset) string {
+	return fmt.Sprintf("%s %dx%d, %s, %s", fileName(a), a.ExifInfo.ExifImageWidth, a.ExifInfo.ExifImageHeight, ui.FormatBytes(a.ExifInfo.FileSizeInByte), a.OriginalPath)
+}
@@ -0,0 +1,114 @@
+package cmddedupe
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type icDedupe struct {
+	assets  []*immich.Asset
+	albums  map[string][]string // album IDs by asset ID
+	added   map[string][]string // asset IDs added by album ID
+	deleted []string
+}
+
+func (c *icDedupe) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.assets {
+		filter(a)
+	}
+	return nil
+}
+
+func (c *icDedupe) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	c.deleted = append(c.deleted, ids...)
+	return nil
+}
+
+func (c *icDedupe) GetAssetAlbums(ctx context.Context, id string) ([]immich.AlbumSimplified, error) {
+	var r []immich.AlbumSimplified
+	for _, al := range c.albums[id] {
+		r = append(r, immich.AlbumSimplified{ID: al, AlbumName: al})
+	}
+	return r, nil
+}
+
+func (c *icDedupe) AddAssetToAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.added[album] = append(c.added[album], ids...)
+	return nil, nil
+}
+
+func asset(id, name string, date time.Time, size int, checksum string, modified time.Time) *immich.Asset {
+	return &immich.Asset{
+		ID:               id,
+		OriginalFileName: name,
+		OriginalPath:     "upload/" + id + ".jpg",
+		Checksum:         checksum,
+		FileModifiedAt:   immich.ImmichTime{Time: modified},
+		ExifInfo: immich.ExifInfo{
+			FileSizeInByte:   size,
+			DateTimeOriginal: immich.ImmichTime{Time: date},
+		},
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	m1 := time.Date(2023, 10, 7, 0, 0, 0, 0, time.UTC)
+	m2 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assets := func() []*immich.Asset {
+		return []*immich.Asset{
+			asset("small", "IMG_1", d, 100, "c1", m2),
+			asset("large", "IMG_1", d.Add(time.Minute), 300, "c2", m1),
+			asset("other-date", "IMG_1", d.Add(time.Hour), 100, "c3", m1),
+			asset("renamed", "IMG_1 (1)", d, 100, "c1", m1),
+			asset("alone", "IMG_2", d, 100, "c4", m1),
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []string
+		added    []string
+	}{
+		{name: "largest", args: nil, expected: []string{"small"}, added: []string{"large"}},
+		{name: "newest", args: []string{"-keep=newest"}, expected: []string{"large"}},
+		{name: "checksum", args: []string{"-checksum"}, expected: []string{"renamed", "small"}, added: []string{"large"}},
+		{name: "dry-run", args: []string{"-dry-run"}, expected: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icDedupe{
+				assets: assets(),
+				albums: map[string][]string{"small": {"holidays"}},
+				added:  map[string][]string{},
+			}
+			err := DedupeCommand(context.Background(), ic, logger.NoLogger{}, tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(ic.deleted)
+			if !slices.Equal(ic.deleted, tc.expected) {
+				t.Errorf("expected deleted %v, got %v", tc.expected, ic.deleted)
+			}
+			if !slices.Equal(ic.added["holidays"], tc.added) {
+				t.Errorf("expected %v added to the album, got %v", tc.added, ic.added["holidays"])
+			}
+		})
+	}
+}
+
+func TestKeepStrategy(t *testing.T) {
+	var k KeepStrategy
+	if err := k.Set("Newest"); err != nil || k != KeepNewest {
+		t.Errorf("Set(Newest) = %s, %v", k, err)
+	}
+	if err := k.Set("best"); err == nil {
+		t.Error("Set(best) should fail")
+	}
+}
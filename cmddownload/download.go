@@ -0,0 +1,205 @@
+// Command Download
+
+package cmddownload
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type iClient interface {
+	GetAllAssetsWithFilter(context.Context, *immich.GetAssetOptions, func(*immich.Asset)) error
+	GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error)
+	GetAlbumInfo(context.Context, string) (immich.AlbumContent, error)
+	DownloadAsset(context.Context, string, io.Writer) error
+}
+
+type DownloadCmd struct {
+	client    iClient          // Immich client
+	log       logger.Logger    // Logger
+	Album     string           // Download only assets of this album
+	DateRange immich.DateRange // Set capture date range
+	DryRun    bool             // List the assets without downloading them
+	Dest      string           // Destination folder
+
+	names map[string]any // names already used in the destination folder
+}
+
+func NewDownloadCmd(ctx context.Context, ic iClient, log logger.Logger, args []string) (*DownloadCmd, error) {
+	cmd := flag.NewFlagSet("download", flag.ExitOnError)
+	app := DownloadCmd{
+		client: ic,
+		log:    log,
+		names:  map[string]any{},
+	}
+
+	cmd.BoolFunc("dry-run", "display the assets to download, but don't download them", myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.StringVar(&app.Album, "album", "", "Download only assets of this album")
+	cmd.Var(&app.DateRange, "date", "Download only assets having a capture date in that range.")
+	err := cmd.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.NArg() != 1 {
+		return nil, errors.New("the destination folder is missing")
+	}
+	app.Dest = cmd.Arg(0)
+	return &app, nil
+}
+
+func DownloadCommand(ctx context.Context, ic iClient, log logger.Logger, args []string) error {
+	app, err := NewDownloadCmd(ctx, ic, log, args)
+	if err != nil {
+		return err
+	}
+	return app.Run(ctx)
+}
+
+func (app *DownloadCmd) Run(ctx context.Context) error {
+	var inAlbum map[string]any
+	if app.Album != "" {
+		var err error
+		inAlbum, err = app.albumAssets(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !app.DryRun {
+		err := os.MkdirAll(app.Dest, 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	app.log.MessageContinue(logger.OK, "Get server's assets...")
+	var list []*immich.Asset
+	err := app.client.GetAllAssetsWithFilter(ctx, nil, func(a *immich.Asset) {
+		if a.IsTrashed {
+			return
+		}
+		if inAlbum != nil {
+			if _, ok := inAlbum[a.ID]; !ok {
+				return
+			}
+		}
+		if !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
+			return
+		}
+		list = append(list, a)
+	})
+	if err != nil {
+		return err
+	}
+	app.log.MessageTerminate(logger.OK, " %d asset(s) to download", len(list))
+
+	downloaded := 0
+	for _, a := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name, exists := app.fileName(a)
+		if exists {
+			app.log.OK("%s already downloaded", name)
+			continue
+		}
+		if app.DryRun {
+			app.log.OK("Download %s skipped - dry run mode", name)
+			continue
+		}
+		err = app.download(ctx, a, name)
+		if err != nil {
+			app.log.Error("Can't download %s: %s", name, err)
+			continue
+		}
+		app.log.OK("%s downloaded", name)
+		downloaded++
+	}
+	app.log.OK("%d asset(s) downloaded", downloaded)
+	return nil
+}
+
+// albumAssets returns the IDs of the album's assets
+func (app *DownloadCmd) albumAssets(ctx context.Context) (map[string]any, error) {
+	albums, err := app.client.GetAllAlbums(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get the album list from the server: %w", err)
+	}
+	for _, al := range albums {
+		if al.AlbumName != app.Album {
+			continue
+		}
+		content, err := app.client.GetAlbumInfo(ctx, al.ID)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the album %q: %w", app.Album, err)
+		}
+		ids := map[string]any{}
+		for _, a := range content.Assets {
+			ids[a.ID] = nil
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("album %q not found on the server", app.Album)
+}
+
+// fileName gives the name of the asset in the destination folder.
+// Name collisions are resolved by adding a counter to the name.
+// exists is true when the file is already present in the destination folder with the same size.
+func (app *DownloadCmd) fileName(a *immich.Asset) (name string, exists bool) {
+	ext := path.Ext(a.OriginalPath)
+	base := strings.TrimSuffix(a.OriginalFileName, ext)
+	if base == "" {
+		base = a.ID
+	}
+	name = base + ext
+	for i := 1; ; i++ {
+		if _, used := app.names[strings.ToLower(name)]; !used {
+			s, err := os.Stat(filepath.Join(app.Dest, name))
+			if err != nil {
+				break
+			}
+			if s.Size() == int64(a.ExifInfo.FileSizeInByte) {
+				app.names[strings.ToLower(name)] = nil
+				return name, true
+			}
+		}
+		name = base + "_" + strconv.Itoa(i) + ext
+	}
+	app.names[strings.ToLower(name)] = nil
+	return name, false
+}
+
+// download writes the asset into a temporary file renamed once complete
+func (app *DownloadCmd) download(ctx context.Context, a *immich.Asset, name string) error {
+	f, err := os.CreateTemp(app.Dest, ".download-*")
+	if err != nil {
+		return err
+	}
+	err = app.client.DownloadAsset(ctx, a.ID, f)
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(app.Dest, name))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	t := a.FileModifiedAt.Time
+	if !t.IsZero() {
+		os.Chtimes(filepath.Join(app.Dest, name), t, t)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cmddownload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type icDownload struct {
+	assets     []*immich.Asset
+	content    map[string]string
+	albums     map[string][]string
+	downloaded []string
+}
+
+func (c *icDownload) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.assets {
+		filter(a)
+	}
+	return nil
+}
+
+func (c *icDownload) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	var r []immich.AlbumSimplified
+	for name := range c.albums {
+		r = append(r, immich.AlbumSimplified{ID: "id-" + name, AlbumName: name})
+	}
+	return r, nil
+}
+
+func (c *icDownload) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	for name, ids := range c.albums {
+		if "id-"+name == id {
+			r := immich.AlbumContent{ID: id, AlbumName: name}
+			for _, id := range ids {
+				r.Assets = append(r.Assets, immich.AssetSimplified{ID: id})
+			}
+			return r, nil
+		}
+	}
+	return immich.AlbumContent{}, errors.New("not found")
+}
+
+func (c *icDownload) DownloadAsset(ctx context.Context, id string, w io.Writer) error {
+	c.downloaded = append(c.downloaded, id)
+	_, err := io.WriteString(w, c.content[id])
+	return err
+}
+
+func asset(id, name, content string, date string) *immich.Asset {
+	d, _ := time.Parse("2006-01-02", date)
+	return &immich.Asset{
+		ID:               id,
+		OriginalFileName: name,
+		OriginalPath:     "upload/library/" + id + ".jpg",
+		ExifInfo: immich.ExifInfo{
+			FileSizeInByte:   len(content),
+			DateTimeOriginal: immich.ImmichTime{Time: d},
+		},
+	}
+}
+
+func newIC() *icDownload {
+	ic := &icDownload{
+		content: map[string]string{"1": "first", "2": "second photo", "3": "third", "4": "trashed"},
+		albums:  map[string][]string{"Holidays": {"2", "3"}},
+	}
+	ic.assets = []*immich.Asset{
+		asset("1", "IMG_0001", ic.content["1"], "2023-01-10"),
+		asset("2", "IMG_0001", ic.content["2"], "2023-06-10"),
+		asset("3", "PXL_20230710", ic.content["3"], "2023-07-10"),
+		asset("4", "DELETED", ic.content["4"], "2023-07-10"),
+	}
+	ic.assets[3].IsTrashed = true
+	return ic
+}
+
+func TestDownload(t *testing.T) {
+	testCases := []struct {
+		name          string
+		args          []string
+		expectedFiles map[string]string
+	}{
+		{
+			name: "all",
+			expectedFiles: map[string]string{
+				"IMG_0001.jpg":     "first",
+				"IMG_0001_1.jpg":   "second photo",
+				"PXL_20230710.jpg": "third",
+			},
+		},
+		{
+			name: "album",
+			args: []string{"-album=Holidays"},
+			expectedFiles: map[string]string{
+				"IMG_0001.jpg":     "second photo",
+				"PXL_20230710.jpg": "third",
+			},
+		},
+		{
+			name: "date",
+			args: []string{"-date=2023-06"},
+			expectedFiles: map[string]string{
+				"IMG_0001.jpg": "second photo",
+			},
+		},
+		{
+			name:          "dry-run",
+			args:          []string{"-dry-run"},
+			expectedFiles: map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "backup")
+			ic := newIC()
+			err := DownloadCommand(context.Background(), ic, logger.NoLogger{}, append(tc.args, dest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFiles(t, dest, tc.expectedFiles)
+		})
+	}
+}
+
+func TestDownloadTwice(t *testing.T) {
+	dest := t.TempDir()
+	ic := newIC()
+	err := DownloadCommand(context.Background(), ic, logger.NoLogger{}, []string{dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.downloaded = nil
+	err = DownloadCommand(context.Background(), ic, logger.NoLogger{}, []string{dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.downloaded) > 0 {
+		t.Errorf("unexpected downloads: %v", ic.downloaded)
+	}
+	checkFiles(t, dest, map[string]string{
+		"IMG_0001.jpg":     "first",
+		"IMG_0001_1.jpg":   "second photo",
+		"PXL_20230710.jpg": "third",
+	})
+}
+
+func checkFiles(t *testing.T, dest string, expected map[string]string) {
+	t.Helper()
+	entries, err := os.ReadDir(dest)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	slices.Sort(names)
+	expectedNames := []string{}
+	for n, c := range expected {
+		expectedNames = append(expectedNames, n)
+		b, err := os.ReadFile(filepath.Join(dest, n))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != c {
+			t.Errorf("file %s: expected %q, got %q", n, c, string(b))
+		}
+	}
+	slices.Sort(expectedNames)
+	if !slices.Equal(names, expectedNames) {
+		t.Errorf("expected files %v, got %v", expectedNames, names)
+	}
+}
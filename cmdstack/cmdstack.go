@@ -1,3 +1,6 @@
+/*
+Stack the assets already on the server, using the rules of the upload command.
+*/
 package cmdstack
 
 import (
@@ -5,75 +8,95 @@ import (
 	"flag"
 	"path"
 	"sort"
-	"strconv"
+	"strings"
 
+	"github.com/simulot/immich-go/helpers/myflag"
 	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/logger"
 	"github.com/simulot/immich-go/ui"
 )
 
+type iClient interface {
+	GetAllAssetsWithFilter(context.Context, *immich.GetAssetOptions, func(*immich.Asset)) error
+	StackAssets(ctx context.Context, cover string, IDs []string) error
+}
+
 type StackCmd struct {
-	Immich *immich.ImmichClient // Immich client
-	logger *logger.Log
+	client iClient
+	log    logger.Logger
 
-	AssumeYes bool
-	DateRange immich.DateRange // Set capture date range
+	AssumeYes       bool
+	DryRun          bool             // Report the stacks without creating them
+	StackJpgRaws    bool             // Stack the jpg/raw photos (Default: TRUE)
+	StackBurst      bool             // Stack the bursts (Default: TRUE)
+	StackLivePhotos bool             // Stack the photo and the video of live photos (Default: TRUE)
+	DateRange       immich.DateRange // Set capture date range
 }
 
-func initSack(xtx context.Context, ic *immich.ImmichClient, log *logger.Log, args []string) (*StackCmd, error) {
+func NewStackCmd(ctx context.Context, ic iClient, log logger.Logger, args []string) (*StackCmd, error) {
 	cmd := flag.NewFlagSet("stack", flag.ExitOnError)
 	validRange := immich.DateRange{}
 
 	validRange.Set("1850-01-04,2030-01-01")
 	app := StackCmd{
-		logger:    log,
-		Immich:    ic,
+		client:    ic,
+		log:       log,
 		DateRange: validRange,
 	}
 
-	cmd.BoolFunc("yes", "When true, assume Yes to all actions", func(s string) error {
-		var err error
-		app.AssumeYes, err = strconv.ParseBool(s)
-		return err
-	})
+	cmd.BoolFunc("yes", "When true, assume Yes to all actions", myflag.BoolFlagFn(&app.AssumeYes, false))
+	cmd.BoolFunc("dry-run", "List the stacks without creating them (default: FALSE)", myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.BoolFunc("stack-jpg-raw", "Control the stacking of jpg/raw photos (default TRUE)", myflag.BoolFlagFn(&app.StackJpgRaws, true))
+	cmd.BoolFunc("stack-burst", "Control the stacking bursts (default TRUE)", myflag.BoolFlagFn(&app.StackBurst, true))
+	cmd.BoolFunc("stack-live-photos", "Control the stacking of the photo and the video of live photos (default TRUE)", myflag.BoolFlagFn(&app.StackLivePhotos, true))
 	cmd.Var(&app.DateRange, "date", "Process only documents having a capture date in that range.")
 	err := cmd.Parse(args)
 	return &app, err
 }
-func NewStackCommand(ctx context.Context, ic *immich.ImmichClient, log *logger.Log, args []string) error {
-	app, err := initSack(ctx, ic, log, args)
+
+func StackCommand(ctx context.Context, ic iClient, log logger.Logger, args []string) error {
+	app, err := NewStackCmd(ctx, ic, log, args)
 	if err != nil {
 		return err
 	}
+	return app.Run(ctx)
+}
 
-	sb := stacking.NewStackBuilder()
-	log.MessageContinue(logger.OK, "Get server's assets...")
+func (app *StackCmd) Run(ctx context.Context) error {
+	sb := stacking.NewStackBuilder().SetLivePhotos(app.StackLivePhotos)
+	app.log.MessageContinue(logger.OK, "Get server's assets...")
 	assetCount := 0
 
-	err = app.Immich.GetAllAssetsWithFilter(ctx, nil, func(a *immich.Asset) {
-		if a.IsTrashed {
+	err := app.client.GetAllAssetsWithFilter(ctx, nil, func(a *immich.Asset) {
+		if a.IsTrashed || a.StackParentId != "" {
 			return
 		}
 		if !app.DateRange.InRange(a.ExifInfo.DateTimeOriginal.Time) {
 			return
 		}
 		assetCount += 1
-		sb.ProcessAsset(a.ID, a.OriginalFileName+path.Ext(a.OriginalPath), a.ExifInfo.DateTimeOriginal.Time)
+		sb.ProcessBurstAsset(a.ID, a.OriginalFileName+path.Ext(a.OriginalPath), a.ExifInfo.DateTimeOriginal.Time, burstInfo(a))
 	})
 	if err != nil {
 		return err
 	}
-	stacks := sb.Stacks()
-	log.MessageTerminate(logger.OK, " %d received, %d stack(s) possible", assetCount, len(stacks))
+	stacks := app.selectStacks(sb.Stacks())
+	app.log.MessageTerminate(logger.OK, " %d received, %d stack(s) possible", assetCount, len(stacks))
 
+	stacked := 0
 	for _, s := range stacks {
-		log.OK("Stack following images taken on %s", s.Date)
-		cover := s.CoverID
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		app.log.OK("Stack following images taken on %s", s.Date)
 		names := s.Names
 		sort.Strings(names)
 		for _, n := range names {
-			log.OK("  %s", n)
+			app.log.OK("  %s", n)
+		}
+		if app.DryRun {
+			continue
 		}
 		yes := app.AssumeYes
 		if !app.AssumeYes {
@@ -86,12 +109,43 @@ func NewStackCommand(ctx context.Context, ic *immich.ImmichClient, log *logger.L
 			}
 		}
 		if yes {
-			err := app.Immich.StackAssets(ctx, cover, s.IDs)
+			err := app.client.StackAssets(ctx, s.CoverID, s.IDs)
 			if err != nil {
-				log.Warning("Can't stack images: %s", err)
+				app.log.Warning("Can't stack images: %s", err)
+				continue
 			}
+			stacked++
 		}
 	}
-
+	if app.DryRun {
+		app.log.OK("Dry run mode, no stack created")
+		return nil
+	}
+	app.log.OK("%d stack(s) created", stacked)
 	return nil
 }
+
+// burstInfo gives what the server knows about the burst of the asset, like the upload command reads it in the file.
+// The server's date of capture keeps the sub-seconds, and the video of a motion photo is linked to the photo.
+func burstInfo(a *immich.Asset) stacking.BurstInfo {
+	return stacking.BurstInfo{
+		Camera:      strings.TrimSpace(a.ExifInfo.Make + " " + a.ExifInfo.Model),
+		SubSecond:   a.ExifInfo.DateTimeOriginal.Nanosecond() != 0,
+		MotionPhoto: a.LivePhotoVideoID != "",
+	}
+}
+
+// selectStacks keeps the kinds of stacks enabled by the options
+func (app *StackCmd) selectStacks(stacks []stacking.Stack) []stacking.Stack {
+	var selected []stacking.Stack
+	for _, s := range stacks {
+		switch {
+		case !app.StackBurst && s.StackType == stacking.StackBurst:
+		case !app.StackJpgRaws && s.StackType == stacking.StackRawJpg:
+		case !app.StackLivePhotos && s.StackType == stacking.StackLivePhoto:
+		default:
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,80 @@
+package cmdstack
+
+import (
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type icStack struct {
+	assets  []*immich.Asset
+	stacked [][]string // cover followed by the sorted IDs of each stack
+}
+
+func (c *icStack) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.assets {
+		filter(a)
+	}
+	return nil
+}
+
+func (c *icStack) StackAssets(ctx context.Context, cover string, IDs []string) error {
+	ids := slices.Clone(IDs)
+	slices.Sort(ids)
+	c.stacked = append(c.stacked, append([]string{cover}, ids...))
+	return nil
+}
+
+func TestStack(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	asset := func(id, name string, date time.Time, camera string) *immich.Asset {
+		return &immich.Asset{ID: id, OriginalFileName: strings.TrimSuffix(name, path.Ext(name)), OriginalPath: "upload/" + name, ExifInfo: immich.ExifInfo{Model: camera, DateTimeOriginal: immich.ImmichTime{Time: date}}}
+	}
+	assets := func() []*immich.Asset {
+		motion := asset("motion", "PXL_20231006_063500000.MP.jpg", d.Add(5*time.Minute), "")
+		motion.LivePhotoVideoID = "motion-video"
+		stacked := asset("stacked", "DSC_0002.NEF", d.Add(time.Hour), "")
+		stacked.StackParentId = "cover"
+		return []*immich.Asset{
+			asset("jpg", "IMG_0001.JPG", d, ""),
+			asset("raw", "IMG_0001.CR2", d, ""),
+			asset("burst1", "DSC_0100.JPG", d.Add(10*time.Minute+100*time.Millisecond), "D750"),
+			asset("burst2", "DSC_0101.JPG", d.Add(10*time.Minute+400*time.Millisecond), "D750"),
+			asset("live", "IMG_0002.HEIC", d.Add(20*time.Minute), ""),
+			asset("live-video", "IMG_0002.MOV", d.Add(20*time.Minute), ""),
+			motion,
+			asset("motion-copy", "PXL_20231006_063500000.MP.mp4", d.Add(5*time.Minute), ""),
+			asset("alone", "DSC_0002.JPG", d.Add(time.Hour), ""),
+			stacked,
+		}
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		args     []string
+		expected [][]string
+	}{
+		{args: []string{"-dry-run"}},
+		{args: []string{"-yes"}, expected: [][]string{{"jpg", "raw"}, {"burst1", "burst2"}, {"live", "live-video"}}},
+		{args: []string{"-yes", "-stack-jpg-raw=false", "-stack-live-photos=false"}, expected: [][]string{{"burst1", "burst2"}}},
+	} {
+		ic := &icStack{assets: assets()}
+		app, err := NewStackCmd(ctx, ic, logger.NoLogger{}, c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.EqualFunc(ic.stacked, c.expected, slices.Equal) {
+			t.Errorf("%v: expected the stacks %v, got %v", c.args, c.expected, ic.stacked)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmdupload
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/gen"
+)
+
+// albumAsset is an asset added to an album, with what is needed to choose the album's cover
+type albumAsset struct {
+	rank    int       // Order of the addition to the album
+	date    time.Time // Date of capture
+	name    string    // Name of the local file
+	present bool      // Already in the album according to the index of the server's albums
+}
+
+// albumAssets gives the assets of an album by ID
+type albumAssets map[string]albumAsset
+
+// byRank gives the IDs of the assets in the order of their addition to the album
+func (l albumAssets) byRank() []string {
+	ids := gen.MapKeys(l)
+	slices.SortFunc(ids, func(a, b string) int { return cmp.Compare(l[a].rank, l[b].rank) })
+	return ids
+}
+
+// Strategies of -album-cover, the other values are file name patterns
+const (
+	AlbumCoverFirst  = "first"
+	AlbumCoverNewest = "newest"
+	AlbumCoverOldest = "oldest"
+)
+
+// checkAlbumCover accepts the strategies and the valid file name patterns
+func checkAlbumCover(s string) error {
+	switch strings.ToLower(s) {
+	case "", AlbumCoverFirst, AlbumCoverNewest, AlbumCoverOldest:
+		return nil
+	}
+	if _, err := path.Match(strings.ToLower(s), ""); err != nil {
+		return fmt.Errorf("invalid value %q for -album-cover: %w", s, err)
+	}
+	return nil
+}
+
+// albumCover chooses the cover of an album following the -album-cover strategy.
+// When the chosen asset is stacked, the cover of its stack is used instead.
+// It returns an empty string when no asset fits, and the server chooses the cover.
+func (app *UpCmd) albumCover(assets albumAssets) string {
+	strategy := strings.ToLower(app.AlbumCover)
+	cover := ""
+	var best albumAsset
+	for id, a := range assets {
+		var better bool
+		switch strategy {
+		case "":
+			return ""
+		case AlbumCoverFirst:
+			better = cover == "" || a.rank < best.rank
+		case AlbumCoverNewest:
+			better = !a.date.IsZero() && (cover == "" || a.date.After(best.date) || a.date.Equal(best.date) && a.rank < best.rank)
+		case AlbumCoverOldest:
+			better = !a.date.IsZero() && (cover == "" || a.date.Before(best.date) || a.date.Equal(best.date) && a.rank < best.rank)
+		default:
+			match, _ := path.Match(strategy, strings.ToLower(path.Base(a.name)))
+			better = match && (cover == "" || a.rank < best.rank)
+		}
+		if better {
+			cover, best = id, a
+		}
+	}
+	if stackCover, ok := app.stackCovers[cover]; ok {
+		if _, inAlbum := assets[stackCover]; inAlbum {
+			cover = stackCover
+		}
+	}
+	return cover
+}
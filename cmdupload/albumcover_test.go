@@ -0,0 +1,104 @@
+package cmdupload
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestAlbumCover(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 8, d, 12, 0, 0, 0, time.UTC) }
+	assets := albumAssets{
+		"a": {rank: 1, date: day(2), name: "2023/IMG_0002.jpg"},
+		"b": {rank: 2, date: day(1), name: "2023/IMG_0001.JPG"},
+		"c": {rank: 3, date: day(3), name: "2023/cover.jpg"},
+		"d": {rank: 4, name: "2023/IMG_0004.jpg"},
+		"e": {rank: 5, date: day(3), name: "2023/IMG_0005.jpg"},
+	}
+	tc := []struct {
+		strategy string
+		stacks   map[string]string
+		expected string
+	}{
+		{strategy: "", expected: ""},
+		{strategy: "first", expected: "a"},
+		{strategy: "Newest", expected: "c"},
+		{strategy: "oldest", expected: "b"},
+		{strategy: "cover.*", expected: "c"},
+		{strategy: "img_*.jpg", expected: "a"},
+		{strategy: "*.png", expected: ""},
+		{strategy: "first", stacks: map[string]string{"a": "b", "b": "b"}, expected: "b"},
+		{strategy: "first", stacks: map[string]string{"a": "z", "z": "z"}, expected: "a"},
+	}
+	for _, c := range tc {
+		app := UpCmd{AlbumCover: c.strategy, stackCovers: c.stacks}
+		if got := app.albumCover(assets); got != c.expected {
+			t.Errorf("%q with the stacks %v: expected %q, got %q", c.strategy, c.stacks, c.expected, got)
+		}
+	}
+
+	for _, s := range []string{"first", "NEWEST", "*.jpg", ""} {
+		if err := checkAlbumCover(s); err != nil {
+			t.Errorf("%q should be accepted: %s", s, err)
+		}
+	}
+	if err := checkAlbumCover("[a-"); err == nil {
+		t.Error("an invalid pattern should be rejected")
+	}
+}
+
+type icCovers struct {
+	icCatchUploadsAssets
+	covers map[string]string
+}
+
+func (c *icCovers) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "existing", AlbumName: "existing"}}, nil
+}
+
+func (c *icCovers) SetAlbumCover(ctx context.Context, albumID string, assetID string) error {
+	c.covers[albumID] = assetID
+	return nil
+}
+
+func TestManageAlbumsCover(t *testing.T) {
+	ic := &icCovers{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, covers: map[string]string{}}
+	app := UpCmd{
+		client:         ic,
+		Journal:        logger.NewJournal(logger.NoLogger{}),
+		AlbumBatchSize: 2,
+		AlbumCover:     "newest",
+		updateAlbums: map[string]albumAssets{
+			"existing": {"a": {rank: 1, date: time.Now()}},
+			"new":      {"b": {rank: 2, date: time.Now().Add(-time.Hour)}, "c": {rank: 3, date: time.Now()}, "d": {rank: 4}},
+		},
+	}
+	err := app.ManageAlbums(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"new": "c"}
+	if !reflect.DeepEqual(ic.covers, expected) {
+		t.Errorf("expected the covers %v, got %v", expected, ic.covers)
+	}
+}
+
+func TestAlbumAssetsOrder(t *testing.T) {
+	app := UpCmd{updateAlbums: map[string]albumAssets{}}
+	for _, id := range []string{"z", "a", "m", "a", "b"} {
+		app.AddToAlbum(id, "album", nil)
+	}
+	app.AddToAlbum("c", "other", nil)
+	app.AddToAlbum("y", "album", nil)
+
+	expected := []string{"z", "a", "m", "b", "y"}
+	for i := 0; i < 10; i++ {
+		if got := app.updateAlbums["album"].byRank(); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the order of the additions %v, got %v", expected, got)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Values of -album-visibility
+const (
+	AlbumVisibilityPrivate = "private"
+	AlbumVisibilityLink    = "link"
+)
+
+// resolveAlbumShares finds on the server the users given by -album-share-with, by email or ID.
+// An unknown user stops the command before anything is uploaded.
+func (app *UpCmd) resolveAlbumShares(ctx context.Context) error {
+	app.albumShareUsers = nil
+	if len(app.AlbumShareWith) == 0 {
+		return nil
+	}
+	users, err := app.client.GetAllUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the users of the server: %w", err)
+	}
+	for _, u := range app.AlbumShareWith {
+		u = strings.TrimSpace(u)
+		found := false
+		for _, su := range users {
+			if su.ID == u || strings.EqualFold(su.Email, u) {
+				app.albumShareUsers = append(app.albumShareUsers, su.ID)
+				app.albumShareNames = append(app.albumShareNames, su.Email)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("the user %q given by -album-share-with doesn't exist on the server", u)
+		}
+	}
+	return nil
+}
+
+// shareAlbum shares the album just created with the users of -album-share-with,
+// and creates its shared link with -album-visibility=link.
+// The album is created anyway, the failures are only reported.
+func (app *UpCmd) shareAlbum(ctx context.Context, album string, id string) {
+	if len(app.albumShareUsers) > 0 {
+		err := app.callWithRetries(ctx, "Sharing of the album "+album, func() error {
+			return app.client.AddUsersToAlbum(ctx, id, app.albumShareUsers)
+		})
+		if err != nil {
+			app.Journal.Warning("can't share the album %q: %s", album, err)
+		} else {
+			app.Journal.OK("Album %q shared with %s", album, strings.Join(app.albumShareNames, ", "))
+		}
+	}
+	if app.AlbumVisibility == AlbumVisibilityLink {
+		err := app.callWithRetries(ctx, "Shared link of the album "+album, func() error {
+			l, err := app.client.CreateAlbumSharedLink(ctx, id)
+			if err == nil {
+				app.Journal.OK("Album %q shared by the link %s", album, l.URL)
+			}
+			return err
+		})
+		if err != nil {
+			app.Journal.Warning("can't create the shared link of the album %q: %s", album, err)
+		}
+	}
+}
+
+// previewShare tells how a real run would share the album created
+func (app *UpCmd) previewShare(album string) {
+	if len(app.albumShareNames) > 0 {
+		app.Journal.OK("Dry run: the album %q would be shared with %s", album, strings.Join(app.albumShareNames, ", "))
+	}
+	if app.AlbumVisibility == AlbumVisibilityLink {
+		app.Journal.OK("Dry run: a shared link of the album %q would be created", album)
+	}
+}
@@ -1,42 +1,164 @@
 package cmdupload
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/immich"
 )
 
 type AssetIndex struct {
-	assets []*immich.Asset
-	byHash map[string][]*immich.Asset
-	byName map[string][]*immich.Asset
-	byID   map[string]*immich.Asset
-	// albums []immich.AlbumSimplified
+	assets     []*immich.Asset
+	byChecksum map[string]*immich.Asset
+	byName     map[string][]*immich.Asset // by nameKey
+	byID       map[string]*immich.Asset
+
+	normalizeExt bool // .jpeg and .tif are matched with .jpg and .tiff
+
+	albumIDs map[string]string         // album ID by name
+	inAlbums map[string]map[string]any // album IDs by asset ID
+
+	membersMut sync.Mutex
+	members    map[string]map[string]bool // asset IDs by album ID, read by AlbumMembers
 }
 
 func (ai *AssetIndex) ReIndex() {
-	ai.byHash = map[string][]*immich.Asset{}
+	ai.byChecksum = map[string]*immich.Asset{}
 	ai.byName = map[string][]*immich.Asset{}
 	ai.byID = map[string]*immich.Asset{}
 
 	for _, a := range ai.assets {
 		ext := path.Ext(a.OriginalPath)
 		ID := fmt.Sprintf("%s-%d", strings.ToUpper(path.Base(a.OriginalFileName)+ext), a.ExifInfo.FileSizeInByte)
-		l := ai.byHash[a.Checksum]
-		l = append(l, a)
-		ai.byHash[a.Checksum] = l
+		if a.Checksum != "" {
+			ai.byChecksum[a.Checksum] = a
+		}
 
-		n := a.OriginalFileName + ext
-		l = ai.byName[n]
+		n := ai.nameKey(a.OriginalFileName + ext)
+		l := ai.byName[n]
 		l = append(l, a)
 		ai.byName[n] = l
 		ai.byID[ID] = a
 	}
 }
 
+// canonicalExt gives the extension matching the one of the key, for -normalize-extensions
+var canonicalExt = map[string]string{
+	".jpeg": ".jpg",
+	".tif":  ".tiff",
+}
+
+// nameKey gives the key of a file name in the index. The names are compared ignoring the case,
+// and the extensions are canonicalized when normalizeExt is set.
+func (ai *AssetIndex) nameKey(name string) string {
+	name = strings.ToLower(path.Base(name))
+	if ai.normalizeExt {
+		ext := path.Ext(name)
+		if c, ok := canonicalExt[ext]; ok {
+			name = strings.TrimSuffix(name, ext) + c
+		}
+	}
+	return name
+}
+
+// ByName returns the server's assets having the name of the file, the case being ignored
+func (ai *AssetIndex) ByName(name string) []*immich.Asset {
+	return ai.byName[ai.nameKey(name)]
+}
+
+// ByChecksum returns the asset having the given checksum, or nil
+func (ai *AssetIndex) ByChecksum(checksum string) *immich.Asset {
+	if checksum == "" {
+		return nil
+	}
+	return ai.byChecksum[checksum]
+}
+
+type albumReader interface {
+	GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error)
+	GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error)
+}
+
+// IndexAlbums records the albums each server's asset belongs to
+func (ai *AssetIndex) IndexAlbums(ctx context.Context, ic albumReader) error {
+	albums, err := ic.GetAllAlbums(ctx)
+	if err != nil {
+		return err
+	}
+	ai.albumIDs = map[string]string{}
+	ai.inAlbums = map[string]map[string]any{}
+	for _, al := range albums {
+		ai.albumIDs[al.AlbumName] = al.ID
+		content, err := ic.GetAlbumInfo(ctx, al.ID)
+		if err != nil {
+			return err
+		}
+		for _, a := range content.Assets {
+			l := ai.inAlbums[a.ID]
+			if l == nil {
+				l = map[string]any{}
+				ai.inAlbums[a.ID] = l
+			}
+			l[al.ID] = nil
+		}
+	}
+	return nil
+}
+
+// InAlbum reports whether the server's asset already belongs to the album
+func (ai *AssetIndex) InAlbum(ID string, album string) bool {
+	if ai == nil || ai.inAlbums == nil {
+		return false
+	}
+	albumID, ok := ai.albumIDs[album]
+	if !ok {
+		return false
+	}
+	_, ok = ai.inAlbums[ID][albumID]
+	return ok
+}
+
+type albumMemberReader interface {
+	GetAlbumAssetIDs(ctx context.Context, id string) ([]string, error)
+}
+
+// AlbumMembers gives the IDs of the assets of the server's album.
+// They are asked once to the server, and kept for the next calls.
+func (ai *AssetIndex) AlbumMembers(ctx context.Context, ic albumMemberReader, albumID string) (map[string]bool, error) {
+	if ai != nil {
+		ai.membersMut.Lock()
+		defer ai.membersMut.Unlock()
+		if m, ok := ai.members[albumID]; ok {
+			return m, nil
+		}
+	}
+	ids, err := ic.GetAlbumAssetIDs(ctx, albumID)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+	if ai != nil {
+		if ai.members == nil {
+			ai.members = map[string]map[string]bool{}
+		}
+		ai.members[albumID] = m
+	}
+	return m, nil
+}
+
+// albumsIndexed tells if the albums of the server's assets are known
+func (ai *AssetIndex) albumsIndexed() bool {
+	return ai != nil && ai.inAlbums != nil
+}
+
 func (ai *AssetIndex) Len() int {
 	return len(ai.assets)
 }
@@ -46,6 +168,7 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, ImmichID string)
 		ID:               ImmichID,
 		DeviceAssetID:    la.DeviceAssetID(),
 		OriginalFileName: strings.TrimSuffix(path.Base(la.Title), path.Ext(la.Title)),
+		Checksum:         la.Checksum,
 		ExifInfo: immich.ExifInfo{
 			FileSizeInByte:   int(la.Size()),
 			DateTimeOriginal: immich.ImmichTime{Time: la.DateTaken},
@@ -56,7 +179,29 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, ImmichID string)
 	}
 	ai.assets = append(ai.assets, sa)
 	ai.byID[sa.DeviceAssetID] = sa
-	l := ai.byName[sa.OriginalFileName]
-	l = append(l, sa)
-	ai.byName[sa.OriginalFileName] = l
+	if sa.Checksum != "" {
+		ai.byChecksum[sa.Checksum] = sa
+	}
+	n := ai.nameKey(localName(la))
+	ai.byName[n] = append(ai.byName[n], sa)
+}
+
+// CompareAssets applies the rules of ShouldUpload to the server's asset b, seen as a copy of a.
+// Copies have the same name and date of capture, and the advice depends on their sizes:
+// SameOnServer, SmallerOnServer when b is smaller than a, BetterOnServer when b is larger.
+// NotOnServer means that b isn't a copy of a. The dates of capture must be within the tolerance.
+func CompareAssets(a, b *immich.Asset, dateTolerance time.Duration) AdviceCode {
+	if !strings.EqualFold(a.OriginalFileName+path.Ext(a.OriginalPath), b.OriginalFileName+path.Ext(b.OriginalPath)) {
+		return NotOnServer
+	}
+	if compareDate(a.ExifInfo.DateTimeOriginal.Time, b.ExifInfo.DateTimeOriginal.Time, dateTolerance) != 0 {
+		return NotOnServer
+	}
+	switch compareSize := a.ExifInfo.FileSizeInByte - b.ExifInfo.FileSizeInByte; {
+	case compareSize > 0:
+		return SmallerOnServer
+	case compareSize < 0:
+		return BetterOnServer
+	}
+	return SameOnServer
 }
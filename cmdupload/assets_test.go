@@ -0,0 +1,266 @@
+package cmdupload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestShouldUploadChecksum(t *testing.T) {
+	content := []byte("the photo content")
+	h := sha1.Sum(content)
+	checksum := base64.StdEncoding.EncodeToString(h[:])
+
+	fsys := fstest.MapFS{
+		"renamed.jpg": &fstest.MapFile{Data: content},
+		"other.jpg":   &fstest.MapFile{Data: []byte("an other content")},
+	}
+
+	ai := &AssetIndex{
+		assets: []*immich.Asset{
+			{
+				ID:               "server-1",
+				OriginalFileName: "original",
+				OriginalPath:     "upload/original.jpg",
+				Checksum:         checksum,
+				ExifInfo: immich.ExifInfo{
+					FileSizeInByte:   len(content),
+					DateTimeOriginal: immich.ImmichTime{Time: time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)},
+				},
+			},
+		},
+	}
+	ai.ReIndex()
+
+	tests := []struct {
+		name   string
+		file   string
+		advice AdviceCode
+	}{
+		{name: "same content, other name", file: "renamed.jpg", advice: SameOnServer},
+		{name: "other content", file: "other.jpg", advice: NotOnServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			la := &browser.LocalAssetFile{
+				FSys:      fsys,
+				FileName:  tt.file,
+				Title:     tt.file,
+				FileSize:  len(fsys[tt.file].Data),
+				DateTaken: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+			_, err := la.ComputeChecksum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			advice, err := ai.ShouldUpload(la, DefaultDateTolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if advice.Advice != tt.advice {
+				t.Errorf("ShouldUpload() = %s, want %s", advice.Advice, tt.advice)
+			}
+		})
+	}
+}
+
+type albumsContent map[string]immich.AlbumContent
+
+func (c albumsContent) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	var r []immich.AlbumSimplified
+	for id, al := range c {
+		r = append(r, immich.AlbumSimplified{ID: id, AlbumName: al.AlbumName})
+	}
+	return r, nil
+}
+
+func (c albumsContent) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	return c[id], nil
+}
+
+func TestIndexAlbums(t *testing.T) {
+	ic := albumsContent{
+		"album-1": {ID: "album-1", AlbumName: "Holidays", Assets: []immich.AssetSimplified{{ID: "A"}, {ID: "B"}}},
+		"album-2": {ID: "album-2", AlbumName: "Family", Assets: []immich.AssetSimplified{{ID: "B"}}},
+	}
+	ai := &AssetIndex{}
+	ai.ReIndex()
+	err := ai.IndexAlbums(context.Background(), ic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id, album string
+		want      bool
+	}{
+		{"A", "Holidays", true},
+		{"A", "Family", false},
+		{"B", "Family", true},
+		{"C", "Holidays", false},
+		{"A", "Unknown", false},
+	}
+	for _, tt := range tests {
+		if got := ai.InAlbum(tt.id, tt.album); got != tt.want {
+			t.Errorf("InAlbum(%q, %q) = %v, want %v", tt.id, tt.album, got, tt.want)
+		}
+	}
+}
+
+func TestCompareAssets(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	asset := func(name string, date time.Time, size int) *immich.Asset {
+		return &immich.Asset{
+			OriginalFileName: name,
+			OriginalPath:     "upload/x.jpg",
+			ExifInfo:         immich.ExifInfo{FileSizeInByte: size, DateTimeOriginal: immich.ImmichTime{Time: date}},
+		}
+	}
+	a := asset("IMG_1", d, 100)
+	tests := []struct {
+		name string
+		b    *immich.Asset
+		want AdviceCode
+	}{
+		{name: "same", b: asset("img_1", d.Add(time.Minute), 100), want: SameOnServer},
+		{name: "smaller", b: asset("IMG_1", d, 50), want: SmallerOnServer},
+		{name: "larger", b: asset("IMG_1", d, 150), want: BetterOnServer},
+		{name: "other date", b: asset("IMG_1", d.Add(time.Hour), 100), want: NotOnServer},
+		{name: "other name", b: asset("IMG_2", d, 100), want: NotOnServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareAssets(a, tt.b, DefaultDateTolerance); got != tt.want {
+				t.Errorf("CompareAssets() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareDate(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		d2        time.Time
+		tolerance time.Duration
+		want      int
+	}{
+		{name: "same", d2: d, tolerance: DefaultDateTolerance, want: 0},
+		{name: "within", d2: d.Add(4 * time.Minute), tolerance: DefaultDateTolerance, want: 0},
+		{name: "limit", d2: d.Add(-5 * time.Minute), tolerance: DefaultDateTolerance, want: 0},
+		{name: "before", d2: d.Add(6 * time.Minute), tolerance: DefaultDateTolerance, want: -1},
+		{name: "after", d2: d.Add(-6 * time.Minute), tolerance: DefaultDateTolerance, want: +1},
+		{name: "burst", d2: d.Add(time.Second), tolerance: 0, want: -1},
+		{name: "exact second", d2: d.Add(300 * time.Millisecond), tolerance: 0, want: 0},
+		{name: "timezone shift", d2: d.Add(2 * time.Hour), tolerance: 2 * time.Hour, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareDate(d, tt.d2, tt.tolerance); got != tt.want {
+				t.Errorf("compareDate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldUploadResolution(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	ai := &AssetIndex{
+		assets: []*immich.Asset{
+			{
+				ID:               "server-1",
+				OriginalFileName: "PXL_20231006_063000",
+				OriginalPath:     "upload/PXL_20231006_063000.jpg",
+				ExifInfo: immich.ExifInfo{
+					FileSizeInByte:   2000,
+					DateTimeOriginal: immich.ImmichTime{Time: date},
+					ExifImageWidth:   2000,
+					ExifImageHeight:  1500,
+				},
+			},
+		},
+	}
+	ai.ReIndex()
+
+	tests := []struct {
+		name          string
+		size          int
+		width, height int
+		advice        AdviceCode
+	}{
+		{name: "higher resolution, fewer bytes", size: 1000, width: 4000, height: 3000, advice: SmallerOnServer},
+		{name: "lower resolution, more bytes", size: 3000, width: 1000, height: 750, advice: BetterOnServer},
+		{name: "rotated, more bytes", size: 3000, width: 1500, height: 2000, advice: SmallerOnServer},
+		{name: "same resolution, same bytes", size: 2000, width: 2000, height: 1500, advice: SameOnServer},
+		{name: "unknown resolution, fewer bytes", size: 1000, advice: BetterOnServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			la := &browser.LocalAssetFile{
+				FileName:  "PXL_20231006_063000.jpg",
+				Title:     "PXL_20231006_063000.jpg",
+				FileSize:  tt.size,
+				DateTaken: date,
+				Width:     tt.width,
+				Height:    tt.height,
+			}
+			advice, err := ai.ShouldUpload(la, DefaultDateTolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if advice.Advice != tt.advice {
+				t.Errorf("ShouldUpload() = %s, want %s: %s", advice.Advice, tt.advice, advice.Message)
+			}
+		})
+	}
+}
+
+func TestShouldUploadNameCase(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "jpg", OriginalFileName: "IMG_0001", OriginalPath: "upload/IMG_0001.JPG", ExifInfo: immich.ExifInfo{FileSizeInByte: 2000, DateTimeOriginal: immich.ImmichTime{Time: date}}},
+			{ID: "tiff", OriginalFileName: "scan", OriginalPath: "upload/scan.tiff", ExifInfo: immich.ExifInfo{FileSizeInByte: 2000, DateTimeOriginal: immich.ImmichTime{Time: date}}},
+		}
+	}
+
+	tests := []struct {
+		file      string
+		normalize bool
+		advice    AdviceCode
+	}{
+		{file: "img_0001.jpg", advice: BetterOnServer},
+		{file: "IMG_0001.jpeg", advice: NotOnServer},
+		{file: "IMG_0001.jpeg", normalize: true, advice: BetterOnServer},
+		{file: "Scan.TIF", advice: NotOnServer},
+		{file: "Scan.TIF", normalize: true, advice: BetterOnServer},
+		{file: "IMG_0001.png", normalize: true, advice: NotOnServer},
+	}
+	for _, tt := range tests {
+		ai := &AssetIndex{assets: server(), normalizeExt: tt.normalize}
+		ai.ReIndex()
+		la := &browser.LocalAssetFile{FileName: tt.file, Title: tt.file, FileSize: 1000, DateTaken: date}
+		advice, err := ai.ShouldUpload(la, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if advice.Advice != tt.advice {
+			t.Errorf("%s, normalize %v: ShouldUpload() = %s, want %s", tt.file, tt.normalize, advice.Advice, tt.advice)
+		}
+	}
+
+	// the files uploaded during the run are found with any case
+	ai := &AssetIndex{}
+	ai.ReIndex()
+	ai.AddLocalAsset(&browser.LocalAssetFile{FileName: "IMG_0002.JPG", Title: "IMG_0002.JPG", FileSize: 1000, DateTaken: date}, "uploaded")
+	advice, _ := ai.ShouldUpload(&browser.LocalAssetFile{FileName: "copy/img_0002.jpg", Title: "img_0002.jpg", FileSize: 500, DateTaken: date}, 0)
+	if advice.Advice != BetterOnServer || advice.ServerAsset.ID != "uploaded" {
+		t.Errorf("the uploaded file should be found, got %s", advice.Advice)
+	}
+}
@@ -0,0 +1,46 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// optionRequirement is the first version of the server supporting an option
+type optionRequirement struct {
+	option  string
+	used    func(app *UpCmd) bool
+	version immich.ServerVersion
+}
+
+// optionRequirements are the options needing a recent server
+var optionRequirements = []optionRequirement{
+	{option: "-external-library", used: func(app *UpCmd) bool { return app.ExternalLibrary != "" }, version: immich.ExternalLibraryVersion},
+	{option: "-tags", used: func(app *UpCmd) bool { return len(app.Tags) > 0 }, version: immich.TagsVersion},
+	{option: "-people-as-tags", used: func(app *UpCmd) bool { return app.PeopleAsTags }, version: immich.TagsVersion},
+	{option: "-patch-metadata", used: func(app *UpCmd) bool { return app.PatchMetadata }, version: immich.AssetsMetadataVersion},
+}
+
+// checkServerCapabilities gets the version and the features of the server when the command starts,
+// and refuses the options the server doesn't support before any file is read
+func (app *UpCmd) checkServerCapabilities(ctx context.Context) error {
+	c, err := app.client.GetServerCapabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the version of the server: %w", err)
+	}
+	app.capabilities = c
+	for _, r := range optionRequirements {
+		if r.used(app) && !c.Version.AtLeast(r.version) {
+			return fmt.Errorf("the server %s doesn't support the option %s, %s or later is needed", c.Version, r.option, r.version)
+		}
+	}
+	if app.DeleteServer && !app.Permanent && c.FeatureDisabled(immich.FeatureTrash) {
+		server := "the server"
+		if app.server != "" {
+			server += " " + app.server
+		}
+		app.Journal.Warning("the trash is disabled on %s, the replaced assets are deleted permanently", server)
+	}
+	return nil
+}
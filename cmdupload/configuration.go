@@ -12,7 +12,11 @@ import (
 type Configuration struct {
 	SelectExtensions  StringList
 	ExcludeExtensions StringList
+	ExcludePaths      fshelper.PathPatterns
 	Recursive         bool
+	SidecarTypes      StringList // Extensions of the files attached to the assets having the same name
+
+	UnknownExtensions []string // Selected extensions unknown to immich-go, left to the server's decision
 }
 
 func (c *Configuration) IsValid() error {
@@ -22,15 +26,29 @@ func (c *Configuration) IsValid() error {
 	)
 
 	if c.SelectExtensions, err = checkExtensions(c.SelectExtensions); err != nil {
-		jerr = errors.Join(jerr, fmt.Errorf("some selected extensions are unknown: %w", err))
+		jerr = errors.Join(jerr, fmt.Errorf("invalid selected extensions: %w", err))
+	}
+	// The files having a selected extension are uploaded, even when immich-go doesn't know it
+	c.UnknownExtensions = nil
+	for _, e := range c.SelectExtensions {
+		if !fshelper.IsKnownExt(e) {
+			c.UnknownExtensions = append(c.UnknownExtensions, e)
+			fshelper.AddExtension(e)
+		}
 	}
 
-	c.ExcludeExtensions, _ = checkExtensions(c.ExcludeExtensions)
+	if c.ExcludeExtensions, err = checkExtensions(c.ExcludeExtensions); err != nil {
+		jerr = errors.Join(jerr, fmt.Errorf("invalid excluded extensions: %w", err))
+	}
+	if c.SidecarTypes, err = checkExtensions(c.SidecarTypes); err != nil {
+		jerr = errors.Join(jerr, fmt.Errorf("invalid sidecar types: %w", err))
+	}
 
 	return jerr
 
 }
 
+// checkExtensions normalizes the extensions like .jpg
 func checkExtensions(l StringList) (StringList, error) {
 	var (
 		r   StringList
@@ -38,12 +56,16 @@ func checkExtensions(l StringList) (StringList, error) {
 	)
 
 	for _, e := range l {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
 		if !strings.HasPrefix(e, ".") {
 			e = "." + e
 		}
-		e = strings.ToLower(e)
-		if _, err = fshelper.MimeFromExt(e); err != nil {
-			err = errors.Join(err, fmt.Errorf("unsupported extension '%s'", e))
+		if len(e) == 1 || strings.ContainsAny(e[1:], "./\\ ") {
+			err = errors.Join(err, fmt.Errorf("invalid extension '%s'", e))
+			continue
 		}
 		r = append(r, e)
 	}
@@ -78,3 +100,26 @@ func (sl StringList) Exclude(s string) bool {
 	}
 	return slices.Contains(sl, strings.ToLower(s))
 }
+
+// AlbumList is a list of album names given by repeating the option.
+// The names aren't split on commas, as album names can contain commas.
+type AlbumList []string
+
+func (al *AlbumList) Set(s string) error {
+	*al = append(*al, s)
+	return nil
+}
+
+func (al AlbumList) String() string {
+	return strings.Join(al, ", ")
+}
+
+// Contains tells if the name is in the list, ignoring the case when ci is set
+func (al AlbumList) Contains(name string, ci bool) bool {
+	for _, a := range al {
+		if a == name || ci && strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
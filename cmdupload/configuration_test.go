@@ -0,0 +1,34 @@
+package cmdupload
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigurationExtensions(t *testing.T) {
+	c := Configuration{
+		SelectExtensions:  StringList{"jpg", " .WEBP", "avif", ".jxl", ".xyz"},
+		ExcludeExtensions: StringList{".mp4"},
+		SidecarTypes:      StringList{".aae", "DOP"},
+	}
+	err := c.IsValid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (StringList{".jpg", ".webp", ".avif", ".jxl", ".xyz"}); !slices.Equal(c.SelectExtensions, expected) {
+		t.Errorf("expected selected extensions %v, got %v", expected, c.SelectExtensions)
+	}
+	if expected := (StringList{".aae", ".dop"}); !slices.Equal(c.SidecarTypes, expected) {
+		t.Errorf("expected sidecar types %v, got %v", expected, c.SidecarTypes)
+	}
+	if !slices.Equal(c.UnknownExtensions, []string{".xyz"}) {
+		t.Errorf("expected the unknown extensions [.xyz], got %v", c.UnknownExtensions)
+	}
+
+	for _, l := range []StringList{{"jpg", "a/b"}, {"."}, {".tar.gz"}} {
+		c := Configuration{ExcludeExtensions: l}
+		if err := c.IsValid(); err == nil {
+			t.Errorf("%v should be rejected", l)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cmdupload
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich/metadata"
+	"github.com/simulot/immich-go/logger"
+)
+
+// skipEmptyFile discards the file without content, often left by an incomplete extraction of a takeout
+func (app *UpCmd) skipEmptyFile(a *browser.LocalAssetFile) {
+	app.damagedFiles = append(app.damagedFiles, a.FileName+": empty file")
+	app.journalAsset(a, logger.EMPTY_FILE, "the file has no content, it isn't uploaded")
+}
+
+// truncatedFile reports the file whose content stops before its end, during -dry-run-open-check
+func (app *UpCmd) truncatedFile(a *browser.LocalAssetFile, err error) {
+	app.damagedFiles = append(app.damagedFiles, a.FileName+": truncated file")
+	app.journalAsset(a, logger.TRUNCATED, "the file is truncated: "+err.Error())
+}
+
+// isTruncated tells if the error comes from a content ending too early.
+// The PNG decoder reports it in the text of its format errors.
+func isTruncated(err error) bool {
+	return err != nil && (errors.Is(err, io.ErrUnexpectedEOF) || strings.HasSuffix(err.Error(), io.ErrUnexpectedEOF.Error()))
+}
+
+// decodeImage decodes the whole JPEG, PNG or GIF image, which detects the images missing their end
+func decodeImage(a *browser.LocalAssetFile) error {
+	if !metadata.CanReadImageSize(a.Ext()) {
+		return nil
+	}
+	f, err := a.FSys.Open(a.FileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return metadata.DecodeImage(f)
+}
+
+// reportDamagedFiles lists the empty and truncated files, to be downloaded again
+func (app *UpCmd) reportDamagedFiles() {
+	if len(app.damagedFiles) == 0 {
+		return
+	}
+	app.Journal.Warning("%6d files are empty or truncated, download them again:", len(app.damagedFiles))
+	for _, f := range app.damagedFiles {
+		app.Journal.Warning("  %s", f)
+	}
+}
@@ -0,0 +1,67 @@
+package cmdupload
+
+import (
+	"context"
+	"slices"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// favoriteFromRating marks as favorite the file rated 5 stars by its XMP sidecar,
+// like the favorites are rated in the generated sidecars
+func favoriteFromRating(a *browser.LocalAssetFile) {
+	if a.SideCar != nil && a.SideCar.Rating >= 5 {
+		a.Favorite = true
+	}
+}
+
+// markFavorite records the asset marked as favorite by -favorite-from-metadata or -favorite-album.
+// The uploaded files are favorites by their upload, the other assets are marked together at the end of the run.
+func (app *UpCmd) markFavorite(ID string, a *browser.LocalAssetFile, uploaded bool, reason string) {
+	if app.favorites == nil {
+		app.favorites = map[string]bool{}
+	}
+	if _, ok := app.favorites[ID]; ok {
+		return
+	}
+	app.favorites[ID] = !uploaded
+	app.journalAsset(a, logger.FAVORITE, reason)
+}
+
+// sourceFavorite marks the asset as favorite when the file is a favorite of the source,
+// unless the server's asset is already one
+func (app *UpCmd) sourceFavorite(ID string, a *browser.LocalAssetFile, sa *immich.Asset) {
+	switch {
+	case !a.Favorite || ID == "":
+	case sa == nil || sa.ID != ID:
+		app.markFavorite(ID, a, true, "favorite in the source")
+	case !sa.IsFavorite:
+		app.markFavorite(ID, a, false, "favorite in the source")
+	}
+}
+
+// setFavorites marks as favorites the assets recorded by markFavorite, in one call
+func (app *UpCmd) setFavorites(ctx context.Context) {
+	ids := []string{}
+	for id, pending := range app.favorites {
+		if pending {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if app.DryRun {
+		app.Journal.OK("  %d assets not marked as favorites, dry run mode", len(ids))
+		return
+	}
+	slices.Sort(ids)
+	err := app.callWithRetries(ctx, "Favorites", func() error {
+		return app.client.UpdateAssetsMetadata(ctx, ids, immich.AssetMetadataUpdate{Favorite: true})
+	})
+	if err != nil {
+		app.Journal.Error("can't mark %d assets as favorites: %s", len(ids), err)
+	}
+}
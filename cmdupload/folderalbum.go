@@ -0,0 +1,140 @@
+package cmdupload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/immich"
+)
+
+// albumTemplateData gives the tokens usable in the -album-name-template option.
+// Tokens that can't be resolved are empty.
+type albumTemplateData struct {
+	ParentDir      string // name of the folder containing the file
+	GrandparentDir string // name of the parent folder
+	Year           string // year of capture, ex: 2023
+	Month          string // month of capture, ex: 07
+	Day            string // day of capture, ex: 14
+}
+
+// parseAlbumTemplate parses the album name template, and checks it with empty tokens
+func parseAlbumTemplate(text string) (*template.Template, error) {
+	t, err := template.New("album").Parse(text)
+	if err == nil {
+		err = t.Execute(io.Discard, albumTemplateData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid album name template: %w", err)
+	}
+	return t, nil
+}
+
+// folderAlbum gives the name of the album of an asset from its folder.
+// The name is built with the album name template when given, or it is made of
+// the last folders of the file's path, relative to the import root.
+func (app *UpCmd) folderAlbum(a *browser.LocalAssetFile) string {
+	d := albumTemplateData{
+		ParentDir:      dirName(path.Dir(a.FileName)),
+		GrandparentDir: dirName(path.Dir(path.Dir(a.FileName))),
+	}
+	if app.albumTemplate == nil {
+		return app.pathAlbum(a.FileName)
+	}
+	if !a.DateTaken.IsZero() {
+		d.Year = a.DateTaken.Format("2006")
+		d.Month = a.DateTaken.Format("01")
+		d.Day = a.DateTaken.Format("02")
+	}
+	b := strings.Builder{}
+	err := app.albumTemplate.Execute(&b, d)
+	name := strings.TrimSpace(b.String())
+	if err != nil || name == "" {
+		app.Journal.Debug("can't build the album name of %q with the template, use the folder's name", a.FileName)
+		return d.ParentDir
+	}
+	return name
+}
+
+// parseAlbumRegex compiles the regular expression of -album-from-filename-regex, that must have a group named album
+func parseAlbumRegex(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err == nil && re.SubexpIndex("album") < 0 {
+		err = errors.New("the group named album is missing, ex: (?P<album>[^_]+)")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for -album-from-filename-regex: %w", expr, err)
+	}
+	return re, nil
+}
+
+// filenameAlbum gives the album captured by -album-from-filename-regex in the file's name,
+// or "" when the name doesn't match
+func (app *UpCmd) filenameAlbum(a *browser.LocalAssetFile) string {
+	m := app.albumRegex.FindStringSubmatch(path.Base(a.FileName))
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[app.albumRegex.SubexpIndex("album")])
+}
+
+// pathAlbum joins the last AlbumPathDepth folders of the file's path
+func (app *UpCmd) pathAlbum(name string) string {
+	dir := path.Dir(name)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	folders := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	if depth := max(app.AlbumPathDepth, 1); len(folders) > depth {
+		folders = folders[len(folders)-depth:]
+	}
+	return strings.Join(folders, app.AlbumPathSeparator)
+}
+
+// dirName gives the base name of the directory, or "" for the root
+func dirName(dir string) string {
+	b := path.Base(dir)
+	if b == "." || b == "/" {
+		return ""
+	}
+	return b
+}
+
+// addFolderDescription records the path of the file in the source, written into the description
+// of the asset at the end of the run. The description found in the metadata, or already given
+// to the server's asset, is kept.
+func (app *UpCmd) addFolderDescription(ID string, a *browser.LocalAssetFile, sa *immich.Asset) {
+	if ID == "" || a.Description != "" || sa != nil && sa.ID == ID && sa.ExifInfo.Description != "" {
+		return
+	}
+	if app.folderDescs == nil {
+		app.folderDescs = map[string]string{}
+	}
+	app.folderDescs[ID] = a.FileName
+}
+
+// writeFolderDescriptions sets the description of the assets recorded by addFolderDescription
+func (app *UpCmd) writeFolderDescriptions(ctx context.Context) {
+	if app.DryRun {
+		app.Journal.OK("  %d descriptions not written, dry run mode", len(app.folderDescs))
+		return
+	}
+	ids := gen.MapKeys(app.folderDescs)
+	slices.Sort(ids)
+	for _, id := range ids {
+		err := app.callWithRetries(ctx, "Description of the asset "+id, func() error {
+			return app.client.SetAssetDescription(ctx, id, app.folderDescs[id])
+		})
+		if err != nil {
+			app.Journal.Error("can't set the description of the asset %s: %s", app.folderDescs[id], err)
+		}
+	}
+}
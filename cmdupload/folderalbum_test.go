@@ -0,0 +1,123 @@
+package cmdupload
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestFolderAlbum(t *testing.T) {
+	date := time.Date(2023, 7, 14, 10, 0, 0, 0, time.Local)
+	testCases := []struct {
+		template string
+		file     string
+		date     time.Time
+		expected string
+	}{
+		{template: "", file: "2023/2023-07 Holiday/photo.jpg", date: date, expected: "2023-07 Holiday"},
+		{template: "{{.GrandparentDir}} / {{.ParentDir}}", file: "2023/2023-07 Holiday/photo.jpg", date: date, expected: "2023 / 2023-07 Holiday"},
+		{template: "{{.Year}}-{{.Month}} {{.ParentDir}}", file: "Holiday/photo.jpg", date: date, expected: "2023-07 Holiday"},
+		{template: "{{.Year}}", file: "Holiday/photo.jpg", expected: "Holiday"},
+		{template: "{{.GrandparentDir}}", file: "photo.jpg", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.template+" "+tc.file, func(t *testing.T) {
+			args := []string{"TEST_DATA/folder/low"}
+			if tc.template != "" {
+				args = append([]string{"-album-name-template=" + tc.template}, args...)
+			}
+			app, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.template != "" && !app.CreateAlbumAfterFolder {
+				t.Errorf("the template should imply -create-album-folder")
+			}
+			got := app.folderAlbum(&browser.LocalAssetFile{FileName: tc.file, DateTaken: tc.date})
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestInvalidAlbumTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{{.ParentDir", "{{.Unknown}}"} {
+		_, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-album-name-template=" + tmpl, "TEST_DATA/folder/low"})
+		if err == nil {
+			t.Errorf("expected an error for the template %q", tmpl)
+		}
+	}
+}
+
+func TestPathAlbum(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		file     string
+		expected string
+	}{
+		{args: nil, file: "2023/Holiday/Beach/photo.jpg", expected: "Beach"},
+		{args: []string{"-album-path-depth=2"}, file: "2023/Holiday/Beach/photo.jpg", expected: "Holiday / Beach"},
+		{args: []string{"-album-path-depth=3"}, file: "2023/Holiday/Beach/photo.jpg", expected: "2023 / Holiday / Beach"},
+		{args: []string{"-album-path-depth=5"}, file: "2023/Holiday/Beach/photo.jpg", expected: "2023 / Holiday / Beach"},
+		{args: []string{"-album-path-depth=2", "-album-path-separator=-"}, file: "Holiday/Beach/photo.jpg", expected: "Holiday-Beach"},
+		{args: []string{"-album-path-depth=2"}, file: "photo.jpg", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " ")+" "+tc.file, func(t *testing.T) {
+			app, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, append(tc.args, "TEST_DATA/folder/low"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := app.folderAlbum(&browser.LocalAssetFile{FileName: tc.file})
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	_, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-album-path-depth=0", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Errorf("expected an error for a depth of 0")
+	}
+}
+
+func TestFilenameAlbum(t *testing.T) {
+	testCases := []struct {
+		regex    string
+		file     string
+		expected string
+	}{
+		{regex: `^\d{4}-\d{2}-\d{2}_(?P<album>[^_]+)_\d+`, file: "2023-07-04_Picnic_0001.jpg", expected: "Picnic"},
+		{regex: `^\d{4}-\d{2}-\d{2}_(?P<album>[^_]+)_\d+`, file: "2023/July/2023-07-04_Picnic_0002.jpg", expected: "Picnic"},
+		{regex: `^\d{4}-\d{2}-\d{2}_(?P<album>[^_]+)_\d+`, file: "PXL_20231006_063000139.jpg", expected: ""},
+		{regex: `^(?P<album>.+?)\s*-\s*\d+\.\w+$`, file: "Wedding Anna - 012.jpg", expected: "Wedding Anna"},
+		{regex: `^IMG_\d+_(?P<album>[[:alpha:]]+)\.`, file: "IMG_1234_Paris.JPG", expected: "Paris"},
+		{regex: `^IMG_\d+_(?P<album>[[:alpha:]]+)\.`, file: "IMG_1234.JPG", expected: ""},
+		{regex: `^(?P<date>\d{8})(?:_(?P<album>\w+))?\.`, file: "20230704.jpg", expected: ""},
+		{regex: `^(?P<date>\d{8})(?:_(?P<album>\w+))?\.`, file: "20230704_Picnic.jpg", expected: "Picnic"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.regex+" "+tc.file, func(t *testing.T) {
+			app, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-album-from-filename-regex=" + tc.regex, "TEST_DATA/folder/low"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := app.filenameAlbum(&browser.LocalAssetFile{FileName: tc.file})
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	for _, regex := range []string{`(?P<album>[^_]+`, `^\d{4}-\d{2}-\d{2}_([^_]+)`} {
+		_, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-album-from-filename-regex=" + regex, "TEST_DATA/folder/low"})
+		if err == nil {
+			t.Errorf("expected an error for the regular expression %q", regex)
+		}
+	}
+}
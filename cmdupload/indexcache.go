@@ -0,0 +1,133 @@
+package cmdupload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// DefaultIndexCacheTTL is the age of the cache forcing a full scan of the server's assets
+const DefaultIndexCacheTTL = 24 * time.Hour
+
+// serverIdentity is implemented by the clients giving the server's address and the user,
+// to select the cache of the server's assets
+type serverIdentity interface {
+	EndPoint() string
+	ValidateConnection(ctx context.Context) (immich.User, error)
+}
+
+// indexCache is the copy of the server's assets kept on disk between runs.
+// Only the assets updated since the previous run are asked to the server.
+type indexCache struct {
+	Server    string              `json:"server"`
+	User      string              `json:"user"`
+	Scanned   time.Time           `json:"scanned"`   // Time of the last full scan
+	Watermark time.Time           `json:"watermark"` // Most recent update of the assets, given by the server's clock
+	Assets    []*immich.Asset     `json:"assets"`    // All assets, archived and trashed included
+	AlbumIDs  map[string]string   `json:"albumIds,omitempty"`
+	InAlbums  map[string][]string `json:"inAlbums,omitempty"` // album IDs by asset ID
+}
+
+var notFileChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// indexCacheFile gives the name of the cache of the server in the folder
+func indexCacheFile(dir string, server string) string {
+	return filepath.Join(dir, notFileChars.ReplaceAllString(server, "_")+".json")
+}
+
+// loadIndexCache reads the cache of the server.
+// It returns nil and the reason when the cache can't be used for the server and the user.
+func loadIndexCache(name string, server string, user string, ttl time.Duration, now time.Time) (*indexCache, string) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "no cache"
+	}
+	if err != nil {
+		return nil, err.Error()
+	}
+	c := indexCache{}
+	err = json.Unmarshal(b, &c)
+	switch {
+	case err != nil:
+		return nil, fmt.Sprintf("invalid cache: %s", err)
+	case c.Server != server || c.User != user:
+		return nil, "the server or the user has changed"
+	case ttl > 0 && now.Sub(c.Scanned) > ttl:
+		return nil, "the cache is too old"
+	}
+	return &c, ""
+}
+
+// merge replaces the cached assets by the updated ones
+func (c *indexCache) merge(updated []*immich.Asset) {
+	byID := map[string]int{}
+	for i, a := range c.Assets {
+		byID[a.ID] = i
+	}
+	for _, a := range updated {
+		if i, ok := byID[a.ID]; ok {
+			c.Assets[i] = a
+		} else {
+			byID[a.ID] = len(c.Assets)
+			c.Assets = append(c.Assets, a)
+		}
+		if a.UpdatedAt.After(c.Watermark) {
+			c.Watermark = a.UpdatedAt.Time
+		}
+	}
+}
+
+// setAlbums keeps the albums of the assets indexed by IndexAlbums
+func (c *indexCache) setAlbums(ai *AssetIndex) {
+	c.AlbumIDs = ai.albumIDs
+	c.InAlbums = map[string][]string{}
+	for id, albums := range ai.inAlbums {
+		for al := range albums {
+			c.InAlbums[id] = append(c.InAlbums[id], al)
+		}
+		slices.Sort(c.InAlbums[id])
+	}
+}
+
+// albums restores the albums of the assets, false when they weren't cached
+func (c *indexCache) albums(ai *AssetIndex) bool {
+	if c.AlbumIDs == nil {
+		return false
+	}
+	ai.albumIDs = c.AlbumIDs
+	ai.inAlbums = map[string]map[string]any{}
+	for id, albums := range c.InAlbums {
+		ai.inAlbums[id] = map[string]any{}
+		for _, al := range albums {
+			ai.inAlbums[id][al] = nil
+		}
+	}
+	return true
+}
+
+// save writes the cache, replacing the previous one only when complete
+func (c *indexCache) save(name string) error {
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
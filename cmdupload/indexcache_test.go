@@ -0,0 +1,91 @@
+package cmdupload
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type icIndexCache struct {
+	stubIC
+	user   string
+	assets []*immich.Asset
+	after  []time.Time // UpdatedAfter of each call
+}
+
+func (c *icIndexCache) EndPoint() string { return "http://immich:2283/api" }
+
+func (c *icIndexCache) ValidateConnection(ctx context.Context) (immich.User, error) {
+	return immich.User{ID: c.user}, nil
+}
+
+func (c *icIndexCache) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	c.after = append(c.after, opt.UpdatedAfter)
+	for _, a := range c.assets {
+		if a.UpdatedAt.After(opt.UpdatedAfter) {
+			cp := *a
+			filter(&cp)
+		}
+	}
+	return nil
+}
+
+func TestIndexCache(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serverAsset := func(id string, updated time.Time) *immich.Asset {
+		return &immich.Asset{ID: id, OriginalFileName: id, OriginalPath: "upload/" + id + ".jpg", UpdatedAt: immich.ImmichTime{Time: updated}}
+	}
+	ic := &icIndexCache{
+		user:   "user1",
+		assets: []*immich.Asset{serverAsset("a1", t1), serverAsset("a2", t1.Add(time.Hour))},
+	}
+	dir := t.TempDir()
+	ctx := context.Background()
+	index := func(args ...string) []string {
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-index-cache=" + dir}, args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.waitAssetIndex(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, a := range app.AssetIndex.assets {
+			ids = append(ids, a.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	check := func(step string, ids []string, after time.Time, expected ...string) {
+		t.Helper()
+		if !slices.Equal(ids, expected) {
+			t.Errorf("%s: expected assets %v, got %v", step, expected, ids)
+		}
+		if got := ic.after[len(ic.after)-1]; !got.Equal(after) {
+			t.Errorf("%s: expected the assets updated after %s, got %s", step, after, got)
+		}
+	}
+
+	check("full scan", index(), time.Time{}, "a1", "a2")
+
+	// a1 is trashed, a3 is uploaded
+	ic.assets[0] = serverAsset("a1", t1.Add(2*time.Hour))
+	ic.assets[0].IsTrashed = true
+	ic.assets = append(ic.assets, serverAsset("a3", t1.Add(3*time.Hour)))
+	check("delta", index(), t1.Add(time.Hour), "a2", "a3")
+	check("no change", index(), t1.Add(3*time.Hour), "a2", "a3")
+
+	ic.user = "user2"
+	check("other user", index(), time.Time{}, "a2", "a3")
+	check("expired", index("-index-cache-ttl=1ns"), time.Time{}, "a2", "a3")
+
+	if l, _ := os.ReadDir(dir); len(l) != 1 || l[0].Name() != "http_immich_2283_api.json" {
+		t.Errorf("unexpected cache files %v", l)
+	}
+}
@@ -0,0 +1,131 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/mock"
+	"github.com/simulot/immich-go/logger"
+)
+
+// newMirrorClient connects to an additional server.
+// The mirror gets the device UUID, the API traces, the timeout, the connection settings and the resumable uploads of the main client.
+var newMirrorClient = func(ctx context.Context, server string, key string, main iClient) (iClient, error) {
+	ic, err := immich.NewImmichClient(strings.TrimSuffix(server, "/"), key, false)
+	if err != nil {
+		return nil, err
+	}
+	// the usual end point of the API is tried when the server doesn't give it
+	_ = ic.DiscoverEndPoint(ctx)
+	if mc, ok := main.(*immich.ImmichClient); ok {
+		ic.SetDeviceUUID(mc.DeviceUUID)
+		ic.EnableAppTrace(mc.ApiTrace)
+		ic.SetTimeout(mc.Timeout())
+		ic.SetMaxConnsPerHost(mc.MaxConnsPerHost())
+		ic.EnableHTTP2(mc.HTTP2())
+		ic.SetChunkedUpload(mc.ChunkedUpload())
+	}
+	err = ic.PingServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = ic.ValidateConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ic, nil
+}
+
+// addMirrors connects to the servers given by the -server and -key options.
+// Each mirror is a copy of the command with its own client, index of the server's assets, albums and stacks,
+// so the advice is given independently for each server.
+func (app *UpCmd) addMirrors(ctx context.Context, log logger.Logger) error {
+	if len(app.MirrorServers) != len(app.MirrorKeys) {
+		return fmt.Errorf("the options -server and -key must be given in pairs, got %d server(s) and %d key(s)", len(app.MirrorServers), len(app.MirrorKeys))
+	}
+	for i, server := range app.MirrorServers {
+		var ic iClient = mock.New()
+		if app.simulator == nil {
+			var err error
+			ic, err = newMirrorClient(ctx, server, app.MirrorKeys[i], app.client)
+			if err != nil {
+				return fmt.Errorf("can't connect to the server %s: %w", server, err)
+			}
+		}
+		if app.DeviceUUID != "" {
+			if c, ok := ic.(deviceUUIDSetter); ok {
+				c.SetDeviceUUID(app.DeviceUUID)
+			}
+		}
+		log.OK("Mirror server %s: OK", server)
+
+		m := app.newMirror(server, ic, log)
+		if err := m.checkServerCapabilities(ctx); err != nil {
+			return err
+		}
+		if err := m.resolveAlbumShares(ctx); err != nil {
+			return fmt.Errorf("server %s: %w", server, err)
+		}
+		m.startAssetIndex(ctx, log)
+		app.mirrors = append(app.mirrors, m)
+	}
+	return nil
+}
+
+// newMirror gives the command of a mirror server: the options of the main command, with its own client, journal and state of the run.
+// It is called before the main command starts the index of its server, while the state of the run is still empty.
+// The mirror shares the files seen in the source with the main command, the report, the progression and the resume journal are the main command's ones.
+func (app *UpCmd) newMirror(server string, ic iClient, log logger.Logger) *UpCmd {
+	m := *app
+	m.server = server
+	m.initRun(ic, log)
+	if m.simulator != nil {
+		// the simulated servers share the same address
+		m.IndexCache = ""
+		m.simulator = nil
+	}
+	m.mirrors = nil
+	m.fsys = nil
+	if app.stacks != nil {
+		m.stacks = stacking.NewStackBuilder().SetLivePhotos(app.StackLivePhotos)
+	}
+	m.uploadJournal = nil
+	m.report = nil
+	return &m
+}
+
+// servers gives the main server followed by the mirrors
+func (app *UpCmd) servers() []*UpCmd {
+	return append([]*UpCmd{app}, app.mirrors...)
+}
+
+// keepMirroredOnly keeps in the list of local files to delete those deleted by all mirrors:
+// a file is deleted only when it is uploaded on all servers.
+func (app *UpCmd) keepMirroredOnly() {
+	for _, m := range app.mirrors {
+		app.deleteLocalList = slices.DeleteFunc(app.deleteLocalList, func(a *browser.LocalAssetFile) bool {
+			return !slices.Contains(m.deleteLocalList, a)
+		})
+	}
+}
+
+// reportMirrors gives the tallies of each server
+func (app *UpCmd) reportMirrors() {
+	if len(app.mirrors) == 0 {
+		return
+	}
+	app.Journal.Summary("Uploads by server:")
+	for _, s := range app.servers() {
+		name := s.server
+		if name == "" {
+			name = "main server"
+		}
+		app.Journal.Summary("%6d uploaded, %d upgraded, %d already on the server, %d errors: %s",
+			s.Journal.Count(logger.UPLOADED), s.Journal.Count(logger.UPGRADED), s.Journal.Count(logger.SERVER_DUPLICATE), s.Journal.Count(logger.SERVER_ERROR), name)
+	}
+}
@@ -0,0 +1,84 @@
+package cmdupload
+
+import (
+	"context"
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+type icMirror struct {
+	icCatchUploadsAssets
+	server []*immich.Asset
+}
+
+func (c *icMirror) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.server {
+		filter(a)
+	}
+	return nil
+}
+
+func TestMirrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.jpg": {Data: make([]byte, 10)},
+		"b.jpg": {Data: make([]byte, 20)},
+	}
+	main := &icMirror{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}}
+	mirrors := map[string]*icMirror{
+		// a.jpg is already on this server
+		"http://b": {
+			icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+			server: []*immich.Asset{
+				{ID: "b-a", OriginalFileName: "a", OriginalPath: "upload/a.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10}},
+			},
+		},
+		"http://c": {icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}},
+	}
+	defer func(f func(context.Context, string, string, iClient) (iClient, error)) { newMirrorClient = f }(newMirrorClient)
+	newMirrorClient = func(ctx context.Context, server string, key string, _ iClient) (iClient, error) {
+		if key != "key-"+server[len("http://"):] {
+			t.Errorf("unexpected key %q for the server %s", key, server)
+		}
+		return mirrors[server], nil
+	}
+
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, main, logger.NoLogger{}, []string{"-server=http://b", "-key=key-b", "-server=http://c", "-key=key-c", "-album=Mirrored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[*icMirror][]string{
+		main:                {"a.jpg", "b.jpg"},
+		mirrors["http://b"]: {"b.jpg"},
+		mirrors["http://c"]: {"a.jpg", "b.jpg"},
+	}
+	for ic, want := range expected {
+		slices.Sort(ic.assets)
+		if !slices.Equal(ic.assets, want) {
+			t.Errorf("expected uploads %v, got %v", want, ic.assets)
+		}
+	}
+	if got := mirrors["http://b"].albums["Mirrored"]; !slices.Contains(got, "b-a") || !slices.Contains(got, "b.jpg") {
+		t.Errorf("the album of the mirror should contain its own asset IDs, got %v", got)
+	}
+	if app.mirrors[0].Journal.Count(logger.UPLOADED) != 1 || app.Journal.Count(logger.UPLOADED) != 2 {
+		t.Errorf("unexpected tallies: main %d, mirror %d", app.Journal.Count(logger.UPLOADED), app.mirrors[0].Journal.Count(logger.UPLOADED))
+	}
+}
+
+func TestMirrorsPairs(t *testing.T) {
+	_, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-server=http://b", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Error("a server without key should be rejected")
+	}
+}
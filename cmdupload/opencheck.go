@@ -0,0 +1,68 @@
+package cmdupload
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
+
+// openCheck verifies that the file can be uploaded, without sending anything to the server:
+// its whole content is read, which detects the truncated files of a takeout archive,
+// the JPEG, PNG and GIF images are decoded, and a date of capture must be known.
+// The truncated files are listed apart, they must be downloaded again.
+func (app *UpCmd) openCheck(a *browser.LocalAssetFile) {
+	problem := ""
+	readErr := readAll(a)
+	var decodeErr error
+	if readErr == nil {
+		decodeErr = a.ReadImageSize()
+		if decodeErr == nil {
+			decodeErr = decodeImage(a)
+		}
+	}
+	switch {
+	case isTruncated(readErr):
+		app.truncatedFile(a, readErr)
+		return
+	case isTruncated(decodeErr):
+		app.truncatedFile(a, decodeErr)
+		return
+	case readErr != nil:
+		problem = fmt.Sprintf("can't read the file: %s", readErr)
+	case decodeErr != nil:
+		problem = fmt.Sprintf("can't decode the image: %s", decodeErr)
+	case a.DateTaken.IsZero():
+		problem = "the date of capture is unknown"
+	}
+	if problem == "" {
+		app.journalAsset(a, logger.INFO, "the file is readable")
+		return
+	}
+	app.openProblems = append(app.openProblems, a.FileName+": "+problem)
+	app.journalAsset(a, logger.ERROR, problem)
+}
+
+// readAll reads the content of the file up to its end
+func readAll(a *browser.LocalAssetFile) error {
+	f, err := a.FSys.Open(a.FileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(io.Discard, f)
+	return err
+}
+
+// reportOpenCheck lists the files to fix before the real import
+func (app *UpCmd) reportOpenCheck() {
+	if len(app.openProblems) == 0 {
+		app.Journal.Summary("All the files can be uploaded")
+		return
+	}
+	app.Journal.Summary("%6d files to fix before the import:", len(app.openProblems))
+	for _, p := range app.openProblems {
+		app.Journal.Summary("  %s", p)
+	}
+}
@@ -0,0 +1,72 @@
+package cmdupload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestOpenCheck(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	err := png.Encode(b, image.NewGray(image.Rect(0, 0, 4, 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpg, err := os.ReadFile("TEST_DATA/bursts/3H2A0102.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"PXL_20230801_120000.png": {Data: b.Bytes(), ModTime: d},
+		"PXL_20230801_120001.jpg": {Data: []byte("not a JPEG"), ModTime: d},
+		"PXL_20230801_120002.png": {Data: b.Bytes()[:b.Len()-20], ModTime: d},
+		"PXL_20230801_120003.jpg": {Data: jpg[:len(jpg)/2], ModTime: d},
+		"PXL_20230801_120004.jpg": {Data: []byte{}, ModTime: d},
+		"undated.mp4":             {Data: make([]byte, 10)},
+	}
+	ic := &icNoScan{}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-dry-run-open-check"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) > 0 || ic.scanned {
+		t.Errorf("nothing should be uploaded nor scanned, got %v uploaded, scanned: %v", ic.assets, ic.scanned)
+	}
+	slices.Sort(app.openProblems)
+	expected := []string{
+		"PXL_20230801_120001.jpg: can't decode the image: image: unknown format",
+		"undated.mp4: the date of capture is unknown",
+	}
+	if !slices.Equal(app.openProblems, expected) {
+		t.Errorf("expected the problems %q, got %q", expected, app.openProblems)
+	}
+	slices.Sort(app.damagedFiles)
+	expected = []string{
+		"PXL_20230801_120002.png: truncated file",
+		"PXL_20230801_120003.jpg: truncated file",
+		"PXL_20230801_120004.jpg: empty file",
+	}
+	if !slices.Equal(app.damagedFiles, expected) {
+		t.Errorf("expected the damaged files %q, got %q", expected, app.damagedFiles)
+	}
+
+	_, err = NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-dry-run-open-check", "-server", "http://other", "-key", "k"})
+	if err == nil {
+		t.Error("the option -dry-run-open-check should be rejected with -server")
+	}
+}
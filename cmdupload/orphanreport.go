@@ -0,0 +1,77 @@
+package cmdupload
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// checkOrphanScope verifies that the comparison of -orphan-report is limited to an album or a date range
+func (app *UpCmd) checkOrphanScope() error {
+	if app.ImportIntoAlbum == "" && !app.DateRange.IsSet() {
+		return errors.New("the option -orphan-report needs a scope: give an album with -album, a date range with -date, -since, -after or -before, or both")
+	}
+	if app.OpenCheck || app.NoServerScan {
+		return errors.New("the option -orphan-report needs the server's assets, it can't be used with -dry-run-open-check or -no-server-scan")
+	}
+	if len(app.MirrorServers) > 0 {
+		return errors.New("the option -orphan-report can't be used with -server")
+	}
+	return nil
+}
+
+// writeOrphanReport writes the server's assets of the scope missing from the source into the file
+// given by -orphan-report, or on stdout for "-". Nothing is deleted.
+// The assets of all devices are compared, not only the ones uploaded by immich-go.
+func (app *UpCmd) writeOrphanReport(ctx context.Context) error {
+	orphans, err := app.missingFromSource(ctx, "")
+	if err != nil {
+		return err
+	}
+	if app.OrphanReport == "-" {
+		err = writeOrphans(os.Stdout, orphans)
+	} else {
+		var f *os.File
+		f, err = os.Create(app.OrphanReport)
+		if err != nil {
+			return err
+		}
+		err = writeOrphans(f, orphans)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		app.Journal.OK("The server has no asset missing from the source")
+	} else {
+		app.Journal.Warning("%d server assets missing from the source are listed in the orphan report", len(orphans))
+	}
+	return nil
+}
+
+// writeOrphans writes the assets as CSV, one line per asset after a header
+func writeOrphans(w io.Writer, orphans []*immich.Asset) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "path", "dateTaken", "size", "checksum", "device"})
+	for _, sa := range orphans {
+		_ = cw.Write([]string{
+			sa.ID,
+			sa.OriginalPath,
+			serverDate(sa).Format(time.RFC3339),
+			strconv.Itoa(sa.ExifInfo.FileSizeInByte),
+			sa.Checksum,
+			sa.DeviceID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
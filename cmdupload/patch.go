@@ -0,0 +1,95 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// metadataPatch is the metadata of a server's asset corrected by -patch-metadata
+type metadataPatch struct {
+	update      immich.AssetMetadataUpdate
+	description string
+}
+
+// checkMetadataPatch compares the metadata of the file with the ones of the server's asset matching it,
+// and records the corrections sent at the end of the run: the date of capture differing by more than
+// -date-tolerance, the missing GPS position, and the missing description.
+// The modification time of a file isn't a date of capture, it doesn't correct the server's date.
+func (app *UpCmd) checkMetadataPatch(a *browser.LocalAssetFile, sa *immich.Asset) {
+	p := metadataPatch{}
+	changes := []string{}
+	serverDate := sa.ExifInfo.DateTimeOriginal.Time
+	if !a.DateTaken.IsZero() && (serverDate.IsZero() || compareDate(a.DateTaken, serverDate, app.DateTolerance) != 0) {
+		if s, err := fs.Stat(a.FSys, a.FileName); err != nil || !s.ModTime().Equal(a.DateTaken) {
+			p.update.DateTimeOriginal = a.DateTaken
+			changes = append(changes, fmt.Sprintf("date %s", a.DateTaken.Format(time.DateTime)))
+		}
+	}
+	if !app.StripGPS && (a.Latitude != 0 || a.Longitude != 0) && sa.ExifInfo.Latitude == 0 && sa.ExifInfo.Longitude == 0 {
+		p.update.Latitude, p.update.Longitude = a.Latitude, a.Longitude
+		changes = append(changes, fmt.Sprintf("GPS %.6f,%.6f", a.Latitude, a.Longitude))
+	}
+	if a.Description != "" && sa.ExifInfo.Description == "" {
+		p.description = a.Description
+		changes = append(changes, "description")
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if app.metadataPatches == nil {
+		app.metadataPatches = map[string]metadataPatch{}
+	}
+	app.metadataPatches[sa.ID] = p
+	app.journalAsset(a, logger.METADATA_PATCHED, fmt.Sprintf("%s of the server's asset %s", strings.Join(changes, ", "), sa.ID))
+}
+
+// patchServerMetadata sends the corrections recorded by checkMetadataPatch.
+// The assets getting the same date and GPS position are updated together, the descriptions one by one.
+func (app *UpCmd) patchServerMetadata(ctx context.Context) {
+	if app.DryRun {
+		app.Journal.OK("  %d server's assets not corrected, dry run mode", len(app.metadataPatches))
+		return
+	}
+	groups := map[immich.AssetMetadataUpdate][]string{}
+	descriptions := []string{}
+	for id, p := range app.metadataPatches {
+		if p.update != (immich.AssetMetadataUpdate{}) {
+			groups[p.update] = append(groups[p.update], id)
+		}
+		if p.description != "" {
+			descriptions = append(descriptions, id)
+		}
+	}
+	updates := gen.MapKeys(groups)
+	slices.SortFunc(updates, func(a, b immich.AssetMetadataUpdate) int {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	})
+	for _, u := range updates {
+		ids := groups[u]
+		slices.Sort(ids)
+		err := app.callWithRetries(ctx, "Metadata of the assets", func() error {
+			return app.client.UpdateAssetsMetadata(ctx, ids, u)
+		})
+		if err != nil {
+			app.Journal.Error("can't correct the metadata of the assets %s: %s", strings.Join(ids, ", "), err)
+		}
+	}
+	slices.Sort(descriptions)
+	for _, id := range descriptions {
+		err := app.callWithRetries(ctx, "Description of the asset "+id, func() error {
+			return app.client.SetAssetDescription(ctx, id, app.metadataPatches[id].description)
+		})
+		if err != nil {
+			app.Journal.Error("can't set the description of the asset %s: %s", id, err)
+		}
+	}
+}
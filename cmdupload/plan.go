@@ -0,0 +1,287 @@
+package cmdupload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// plan is the list of the changes of the server decided by a run.
+// -dump-plan writes it without changing the server, -execute-plan performs exactly its actions.
+type plan struct {
+	Version int          `json:"version"`
+	Actions []planAction `json:"actions"`
+}
+
+// planVersion is the version of the format of the plan files
+const planVersion = 1
+
+// Kinds of plan actions
+const (
+	PlanUpload = "upload" // upload the file
+	PlanAlbum  = "album"  // add the assets to the album, created when missing
+	PlanTag    = "tag"    // tag the assets
+	PlanStack  = "stack"  // stack the assets, the first one being the cover
+	PlanDelete = "delete" // delete the server's assets replaced by the uploaded files
+)
+
+// planAction is an action of the plan. The assets are server's assets IDs,
+// or the files uploaded by the plan given by planFileRef followed by their path in the source.
+type planAction struct {
+	Action string   `json:"action"`
+	File   string   `json:"file,omitempty"`   // upload: the path of the file in the source
+	Name   string   `json:"name,omitempty"`   // album and tag: the name
+	Assets []string `json:"assets,omitempty"` // album, tag, stack and delete: the assets
+}
+
+// planFileRef prefixes the files uploaded by the plan in the assets of the actions
+const planFileRef = "file:"
+
+// checkPlanOptions verifies that -dump-plan and -execute-plan can be used with the other options
+func (app *UpCmd) checkPlanOptions() error {
+	if app.DumpPlan == "" && app.ExecutePlan == "" {
+		return nil
+	}
+	if app.DumpPlan != "" && app.ExecutePlan != "" {
+		return errors.New("the options -dump-plan and -execute-plan can't be used together")
+	}
+	option := "-dump-plan"
+	if app.ExecutePlan != "" {
+		option = "-execute-plan"
+	}
+	switch {
+	case app.syncing:
+		return fmt.Errorf("the option %s can't be used with the sync command", option)
+	case len(app.MirrorServers) > 0:
+		return fmt.Errorf("the option %s can't be used with -server", option)
+	case app.OpenCheck:
+		return fmt.Errorf("the option %s can't be used with -dry-run-open-check", option)
+	case app.Move || app.Delete:
+		return fmt.Errorf("the option %s can't be used with -move or -delete-local", option)
+	case app.PatchMetadata:
+		return fmt.Errorf("the option %s can't be used with -patch-metadata", option)
+	case app.FavoriteFromMetadata || app.FavoriteAlbum != "":
+		return fmt.Errorf("the option %s can't be used with -favorite-from-metadata or -favorite-album", option)
+	}
+	if app.DumpPlan != "" {
+		app.DryRun = true
+		app.planRefs = map[string]string{}
+		return nil
+	}
+	b, err := os.ReadFile(app.ExecutePlan)
+	if err != nil {
+		return fmt.Errorf("can't read the plan: %w", err)
+	}
+	p := plan{}
+	if err = json.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("can't read the plan %s: %w", app.ExecutePlan, err)
+	}
+	if p.Version != planVersion {
+		return fmt.Errorf("the plan %s has the version %d, expecting %d", app.ExecutePlan, p.Version, planVersion)
+	}
+	app.plan = &p
+	app.planRefs = map[string]string{}
+	for _, a := range p.Actions {
+		switch a.Action {
+		case PlanUpload:
+			app.planRefs[planFileRef+a.File] = ""
+		case PlanAlbum, PlanTag, PlanStack, PlanDelete:
+		default:
+			return fmt.Errorf("unknown action %q in the plan %s", a.Action, app.ExecutePlan)
+		}
+	}
+	return nil
+}
+
+// executingPlan tells if the run performs the plan given by -execute-plan
+func (app *UpCmd) executingPlan() bool {
+	return app.plan != nil
+}
+
+// planUpload records the upload of a file. When writing the plan, the ID given to the file by the dry run
+// refers to the file. When performing the plan, the file refers to the ID of the server's asset.
+func (app *UpCmd) planUpload(file string, ID string) {
+	switch {
+	case app.DumpPlan != "":
+		app.planRefs[ID] = planFileRef + file
+		app.planUploads = append(app.planUploads, file)
+	case app.executingPlan():
+		app.planRefs[planFileRef+file] = ID
+	}
+}
+
+// stacksToCreate gives the stacks of the uploaded assets having a kind enabled by the options
+func (app *UpCmd) stacksToCreate() []stacking.Stack {
+	if app.executingPlan() {
+		return app.planStacks
+	}
+	if !app.CreateStacks {
+		return nil
+	}
+	var stacks []stacking.Stack
+	for _, s := range app.stacks.Stacks() {
+		switch {
+		case !app.StackBurst && s.StackType == stacking.StackBurst:
+		case !app.StackJpgRaws && s.StackType == stacking.StackRawJpg:
+		case !app.StackLivePhotos && s.StackType == stacking.StackLivePhoto:
+		default:
+			stacks = append(stacks, s)
+		}
+	}
+	return stacks
+}
+
+// executePlanAsset uploads the file when it's in the plan, with its metadata.
+// The decisions of the plan replace the comparison with the server's assets and the options selecting the files.
+func (app *UpCmd) executePlanAsset(ctx context.Context, a *browser.LocalAssetFile) error {
+	if _, ok := app.planRefs[planFileRef+a.FileName]; !ok {
+		app.journalAsset(a, logger.NOT_SELECTED, "not in the plan")
+		return nil
+	}
+	if app.StripGPS {
+		app.stripGPS(a)
+	}
+	ID, err := app.UploadAsset(ctx, a)
+	if err != nil {
+		return nil
+	}
+	app.updateAssetMetadata(ctx, ID, a)
+	return nil
+}
+
+// buildPlan collects the actions decided by the dry run
+func (app *UpCmd) buildPlan() plan {
+	refs := func(ids []string) []string {
+		l := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if ref, ok := app.planRefs[id]; ok {
+				id = ref
+			}
+			l = append(l, id)
+		}
+		return l
+	}
+	p := plan{Version: planVersion, Actions: []planAction{}}
+	for _, f := range app.planUploads {
+		p.Actions = append(p.Actions, planAction{Action: PlanUpload, File: f})
+	}
+	albums := gen.MapKeys(app.updateAlbums)
+	slices.Sort(albums)
+	for _, album := range albums {
+		list := app.updateAlbums[album]
+		ids := []string{}
+		for _, id := range list.byRank() {
+			if !list[id].present {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			p.Actions = append(p.Actions, planAction{Action: PlanAlbum, Name: album, Assets: refs(ids)})
+		}
+	}
+	tags := gen.MapKeys(app.updateTags)
+	slices.Sort(tags)
+	for _, tag := range tags {
+		ids := gen.MapKeys(app.updateTags[tag])
+		slices.Sort(ids)
+		p.Actions = append(p.Actions, planAction{Action: PlanTag, Name: tag, Assets: refs(ids)})
+	}
+	for _, s := range app.stacksToCreate() {
+		ids := []string{s.CoverID}
+		for _, id := range s.IDs {
+			if id != s.CoverID {
+				ids = append(ids, id)
+			}
+		}
+		p.Actions = append(p.Actions, planAction{Action: PlanStack, Assets: refs(ids)})
+	}
+	if app.DeleteServer && len(app.deleteServerList) > 0 {
+		ids := []string{}
+		for _, sa := range app.deleteServerList {
+			ids = append(ids, sa.ID)
+		}
+		p.Actions = append(p.Actions, planAction{Action: PlanDelete, Assets: ids})
+	}
+	return p
+}
+
+// writePlan writes the plan into the file given by -dump-plan, or on stdout for "-"
+func (app *UpCmd) writePlan() error {
+	p := app.buildPlan()
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if app.DumpPlan == "-" {
+		_, err = os.Stdout.Write(b)
+	} else {
+		err = os.WriteFile(app.DumpPlan, b, 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("can't write the plan: %w", err)
+	}
+	app.Journal.OK("The plan of %d actions, %d uploads, is written into %s", len(p.Actions), len(app.planUploads), app.DumpPlan)
+	return nil
+}
+
+// applyPlan turns the actions of the plan following the uploads into the updates of the server.
+// The files of the plan that weren't uploaded are left out of the albums, tags and stacks.
+func (app *UpCmd) applyPlan() {
+	missing := 0
+	resolve := func(asset string) string {
+		if strings.HasPrefix(asset, planFileRef) {
+			return app.planRefs[asset]
+		}
+		return asset
+	}
+	ids := func(assets []string) []string {
+		l := []string{}
+		for _, a := range assets {
+			if id := resolve(a); id != "" {
+				l = append(l, id)
+			}
+		}
+		return l
+	}
+	for ref, id := range app.planRefs {
+		if id == "" {
+			missing++
+			app.Journal.Warning("%s of the plan wasn't uploaded", strings.TrimPrefix(ref, planFileRef))
+		}
+	}
+	for _, a := range app.plan.Actions {
+		switch a.Action {
+		case PlanAlbum:
+			for _, id := range ids(a.Assets) {
+				app.AddToAlbum(id, a.Name, nil)
+			}
+		case PlanTag:
+			for _, id := range ids(a.Assets) {
+				app.AddToTag(id, a.Name)
+			}
+		case PlanStack:
+			// the stack is left out when its cover wasn't uploaded
+			if l := ids(a.Assets); len(l) > 1 && l[0] == resolve(a.Assets[0]) {
+				app.planStacks = append(app.planStacks, stacking.Stack{CoverID: l[0], IDs: l, Names: a.Assets})
+			}
+		case PlanDelete:
+			for _, id := range ids(a.Assets) {
+				app.deleteServerList = append(app.deleteServerList, &immich.Asset{ID: id})
+			}
+		}
+	}
+	if missing > 0 {
+		app.Journal.Warning("%d files of the plan weren't uploaded, they are left out of the albums, tags and stacks", missing)
+	}
+}
@@ -0,0 +1,211 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/logger"
+)
+
+// ProgressMode selects how the progression of the upload is displayed
+type ProgressMode int
+
+const (
+	ProgressNone  ProgressMode = iota // no progression
+	ProgressPlain                     // a line from time to time, suitable for log files
+	ProgressBar                       // a bar updated in place
+)
+
+func (m *ProgressMode) Set(s string) error {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "none":
+		*m = ProgressNone
+	case "plain":
+		*m = ProgressPlain
+	case "bar":
+		*m = ProgressBar
+	default:
+		return fmt.Errorf("invalid progress mode %q, expecting bar, plain or none", s)
+	}
+	return nil
+}
+
+func (m ProgressMode) String() string {
+	switch m {
+	case ProgressPlain:
+		return "plain"
+	case ProgressBar:
+		return "bar"
+	}
+	return "none"
+}
+
+const (
+	barWidth          = 30
+	barInterval       = 200 * time.Millisecond // minimum delay between two updates of the bar
+	plainInterval     = 10 * time.Second       // minimum delay between two plain progress lines
+	throughputSmooth  = 0.2                    // weight of the last upload in the moving average of the throughput
+	minUploadDuration = time.Millisecond
+)
+
+// uploadProgress tracks the progression of the run in files and bytes.
+// The totals are measured before the upload, and grow when the browser gives more than expected.
+// The ETA is given by the remaining bytes and a moving average of the upload throughput.
+type uploadProgress struct {
+	mode ProgressMode
+	log  logger.Logger
+	now  func() time.Time
+
+	totalFiles    int
+	totalBytes    int64
+	doneFiles     int
+	doneBytes     int64
+	uploadedBytes int64
+	throughput    float64 // bytes per second, 0 until the first upload
+	lastDisplay   time.Time
+}
+
+func newUploadProgress(mode ProgressMode, log logger.Logger) *uploadProgress {
+	return &uploadProgress{
+		mode: mode,
+		log:  log,
+		now:  time.Now,
+	}
+}
+
+// measureSource counts the files and bytes to be processed.
+// With google photos, files present in several folders are counted once.
+func (app *UpCmd) measureSource(ctx context.Context, fsyss []fs.FS) error {
+	type fileKey struct {
+		name string
+		size int64
+	}
+	seen := map[fileKey]bool{}
+
+	for _, fsys := range fsyss {
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if d.IsDir() {
+				if !app.GooglePhotos && name != "." && app.BrowserConfig.ExcludePaths.Match(name) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			ext := path.Ext(name)
+			if _, err := fshelper.MimeFromExt(ext); err != nil {
+				return nil
+			}
+			if app.BrowserConfig.ExcludeExtensions.Exclude(ext) || !app.BrowserConfig.SelectExtensions.Include(ext) {
+				return nil
+			}
+			if !app.GooglePhotos && app.BrowserConfig.ExcludePaths.Match(name) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if app.GooglePhotos {
+				k := fileKey{name: strings.ToLower(path.Base(name)), size: info.Size()}
+				if seen[k] {
+					return nil
+				}
+				seen[k] = true
+			}
+			app.progress.totalFiles++
+			app.progress.totalBytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assetDone counts a file processed, uploaded or not
+func (p *uploadProgress) assetDone(size int64) {
+	if p == nil {
+		return
+	}
+	p.doneFiles++
+	p.doneBytes += size
+	p.totalFiles = max(p.totalFiles, p.doneFiles)
+	p.totalBytes = max(p.totalBytes, p.doneBytes)
+	p.display(false)
+}
+
+// uploadDone accounts the bytes sent to the server and updates the throughput
+func (p *uploadProgress) uploadDone(size int64, d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.uploadedBytes += size
+	rate := float64(size) / max(d, minUploadDuration).Seconds()
+	if p.throughput == 0 {
+		p.throughput = rate
+	} else {
+		p.throughput = throughputSmooth*rate + (1-throughputSmooth)*p.throughput
+	}
+}
+
+// eta estimates the remaining time, 0 when unknown
+func (p *uploadProgress) eta() time.Duration {
+	if p.throughput == 0 {
+		return 0
+	}
+	remaining := p.totalBytes - p.doneBytes
+	return time.Duration(float64(remaining) / p.throughput * float64(time.Second)).Round(time.Second)
+}
+
+func (p *uploadProgress) percent() int {
+	if p.totalBytes == 0 {
+		if p.totalFiles == 0 {
+			return 100
+		}
+		return 100 * p.doneFiles / p.totalFiles
+	}
+	return int(100 * p.doneBytes / p.totalBytes)
+}
+
+// String gives the progression, like 42% 120/300 files, 1.2 GB/2.9 GB, 0.8 GB uploaded at 3.1 MB/s, ETA 9m10s
+func (p *uploadProgress) String() string {
+	s := fmt.Sprintf("%3d%% %d/%d files, %s/%s", p.percent(), p.doneFiles, p.totalFiles, formatBytes(int(p.doneBytes)), formatBytes(int(p.totalBytes)))
+	if p.throughput > 0 {
+		s += fmt.Sprintf(", %s uploaded at %s/s, ETA %s", formatBytes(int(p.uploadedBytes)), formatBytes(int(p.throughput)), p.eta())
+	}
+	return s
+}
+
+// display shows the progression when the last display is old enough, or when forced
+func (p *uploadProgress) display(force bool) {
+	if p == nil || p.mode == ProgressNone {
+		return
+	}
+	interval := barInterval
+	if p.mode == ProgressPlain {
+		interval = plainInterval
+	}
+	now := p.now()
+	if !force && now.Sub(p.lastDisplay) < interval {
+		return
+	}
+	p.lastDisplay = now
+	switch p.mode {
+	case ProgressBar:
+		filled := barWidth * p.percent() / 100
+		p.log.Progress(logger.OK, "[%s%s] %s", strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled), p)
+	case ProgressPlain:
+		p.log.OK("Progress: %s", p)
+	}
+}
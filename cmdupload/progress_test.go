@@ -0,0 +1,123 @@
+package cmdupload
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestMeasureSource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photos/a.jpg":       {Data: make([]byte, 100)},
+		"photos/b.mp4":       {Data: make([]byte, 1000)},
+		"photos/b.mp4.json":  {Data: []byte("{}")},
+		"photos/readme.txt":  {Data: make([]byte, 10)},
+		"@eaDir/a.jpg":       {Data: make([]byte, 50)},
+		"album/a.jpg":        {Data: make([]byte, 100)},
+		"album/c.heic":       {Data: make([]byte, 10)},
+		"album/other/d.jpeg": {Data: make([]byte, 1)},
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantFiles int
+		wantBytes int64
+	}{
+		{name: "folder", args: []string{"-progress=plain"}, wantFiles: 6, wantBytes: 1261},
+		{name: "excluded-path", args: []string{"-progress=plain", "-exclude-path=@eaDir"}, wantFiles: 5, wantBytes: 1211},
+		{name: "excluded-type", args: []string{"-progress=plain", "-exclude-types=.mp4"}, wantFiles: 5, wantBytes: 261},
+		{name: "google-photos", args: []string{"-progress=plain", "-google-photos"}, wantFiles: 5, wantBytes: 1161},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.progress = newUploadProgress(app.Progress, logger.NoLogger{})
+			err = app.measureSource(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if app.progress.totalFiles != tt.wantFiles || app.progress.totalBytes != tt.wantBytes {
+				t.Errorf("measureSource() = %d files, %d bytes, want %d files, %d bytes", app.progress.totalFiles, app.progress.totalBytes, tt.wantFiles, tt.wantBytes)
+			}
+		})
+	}
+}
+
+type progressLogger struct {
+	logger.NoLogger
+	lines []string
+}
+
+func (l *progressLogger) Progress(level logger.Level, f string, v ...any) {
+	l.lines = append(l.lines, "progress")
+}
+
+func (l *progressLogger) OK(f string, v ...any) {
+	l.lines = append(l.lines, "ok")
+}
+
+func TestUploadProgress(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := &progressLogger{}
+	p := newUploadProgress(ProgressBar, log)
+	p.now = func() time.Time { return now }
+	p.totalFiles = 4
+	p.totalBytes = 4000
+
+	p.uploadDone(1000, time.Second)
+	p.assetDone(1000)
+	if p.percent() != 25 {
+		t.Errorf("percent() = %d, want 25", p.percent())
+	}
+	if p.eta() != 3*time.Second {
+		t.Errorf("eta() = %s, want 3s", p.eta())
+	}
+
+	// the moving average follows the throughput
+	p.uploadDone(1000, 100*time.Millisecond)
+	if p.throughput != 0.2*10000+0.8*1000 {
+		t.Errorf("throughput = %f, want 2800", p.throughput)
+	}
+
+	// the display is throttled
+	p.assetDone(1000)
+	now = now.Add(barInterval)
+	p.assetDone(1000)
+	if len(log.lines) != 2 {
+		t.Errorf("got %d displays, want 2", len(log.lines))
+	}
+
+	// totals grow when the source gives more than measured
+	p.assetDone(1000)
+	p.assetDone(500)
+	if p.totalFiles != 5 || p.totalBytes != 4500 || p.percent() != 100 {
+		t.Errorf("got %s, want 5 files, 4500 bytes and 100%%", p)
+	}
+
+	var none *uploadProgress
+	none.assetDone(10)
+	none.uploadDone(10, time.Second)
+	none.display(true)
+}
+
+func TestProgressMode(t *testing.T) {
+	for _, s := range []string{"bar", "plain", "none"} {
+		var m ProgressMode
+		if err := m.Set(s); err != nil || m.String() != s {
+			t.Errorf("Set(%q) = %s, %v", s, m, err)
+		}
+	}
+	var m ProgressMode
+	if err := m.Set("fancy"); err == nil {
+		t.Error("Set(\"fancy\") should fail")
+	}
+}
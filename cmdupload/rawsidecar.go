@@ -0,0 +1,48 @@
+package cmdupload
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich/metadata"
+	"github.com/simulot/immich-go/logger"
+)
+
+// rawExtensions are the RAW files given a sidecar with their EXIF by -copy-exif-to-sidecar
+var rawExtensions = []string{".3fr", ".arw", ".cr2", ".cr3", ".dcr", ".dng", ".erf", ".iiq", ".kdc", ".nef", ".nrw", ".orf", ".pef", ".raf", ".rw2", ".rwl", ".sr2", ".srf", ".srw"}
+
+// copyExifToSidecar tells if the EXIF of the file is copied into a generated sidecar.
+// A sidecar found next to the file is uploaded as is.
+func (app *UpCmd) copyExifToSidecar(a *browser.LocalAssetFile) bool {
+	return app.CopyExifToSidecar && a.FSys != nil && slices.Contains(rawExtensions, strings.ToLower(a.Ext())) &&
+		(a.SideCar == nil || !a.SideCar.OnFSsys)
+}
+
+// exifSideCar reads the EXIF of the RAW file, and writes its date of capture, GPS position and orientation in the sidecar.
+// The date and the position known by other means are kept when the file doesn't give them.
+func (app *UpCmd) exifSideCar(a *browser.LocalAssetFile, sc *metadata.SideCar) {
+	md, err := metadata.GetFileMetaData(a.FSys, a.FileName)
+	if err != nil && md.DateTaken.IsZero() {
+		app.journalAsset(a, logger.INFO, fmt.Sprintf("can't read the EXIF for the sidecar: %s", err))
+		return
+	}
+	copied := []string{}
+	if !md.DateTaken.IsZero() {
+		sc.DateTaken = md.DateTaken
+		copied = append(copied, "date "+md.DateTaken.Format(time.DateTime))
+	}
+	if !app.StripGPS && (md.Latitude != 0 || md.Longitude != 0) {
+		sc.Latitude, sc.Longitude, sc.Elevation = md.Latitude, md.Longitude, md.Altitude
+		copied = append(copied, "GPS")
+	}
+	if md.Orientation > 0 {
+		sc.Orientation = md.Orientation
+		copied = append(copied, "orientation")
+	}
+	if len(copied) > 0 {
+		app.journalAsset(a, logger.EXIF_SIDECAR, strings.Join(copied, ", "))
+	}
+}
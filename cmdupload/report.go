@@ -0,0 +1,153 @@
+package cmdupload
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/simulot/immich-go/logger"
+)
+
+// runReport summarizes the run in a machine-readable form.
+// It is built along the run and written as JSON at the end.
+type runReport struct {
+	mut sync.Mutex
+
+	DryRun        bool            `json:"dryRun"`        // The counts are the changes planned by -dry-run
+	MediaCount    int             `json:"mediaCount"`    // Count of media on the source
+	MediaUploaded int             `json:"mediaUploaded"` // Count of uploaded medias
+	MediaFailed   int             `json:"mediaFailed"`   // Count of medias that couldn't be uploaded
+	MediaVerified int             `json:"mediaVerified"` // Count of uploads verified with the server's checksum
+	MediaMismatch int             `json:"mediaMismatch"` // Count of uploads not matching the server's checksum
+	Advices       map[string]int  `json:"advices"`       // Count of files by advice
+	ServerDeleted int             `json:"serverDeleted"` // Count of server's assets deleted
+	LocalDeleted  int             `json:"localDeleted"`  // Count of local files deleted
+	AlbumsCreated int             `json:"albumsCreated"`
+	AlbumsUpdated int             `json:"albumsUpdated"`
+	Failures      []reportFailure `json:"failures"`
+	Aborted       string          `json:"aborted"` // Reason of the abort of the run, empty when the run is complete
+	Orphans       int             `json:"orphans"` // Count of takeout files refused for lack of JSON metadata
+
+	Extensions map[string]logger.ExtensionStats `json:"extensions"` // Counts by file extension
+	Albums     map[string]reportAlbum           `json:"albums"`     // Assets sent to the albums by album name
+}
+
+type reportFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+type reportAlbum struct {
+	Added   int `json:"added"`   // Assets added to the album
+	Present int `json:"present"` // Assets already in the album
+	Errors  int `json:"errors"`  // Assets that couldn't be added
+}
+
+func newRunReport() *runReport {
+	return &runReport{
+		Advices:  map[string]int{},
+		Albums:   map[string]reportAlbum{},
+		Failures: []reportFailure{},
+	}
+}
+
+func (r *runReport) addAdvice(a AdviceCode) {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.Advices[a.String()]++
+}
+
+func (r *runReport) addFailure(file string, err string) {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.Failures = append(r.Failures, reportFailure{File: file, Error: err})
+}
+
+func (r *runReport) albumCreated() {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.AlbumsCreated++
+}
+
+func (r *runReport) albumUpdated() {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.AlbumsUpdated++
+}
+
+func (r *runReport) albumAssets(album string, stats reportAlbum) {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	// the server's albums having the same name are counted together
+	s := r.Albums[album]
+	s.Added += stats.Added
+	s.Present += stats.Present
+	s.Errors += stats.Errors
+	r.Albums[album] = s
+}
+
+func (r *runReport) aborted(err error) {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.Aborted = err.Error()
+}
+
+func (r *runReport) takeoutOrphans(n int) {
+	if r == nil {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.Orphans = n
+}
+
+func (r *runReport) write(w io.Writer) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeReport writes the report into the file given by the option -report, or on stdout for "-"
+func (app *UpCmd) writeReport() error {
+	app.report.MediaCount = int(atomic.LoadInt64(&app.mediaCount))
+	app.report.MediaUploaded = int(atomic.LoadInt64(&app.mediaUploaded))
+	app.report.MediaFailed = int(atomic.LoadInt64(&app.mediaFailed))
+	app.report.MediaVerified = app.mediaVerified
+	app.report.MediaMismatch = app.mediaMismatch
+	app.report.Extensions = app.Journal.Extensions()
+
+	if app.Report == "-" {
+		return app.report.write(os.Stdout)
+	}
+	f, err := os.Create(app.Report)
+	if err != nil {
+		return err
+	}
+	err = app.report.write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
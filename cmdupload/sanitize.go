@@ -0,0 +1,59 @@
+package cmdupload
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/logger"
+)
+
+// DefaultMaxFilenameLength is the usual limit of the file systems for a file name, in bytes
+const DefaultMaxFilenameLength = 255
+
+// illegalNameChars are the path separators and the characters refused by the Windows file systems
+const illegalNameChars = `/\:*?"<>|`
+
+// sanitizeName replaces the illegal characters, the control characters and the invalid UTF-8 bytes by _,
+// and shortens the name to maxLen bytes, keeping its extension and whole UTF-8 characters.
+// The spaces and dots ending the name before its extension are removed.
+func sanitizeName(name string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == utf8.RuneError || r < 0x20 || r == 0x7f || strings.ContainsRune(illegalNameChars, r) {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	name = b.String()
+	ext := path.Ext(name)
+	if len(ext) > maxLen/2 {
+		// a dot in a long name doesn't give an extension
+		ext = ""
+	}
+	base := strings.TrimRight(strings.TrimSuffix(name, ext), " .")
+	for len(base)+len(ext) > maxLen {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return base + ext
+}
+
+// sanitizeTitle gives to the asset a name accepted by the server, with -sanitize-names.
+// The original name is added to the description of the asset.
+func (app *UpCmd) sanitizeTitle(a *browser.LocalAssetFile) {
+	title := sanitizeName(a.Title, app.MaxFilenameLength)
+	if title == a.Title {
+		return
+	}
+	app.journalAsset(a, logger.NAME_SANITIZED, fmt.Sprintf("%q uploaded as %q", a.Title, title))
+	original := "Original file name: " + a.Title
+	if a.Description == "" {
+		a.Description = original
+	} else {
+		a.Description += "\n" + original
+	}
+	a.Title = title
+}
@@ -0,0 +1,82 @@
+package cmdupload
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestSanitizeName(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		maxLen   int
+		expected string
+	}{
+		{"IMG_0001.jpg", 255, "IMG_0001.jpg"},
+		{"Trip: Rome/Day 1?.jpg", 255, "Trip_ Rome_Day 1_.jpg"},
+		{"tab\there\x00.heic", 255, "tab_here_.heic"},
+		{"bad\xffbyte.jpg", 255, "bad_byte.jpg"},
+		{"trailing. .jpg", 255, "trailing.jpg"},
+		{strings.Repeat("a", 30) + ".jpeg", 20, strings.Repeat("a", 15) + ".jpeg"},
+		{strings.Repeat("é", 10) + ".jpg", 20, strings.Repeat("é", 8) + ".jpg"},
+		{"v1.0 of a very long name without extension", 20, "v1.0 of a very long "},
+	} {
+		if got := sanitizeName(c.name, c.maxLen); got != c.expected {
+			t.Errorf("sanitizeName(%q, %d): expected %q, got %q", c.name, c.maxLen, c.expected, got)
+		}
+	}
+}
+
+// icTitles records the names and the descriptions sent to the server
+type icTitles struct {
+	stubIC
+	titles       []string
+	descriptions map[string]string
+}
+
+func (c *icTitles) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.titles = append(c.titles, a.Title)
+	return immich.AssetResponse{ID: a.FileName}, nil
+}
+
+func (c *icTitles) UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*immich.Asset, error) {
+	c.descriptions[ID] = a.Description
+	return nil, nil
+}
+
+func TestSanitizeNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"PXL_20231006_063000139.jpg": {Data: []byte("photo")},
+		"Rome: day 1.jpg":            {Data: []byte("rome")},
+	}
+	ctx := context.Background()
+	ic := &icTitles{descriptions: map[string]string{}}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-sanitize-names"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ic.titles, ",") != "PXL_20231006_063000139.jpg,Rome_ day 1.jpg" {
+		t.Errorf("unexpected names on the server: %v", ic.titles)
+	}
+	if d := ic.descriptions["Rome: day 1.jpg"]; d != "Original file name: Rome: day 1.jpg" || len(ic.descriptions) != 1 {
+		t.Errorf("expected the original name in the description, got %v", ic.descriptions)
+	}
+	if n := app.Journal.Count(logger.NAME_SANITIZED); n != 1 {
+		t.Errorf("expected 1 name changed, got %d", n)
+	}
+
+	_, err = NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-sanitize-names", "-max-filename-length=8"})
+	if err == nil {
+		t.Error("an error is expected for a too short -max-filename-length")
+	}
+}
@@ -0,0 +1,176 @@
+package cmdupload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+// SyncCommand uploads the folders like the upload command, then moves to the trash
+// the server's assets of the scope that are no more in the folders.
+func SyncCommand(ctx context.Context, ic iClient, log logger.Logger, args []string) error {
+	app, err := NewSyncCmd(ctx, ic, log, args)
+	if err != nil {
+		return err
+	}
+	return app.runCommand(ctx)
+}
+
+// NewSyncCmd parses the options of the sync command, the ones of the upload command and -confirm-deletes
+func NewSyncCmd(ctx context.Context, ic iClient, log logger.Logger, args []string) (*UpCmd, error) {
+	return newUpCmd(ctx, ic, log, args, true)
+}
+
+// checkSyncScope verifies that the deletions of the sync command are limited to an album or a date range
+func (app *UpCmd) checkSyncScope() error {
+	if app.GooglePhotos {
+		return errors.New("the sync command can't be used with -google-photos, a takeout may not hold all the photos")
+	}
+	if app.ImportIntoAlbum == "" && !app.DateRange.IsSet() {
+		return errors.New("the sync command needs a scope: give an album with -album, a date range with -date, or both")
+	}
+	if len(app.BrowserConfig.ExcludePaths) > 0 {
+		return errors.New("the sync command can't be used with -exclude-path, the server's assets of the excluded files would be deleted")
+	}
+	return nil
+}
+
+// sourceKey identifies a local file by its upper case name and its size, like the device asset ID
+type sourceKey struct {
+	name string
+	size int64
+}
+
+// see records a file of the source, selected or not.
+// The server's assets matching it are kept, even when the file is excluded by the filters of the command:
+// the files are seen before the selection of their type, their size and their date of capture.
+func (app *UpCmd) see(a *browser.LocalAssetFile) {
+	name := strings.ToUpper(path.Base(a.Title))
+	app.seenFiles[sourceKey{name: name, size: a.Size()}] = true
+	app.seenFiles[sourceKey{name: name, size: -1}] = true
+}
+
+// tracksSource tells if the files of the source are recorded to find the server's assets missing from it
+func (app *UpCmd) tracksSource() bool {
+	return app.syncing || app.OrphanReport != ""
+}
+
+// inSource tells if a server's asset has been matched with a file of the source,
+// or if the source has a file of the same name and size.
+// Only the name is compared when the server doesn't give the size.
+func (app *UpCmd) inSource(sa *immich.Asset) bool {
+	if app.matchedAssets[sa.ID] {
+		return true
+	}
+	name := strings.ToUpper(path.Base(sa.OriginalFileName) + path.Ext(sa.OriginalPath))
+	size := int64(sa.ExifInfo.FileSizeInByte)
+	if size == 0 {
+		size = -1
+	}
+	return app.seenFiles[sourceKey{name: name, size: size}]
+}
+
+// deviceID gives the device of the assets uploaded by immich-go on this machine
+func (app *UpCmd) deviceID() string {
+	if app.DeviceUUID != "" {
+		return app.DeviceUUID
+	}
+	if c, ok := app.client.(*immich.ImmichClient); ok {
+		return c.DeviceUUID
+	}
+	h, _ := os.Hostname()
+	return h
+}
+
+// syncExtras gives the server's assets of the scope that are missing from the source.
+// The scope is made of the assets uploaded from this device, in the album given by -album
+// and captured in the -date range. The assets uploaded by other means are never in the scope.
+func (app *UpCmd) syncExtras(ctx context.Context) ([]*immich.Asset, error) {
+	return app.missingFromSource(ctx, app.deviceID())
+}
+
+// missingFromSource gives the server's assets in the album given by -album and captured in the date range,
+// that are missing from the source. Only the assets uploaded from the device are kept, unless device is empty.
+func (app *UpCmd) missingFromSource(ctx context.Context, device string) ([]*immich.Asset, error) {
+	var inAlbum map[string]bool
+	if app.ImportIntoAlbum != "" {
+		inAlbum = map[string]bool{}
+		albums, err := app.client.GetAllAlbums(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the album list from the server: %w", err)
+		}
+		id, byID := albumIDRef(app.ImportIntoAlbum)
+		for _, al := range albums {
+			if byID && al.ID != id || !byID && app.albumKey(al.AlbumName) != app.albumKey(app.ImportIntoAlbum) {
+				continue
+			}
+			content, err := app.client.GetAlbumInfo(ctx, al.ID)
+			if err != nil {
+				return nil, fmt.Errorf("can't get the assets of the album %q: %w", al.AlbumName, err)
+			}
+			for _, a := range content.Assets {
+				inAlbum[a.ID] = true
+			}
+		}
+	}
+
+	var extras []*immich.Asset
+	for _, sa := range app.AssetIndex.assets {
+		switch {
+		case sa.JustUploaded || sa.IsTrashed || (device != "" && sa.DeviceID != device):
+			continue
+		case inAlbum != nil && !inAlbum[sa.ID]:
+			continue
+		case app.DateRange.IsSet() && !app.DateRange.InRange(serverDate(sa)):
+			continue
+		case app.inSource(sa):
+			continue
+		}
+		extras = append(extras, sa)
+	}
+	return extras, nil
+}
+
+// syncServer lists the server's assets missing from the source, and moves them to the trash
+// when the deletions are confirmed with -confirm-deletes
+func (app *UpCmd) syncServer(ctx context.Context) error {
+	extras, err := app.syncExtras(ctx)
+	if err != nil {
+		return err
+	}
+	if len(extras) == 0 {
+		app.Journal.OK("The server has no asset missing from the source")
+		return nil
+	}
+	confirmed := app.ConfirmDeletes && !app.DryRun
+	ids := make([]string, 0, len(extras))
+	for _, sa := range extras {
+		ids = append(ids, sa.ID)
+		if confirmed {
+			app.Journal.Info("%s: missing from the source, moved to the trash", sa.OriginalPath)
+		} else {
+			app.Journal.Warning("%s: missing from the source, would be moved to the trash", sa.OriginalPath)
+		}
+	}
+	if !confirmed {
+		app.Journal.Warning("%d server assets missing from the source are kept, use -confirm-deletes to move them to the trash", len(extras))
+		return nil
+	}
+	return app.DeleteServerAssets(ctx, ids)
+}
+
+// serverDate gives the date of capture of a server's asset, or the date of its file when unknown
+func serverDate(sa *immich.Asset) time.Time {
+	if !sa.ExifInfo.DateTimeOriginal.IsZero() {
+		return sa.ExifInfo.DateTimeOriginal.Time
+	}
+	return sa.FileCreatedAt.Time
+}
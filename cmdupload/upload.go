@@ -4,25 +4,40 @@ package cmdupload
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"math"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/browser/files"
 	"github.com/simulot/immich-go/browser/gp"
+	"github.com/simulot/immich-go/helpers/exiftool"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/geocoding"
+	"github.com/simulot/immich-go/helpers/hashcache"
 	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/helpers/ratelimit"
+	"github.com/simulot/immich-go/helpers/shutdown"
 	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/immich/metadata"
+	"github.com/simulot/immich-go/immich/mock"
+	"github.com/simulot/immich-go/ui"
 
 	"github.com/simulot/immich-go/logger"
 )
@@ -37,9 +52,31 @@ type iClient interface {
 	GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error)
 	AddAssetToAlbum(context.Context, string, []string) ([]immich.UpdateAlbumResult, error)
 	CreateAlbum(context.Context, string, []string) (immich.AlbumSimplified, error)
+	GetAlbumInfo(context.Context, string) (immich.AlbumContent, error)
+	GetAlbumAssetIDs(context.Context, string) ([]string, error)
 	UpdateAssets(ctx context.Context, IDs []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentId string) error
 	StackAssets(ctx context.Context, cover string, IDs []string) error
 	UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*immich.Asset, error)
+	UpdateAssetsMetadata(ctx context.Context, IDs []string, m immich.AssetMetadataUpdate) error
+	SetAssetDescription(ctx context.Context, ID string, description string) error
+	GetAssetByID(ctx context.Context, ID string) (*immich.Asset, error)
+	GetAssetAlbums(ctx context.Context, ID string) ([]immich.AlbumSimplified, error)
+	TagAssets(ctx context.Context, tagName string, ids []string) ([]immich.TagAssetsResult, error)
+	SetAlbumCover(ctx context.Context, albumID string, assetID string) error
+	SetAlbumDescription(ctx context.Context, albumID string, description string) error
+	AddUsersToAlbum(ctx context.Context, albumID string, userIDs []string) error
+	CreateAlbumSharedLink(ctx context.Context, albumID string) (immich.SharedLink, error)
+	GetAllUsers(ctx context.Context) ([]immich.User, error)
+	GetServerCapabilities(ctx context.Context) (immich.ServerCapabilities, error)
+	ImportAsset(ctx context.Context, a *browser.LocalAssetFile, imp immich.AssetImport) (immich.AssetResponse, error)
+}
+
+// confirm asks the user to confirm an action
+var confirm = ui.ConfirmYesNo
+
+// deviceUUIDSetter is implemented by clients accepting a device UUID
+type deviceUUIDSetter interface {
+	SetDeviceUUID(string) *immich.ImmichClient
 }
 
 type UpCmd struct {
@@ -49,7 +86,8 @@ type UpCmd struct {
 	fsys []fs.FS // pseudo file system to browse
 
 	GooglePhotos           bool             // For reading Google Photos takeout files
-	Delete                 bool             // Delete original file after import
+	Delete                 bool             // Delete the local files at the end of the run, once on the server (Default: FALSE)
+	Move                   bool             // Delete each local file right after its upload (Default: FALSE)
 	CreateAlbumAfterFolder bool             // Create albums for assets based on the parent folder or a given name
 	ImportIntoAlbum        string           // All assets will be added to this album
 	PartnerAlbum           string           // Partner's assets will be added to this album
@@ -57,7 +95,10 @@ type UpCmd struct {
 	DeviceUUID             string           // Set a device UUID
 	Paths                  []string         // Path to explore
 	DateRange              immich.DateRange // Set capture date range
-	ImportFromAlbum        string           // Import assets from this albums
+	ImportFromAlbum        AlbumList        // Import assets from these albums
+	AlbumMatchCI           bool             // Match the names given by -from-album ignoring the case (Default: FALSE)
+	FlattenAlbums          bool             // Merge the albums whose names differ by spaces (Default: FALSE)
+	FlattenAlbumsCI        bool             // Merge also the albums whose names differ by case (Default: FALSE)
 	CreateAlbums           bool             // Create albums when exists in the source
 	KeepTrashed            bool             // Import trashed assets
 	KeepPartner            bool             // Import partner's assets
@@ -65,50 +106,293 @@ type UpCmd struct {
 	UseFolderAsAlbumName   bool             // Use folder's name instead of metadata's title as Album name
 	DryRun                 bool             // Display actions but don't change anything
 	ForceSidecar           bool             // Generate a sidecar file for each file (default: TRUE)
+	WriteXMPSidecars       bool             // Generate a sidecar file with all known metadata for each file (Default: FALSE)
 	CreateStacks           bool             // Stack jpg/raw/burst (Default: TRUE)
 	StackJpgRaws           bool             // Stack jpg/raw (Default: TRUE)
 	StackBurst             bool             // Stack burst (Default: TRUE)
+	StackLivePhotos        bool             // Stack the photo and the video of live photos (Default: TRUE)
 	DiscardArchived        bool             // Don't import archived assets (Default: FALSE)
+	PreferEdited           bool             // Import only the edited version of photos (Default: FALSE)
+	PreferOriginal         bool             // Import only the original version of edited photos (Default: FALSE)
+	EditedSuffixes         StringList       // Suffixes of edited photos (Default: -edited and its translations)
+	UploadRetries          int              // Number of retries when an upload fails with a transient error (Default: 3)
+	RetryDelay             time.Duration    // Delay before the first retry of an upload or an update, doubled at each attempt (Default: 1s)
+	UploadTimeout          time.Duration    // Base duration of an upload before it is aborted and retried, 0 for no limit (Default: 0)
+	UploadMinRate          ratelimit.Rate   // Slowest bandwidth accepted, extending the upload timeout with the file size (Default: 100KB/s)
+	ResumeJournal          string           // File where successful uploads are recorded for resuming an interrupted run
+	ResumeJournalReset     bool             // Truncate the resume journal before starting
+	CheckSum               bool             // Compare the checksum of local files with the server's ones (Default: FALSE)
+	AlbumBatchSize         int              // Maximum number of assets added to an album in one call (Default: 500)
+	ConcurrentAlbums       int              // Number of albums updated in parallel (Default: 4)
+	ConcurrentStacks       int              // Number of stacks created in parallel (Default: 4)
+	SkipExistingByAlbum    bool             // Don't add assets already in the target album (Default: FALSE)
+	AlbumByLocation        bool             // Create albums named after the city where the photo was taken (Default: FALSE)
+	IncludeArchived        bool             // Compare local files with server's archived assets (Default: TRUE)
+	NoServerScan           bool             // Don't get the server's assets, rely on the server's duplicate detection (Default: FALSE)
+	Report                 string           // Write a JSON report of the run into this file, "-" for stdout
+	AlbumNameTemplate      string           // Template of the album name for folder imports, ex: {{.Year}} - {{.ParentDir}}
+	AlbumPathDepth         int              // Number of folders of the path used for the album name (Default: 1)
+	AlbumPathSeparator     string           // Separator of the folders in the album name (Default: " / ")
+	MinFileSize            myflag.ByteSize  // Skip files smaller than this size
+	MaxFileSize            myflag.ByteSize  // Skip files larger than this size
+	VerifyUploads          SampleSize       // Number or percentage of uploads verified with the server's checksum (Default: 0)
+	VerifySeed             int64            // Seed of the random selection of verified uploads (Default: random)
+	Progress               ProgressMode     // Display of the progression: bar, plain or none (Default: none)
+	DateTolerance          time.Duration    // Difference accepted between the dates of capture of a file and a server's asset (Default: 5m)
+	MirrorServers          StringList       // Other servers receiving the same assets
+	Tags                   StringList       // Tags applied to the uploaded assets
+	PeopleAsTags           bool             // Tag the uploaded assets with the names of the people recognized by Google Photos (Default: FALSE)
+	MirrorKeys             StringList       // API keys of the other servers
+	NoExif                 bool             // Don't read the date of capture in the files (Default: FALSE)
+	SidecarFromFile        bool             // Upload the XMP files found next to the assets (Default: TRUE)
+	OverwriteServer        bool             // Replace the server's assets by the local files, whatever their sizes (Default: FALSE)
+	AssumeYes              bool             // Don't ask for confirmation (Default: FALSE)
+	TakeoutTimeZone        string           // Time zone of the dates of the takeout: an IANA name, or auto to use the GPS position (Default: local time zone)
 
 	BrowserConfig Configuration
+	S3            fshelper.S3Options // Access to the s3:// sources, completed by the AWS environment variables
+	Simulate      bool               // Use an in-memory server instead of the real one (Default: FALSE)
+	IndexCache    string             // Folder keeping the server's assets between runs
+	IndexCacheTTL time.Duration      // Age of the cache forcing a full scan (Default: 24h)
+	SimulateState string             // File keeping the state of the simulated server between runs
+
+	DeleteServer bool // Delete the server's assets replaced by the local files (Default: TRUE)
+	Permanent    bool // Delete the server's assets permanently instead of moving them to the trash (Default: FALSE)
+
+	AlbumCover string // Cover of the created albums: first, newest, oldest or a file name pattern (Default: chosen by the server)
+	OnConflict string // What to do with the files that can't be compared with a server's asset: skip, upload or ask (Default: upload)
+	HashCache  string // File keeping the checksums of the local files between runs
+
+	DateFallback string // Date used by -date for the files without date of capture: none or modtime (Default: none)
+
+	AlbumDescription string // Description of the album given by -album
+
+	StripGPS bool // Remove the GPS position from the uploaded files and sidecars (Default: FALSE)
+
+	AlbumFromFilenameRegex string // Regular expression giving the album of a file from its name, in the group named album
+
+	MaxErrors int // Number of upload errors stopping the run, 0 for no limit (Default: 0)
+
+	ExternalLibrary string // ID of the external library where the files are registered in place instead of being uploaded
+	ExternalPath    string // Path of the imported folder as seen by the server (Default: the absolute path of the folder)
+
+	ConfirmDeletes bool // sync command: move to the trash the server's assets missing from the source (Default: FALSE)
+
+	PreserveFolderStructure bool // Write the path of the file in the source into the description of the asset (Default: FALSE)
+
+	AssumeMetadataFromJSONOnly bool // Takeout files need a JSON with a date of capture, the dates and GPS positions come from the JSON only (Default: FALSE)
+
+	CompareResolution bool // Compare the dimensions of the images with the server's ones before their sizes in bytes (Default: FALSE)
+
+	AlbumImportExisting bool // Ask once for the assets of each existing album to update, and add only the missing ones (Default: FALSE)
+
+	OpenCheck bool // Read and check each file instead of uploading it, the server isn't scanned (Default: FALSE)
+
+	SelectAlbumsRegex  string // Import only the assets of the takeout albums whose names match
+	ExcludeAlbumsRegex string // Don't import the assets of the takeout albums whose names match
+
+	UseExifTool  bool   // Read the metadata of the files with exiftool (Default: FALSE)
+	ExifToolPath string // exiftool executable, empty for the one of the PATH
+
+	Since      myflag.Duration // Select the files captured during this duration before the run
+	DateAfter  string          // Select the files captured on or after this date
+	DateBefore string          // Select the files captured before this date
+
+	ChunkThreshold myflag.ByteSize // Size of the files uploaded by chunks to the servers supporting the resumable uploads, 0 for never
+	ChunkState     string          // File keeping the resumable uploads in progress between runs
+
+	OrphanReport string // Write the server's assets of the scope missing from the source into this file, - for the standard output
+
+	APIRetries int // Number of retries when an album, stack, tag or metadata update fails with a transient error (Default: 3)
+
+	SharedAlbumPrefix string // Prefix of the names of the takeout's shared albums, empty to keep their names
+
+	NormalizeExtensions bool // Match the .jpeg and .tif files with the server's .jpg and .tiff assets of the same name (Default: FALSE)
+
+	AlbumMergeStrategy string // Names of the takeout albums: metadata, folder, both or combined (Default: metadata)
+
+	VerifyMime string // Check that the extensions match the content of the files: none, log or fix (Default: none)
+
+	DumpPlan    string // Write the actions of the run into this JSON file without performing them, - for the standard output
+	ExecutePlan string // Perform the actions of the plan written by -dump-plan
+
+	Watch      bool          // After the first pass, upload the files added to the folders until the stop request (Default: FALSE)
+	WatchDelay time.Duration // Time during which a new file must keep the same size before its upload (Default: 2s)
+
+	SanitizeNames     bool // Replace the characters refused by the server in the names of the files, and shorten the long names (Default: FALSE)
+	MaxFilenameLength int  // Length in bytes of the names shortened by -sanitize-names (Default: 255)
+
+	ArchivePassword string // Password of the encrypted zip archives, never logged
+
+	ReplaceSmaller bool // Replace the server's assets smaller than the local files, and move them to the trash (Default: TRUE)
+
+	PatchMetadata bool // Correct the date, the GPS position and the description of the server's assets matching the files (Default: FALSE)
+
+	FavoriteFromMetadata bool   // Mark as favorites the assets starred in the source, even when they are already on the server (Default: FALSE)
+	FavoriteAlbum        string // Mark as favorites the assets added to this album
+
+	CopyExifToSidecar bool // Upload the RAW files with a sidecar giving the date, GPS position and orientation read from their EXIF (Default: FALSE)
+
+	AlbumShareWith  StringList // Users sharing the albums created by the run, given by email or ID
+	AlbumVisibility string     // Visibility of the albums created by the run: private, or link for a shared link (Default: private)
 
 	AssetIndex       *AssetIndex               // List of assets present on the server
 	deleteServerList []*immich.Asset           // List of server assets to remove
 	deleteLocalList  []*browser.LocalAssetFile // List of local assets to remove
-	mediaUploaded    int                       // Count uploaded medias
-	mediaCount       int                       // Count of media on the source
-	updateAlbums     map[string]map[string]any // track immich albums changes
+	mediaUploaded    int64                     // Count uploaded medias, updated atomically
+	mediaCount       int64                     // Count of media on the source, updated atomically
+	mediaFailed      int64                     // Count medias that couldn't be uploaded, updated atomically
+	apiFailed        int64                     // Count of album, stack, tag and metadata updates failed after their retries, updated atomically
+	mediaVerified    int                       // Count uploads verified with the server's checksum
+	mediaMismatch    int                       // Count uploads not matching the server's checksum
+	sparedFiles      int                       // Count of files found on the server without reading their content
+	sparedBytes      int64                     // Size of the files found on the server without reading their content
+	uploaded         []uploadedAsset           // Uploads to be verified
+	updateAlbums     map[string]albumAssets    // track immich albums changes
+	albumRank        int                       // Count of the assets added to the albums
+	stackCovers      map[string]string         // Cover of the created stacks by asset ID
+	hashCache        *hashcache.Cache          // Checksums of the local files kept by -hash-cache, nil when not used
+	undated          []string                  // Files excluded by -date because their date of capture is unknown
+	albumDescs       map[string]string         // Description of the albums found in the source by album name
+	updateTags       map[string]map[string]any // assets IDs by tag
+	abortRun         context.CancelCauseFunc   // Stops the run when -max-errors is reached, set by Run
+	syncing          bool                      // Run by the sync command
+	seenFiles        map[sourceKey]bool        // Files of the source seen by the sync command and -orphan-report
+	plan             *plan                     // Plan performed by -execute-plan
+	planRefs         map[string]string         // -dump-plan: file references by dry run ID, -execute-plan: IDs by file reference
+	planUploads      []string                  // Files uploaded by the plan written by -dump-plan
+	planStacks       []stacking.Stack          // Stacks of the plan performed by -execute-plan
+	matchedAssets    map[string]bool           // IDs of the server's assets matched with a file of the source
+	folderDescs      map[string]string         // Path of the files in the source by asset ID, for -preserve-folder-structure
+	metadataPatches  map[string]metadataPatch  // Corrections of the server's assets by asset ID, for -patch-metadata
+	favorites        map[string]bool           // Assets marked as favorites by ID, true when they are marked at the end of the run
+	capabilities     immich.ServerCapabilities // Version and features of the server, read when the command starts
+	albumShareUsers  []string                  // IDs of the users given by -album-share-with
+	albumShareNames  []string                  // Emails of the users given by -album-share-with
+	openProblems     []string                  // Files failing -dry-run-open-check, with the reason
+	damagedFiles     []string                  // Empty and truncated files, with the reason
 	stacks           *stacking.StackBuilder
+	uploadJournal    *uploadJournal // Assets uploaded by a previous run
+	assetIndexDone   chan struct{}  // Closed when the server's assets are indexed
+	assetIndexErr    error          // Error encountered while getting server's assets
+	throttle         time.Duration  // Pause before each upload when the server is overloaded
+	geocoder         *geocoding.Geocoder
+	report           *runReport         // Summary of the run
+	albumTemplate    *template.Template // Parsed AlbumNameTemplate
+	albumRegex       *regexp.Regexp     // Parsed AlbumFromFilenameRegex
+	selectAlbums     *regexp.Regexp     // Parsed SelectAlbumsRegex
+	excludeAlbums    *regexp.Regexp     // Parsed ExcludeAlbumsRegex
+	exifTool         *exiftool.Tool     // exiftool found for -use-exiftool, nil when not used
+	progress         *uploadProgress    // Progression of the run, nil when not displayed
+	server           string             // Address of a mirror server, empty for the main one
+	mirrors          []*UpCmd           // Other servers receiving the same assets
+	takeoutZone      *time.Location     // Parsed TakeoutTimeZone, nil for auto or the local zone
+	simulator        *mock.Client       // Simulated server, nil when using the real one
 }
 
 func NewUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string) (*UpCmd, error) {
+	return newUpCmd(ctx, ic, log, args, false)
+}
+
+// initRun gives the command its client, its journal and an empty state of the run
+func (app *UpCmd) initRun(ic iClient, log logger.Logger) {
+	app.client = ic
+	app.Journal = logger.NewJournal(log)
+	app.matchedAssets = map[string]bool{}
+	app.updateAlbums = map[string]albumAssets{}
+	app.updateTags = map[string]map[string]any{}
+}
+
+// newUpCmd parses the options of the upload command, and the ones of the sync command when syncing
+func newUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string, syncing bool) (*UpCmd, error) {
 	var err error
-	cmd := flag.NewFlagSet("upload", flag.ExitOnError)
+	name := "upload"
+	if syncing {
+		name = "sync"
+	}
+	cmd := flag.NewFlagSet(name, flag.ExitOnError)
 
 	app := UpCmd{
-		updateAlbums: map[string]map[string]any{},
-		Journal:      logger.NewJournal(log),
-		client:       ic,
+		syncing:   syncing,
+		seenFiles: map[sourceKey]bool{},
+		report:    newRunReport(),
 	}
+	app.initRun(ic, log)
+	app.BrowserConfig.SidecarTypes = slices.Clone(files.DefaultSidecarTypes)
 	cmd.BoolFunc(
 		"dry-run",
 		"display actions but don't touch source or destination",
 		myflag.BoolFlagFn(&app.DryRun, false))
+	cmd.BoolFunc(
+		"dry-run-open-check",
+		"Read each selected file completely, decode the dimensions of the images and check the date of capture, without scanning the server nor uploading. The files to fix are listed at the end (default FALSE)",
+		myflag.BoolFlagFn(&app.OpenCheck, false))
 	cmd.Var(&app.DateRange,
 		"date",
 		"Date of capture range.")
+	cmd.Var(&app.Since,
+		"since",
+		"Select the files captured during this duration before now, ex: 7d or 36h. Can't be used with -date, -after or -before")
+	cmd.StringVar(&app.DateAfter,
+		"after",
+		"",
+		"Select the files captured on or after this date, YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS+01:00. Can't be used with -date")
+	cmd.StringVar(&app.DateBefore,
+		"before",
+		"",
+		"Select the files captured before this date, YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS+01:00. Can't be used with -date")
+	cmd.StringVar(&app.DateFallback,
+		"date-fallback",
+		DateFallbackNone,
+		"Date compared with the -date range for the files without date of capture: none to exclude them, or modtime to use the file modification time")
+	cmd.StringVar(&app.DeviceUUID,
+		"device-uuid",
+		"",
+		"Set the device UUID used for the uploads. Use the same value on all machines importing the same files")
 	cmd.StringVar(&app.ImportIntoAlbum,
 		"album",
 		"",
-		"All assets will be added to this album.")
+		"All assets will be added to this album. Use id: followed by the ID of an existing album to target it whatever its name, when several albums have the same name")
+	cmd.StringVar(&app.AlbumDescription,
+		"album-description",
+		"",
+		"Description of the album given by -album. The description of an existing album is replaced")
 	cmd.BoolFunc(
 		"force-sidecar",
 		"Upload the photo and a sidecar file with known information like date and GPS coordinates. With google-photos, information comes from the metadata files. (DEFAULT false)",
 		myflag.BoolFlagFn(&app.ForceSidecar, false))
+	cmd.BoolFunc(
+		"write-xmp-sidecars",
+		"Upload the photo and a sidecar file with all known information: date, GPS coordinates, description, people, rating and orientation (DEFAULT false)",
+		myflag.BoolFlagFn(&app.WriteXMPSidecars, false))
+	cmd.BoolFunc(
+		"strip-gps",
+		"Remove the GPS position from the uploaded JPEG files and from the sidecars. The position embedded in the other formats is kept (DEFAULT false)",
+		myflag.BoolFlagFn(&app.StripGPS, false))
 	cmd.BoolFunc(
 		"create-album-folder",
 		" folder import only: Create albums for assets based on the parent folder",
 		myflag.BoolFlagFn(&app.CreateAlbumAfterFolder, false))
+	cmd.StringVar(&app.AlbumNameTemplate,
+		"album-name-template",
+		"",
+		" folder import only: Template of the album name, implies -create-album-folder. Tokens: {{.ParentDir}}, {{.GrandparentDir}}, {{.Year}}, {{.Month}}, {{.Day}}")
+	cmd.BoolFunc(
+		"preserve-folder-structure",
+		" folder import only: Write the path of the file in the imported folder into the description of the asset, unless the file or the server's asset has a description (DEFAULT false)",
+		myflag.BoolFlagFn(&app.PreserveFolderStructure, false))
+	cmd.StringVar(&app.AlbumFromFilenameRegex,
+		"album-from-filename-regex",
+		"",
+		" folder import only: Regular expression matching the file name, the files are added to the album captured by the group named album, ex: ^\\d{4}-\\d{2}-\\d{2}_(?P<album>[^_]+)_")
+	cmd.IntVar(&app.AlbumPathDepth,
+		"album-path-depth",
+		1,
+		" folder import only: Number of folders of the file's path joined to make the album name, ex: 3 gives 2023 / Holiday / Beach")
+	cmd.StringVar(&app.AlbumPathSeparator,
+		"album-path-separator",
+		" / ",
+		" folder import only: Separator of the folders in the album name")
 	cmd.BoolFunc(
 		"google-photos",
 		"Import GooglePhotos takeout zip files",
@@ -124,10 +408,38 @@ func NewUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string)
 	cmd.BoolFunc(
 		"keep-partner",
 		" google-photos only: Import also partner's items (default: TRUE)", myflag.BoolFlagFn(&app.KeepPartner, true))
-	cmd.StringVar(&app.ImportFromAlbum,
+	cmd.Var(&app.ImportFromAlbum,
 		"from-album",
+		" google-photos only: Import only from this album. Can be repeated to import from several albums")
+	cmd.BoolFunc(
+		"album-match-ci",
+		" google-photos only: Match the albums given by -from-album ignoring the case (default: FALSE)", myflag.BoolFlagFn(&app.AlbumMatchCI, false))
+	cmd.StringVar(&app.SelectAlbumsRegex,
+		"select-albums-regex",
+		"",
+		" google-photos only: Import only the assets of the albums whose names match this regular expression")
+	cmd.StringVar(&app.ExcludeAlbumsRegex,
+		"exclude-albums-regex",
+		"",
+		" google-photos only: Don't import the albums whose names match this regular expression, nor the assets belonging only to them")
+	cmd.StringVar(&app.SharedAlbumPrefix,
+		"shared-album-prefix",
 		"",
-		" google-photos only: Import only from this album")
+		" google-photos only: Prefix the names of the shared albums, to keep them apart from your own albums having the same names")
+	cmd.BoolFunc(
+		"normalize-extensions",
+		"Compare the files having the extensions .jpeg and .tif with the server's assets of the same name having the extensions .jpg and .tiff. The files are uploaded with their own names (default: FALSE)",
+		myflag.BoolFlagFn(&app.NormalizeExtensions, false))
+	cmd.StringVar(&app.VerifyMime,
+		"verify-mime",
+		VerifyMimeNone,
+		" folder import only: Read the first bytes of each file to check that its extension matches its content: none, log to report the mismatches, fix to upload the files with the extension of their content. The files having an unknown extension are recognized by their content. The files without extension are always recognized by their content")
+	cmd.BoolFunc(
+		"flatten-albums",
+		"Merge the albums whose names differ only by spaces, like \"Summer 2023\" and \"Summer  2023 \" (default: FALSE)", myflag.BoolFlagFn(&app.FlattenAlbums, false))
+	cmd.BoolFunc(
+		"flatten-albums-ci",
+		"With -flatten-albums, merge also the albums whose names differ by case (default: FALSE)", myflag.BoolFlagFn(&app.FlattenAlbumsCI, false))
 
 	cmd.BoolFunc(
 		"keep-untitled-albums",
@@ -136,10 +448,40 @@ func NewUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string)
 	cmd.BoolFunc(
 		"use-album-folder-as-name",
 		" google-photos only: Use folder name and ignore albums' title (default:FALSE)", myflag.BoolFlagFn(&app.UseFolderAsAlbumName, false))
+	cmd.StringVar(&app.AlbumMergeStrategy,
+		"album-merge-strategy",
+		AlbumMergeMetadata,
+		" google-photos only: Name of the albums whose title differs from their folder: metadata for the title, folder for the name of the folder, both to add the assets to both albums, combined for \"title (folder)\". -use-album-folder-as-name is the same as folder")
 
 	cmd.BoolFunc(
 		"discard-archived",
 		" google-photos only: Do not import archived photos (default FALSE)", myflag.BoolFlagFn(&app.DiscardArchived, false))
+	cmd.BoolFunc(
+		"keep-archived",
+		" google-photos only: Import archived photos, and archive them on the server. Same as -discard-archived=false (default TRUE)", func(s string) error {
+			var keep bool
+			err := myflag.BoolFlagFn(&keep, true)(s)
+			app.DiscardArchived = !keep
+			return err
+		})
+	cmd.BoolFunc(
+		"prefer-edited",
+		" google-photos only: When a photo and its edited version are present, import only the edited version (default FALSE)", myflag.BoolFlagFn(&app.PreferEdited, false))
+	cmd.BoolFunc(
+		"prefer-original",
+		" google-photos only: When a photo and its edited version are present, import only the original (default FALSE)", myflag.BoolFlagFn(&app.PreferOriginal, false))
+	cmd.BoolFunc(
+		"people-as-tags",
+		" google-photos only: Tag the uploaded assets with the names of the people recognized by Google Photos (default FALSE)", myflag.BoolFlagFn(&app.PeopleAsTags, false))
+	cmd.Var(&app.EditedSuffixes, "edited-suffixes", " google-photos only: list of suffixes of edited photos separated by a comma (default: -edited and its translations)")
+	cmd.StringVar(&app.TakeoutTimeZone,
+		"takeout-timezone",
+		"",
+		" google-photos only: Time zone of the dates of capture, like Europe/Paris. Use auto to get the zone from the GPS position of the photos (default: local time zone)")
+	cmd.BoolFunc(
+		"assume-metadata-from-json-only",
+		" google-photos only: Refuse the files without JSON or without date of capture in their JSON, and give the server the dates and the GPS positions of the JSON files, not the ones of the files (default: FALSE)",
+		myflag.BoolFlagFn(&app.AssumeMetadataFromJSONOnly, false))
 
 	cmd.BoolFunc(
 		"create-stacks",
@@ -151,11 +493,208 @@ func NewUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string)
 	cmd.BoolFunc(
 		"stack-burst",
 		"Control the stacking bursts (default TRUE)", myflag.BoolFlagFn(&app.StackBurst, true))
+	cmd.BoolFunc(
+		"stack-live-photos",
+		"Control the stacking of the photo and the video of live photos (default TRUE)", myflag.BoolFlagFn(&app.StackLivePhotos, true))
+
+	cmd.IntVar(&app.UploadRetries,
+		"upload-retries",
+		3,
+		"Number of retries when an upload fails because of a network or a server error")
+	cmd.IntVar(&app.APIRetries,
+		"api-retries",
+		3,
+		"Number of retries when an album, stack, tag or metadata update fails because of a network or a server error, after the uploads. A failed album is reported and the others are updated")
+	cmd.IntVar(&app.MaxErrors,
+		"max-errors",
+		0,
+		"Stop the run when this number of uploads have failed, 0 for no limit. The albums, stacks and tags aren't updated after a stop")
+	cmd.StringVar(&app.ExternalLibrary,
+		"external-library",
+		"",
+		" folder import only: ID of an external library of the server. The files are registered in place in the library instead of being uploaded. The server must read them at the path given by -external-path")
+	cmd.StringVar(&app.ExternalPath,
+		"external-path",
+		"",
+		"Path of the imported folder as seen by the server, for -external-library (default: the absolute path of the folder)")
+	if syncing {
+		cmd.BoolFunc("confirm-deletes",
+			"Move to the trash the server's assets of the scope missing from the source. Without it, they are only listed",
+			myflag.BoolFlagFn(&app.ConfirmDeletes, false))
+	}
+	cmd.DurationVar(&app.RetryDelay,
+		"retry-delay",
+		time.Second,
+		"Delay before retrying a failed upload or update, doubled at each new attempt")
+	app.UploadMinRate = DefaultUploadMinRate
+	cmd.DurationVar(&app.UploadTimeout,
+		"upload-timeout",
+		0,
+		"Abort and retry an upload lasting longer than this duration, extended by the time needed to send the file at the -upload-min-rate bandwidth (default: no limit)")
+	cmd.Var(&app.ChunkThreshold, "chunk-threshold", "Upload the files larger than this size by chunks, ex: 500MB, when the server supports the resumable uploads. A failed upload is resumed where it stopped (default: never)")
+	cmd.StringVar(&app.ChunkState, "chunk-state", "", "File keeping the resumable uploads in progress, to resume them in the next run")
+	cmd.Var(&app.UploadMinRate, "upload-min-rate", "Slowest upload bandwidth accepted, ex: 100KB/s, to extend the -upload-timeout of the large files (default: 100KB/s)")
+	cmd.BoolFunc(
+		"checksum",
+		"Compute the checksum of each file and compare it with server's assets to detect duplicates. Slower but more accurate (default FALSE)", myflag.BoolFlagFn(&app.CheckSum, false))
+	cmd.IntVar(&app.AlbumBatchSize,
+		"album-batch",
+		500,
+		"Maximum number of assets added to an album in one request")
+	cmd.IntVar(&app.ConcurrentAlbums,
+		"concurrent-albums",
+		4,
+		"Number of albums created or updated in parallel")
+	cmd.IntVar(&app.ConcurrentStacks,
+		"concurrent-stacks",
+		4,
+		"Number of stacks created in parallel")
+	cmd.StringVar(&app.AlbumCover,
+		"album-cover",
+		"",
+		"Cover of the created albums: first, newest or oldest asset, or the first asset matching a file name pattern like *_cover.jpg (default: chosen by the server)")
+	cmd.BoolFunc(
+		"album-by-location",
+		" folder import only: Create albums named after the city near the GPS position of the photo (default FALSE)", myflag.BoolFlagFn(&app.AlbumByLocation, false))
+	cmd.BoolFunc(
+		"include-archived",
+		"Compare local files with server's archived assets. When false, an asset archived on the server is ignored, and the local file can be uploaded again (default TRUE)", myflag.BoolFlagFn(&app.IncludeArchived, true))
+	cmd.BoolFunc(
+		"exclude-archived",
+		"Ignore server's archived assets, same as -include-archived=false (default FALSE)", func(s string) error {
+			var exclude bool
+			err := myflag.BoolFlagFn(&exclude, false)(s)
+			app.IncludeArchived = !exclude
+			return err
+		})
+	cmd.BoolFunc(
+		"no-server-scan",
+		"Don't get the list of server's assets before uploading. Faster when all files are new, the server discards the duplicates (default FALSE)", myflag.BoolFlagFn(&app.NoServerScan, false))
+	cmd.BoolFunc(
+		"skip-existing-by-album",
+		"Read the content of server's albums to avoid adding assets already in the target album (default FALSE)", myflag.BoolFlagFn(&app.SkipExistingByAlbum, false))
+	cmd.BoolFunc(
+		"album-import-existing",
+		"Ask the server for the assets of each existing album to update, once, and add only the missing ones. Faster than -skip-existing-by-album, which reads all the albums of the server (default FALSE)",
+		myflag.BoolFlagFn(&app.AlbumImportExisting, false))
+	cmd.StringVar(&app.Report,
+		"report",
+		"",
+		"Write a JSON summary of the run into this file, use - for the standard output")
+	cmd.StringVar(&app.OrphanReport,
+		"orphan-report",
+		"",
+		"Write into this CSV file the server's assets missing from the source, without deleting them. The comparison is limited to the album given by -album and to the date range given by -date, -since, -after or -before. Use - for the standard output")
+	cmd.StringVar(&app.DumpPlan,
+		"dump-plan",
+		"",
+		"Write into this JSON file the uploads, album and tag additions, stacks and deletions decided by the run, without performing them. Use - for the standard output")
+	cmd.StringVar(&app.ExecutePlan,
+		"execute-plan",
+		"",
+		"Perform exactly the actions of the plan written by -dump-plan, and reviewed or edited since. The source must be the same. The files of the source missing from the plan aren't uploaded")
+	cmd.BoolFunc(
+		"watch",
+		" folder import only: After the first pass, watch the folders and upload the files added to them, until Ctrl+C (default FALSE)", myflag.BoolFlagFn(&app.Watch, false))
+	cmd.DurationVar(&app.WatchDelay,
+		"watch-delay",
+		DefaultWatchDelay,
+		"Time during which a new file must keep the same size before its upload by -watch")
+	cmd.BoolFunc(
+		"sanitize-names",
+		"Replace the path separators, the characters refused by Windows and the control characters of the names sent to the server, and shorten the names longer than -max-filename-length. The original name is added to the description (default FALSE)", myflag.BoolFlagFn(&app.SanitizeNames, false))
+	cmd.IntVar(&app.MaxFilenameLength,
+		"max-filename-length",
+		DefaultMaxFilenameLength,
+		"Length in bytes of the names shortened by -sanitize-names, their extension being kept")
+	cmd.StringVar(&app.ResumeJournal,
+		"journal",
+		"",
+		"Record uploaded files into this file, and skip files already recorded. Allow resuming an interrupted upload")
+	cmd.BoolFunc(
+		"journal-reset",
+		"Truncate the journal file before starting (default FALSE)", myflag.BoolFlagFn(&app.ResumeJournalReset, false))
 
-	// cmd.BoolVar(&app.Delete, "delete", false, "Delete local assets after upload")
-
+	cmd.BoolFunc(
+		"delete-local",
+		" folder import only: Delete the local files at the end of the run, once uploaded or found on the server. Files skipped or failed are kept (default FALSE)", myflag.BoolFlagFn(&app.Delete, false))
+	cmd.BoolFunc(
+		"delete-server",
+		"Delete the server's assets replaced by better local files, or by -overwrite-server. When FALSE, both versions are kept on the server (default: TRUE)", myflag.BoolFlagFn(&app.DeleteServer, true))
+	cmd.BoolFunc(
+		"permanent",
+		"Delete the server's assets permanently instead of moving them to the trash (default: FALSE)", myflag.BoolFlagFn(&app.Permanent, false))
+	cmd.BoolFunc(
+		"move",
+		" folder import only: Delete each local file right after its upload is confirmed, and its checksum verified with -checksum or -verify-uploads. Files skipped or failed are kept (default FALSE)", myflag.BoolFlagFn(&app.Move, false))
+
+	cmd.Var(&app.VerifyUploads, "verify-uploads", "Compare the checksum of a sample of uploaded files with the server's one. Give a count like 20, or a percentage like 10%")
+	cmd.Int64Var(&app.VerifySeed, "verify-seed", 0, "Seed of the random selection of the uploads to verify, to verify the same sample again")
+	cmd.Var(&app.MirrorServers, "server", "Upload also to this server, given with its -key. Can be repeated to mirror the assets on several servers")
+	cmd.Var(&app.MirrorKeys, "key", "API key of the server given with -server")
+	cmd.DurationVar(&app.DateTolerance, "date-tolerance", DefaultDateTolerance, "Difference accepted between the dates of capture of a file and a server's asset having the same name, 0 requires the same second")
+	cmd.BoolFunc(
+		"compare-resolution",
+		"Compare the dimensions of the JPEG, PNG and GIF files with the server's assets having the same name and date: the image with the most pixels is kept, whatever its size in bytes (default: FALSE)",
+		myflag.BoolFlagFn(&app.CompareResolution, false))
+	cmd.BoolFunc(
+		"overwrite-server",
+		"Upload the files already on the server, and move the server's assets to the trash. Their albums are given to the uploaded assets (default: FALSE)", myflag.BoolFlagFn(&app.OverwriteServer, false))
+	cmd.BoolFunc(
+		"replace-smaller",
+		"Upload the files larger than the server's assets, and move the server's assets to the trash. When FALSE, the server's assets are kept and the replacements are only reported (default: TRUE)", myflag.BoolFlagFn(&app.ReplaceSmaller, true))
+	cmd.BoolFunc(
+		"patch-metadata",
+		"Correct the server's assets already matching the files with the metadata of the source: the date of capture differing by more than -date-tolerance, the missing GPS position and the missing description. The files aren't uploaded again (default: FALSE)", myflag.BoolFlagFn(&app.PatchMetadata, false))
+	cmd.BoolFunc(
+		"favorite-from-metadata",
+		"Mark as favorites the assets starred in the source, even when they are already on the server: the favorites of the Google Photos takeouts, and the files rated 5 stars by their XMP sidecar (default: FALSE)", myflag.BoolFlagFn(&app.FavoriteFromMetadata, false))
+	cmd.StringVar(&app.FavoriteAlbum, "favorite-album", "", "Mark as favorites the assets added to this album by the run")
+	cmd.BoolFunc("copy-exif-to-sidecar",
+		"Upload the RAW files with a sidecar giving the date of capture, the GPS position and the orientation read from their EXIF, for the RAW formats the server can't read (default: FALSE)", myflag.BoolFlagFn(&app.CopyExifToSidecar, false))
+	cmd.Var(&app.AlbumShareWith, "album-share-with", "Share the albums created by the run with these users, given by email or ID and separated by a comma")
+	cmd.StringVar(&app.AlbumVisibility,
+		"album-visibility",
+		AlbumVisibilityPrivate,
+		"Visibility of the albums created by the run: private, seen by their owner and the users of -album-share-with, or link to create a shared link giving access to anyone having it")
+	cmd.BoolFunc("yes", "When true, assume Yes to all actions", myflag.BoolFlagFn(&app.AssumeYes, false))
+	cmd.StringVar(&app.OnConflict,
+		"on-conflict",
+		OnConflictUpload,
+		"What to do with a file having the name of a server's asset, when their dates or sizes can't tell if they are the same: skip, upload, or ask")
+	cmd.Var(&app.Tags, "tags", "List of tags separated by a comma, applied to every uploaded asset")
+	cmd.Var(&app.Progress, "progress", "Display the progression with an ETA: bar, plain for log files, or none (default none)")
+	cmd.Var(&app.MinFileSize, "min-file-size", "Skip files smaller than this size, ex: 10KB")
+	cmd.Var(&app.MaxFileSize, "max-file-size", "Skip files larger than this size, ex: 2GB")
 	cmd.Var(&app.BrowserConfig.SelectExtensions, "select-types", "list of selected extensions separated by a comma")
 	cmd.Var(&app.BrowserConfig.ExcludeExtensions, "exclude-types", "list of excluded extensions separated by a comma")
+	cmd.BoolFunc(
+		"no-exif",
+		" folder import only: Don't read the date of capture and the GPS position in the files. The date is given by the file name, or the file's modification time. Faster, but less accurate (default: FALSE)", myflag.BoolFlagFn(&app.NoExif, false))
+	cmd.BoolFunc(
+		"use-exiftool",
+		" folder import only: Read the date of capture, the GPS position and the dimensions of the files with exiftool, that must be installed. The files of a folder are read by a single run of exiftool (default: FALSE)", myflag.BoolFlagFn(&app.UseExifTool, false))
+	cmd.StringVar(&app.ExifToolPath,
+		"exif-tool-path",
+		"",
+		" folder import only: Path of the exiftool executable used by -use-exiftool (default: exiftool found in the PATH)")
+	cmd.BoolFunc(
+		"sidecar-from-file",
+		" folder import only: Upload the XMP file found next to an asset, like IMG_1234.jpg.xmp or IMG_1234.xmp, instead of generating one. Its date of capture and GPS position take precedence over the ones of the file name (default: TRUE)", myflag.BoolFlagFn(&app.SidecarFromFile, true))
+	cmd.StringVar(&app.S3.Endpoint, "s3-endpoint", "", "URL of an S3 compatible service for the s3:// sources, like http://minio:9000 (default: AWS_ENDPOINT_URL, or AWS)")
+	cmd.StringVar(&app.S3.Region, "s3-region", "", "Region of the S3 buckets (default: AWS_REGION, or us-east-1)")
+	cmd.StringVar(&app.S3.AccessKey, "s3-access-key", "", "Access key of the S3 buckets (default: AWS_ACCESS_KEY_ID)")
+	cmd.StringVar(&app.S3.SecretKey, "s3-secret-key", "", "Secret key of the S3 buckets (default: AWS_SECRET_ACCESS_KEY)")
+	cmd.StringVar(&app.ArchivePassword, "archive-password", "", "Password of the zip archives encrypted with ZipCrypto or AES")
+	cmd.BoolFunc(
+		"simulate",
+		"Run the upload against an in-memory server instead of the real one, to check the effect of the options. The simulated server answers like the real one (default: FALSE)", myflag.BoolFlagFn(&app.Simulate, false))
+	cmd.StringVar(&app.SimulateState, "simulate-state", "", "File keeping the content of the simulated server between runs, so a second run finds the assets uploaded by the first one")
+	cmd.StringVar(&app.HashCache, "hash-cache", "", "File keeping the checksums of the local files between runs. The unchanged files aren't read again by -checksum and -verify-uploads")
+	cmd.StringVar(&app.IndexCache, "index-cache", "", "Folder keeping the list of the server's assets between runs. The next run asks only for the assets updated since")
+	cmd.DurationVar(&app.IndexCacheTTL, "index-cache-ttl", DefaultIndexCacheTTL, "Age of the cache of the server's assets forcing a full scan")
+	cmd.Var(&app.BrowserConfig.SidecarTypes, "ignore-sidecar-types", " folder import only: list of extensions separated by a comma of the files attached to the asset having the same name instead of being uploaded, added to .aae,.thm,.lrv,.xml")
+	cmd.Var(&app.BrowserConfig.ExcludePaths, "exclude-path", " folder import only: glob pattern of files or folders to ignore, ex: **/@eaDir. Can be repeated")
 
 	err = cmd.Parse(args)
 	if err != nil {
@@ -165,38 +704,446 @@ func NewUpCmd(ctx context.Context, ic iClient, log logger.Logger, args []string)
 	if err = app.BrowserConfig.IsValid(); err != nil {
 		return nil, err
 	}
+	if l := app.BrowserConfig.UnknownExtensions; len(l) > 0 {
+		log.Warning("The extensions %s are unknown to immich-go, the server may reject the files.", strings.Join(l, ", "))
+	}
+
+	if tz := app.TakeoutTimeZone; tz != "" && !strings.EqualFold(tz, "auto") {
+		app.takeoutZone, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for -takeout-timezone: %w", tz, err)
+		}
+	}
+
+	if app.HashCache != "" {
+		app.hashCache, err = hashcache.Open(app.HashCache)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the hash cache: %w", err)
+		}
+	}
+
+	if app.SimulateState != "" && !app.Simulate {
+		return nil, errors.New("the option -simulate-state requires -simulate")
+	}
+	if app.Simulate {
+		app.simulator = mock.New()
+		if app.SimulateState != "" {
+			err = app.simulator.LoadFile(app.SimulateState)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		app.client = app.simulator
+		log.Warning("The server is simulated, nothing is sent to the server.")
+	}
+
+	if app.ChunkState != "" && app.ChunkThreshold == 0 {
+		return nil, errors.New("the option -chunk-state requires -chunk-threshold")
+	}
+	if c, ok := app.client.(*immich.ImmichClient); ok && app.ChunkThreshold > 0 {
+		state, err := immich.OpenUploadState(app.ChunkState)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the state of the resumable uploads: %w", err)
+		}
+		c.SetChunkedUpload(immich.ChunkedUpload{Threshold: int64(app.ChunkThreshold), State: state})
+	}
+
+	if app.OverwriteServer && !app.ReplaceSmaller {
+		return nil, errors.New("the option -overwrite-server can't be used with -replace-smaller=false")
+	}
+	if app.OverwriteServer && !app.DryRun && !app.AssumeYes {
+		r, err := confirm(ctx, "The assets already on the server will be replaced by the local files and moved to the trash. Proceed?", "n")
+		if err != nil {
+			return nil, err
+		}
+		if r != "y" {
+			return nil, errors.New("upload canceled")
+		}
+	}
+
+	if app.Permanent && !app.DeleteServer {
+		return nil, errors.New("the option -permanent can't be used with -delete-server=false")
+	}
+	if app.Permanent && !app.DryRun && !app.AssumeYes {
+		r, err := confirm(ctx, "The server's assets replaced by the local files will be deleted permanently, without going to the trash. Proceed?", "n")
+		if err != nil {
+			return nil, err
+		}
+		if r != "y" {
+			return nil, errors.New("upload canceled")
+		}
+	}
+
+	app.report.DryRun = app.DryRun
+	if err := checkAlbumCover(app.AlbumCover); err != nil {
+		return nil, err
+	}
+	app.DateFallback = strings.ToLower(app.DateFallback)
+	if app.DateFallback != DateFallbackNone && app.DateFallback != DateFallbackModTime {
+		return nil, fmt.Errorf("invalid value %q for -date-fallback, expecting none or modtime", app.DateFallback)
+	}
+	if err = app.setAlbumMergeStrategy(); err != nil {
+		return nil, err
+	}
+	app.VerifyMime = strings.ToLower(app.VerifyMime)
+	switch app.VerifyMime {
+	case VerifyMimeNone, VerifyMimeLog, VerifyMimeFix:
+	default:
+		return nil, fmt.Errorf("invalid value %q for -verify-mime, expecting none, log or fix", app.VerifyMime)
+	}
+	if app.VerifyMime != VerifyMimeNone && app.GooglePhotos {
+		return nil, errors.New("the option -verify-mime can't be used with -google-photos")
+	}
+	if err = app.setDateBounds(time.Now()); err != nil {
+		return nil, err
+	}
+	app.OnConflict = strings.ToLower(app.OnConflict)
+	switch app.OnConflict {
+	case OnConflictSkip, OnConflictUpload, OnConflictAsk:
+	default:
+		return nil, fmt.Errorf("invalid value %q for -on-conflict, expecting skip, upload or ask", app.OnConflict)
+	}
+	app.AlbumVisibility = strings.ToLower(app.AlbumVisibility)
+	switch app.AlbumVisibility {
+	case AlbumVisibilityPrivate, AlbumVisibilityLink:
+	default:
+		return nil, fmt.Errorf("invalid value %q for -album-visibility, expecting private or link", app.AlbumVisibility)
+	}
+
+	if app.PreferEdited && app.PreferOriginal {
+		return nil, errors.New("the options -prefer-edited and -prefer-original can't be used together")
+	}
+
+	if app.Move && app.GooglePhotos {
+		return nil, errors.New("the option -move can't be used with -google-photos")
+	}
+	if app.Delete && app.GooglePhotos {
+		return nil, errors.New("the option -delete-local can't be used with -google-photos")
+	}
+	if app.AssumeMetadataFromJSONOnly && !app.GooglePhotos {
+		return nil, errors.New("the option -assume-metadata-from-json-only requires -google-photos")
+	}
+	if (app.SelectAlbumsRegex != "" || app.ExcludeAlbumsRegex != "") && !app.GooglePhotos {
+		return nil, errors.New("the options -select-albums-regex and -exclude-albums-regex require -google-photos")
+	}
+	if app.SharedAlbumPrefix != "" && !app.GooglePhotos {
+		return nil, errors.New("the option -shared-album-prefix requires -google-photos")
+	}
+	if app.PreserveFolderStructure && app.GooglePhotos {
+		return nil, errors.New("the option -preserve-folder-structure can't be used with -google-photos")
+	}
+	if app.Delete && app.Move {
+		return nil, errors.New("the options -delete-local and -move can't be used together")
+	}
+	if app.syncing {
+		if err = app.checkSyncScope(); err != nil {
+			return nil, err
+		}
+	}
+	if app.OrphanReport != "" {
+		if err = app.checkOrphanScope(); err != nil {
+			return nil, err
+		}
+	}
+	if err = app.checkPlanOptions(); err != nil {
+		return nil, err
+	}
+	if err = app.checkWatchOptions(); err != nil {
+		return nil, err
+	}
+	if id, ok := albumIDRef(app.ImportIntoAlbum); ok {
+		if strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("invalid value %q for -album, expecting a name or id: followed by the ID of an album", app.ImportIntoAlbum)
+		}
+		if len(app.MirrorServers) > 0 {
+			return nil, errors.New("the option -album can't give the ID of an album with -server, the albums have other IDs on the other servers")
+		}
+	}
+	if app.ExternalLibrary == "" && app.ExternalPath != "" {
+		return nil, errors.New("the option -external-path requires -external-library")
+	}
+	if app.Move && len(app.MirrorServers) > 0 {
+		return nil, errors.New("the option -move can't be used with -server")
+	}
+	if app.OpenCheck {
+		if len(app.MirrorServers) > 0 {
+			return nil, errors.New("the option -dry-run-open-check can't be used with -server")
+		}
+		app.DryRun = true
+	}
+
+	if app.MaxFileSize > 0 && app.MinFileSize > app.MaxFileSize {
+		return nil, errors.New("the option -min-file-size is larger than -max-file-size")
+	}
+
+	if app.DateTolerance < 0 {
+		return nil, errors.New("the option -date-tolerance can't be negative")
+	}
+	if app.ConcurrentStacks < 1 {
+		return nil, errors.New("the option -concurrent-stacks must be at least 1")
+	}
+	if app.MaxFilenameLength < 16 {
+		return nil, errors.New("the option -max-filename-length must be at least 16")
+	}
+	if app.APIRetries < 0 {
+		return nil, errors.New("the option -api-retries can't be negative")
+	}
+	if app.MaxErrors < 0 {
+		return nil, errors.New("the option -max-errors can't be negative")
+	}
+
+	if app.AlbumPathDepth < 1 {
+		return nil, errors.New("the option -album-path-depth must be at least 1")
+	}
+
+	if app.AlbumNameTemplate != "" {
+		app.albumTemplate, err = parseAlbumTemplate(app.AlbumNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+		app.CreateAlbumAfterFolder = true
+	}
+	if app.AlbumFromFilenameRegex != "" {
+		app.albumRegex, err = parseAlbumRegex(app.AlbumFromFilenameRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if app.ExifToolPath != "" && !app.UseExifTool {
+		return nil, errors.New("the option -exif-tool-path requires -use-exiftool")
+	}
+	if app.UseExifTool && app.NoExif {
+		return nil, errors.New("the options -use-exiftool and -no-exif can't be used together")
+	}
+	if app.SelectAlbumsRegex != "" {
+		app.selectAlbums, err = regexp.Compile(app.SelectAlbumsRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for -select-albums-regex: %w", app.SelectAlbumsRegex, err)
+		}
+	}
+	if app.ExcludeAlbumsRegex != "" {
+		app.excludeAlbums, err = regexp.Compile(app.ExcludeAlbumsRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for -exclude-albums-regex: %w", app.ExcludeAlbumsRegex, err)
+		}
+	}
 
 	app.Journal = logger.NewJournal(log)
+	if app.UseExifTool && !app.GooglePhotos {
+		name := app.ExifToolPath
+		if name == "" {
+			name = "exiftool"
+		}
+		if t, err := exiftool.New(name); err != nil {
+			app.Journal.Warning("%s, the metadata are read by immich-go", err)
+		} else {
+			app.exifTool = t
+		}
+	}
+	if app.DeviceUUID != "" {
+		if c, ok := app.client.(deviceUUIDSetter); ok {
+			c.SetDeviceUUID(app.DeviceUUID)
+		}
+	}
+	if app.AlbumByLocation {
+		app.geocoder = geocoding.NewGeocoder()
+	}
 
-	app.fsys, err = fshelper.ParsePath(cmd.Args(), app.GooglePhotos)
+	app.fsys, err = fshelper.ParsePathWithOptions(cmd.Args(), app.GooglePhotos, fshelper.PathOptions{S3: app.S3, ArchivePassword: app.ArchivePassword})
+	if errors.Is(err, fshelper.ErrArchiveEncrypted) {
+		return nil, fmt.Errorf("%w, give it with -archive-password", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if app.ExternalLibrary != "" {
+		err = app.checkExternalLibrary(cmd.Args())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = app.checkServerCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = app.resolveAlbumShares(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	if app.CreateStacks || app.StackBurst || app.StackJpgRaws {
-		app.stacks = stacking.NewStackBuilder()
+		app.stacks = stacking.NewStackBuilder().SetLivePhotos(app.StackLivePhotos)
 	}
-	log.OK("Ask for server's assets...")
-	var list []*immich.Asset
-	err = app.client.GetAllAssetsWithFilter(ctx, nil, func(a *immich.Asset) {
-		if a.IsTrashed {
-			return
+
+	if app.ResumeJournal != "" {
+		app.uploadJournal, err = openUploadJournal(app.ResumeJournal, app.ResumeJournalReset)
+		if err != nil {
+			return nil, err
 		}
-		list = append(list, a)
-	})
+		log.OK("%d asset(s) already uploaded according to the journal", app.uploadJournal.Len())
+	}
+
+	// the mirrors copy the command before the index of the server's assets is started
+	err = app.addMirrors(ctx, log)
 	if err != nil {
 		return nil, err
 	}
-	log.OK("%d asset(s) received", len(list))
+	app.startAssetIndex(ctx, log)
+
+	return &app, err
 
-	app.AssetIndex = &AssetIndex{
-		assets: list,
+}
+
+// startAssetIndex gets the server's assets in background, while the local files are browsed.
+// The index must be joined with waitAssetIndex before being used.
+
+func (app *UpCmd) startAssetIndex(ctx context.Context, log logger.Logger) {
+	app.assetIndexDone = make(chan struct{})
+	if app.NoServerScan || app.OpenCheck {
+		if app.NoServerScan {
+			log.Warning("The server's assets are not scanned: all files are uploaded, and the server discards the duplicates.")
+		}
+		if app.NoServerScan && app.SkipExistingByAlbum {
+			log.Warning("The option -skip-existing-by-album is disabled by -no-server-scan.")
+		}
+		app.AssetIndex = &AssetIndex{normalizeExt: app.NormalizeExtensions}
+		app.AssetIndex.ReIndex()
+		if !app.OpenCheck {
+			app.assetIndexErr = app.checkAlbumID(ctx, log)
+		}
+		close(app.assetIndexDone)
+		return
 	}
+	log.OK("Ask for server's assets...")
 
-	app.AssetIndex.ReIndex()
+	go func() {
+		defer close(app.assetIndexDone)
+		if err := app.checkAlbumID(ctx, log); err != nil {
+			app.assetIndexErr = err
+			return
+		}
+		opt := &immich.GetAssetOptions{
+			Progress: func(pages int, assets int) {
+				log.Progress(logger.OK, "Ask for server's assets... %d page(s), %d asset(s) received", pages, assets)
+			},
+		}
+		cache, cacheFile := app.openIndexCache(ctx, log)
+		if cache != nil {
+			opt.UpdatedAfter = cache.Watermark
+		}
+		var received []*immich.Asset
+		err := app.client.GetAllAssetsWithFilter(ctx, opt, func(a *immich.Asset) {
+			received = append(received, a)
+		})
+		if err != nil {
+			app.assetIndexErr = fmt.Errorf("can't get the server's assets: %w", err)
+			return
+		}
+		if cache != nil {
+			cache.merge(received)
+			received = cache.Assets
+		}
+		var list []*immich.Asset
+		for _, a := range received {
+			if a.IsTrashed || (a.IsArchived && !app.IncludeArchived) {
+				continue
+			}
+			list = append(list, a)
+		}
+		log.OK("%d asset(s) received", len(list))
 
-	return &app, err
+		app.AssetIndex = &AssetIndex{
+			assets:       list,
+			normalizeExt: app.NormalizeExtensions,
+		}
+		app.AssetIndex.ReIndex()
+
+		if app.SkipExistingByAlbum {
+			if cache != nil && cache.albums(app.AssetIndex) {
+				log.OK("Server's albums read from the cache")
+			} else {
+				log.OK("Ask for server's albums...")
+				err = app.AssetIndex.IndexAlbums(ctx, app.client)
+				if err != nil {
+					app.assetIndexErr = fmt.Errorf("can't get the server's albums: %w", err)
+					return
+				}
+				if cache != nil {
+					cache.setAlbums(app.AssetIndex)
+				}
+			}
+		}
+		if cache != nil {
+			err = cache.save(cacheFile)
+			if err != nil {
+				log.Warning("Can't write the cache of the server's assets: %s", err)
+			}
+		}
+	}()
+}
+
+// AlbumIDPrefix introduces the ID of an existing album in the value of -album, instead of its name
+const AlbumIDPrefix = "id:"
+
+// albumIDRef gives the ID of an album given as id:<ID>
+func albumIDRef(album string) (string, bool) {
+	return strings.CutPrefix(album, AlbumIDPrefix)
+}
+
+// checkAlbumID verifies that the album given by its ID to -album exists on the server
+func (app *UpCmd) checkAlbumID(ctx context.Context, log logger.Logger) error {
+	id, ok := albumIDRef(app.ImportIntoAlbum)
+	if !ok {
+		return nil
+	}
+	albums, err := app.client.GetAllAlbums(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get the album list from the server: %w", err)
+	}
+	for _, al := range albums {
+		if al.ID == id {
+			log.OK("The assets are added to the album %q (%s)", al.AlbumName, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("the album %s given by -album doesn't exist on the server", id)
+}
 
+// openIndexCache gives the cache of the server's assets and its file, or nil when the cache isn't used.
+// The cache is empty when a full scan is needed.
+func (app *UpCmd) openIndexCache(ctx context.Context, log logger.Logger) (*indexCache, string) {
+	if app.IndexCache == "" {
+		return nil, ""
+	}
+	id, ok := app.client.(serverIdentity)
+	if !ok {
+		log.Warning("The cache of the server's assets isn't available with this server.")
+		return nil, ""
+	}
+	user, err := id.ValidateConnection(ctx)
+	if err != nil {
+		log.Warning("The cache of the server's assets isn't used: %s", err)
+		return nil, ""
+	}
+	name := indexCacheFile(app.IndexCache, id.EndPoint())
+	now := time.Now()
+	cache, reason := loadIndexCache(name, id.EndPoint(), user.ID, app.IndexCacheTTL, now)
+	if cache == nil {
+		log.OK("Full scan of the server's assets: %s", reason)
+		return &indexCache{Server: id.EndPoint(), User: user.ID, Scanned: now}, name
+	}
+	log.OK("%d asset(s) read from the cache, ask for the updated ones...", len(cache.Assets))
+	return cache, name
+}
+
+// waitAssetIndex waits the end of the server's assets scan
+func (app *UpCmd) waitAssetIndex(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-app.assetIndexDone:
+		return app.assetIndexErr
+	}
 }
 
 func UploadCommand(ctx context.Context, ic iClient, log logger.Logger, args []string) error {
@@ -204,15 +1151,70 @@ func UploadCommand(ctx context.Context, ic iClient, log logger.Logger, args []st
 	if err != nil {
 		return err
 	}
-	return app.Run(ctx, app.fsys)
+	return app.runCommand(ctx)
+}
 
+// runCommand runs the command on the parsed folders, and saves the simulated server and the hash cache
+func (app *UpCmd) runCommand(ctx context.Context) error {
+	defer app.uploadJournal.Close()
+	defer func() {
+		for _, fsys := range app.fsys {
+			if c, ok := fsys.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}()
+	err := app.Run(ctx, app.fsys)
+	if app.simulator != nil && app.SimulateState != "" {
+		err = errors.Join(err, app.simulator.SaveFile(app.SimulateState))
+	}
+	if cerr := app.hashCache.Save(); cerr != nil {
+		err = errors.Join(err, fmt.Errorf("can't write the hash cache: %w", cerr))
+	}
+	return err
+}
+
+// checksum gives the checksum of the local file, read from the -hash-cache when the file is unchanged
+func (app *UpCmd) checksum(a *browser.LocalAssetFile) (string, error) {
+	if a.Checksum != "" {
+		return a.Checksum, nil
+	}
+	key := "sha1"
+	if a.StripGPS {
+		key = "sha1-nogps"
+	}
+	h, err := app.hashCache.Hash(a.FSys, a.FileName, key, a.ComputeChecksum)
+	if err != nil {
+		return "", err
+	}
+	a.Checksum = h
+	return h, nil
 }
 
 func (app *UpCmd) journalAsset(a *browser.LocalAssetFile, action logger.Action, comment ...string) {
+	switch action {
+	case logger.ERROR, logger.SERVER_ERROR, logger.EMPTY_FILE, logger.TRUNCATED:
+		app.report.addFailure(a.FileName, strings.Join(comment, " "))
+	}
 	app.Journal.AddEntry(a.FileName, action, comment...)
 }
 
 func (app *UpCmd) Run(ctx context.Context, fsyss []fs.FS) error {
+	if app.Report != "" {
+		defer func() {
+			if err := app.writeReport(); err != nil {
+				app.Journal.Error("can't write the report: %s", err)
+			}
+		}()
+	}
+
+	// The run stops when the -max-errors threshold is reached
+	ctx, abortRun := context.WithCancelCause(ctx)
+	defer abortRun(nil)
+	for _, srv := range app.servers() {
+		srv.abortRun = abortRun
+	}
+	var aborted error
 
 	var browser browser.Browser
 	var err error
@@ -232,52 +1234,308 @@ func (app *UpCmd) Run(ctx context.Context, fsyss []fs.FS) error {
 	}
 	app.Journal.Message(logger.OK, "Done.")
 
-	assetChan := browser.Browse(ctx)
+	if app.Progress != ProgressNone {
+		app.progress = newUploadProgress(app.Progress, app.Journal)
+		if err := app.measureSource(ctx, fsyss); err != nil {
+			app.Journal.Warning("can't measure the source: %s", err)
+		}
+		app.Journal.OK("%d file(s) to process, %s", app.progress.totalFiles, formatBytes(int(app.progress.totalBytes)))
+	}
+
+	// The folders are watched from now, the files added during the first pass are uploaded after it
+	var watcher *sourceWatcher
+	if app.Watch {
+		watcher, err = app.newSourceWatcher(fsyss)
+		if err != nil {
+			app.Journal.Message(logger.Error, err.Error())
+			return err
+		}
+		defer watcher.Close()
+	}
+
+	// On the first Ctrl+C, the browsing stops, but the albums, stacks and tags are updated
+	// with the assets already uploaded
+	browseCtx, stopBrowsing := context.WithCancel(ctx)
+	defer stopBrowsing()
+	stopping := shutdown.Stopping(ctx)
+	interrupted := false
+	browseErrors := 0
+
+	assetChan := browser.Browse(browseCtx)
 assetLoop:
 	for {
+		// the stop request takes precedence over the next asset
 		select {
+		case <-stopping:
+			stopBrowsing()
+			interrupted = true
+			app.Journal.Warning("Upload interrupted, updating the server with the assets already uploaded...")
+			break assetLoop
 		case <-ctx.Done():
-			return ctx.Err()
+			aborted = context.Cause(ctx)
+			if !errors.Is(aborted, errMaxErrors) {
+				return ctx.Err()
+			}
+			app.Journal.Error("Upload aborted: %s", aborted)
+			break assetLoop
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			continue
+
+		case <-stopping:
+			continue
 
 		case a, ok := <-assetChan:
 			if !ok {
 				break assetLoop
 			}
+			if app.tracksSource() {
+				app.see(a)
+			}
 			if a.Err != nil {
+				browseErrors++
 				app.journalAsset(a, logger.ERROR, a.Err.Error())
-			} else {
-				err = app.handleAsset(ctx, a)
-				if err != nil {
-					app.journalAsset(a, logger.ERROR, err.Error())
-				}
+			} else if err = app.handleServersAsset(ctx, a); err != nil {
+				return err
+			}
+			app.progress.assetDone(a.Size())
+		}
+	}
+	app.progress.display(true)
+
+	// After an abort, the server isn't updated with the assets already uploaded
+	for _, srv := range app.servers() {
+		if aborted != nil {
+			break
+		}
+		err = srv.updateServer(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	// With -watch, the new files are uploaded until the stop request
+	if watcher != nil && aborted == nil && !interrupted {
+		err = watcher.run(ctx, browser, stopping)
+		if cause := context.Cause(ctx); errors.Is(cause, errMaxErrors) {
+			aborted = cause
+			app.Journal.Error("Upload aborted: %s", aborted)
+		} else if err != nil {
+			return err
+		}
+	}
+	// The server's assets are deleted only when the whole source has been read
+	switch {
+	case !app.syncing || aborted != nil:
+	case interrupted || browseErrors > 0:
+		app.Journal.Warning("The source wasn't read completely, the server's assets missing from the source aren't deleted")
+	default:
+		for _, srv := range app.servers() {
+			err = srv.syncServer(ctx)
+			if err != nil {
+				return err
 			}
 		}
 	}
+	switch {
+	case app.DumpPlan == "" || aborted != nil:
+	case interrupted || browseErrors > 0:
+		app.Journal.Warning("The source wasn't read completely, the plan isn't written")
+	default:
+		err = app.writePlan()
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case app.OrphanReport == "" || aborted != nil:
+	case interrupted || browseErrors > 0:
+		app.Journal.Warning("The source wasn't read completely, the orphan report isn't written")
+	default:
+		err = app.writeOrphanReport(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	app.keepMirroredOnly()
+
+	if len(app.deleteLocalList) > 0 {
+		err = app.DeleteLocalAssets()
+	}
+
+	app.Journal.Report()
+	if failed := atomic.LoadInt64(&app.mediaFailed); failed > 0 {
+		app.Journal.Warning("%6d files failed to upload after %d retries", failed, app.UploadRetries)
+	}
+	if failed := atomic.LoadInt64(&app.apiFailed); failed > 0 {
+		app.Journal.Warning("%6d album, stack, tag or metadata updates failed, see the errors above", failed)
+	}
+	if app.mediaVerified > 0 {
+		app.Journal.Summary("%6d uploaded files verified, %d don't match the server's checksum", app.mediaVerified, app.mediaMismatch)
+	}
+	if app.sparedFiles > 0 {
+		app.Journal.Summary("%6d files found on the server by name, date and size, %s not read for the checksums and dimensions", app.sparedFiles, formatBytes(int(app.sparedBytes)))
+	}
+	app.reportUndated()
+	if app.OpenCheck {
+		app.reportOpenCheck()
+	}
+	app.reportDamagedFiles()
+	if to, ok := browser.(*gp.Takeout); ok && to.Orphans() > 0 {
+		app.reportOrphans(to)
+	}
+	app.Journal.ReportExtensions()
+	app.reportMirrors()
+
+	if aborted != nil {
+		app.Journal.Error("The run was aborted: %s. The albums, stacks and tags aren't updated", aborted)
+		app.report.aborted(aborted)
+		err = errors.Join(err, aborted)
+	}
+	if err == nil && interrupted {
+		err = errors.New("upload interrupted by the user")
+	}
+	return err
+}
+
+// handleServersAsset gives the asset to the main server and to the mirrors.
+// It fails when the server's assets can't be indexed, the errors of the asset are only reported.
+func (app *UpCmd) handleServersAsset(ctx context.Context, a *browser.LocalAssetFile) error {
+	for _, srv := range app.servers() {
+		// The server's assets are needed from now
+		if err := srv.waitAssetIndex(ctx); err != nil {
+			app.Journal.Message(logger.Error, err.Error())
+			return err
+		}
+		if err := srv.handleAsset(ctx, a); err != nil {
+			srv.journalAsset(a, logger.ERROR, err.Error())
+		}
+	}
+	return nil
+}
+
+// reportOrphans tells how many files of the takeout were refused for lack of JSON metadata
+func (app *UpCmd) reportOrphans(to *gp.Takeout) {
+	if to.JSONOnly() {
+		app.Journal.Warning("%6d files without JSON or without date of capture in their JSON weren't uploaded. The takeout may be incomplete, or its archives split incorrectly", to.Orphans())
+	} else {
+		app.Journal.Warning("%6d files without JSON weren't uploaded. The takeout may be incomplete, or its archives split incorrectly", to.Orphans())
+	}
+	app.report.takeoutOrphans(to.Orphans())
+}
+
+// errMaxErrors stops the run when the -max-errors threshold is reached
+var errMaxErrors = errors.New("too many upload errors")
+
+// countFailure counts an upload failure, and aborts the run when the -max-errors threshold is reached
+func (app *UpCmd) countFailure() {
+	n := atomic.AddInt64(&app.mediaFailed, 1)
+	if app.MaxErrors > 0 && n >= int64(app.MaxErrors) && app.abortRun != nil {
+		app.abortRun(fmt.Errorf("%w: %d upload errors reached the limit given by -max-errors", errMaxErrors, n))
+	}
+}
+
+// setDateBounds sets the date range given by -since, -after and -before.
+// The dates without time are days in UTC, as the ones of -date.
+func (app *UpCmd) setDateBounds(now time.Time) error {
+	if app.Since == 0 && app.DateAfter == "" && app.DateBefore == "" {
+		return nil
+	}
+	if app.DateRange.IsSet() {
+		return errors.New("the options -since, -after and -before can't be used with -date")
+	}
+	if app.Since > 0 {
+		if app.DateAfter != "" || app.DateBefore != "" {
+			return errors.New("the option -since can't be used with -after or -before")
+		}
+		app.DateRange.SetBounds(now.Add(-time.Duration(app.Since)), now)
+		return nil
+	}
+	after, err := parseDateBound("after", app.DateAfter)
+	if err != nil {
+		return err
+	}
+	before, err := parseDateBound("before", app.DateBefore)
+	if err != nil {
+		return err
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return errors.New("the date of -after must be before the one of -before")
+	}
+	app.DateRange.SetBounds(after, before)
+	return nil
+}
+
+// parseDateBound reads the value of -after or -before, a day or a time with its offset
+func parseDateBound(option string, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid value %q for -%s, expecting YYYY-MM-DD or YYYY-MM-DDTHH:MM:SS+01:00", s, option)
+}
+
+// Values of -date-fallback
+const (
+	DateFallbackNone    = "none"
+	DateFallbackModTime = "modtime"
+)
+
+// Values of -verify-mime
+const (
+	VerifyMimeNone = "none" // only the files without extension are recognized by their content
+	VerifyMimeLog  = "log"  // the files whose content doesn't match the extension are reported
+	VerifyMimeFix  = "fix"  // the files whose content doesn't match the extension are uploaded with the extension of the content
+)
+
+// undatedSamples is the number of files without date of capture named at the end of the run
+const undatedSamples = 5
+
+// reportUndated warns about the files excluded by -date because their date of capture is unknown
+func (app *UpCmd) reportUndated() {
+	if len(app.undated) == 0 {
+		return
+	}
+	samples := app.undated[:min(len(app.undated), undatedSamples)]
+	more := ""
+	if len(app.undated) > len(samples) {
+		more = ", ..."
+	}
+	app.Journal.Warning("%6d files without date of capture excluded by -date, like %s%s. Use -date-fallback=modtime to select them with their modification time",
+		len(app.undated), strings.Join(samples, ", "), more)
+}
+
+// updateServer stacks the uploaded assets, updates the albums, removes the replaced assets and verifies the uploads
+func (app *UpCmd) updateServer(ctx context.Context) error {
+	var err error
+	if app.server != "" {
+		app.Journal.OK("Updating the server %s", app.server)
+	}
 
-	if app.CreateStacks {
-		stacks := app.stacks.Stacks()
-		if len(stacks) > 0 {
-			app.Journal.OK("Creating stacks")
-		nextStack:
-			for _, s := range stacks {
-				switch {
-				case !app.StackBurst && s.StackType == stacking.StackBurst:
-					continue nextStack
-				case !app.StackJpgRaws && s.StackType == stacking.StackRawJpg:
-					continue nextStack
-				}
-				app.Journal.OK("  Stacking %s...", strings.Join(s.Names, ", "))
-				if !app.DryRun {
-					err = app.client.StackAssets(ctx, s.CoverID, s.IDs)
-					if err != nil {
-						app.Journal.Warning("Can't stack images: %s", err)
-					}
-				}
+	if app.executingPlan() {
+		app.applyPlan()
+	}
+
+	stacks := app.stacksToCreate()
+	if len(stacks) > 0 {
+		app.Journal.OK("Creating stacks")
+		err = app.ManageStacks(ctx, stacks)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
 			}
+			app.Journal.Error(err.Error())
+			err = nil
 		}
 	}
 
-	if app.CreateAlbums || app.CreateAlbumAfterFolder || (app.KeepPartner && len(app.PartnerAlbum) > 0) || len(app.ImportIntoAlbum) > 0 {
+	if len(app.updateAlbums) > 0 {
 		app.Journal.OK("Managing albums")
 		err = app.ManageAlbums(ctx)
 		if err != nil {
@@ -286,7 +1544,33 @@ assetLoop:
 		}
 	}
 
-	if len(app.deleteServerList) > 0 {
+	if len(app.updateTags) > 0 {
+		app.Journal.OK("Managing tags")
+		err = app.ManageTags(ctx)
+		if err != nil {
+			app.Journal.Error(err.Error())
+			err = nil
+		}
+	}
+
+	if len(app.folderDescs) > 0 {
+		app.Journal.OK("Writing the paths of the files into the descriptions")
+		app.writeFolderDescriptions(ctx)
+	}
+
+	if len(app.metadataPatches) > 0 {
+		app.Journal.OK("Correcting the metadata of the server's assets")
+		app.patchServerMetadata(ctx)
+	}
+
+	if len(app.favorites) > 0 {
+		app.Journal.OK("Marking the favorites")
+		app.setFavorites(ctx)
+	}
+
+	if len(app.deleteServerList) > 0 && !app.DeleteServer && !app.executingPlan() {
+		app.Journal.Warning("%d server assets replaced by the local files are kept, -delete-server is FALSE", len(app.deleteServerList))
+	} else if len(app.deleteServerList) > 0 {
 		ids := []string{}
 		for _, da := range app.deleteServerList {
 			ids = append(ids, da.ID)
@@ -295,29 +1579,49 @@ assetLoop:
 		if err != nil {
 			return fmt.Errorf("can't delete server's assets: %w", err)
 		}
+		if !app.DryRun && app.report != nil {
+			app.report.ServerDeleted = len(ids)
+		}
 	}
 
-	if len(app.deleteLocalList) > 0 {
-		err = app.DeleteLocalAssets()
+	if len(app.uploaded) > 0 {
+		err = app.verifyUploads(ctx)
+		if err != nil {
+			return err
+		}
 	}
-
-	app.Journal.Report()
-
-	return err
+	return nil
 }
 
 func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) error {
 	defer func() {
 		a.Close()
 	}()
-	app.mediaCount++
+	atomic.AddInt64(&app.mediaCount, 1)
+
+	// the mirrors get the name given to the main server
+	if app.SanitizeNames {
+		app.sanitizeTitle(a)
+	}
+	if app.FavoriteFromMetadata {
+		favoriteFromRating(a)
+	}
+
+	if app.executingPlan() {
+		return app.executePlanAsset(ctx, a)
+	}
+
+	if app.uploadJournal.Has(a.DeviceAssetID()) {
+		app.journalAsset(a, logger.SERVER_DUPLICATE, "already uploaded according to the journal")
+		return nil
+	}
 
 	// ext := path.Ext(a.FileName)
 	// if _, err := fshelper.MimeFromExt(ext); err != nil {
 	// 	app.journalAsset(a, logger.NOT_SELECTED, "not recognized extension")
 	// 	return nil
 	// }
-	ext := path.Ext(a.FileName)
+	ext := a.Ext()
 	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
 		app.journalAsset(a, logger.NOT_SELECTED, "extension excluded")
 		return nil
@@ -337,8 +1641,8 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		return nil
 	}
 
-	if len(app.ImportFromAlbum) > 0 && !app.isInAlbum(a, app.ImportFromAlbum) {
-		app.journalAsset(a, logger.NOT_SELECTED, "asset excluded because not from the required album")
+	if len(app.ImportFromAlbum) > 0 && !app.isInAlbum(a) {
+		app.journalAsset(a, logger.NOT_SELECTED, "asset excluded because not from the required albums")
 		return nil
 	}
 
@@ -347,9 +1651,29 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		return nil
 	}
 
+	if a.Size() == 0 {
+		app.skipEmptyFile(a)
+		return nil
+	}
+	if app.MinFileSize > 0 && a.Size() < int64(app.MinFileSize) {
+		app.journalAsset(a, logger.SIZE_FILTERED, "file smaller than "+app.MinFileSize.String())
+		return nil
+	}
+	if app.MaxFileSize > 0 && a.Size() > int64(app.MaxFileSize) {
+		app.journalAsset(a, logger.SIZE_FILTERED, "file larger than "+app.MaxFileSize.String())
+		return nil
+	}
+
 	if app.DateRange.IsSet() {
+		if a.DateTaken.IsZero() && app.DateFallback == DateFallbackModTime {
+			if s, err := fs.Stat(a.FSys, a.FileName); err == nil && !s.ModTime().IsZero() {
+				a.DateTaken = s.ModTime()
+				app.journalAsset(a, logger.INFO, "the date of capture is unknown, the file modification time is used")
+			}
+		}
 		d := a.DateTaken
 		if d.IsZero() {
+			app.undated = append(app.undated, a.FileName)
 			app.journalAsset(a, logger.NOT_SELECTED, "asset excluded because the date of capture is unknown and a date range is given")
 			return nil
 		}
@@ -367,29 +1691,91 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 
 	app.Journal.DebugObject("handleAsset: LocalAssetFile=", a)
 
-	advice, err := app.AssetIndex.ShouldUpload(a)
+	if app.OpenCheck {
+		app.openCheck(a)
+		return nil
+	}
+
+	if app.StripGPS {
+		app.stripGPS(a)
+	}
+
+	advice, err := app.decidedAdvice(a)
 	if err != nil {
 		return err
 	}
+	if advice == nil {
+		if app.CheckSum {
+			if _, err := app.checksum(a); err != nil {
+				app.Journal.Warning("can't compute the checksum of %q: %s", a.FileName, err)
+			}
+		}
+
+		if app.CompareResolution {
+			if err := a.ReadImageSize(); err != nil {
+				app.Journal.Warning("can't read the dimensions of %q: %s", a.FileName, err)
+			}
+		}
+
+		advice, err = app.AssetIndex.ShouldUpload(a, app.DateTolerance)
+		if err != nil {
+			return err
+		}
+	}
+	if app.OverwriteServer && (advice.Advice == SameOnServer || advice.Advice == BetterOnServer) && !advice.ServerAsset.JustUploaded {
+		advice = app.AssetIndex.adviceOverwriteServer(advice.ServerAsset)
+	}
+	app.report.addAdvice(advice.Advice)
+	if advice.ServerAsset != nil && app.tracksSource() {
+		app.matchedAssets[advice.ServerAsset.ID] = true
+	}
 
 	var ID string
 	switch advice.Advice {
+	case IDontKnow:
+		var upload bool
+		upload, err = app.onConflict(ctx, advice)
+		if err != nil {
+			return err
+		}
+		if !upload {
+			app.journalAsset(a, logger.CONFLICT, advice.Message)
+			return nil
+		}
+		app.journalAsset(a, logger.INFO, advice.Message+", uploaded")
+		ID, err = app.UploadAsset(ctx, a)
+		if app.Delete && err == nil {
+			app.deleteLocalList = append(app.deleteLocalList, a)
+		}
 	case NotOnServer:
 		ID, err = app.UploadAsset(ctx, a)
 		if app.Delete && err == nil {
 			app.deleteLocalList = append(app.deleteLocalList, a)
 		}
 	case SmallerOnServer:
+		if !app.ReplaceSmaller {
+			app.journalAsset(a, logger.SERVER_SMALLER, advice.Message+" Kept (-replace-smaller=false).")
+			return nil
+		}
 		app.journalAsset(a, logger.UPGRADED, advice.Message)
 		// add the superior asset into albums of the original asset
+		app.getServerAssetAlbums(ctx, advice.ServerAsset)
 		for _, al := range advice.ServerAsset.Albums {
 			app.journalAsset(a, logger.INFO, "Added to album: "+al.AlbumName)
 			a.AddAlbum(browser.LocalAlbum{Name: al.AlbumName})
 		}
 		ID, err = app.UploadAsset(ctx, a)
 
-		if err != nil {
-			app.deleteServerList = append(app.deleteServerList, advice.ServerAsset)
+		if err == nil {
+			if ID == advice.ServerAsset.ID {
+				// the server recognized the same content, and kept its asset
+				app.journalAsset(a, logger.INFO, "the server's asset has the same content, it is kept")
+			} else {
+				for _, al := range advice.ServerAsset.Albums {
+					app.AddToAlbum(ID, al.AlbumName, a)
+				}
+				app.deleteServerList = append(app.deleteServerList, advice.ServerAsset)
+			}
 			if app.Delete {
 				app.deleteLocalList = append(app.deleteLocalList, a)
 			}
@@ -404,19 +1790,25 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		ID = advice.ServerAsset.ID
 		if app.CreateAlbums {
 			for _, al := range a.Albums {
-				app.journalAsset(a, logger.INFO, "Added to album: "+al.Name)
-				app.AddToAlbum(advice.ServerAsset.ID, app.albumName(al))
+				for _, name := range app.albumNames(al) {
+					app.journalAsset(a, logger.INFO, "Added to album: "+name)
+					app.AddToAlbum(advice.ServerAsset.ID, name, a)
+					app.addAlbumDescription(name, al.Description)
+				}
 			}
 		}
 		if app.ImportIntoAlbum != "" {
 			app.journalAsset(a, logger.INFO, "Added to album: "+app.ImportIntoAlbum)
-			app.AddToAlbum(advice.ServerAsset.ID, app.ImportIntoAlbum)
+			app.AddToAlbum(advice.ServerAsset.ID, app.ImportIntoAlbum, a)
 		}
 		if app.PartnerAlbum != "" && a.FromPartner {
 			app.journalAsset(a, logger.INFO, "Added to album: "+app.PartnerAlbum)
-			app.AddToAlbum(advice.ServerAsset.ID, app.PartnerAlbum)
+			app.AddToAlbum(advice.ServerAsset.ID, app.PartnerAlbum, a)
 		}
 		if !advice.ServerAsset.JustUploaded {
+			if app.PatchMetadata {
+				app.checkMetadataPatch(a, advice.ServerAsset)
+			}
 			if app.Delete {
 				app.deleteLocalList = append(app.deleteLocalList, a)
 			}
@@ -426,26 +1818,35 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 	case BetterOnServer:
 		app.journalAsset(a, logger.SERVER_BETTER, advice.Message)
 		ID = advice.ServerAsset.ID
+		if app.PatchMetadata && !advice.ServerAsset.JustUploaded {
+			app.checkMetadataPatch(a, advice.ServerAsset)
+		}
 		// keep the server version but update albums
 		if app.CreateAlbums {
 			for _, al := range a.Albums {
-				app.journalAsset(a, logger.INFO, "Added to album: "+al.Name)
-				app.AddToAlbum(advice.ServerAsset.ID, app.albumName(al))
+				for _, name := range app.albumNames(al) {
+					app.journalAsset(a, logger.INFO, "Added to album: "+name)
+					app.AddToAlbum(advice.ServerAsset.ID, name, a)
+					app.addAlbumDescription(name, al.Description)
+				}
 			}
 		}
 		if app.PartnerAlbum != "" && a.FromPartner {
 			app.journalAsset(a, logger.INFO, "Added to album: "+app.PartnerAlbum)
-			app.AddToAlbum(advice.ServerAsset.ID, app.PartnerAlbum)
+			app.AddToAlbum(advice.ServerAsset.ID, app.PartnerAlbum, a)
 		}
 	}
 
 	if err != nil {
 		return nil
 	}
+	if app.FavoriteFromMetadata {
+		app.sourceFavorite(ID, a, advice.ServerAsset)
+	}
 
 	if app.ImportIntoAlbum != "" ||
 		(app.GooglePhotos && (app.CreateAlbums || app.PartnerAlbum != "")) ||
-		(!app.GooglePhotos && app.CreateAlbumAfterFolder) {
+		(!app.GooglePhotos && (app.CreateAlbumAfterFolder || app.AlbumByLocation || app.albumRegex != nil)) {
 		albums := []browser.LocalAlbum{}
 
 		if app.ImportIntoAlbum != "" {
@@ -458,129 +1859,632 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 					albums = append(albums, browser.LocalAlbum{Path: app.PartnerAlbum, Name: app.PartnerAlbum})
 				}
 			case !app.GooglePhotos && app.CreateAlbumAfterFolder:
-				album := path.Base(path.Dir(a.FileName))
-				if album != "" && album != "." {
+				album := app.folderAlbum(a)
+				if album != "" {
+					albums = append(albums, browser.LocalAlbum{Path: album, Name: album})
+				}
+			}
+			if !app.GooglePhotos && app.albumRegex != nil {
+				if album := app.filenameAlbum(a); album != "" {
 					albums = append(albums, browser.LocalAlbum{Path: album, Name: album})
 				}
 			}
+			if !app.GooglePhotos && app.AlbumByLocation {
+				if album, ok := app.locationAlbum(a); ok {
+					albums = append(albums, album)
+				}
+			}
 		}
 
 		if len(albums) > 0 {
 			Names := []string{}
 			for _, al := range albums {
-				Name := app.albumName(al)
 				app.Journal.DebugObject("Add asset to the album:", al)
-
-				if app.GooglePhotos && Name == "" {
-					continue
+				for _, Name := range app.albumNames(al) {
+					if app.GooglePhotos && Name == "" {
+						continue
+					}
+					Names = append(Names, Name)
+					app.addAlbumDescription(Name, al.Description)
 				}
-				Names = append(Names, Name)
 			}
 			if len(Names) > 0 {
 				app.journalAsset(a, logger.ALBUM, strings.Join(Names, ", "))
 				for _, n := range Names {
-					app.AddToAlbum(ID, n)
+					app.AddToAlbum(ID, n, a)
 				}
 			}
 		}
 	}
 
+	if app.PreserveFolderStructure {
+		app.addFolderDescription(ID, a, advice.ServerAsset)
+	}
+
+	app.updateAssetMetadata(ctx, ID, a)
+	return nil
+}
+
+// updateAssetMetadata gives to the server's asset the description, the favorite and archived flags
+// and the GPS position found in the source
+func (app *UpCmd) updateAssetMetadata(ctx context.Context, ID string, a *browser.LocalAssetFile) {
 	shouldUpdate := len(a.Description) > 0
 	shouldUpdate = shouldUpdate || a.Favorite
 	shouldUpdate = shouldUpdate || a.Longitude != 0 || a.Latitude != 0
 	shouldUpdate = shouldUpdate || a.Archived
 
 	if !app.DryRun && shouldUpdate {
-		_, err := app.client.UpdateAsset(ctx, ID, a)
+		err := app.callWithRetries(ctx, "Update of the asset "+ID, func() error {
+			_, err := app.client.UpdateAsset(ctx, ID, a)
+			return err
+		})
 		if err != nil {
 			app.Journal.Error("can't update the asset '%s': ", err)
 		}
 	}
-
+}
+
+// isInAlbum tells if the asset belongs to one of the albums given by -from-album
+func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile) bool {
+	for _, al := range a.Albums {
+		for _, name := range app.albumNames(al) {
+			if app.ImportFromAlbum.Contains(name, app.AlbumMatchCI) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *UpCmd) ReadGoogleTakeOut(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
+	to, err := gp.NewTakeout(ctx, a.Journal, fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	if a.DateRange.IsSet() {
+		to.SetDateRange(browser.DateRange{After: a.DateRange.After, Before: a.DateRange.Before})
+	}
+	if a.TakeoutTimeZone != "" {
+		to.SetTimeZone(a.takeoutZone, strings.EqualFold(a.TakeoutTimeZone, "auto"))
+	}
+	to.SetJSONOnly(a.AssumeMetadataFromJSONOnly)
+	if a.selectAlbums != nil || a.excludeAlbums != nil {
+		to.SetAlbumFilter(a.isSelectedAlbum, a.selectAlbums == nil)
+	}
+	policy := gp.KeepBothVersions
+	switch {
+	case a.PreferEdited:
+		policy = gp.PreferEdited
+	case a.PreferOriginal:
+		policy = gp.PreferOriginal
+	}
+	return to.SetEditedPolicy(policy, a.EditedSuffixes), nil
+}
+
+func (a *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
+	la, err := files.NewLocalFiles(ctx, a.Journal, fsyss...)
+	if err != nil {
+		return nil, err
+	}
+	// the files out of the date range must be seen when the source is tracked, the command selects them
+	if a.DateRange.IsSet() && !a.tracksSource() {
+		la.SetDateRange(browser.DateRange{After: a.DateRange.After, Before: a.DateRange.Before})
+	}
+	if a.exifTool != nil {
+		la.SetExifTool(a.exifTool)
+	}
+	la.SetVerifyMime(a.VerifyMime != VerifyMimeNone, a.VerifyMime == VerifyMimeFix)
+	return la.SetExcludedPaths(a.BrowserConfig.ExcludePaths).SetSkipExif(a.NoExif).SetSidecarFromFile(a.SidecarFromFile).SetSidecarTypes(a.BrowserConfig.SidecarTypes), nil
+}
+
+// UploadAsset upload the asset on the server
+// Add the assets into listed albums
+// return ID of the asset
+
+func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (string, error) {
+	var resp immich.AssetResponse
+	var err error
+	if !app.DryRun {
+
+		// a sidecar found next to the file is uploaded as is.
+		// With -assume-metadata-from-json-only, the sidecar gives the JSON's date and position to the server.
+		rawExif := app.copyExifToSidecar(a)
+		if (app.ForceSidecar || app.WriteXMPSidecars || app.AssumeMetadataFromJSONOnly || rawExif) && (a.SideCar == nil || !a.SideCar.OnFSsys) {
+			sc := metadata.SideCar{}
+			sc.DateTaken = a.DateTaken
+			sc.TimeZone = app.sideCarZone(a)
+			sc.Latitude = a.Latitude
+			sc.Longitude = a.Longitude
+			sc.Elevation = a.Altitude
+			sc.FileName = a.FileName + ".xmp"
+			if app.WriteXMPSidecars {
+				app.completeSideCar(a, &sc)
+			}
+			if rawExif {
+				app.exifSideCar(a, &sc)
+			}
+			a.SideCar = &sc
+		}
+
+		if app.ExternalLibrary != "" {
+			resp, err = app.importAsset(ctx, a)
+		} else {
+			start := time.Now()
+			resp, err = app.uploadWithRetries(ctx, a)
+			if err == nil && !resp.Duplicate {
+				app.progress.uploadDone(a.Size(), time.Since(start))
+			}
+		}
+	} else {
+		resp.ID = uuid.NewString()
+	}
+	if err != nil {
+		app.countFailure()
+		app.journalAsset(a, logger.SERVER_ERROR, err.Error())
+		return "", err
+	}
+	if !app.DryRun {
+		if err := app.uploadJournal.Record(a.DeviceAssetID(), resp.ID); err != nil {
+			app.Journal.Warning("can't write the journal: %s", err)
+		}
+	}
+	if !resp.Duplicate {
+		app.journalAsset(a, logger.UPLOADED, a.Title)
+		app.AssetIndex.AddLocalAsset(a, resp.ID)
+		atomic.AddInt64(&app.mediaUploaded, 1)
+		// the tags and the stacks of a plan are given by its actions
+		if !app.executingPlan() {
+			for _, tag := range app.Tags {
+				app.AddToTag(resp.ID, tag)
+			}
+			if app.PeopleAsTags {
+				for _, p := range a.People {
+					app.AddToTag(resp.ID, p)
+				}
+			}
+		}
+		if app.Move {
+			// moved files are verified one by one
+			app.moveAsset(ctx, a, resp.ID)
+		} else if !app.DryRun && app.VerifyUploads.N > 0 {
+			app.uploaded = append(app.uploaded, uploadedAsset{ID: resp.ID, a: a})
+		}
+		if app.CreateStacks && !app.executingPlan() {
+			date, info := app.burstInfo(a)
+			app.stacks.ProcessBurstAsset(resp.ID, strings.TrimSuffix(a.FileName, path.Ext(a.FileName))+a.Ext(), date, info)
+		}
+
+	} else {
+		app.journalAsset(a, logger.SERVER_DUPLICATE, "already on the server")
+	}
+	app.planUpload(a.FileName, resp.ID)
+	return resp.ID, nil
+}
+
+// checkExternalLibrary checks that the files given to -external-library can be read in place by the server.
+// The version of the server is checked with the other options by checkServerCapabilities.
+func (app *UpCmd) checkExternalLibrary(args []string) error {
+	switch {
+	case app.GooglePhotos:
+		return errors.New("the option -external-library can't be used with -google-photos, the files of a takeout can't be read in place")
+	case app.Delete || app.Move:
+		return errors.New("the option -external-library can't be used with -delete-local or -move, the server reads the files in place")
+	case app.StripGPS:
+		return errors.New("the option -external-library can't be used with -strip-gps, the files aren't rewritten")
+	case app.ForceSidecar || app.WriteXMPSidecars || app.CopyExifToSidecar:
+		return errors.New("the option -external-library can't be used with -force-sidecar, -write-xmp-sidecars or -copy-exif-to-sidecar, only the sidecar files found next to the files are given to the server")
+	case len(app.MirrorServers) > 0:
+		return errors.New("the option -external-library can't be used with -server")
+	case len(args) != 1:
+		return errors.New("the option -external-library needs a single folder")
+	}
+	if i, err := os.Stat(args[0]); err != nil || !i.IsDir() {
+		return fmt.Errorf("the option -external-library needs a folder, %q isn't one", args[0])
+	}
+	if app.ExternalPath == "" {
+		abs, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+		app.ExternalPath = filepath.ToSlash(abs)
+	}
+	return nil
+}
+
+// importAsset registers the file in the -external-library instead of uploading it, the server reads it in place
+func (app *UpCmd) importAsset(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	imp := immich.AssetImport{
+		LibraryID: app.ExternalLibrary,
+		AssetPath: path.Join(app.ExternalPath, a.FileName),
+	}
+	if a.SideCar != nil && a.SideCar.OnFSsys {
+		imp.SidecarPath = path.Join(app.ExternalPath, a.SideCar.FileName)
+	}
+	return app.client.ImportAsset(ctx, a, imp)
+}
+
+// uploadWithRetries calls AssetUpload and retries with an exponential backoff when the error is transient.
+// Each attempt is limited by -upload-timeout, a timed out upload is retried.
+
+func (app *UpCmd) uploadWithRetries(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	delay := app.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := app.waitThrottle(ctx)
+		if err != nil {
+			return immich.AssetResponse{}, err
+		}
+		uploadCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout := app.uploadTimeout(a.Size()); timeout > 0 {
+			uploadCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		resp, err := app.client.AssetUpload(uploadCtx, a)
+		cancel()
+		if err == nil {
+			app.releaseThrottle()
+		}
+		var rle *immich.RateLimitError
+		if errors.As(err, &rle) {
+			app.increaseThrottle(rle.RetryAfter)
+			delay = max(delay, rle.RetryAfter)
+		}
+		if err == nil || attempt > app.UploadRetries || !immich.IsTransientError(err) {
+			return resp, err
+		}
+		app.Journal.Warning("Upload of %q failed, attempt %d/%d, retry in %s: %s", a.FileName, attempt, app.UploadRetries+1, delay, err)
+
+		// The next attempt must read the file from its beginning
+		a.Close()
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// callWithRetries calls f, an update of the albums, stacks, tags or metadata of the assets, and retries it
+// with an exponential backoff when the error is transient. These calls are retried -api-retries times,
+// the uploads being retried by uploadWithRetries. The final failures are counted for the summary.
+func (app *UpCmd) callWithRetries(ctx context.Context, what string, f func() error) error {
+	delay := app.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		var rle *immich.RateLimitError
+		if errors.As(err, &rle) {
+			delay = max(delay, rle.RetryAfter)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt > app.APIRetries || !immich.IsTransientError(err) {
+			atomic.AddInt64(&app.apiFailed, 1)
+			return err
+		}
+		app.Journal.Warning("%s failed, attempt %d/%d, retry in %s: %s", what, attempt, app.APIRetries+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// DefaultUploadMinRate is the slowest upload bandwidth accepted with -upload-timeout
+const DefaultUploadMinRate = ratelimit.Rate(100 * 1024)
+
+// uploadTimeout gives the time allowed to upload a file of the given size, 0 for no limit
+func (app *UpCmd) uploadTimeout(size int64) time.Duration {
+	if app.UploadTimeout <= 0 {
+		return 0
+	}
+	timeout := app.UploadTimeout
+	if app.UploadMinRate > 0 {
+		timeout += time.Duration(float64(size) / float64(app.UploadMinRate) * float64(time.Second))
+	}
+	return timeout
+}
+
+// When the server is overloaded (429), uploads are paused for a while before starting.
+// The pause is doubled at each new 429, and halved after each successful upload.
+
+const maxThrottle = time.Minute
+
+func (app *UpCmd) waitThrottle(ctx context.Context) error {
+	if app.throttle == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(app.throttle):
+		return nil
+	}
+}
+
+func (app *UpCmd) increaseThrottle(retryAfter time.Duration) {
+	app.throttle = min(max(2*app.throttle, app.RetryDelay, retryAfter, 100*time.Millisecond), maxThrottle)
+	app.Journal.Debug("The server is busy, uploads are paused %s", app.throttle)
+}
+
+func (app *UpCmd) releaseThrottle() {
+	if app.throttle == 0 {
+		return
+	}
+	app.throttle /= 2
+	if app.throttle < 100*time.Millisecond {
+		app.throttle = 0
+		app.Journal.Debug("The server is responsive, uploads resume at full speed")
+		return
+	}
+	app.Journal.Debug("Uploads are paused %s", app.throttle)
+}
+
+// isSelectedAlbum tells if one of the album's names matches -select-albums-regex and not -exclude-albums-regex.
+// The untitled albums are named after their folder with -keep-untitled-albums.
+func (app *UpCmd) isSelectedAlbum(al browser.LocalAlbum) bool {
+	return slices.ContainsFunc(app.albumNames(al), func(name string) bool {
+		if app.selectAlbums != nil && !app.selectAlbums.MatchString(name) {
+			return false
+		}
+		return app.excludeAlbums == nil || !app.excludeAlbums.MatchString(name)
+	})
+}
+
+// albumName gives the name of the album on the server, the first one with -album-merge-strategy=both
+func (app *UpCmd) albumName(al browser.LocalAlbum) string {
+	return app.albumNames(al)[0]
+}
+
+// albumNames gives the names of the album on the server. A takeout album has the title of its metadata and
+// the name of its folder, -album-merge-strategy chooses between them when they differ.
+func (app *UpCmd) albumNames(al browser.LocalAlbum) []string {
+	names := []string{al.Name}
+	if app.GooglePhotos {
+		folder := path.Base(al.Path)
+		switch {
+		case app.AlbumMergeStrategy == AlbumMergeFolder:
+			names = []string{folder}
+		case al.Name == "":
+			if app.KeepUntitled {
+				names = []string{folder}
+			}
+		case al.Path == "" || folder == al.Name:
+		case app.AlbumMergeStrategy == AlbumMergeBoth:
+			names = []string{al.Name, folder}
+		case app.AlbumMergeStrategy == AlbumMergeCombined:
+			names = []string{al.Name + " (" + folder + ")"}
+		}
+		if al.Shared {
+			for i := range names {
+				names[i] = app.SharedAlbumPrefix + names[i]
+			}
+		}
+	}
+	if app.FlattenAlbums {
+		for i := range names {
+			names[i] = strings.Join(strings.Fields(names[i]), " ")
+		}
+	}
+	return names
+}
+
+// Values of -album-merge-strategy
+const (
+	AlbumMergeMetadata = "metadata" // the title of the album's metadata
+	AlbumMergeFolder   = "folder"   // the name of the album's folder
+	AlbumMergeBoth     = "both"     // the assets are added to the album of each name
+	AlbumMergeCombined = "combined" // "title (folder)"
+)
+
+// setAlbumMergeStrategy checks -album-merge-strategy, -use-album-folder-as-name being the folder strategy
+func (app *UpCmd) setAlbumMergeStrategy() error {
+	app.AlbumMergeStrategy = strings.ToLower(app.AlbumMergeStrategy)
+	switch app.AlbumMergeStrategy {
+	case AlbumMergeMetadata, AlbumMergeFolder, AlbumMergeBoth, AlbumMergeCombined:
+	default:
+		return fmt.Errorf("invalid value %q for -album-merge-strategy, expecting metadata, folder, both or combined", app.AlbumMergeStrategy)
+	}
+	if app.AlbumMergeStrategy != AlbumMergeMetadata && !app.GooglePhotos {
+		return errors.New("the option -album-merge-strategy requires -google-photos")
+	}
+	if app.UseFolderAsAlbumName {
+		if app.AlbumMergeStrategy != AlbumMergeMetadata && app.AlbumMergeStrategy != AlbumMergeFolder {
+			return errors.New("the option -use-album-folder-as-name can't be used with -album-merge-strategy=" + app.AlbumMergeStrategy)
+		}
+		app.AlbumMergeStrategy = AlbumMergeFolder
+	}
 	return nil
+}
 
+// albumKey gives the name used to merge the albums with -flatten-albums
+func (app *UpCmd) albumKey(name string) string {
+	if !app.FlattenAlbums {
+		return name
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if app.FlattenAlbumsCI {
+		name = strings.ToLower(name)
+	}
+	return name
 }
 
-func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile, album string) bool {
-	for _, al := range a.Albums {
-		if app.albumName(al) == album {
-			return true
+// locationAlbum gives an album named after the city near the asset's GPS position.
+// The position is read from the file when not already known.
+func (app *UpCmd) locationAlbum(a *browser.LocalAssetFile) (browser.LocalAlbum, bool) {
+	lat, long := a.Latitude, a.Longitude
+	if lat == 0 && long == 0 && a.SideCar != nil {
+		lat, long = a.SideCar.Latitude, a.SideCar.Longitude
+	}
+	if lat == 0 && long == 0 {
+		f, err := a.FSys.Open(a.FileName)
+		if err != nil {
+			return browser.LocalAlbum{}, false
 		}
+		defer f.Close()
+		md, err := metadata.GetFromReader(f, a.Ext())
+		if err != nil {
+			return browser.LocalAlbum{}, false
+		}
+		lat, long = md.Latitude, md.Longitude
 	}
-	return false
+	if lat == 0 && long == 0 {
+		return browser.LocalAlbum{}, false
+	}
+	c, ok := app.geocoder.Locate(lat, long)
+	if !ok {
+		return browser.LocalAlbum{}, false
+	}
+	return browser.LocalAlbum{Path: c.String(), Name: c.String()}, true
 }
 
-func (a *UpCmd) ReadGoogleTakeOut(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
-	a.Delete = false
-	return gp.NewTakeout(ctx, a.Journal, fsyss...)
+// burstInfo reads the burst identifier and the sub-seconds of the date of capture in the file.
+// The precise date is used only when it matches the date of the asset, and when the date can come from the file.
+func (app *UpCmd) burstInfo(a *browser.LocalAssetFile) (time.Time, stacking.BurstInfo) {
+	info := stacking.BurstInfo{MotionPhoto: a.MotionPhoto}
+	if !app.StackBurst || a.FSys == nil {
+		return a.DateTaken, info
+	}
+	md, err := metadata.GetFileMetaData(a.FSys, a.FileName)
+	if err != nil {
+		return a.DateTaken, info
+	}
+	info.ID, info.Camera = md.BurstID, md.Camera
+	if md.SubSecond && !app.AssumeMetadataFromJSONOnly && (a.DateTaken.IsZero() || md.DateTaken.Truncate(time.Second).Equal(a.DateTaken.Truncate(time.Second))) {
+		info.SubSecond = true
+		return md.DateTaken, info
+	}
+	return a.DateTaken, info
 }
 
-func (a *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browser.Browser, error) {
-	return files.NewLocalFiles(ctx, a.Journal, fsyss...)
+// sideCarZone gives the zone of the date of capture written in the generated sidecars:
+// the zone given by -takeout-timezone to the dates of a takeout, nil for the local zone otherwise
+func (app *UpCmd) sideCarZone(a *browser.LocalAssetFile) *time.Location {
+	if app.GooglePhotos && app.TakeoutTimeZone != "" {
+		return a.DateTaken.Location()
+	}
+	return nil
 }
 
-// UploadAsset upload the asset on the server
-// Add the assets into listed albums
-// return ID of the asset
-
-func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (string, error) {
-	var resp immich.AssetResponse
-	var err error
-	if !app.DryRun {
-
-		if app.ForceSidecar {
-			sc := metadata.SideCar{}
-			sc.DateTaken = a.DateTaken
-			sc.Latitude = a.Latitude
-			sc.Longitude = a.Longitude
-			sc.Elevation = a.Altitude
-			sc.FileName = a.FileName + ".xmp"
+// stripGPS removes the GPS position of the asset before its upload.
+// A sidecar found next to the file is replaced by a generated one, with the same date.
+// Only the JPEG files can be rewritten, the position embedded in the other files is kept.
+func (app *UpCmd) stripGPS(a *browser.LocalAssetFile) {
+	a.Latitude, a.Longitude, a.Altitude = 0, 0, 0
+	sc := metadata.SideCar{DateTaken: a.DateTaken, TimeZone: app.sideCarZone(a), FileName: a.FileName + ".xmp"}
+	if a.SideCar != nil {
+		sc = *a.SideCar
+		sc.OnFSsys = false
+		sc.Latitude, sc.Longitude, sc.Elevation = 0, 0, 0
+	}
+	if metadata.CanStripGPS(a.Ext()) {
+		a.StripGPS = true
+		if a.SideCar != nil {
 			a.SideCar = &sc
 		}
-
-		resp, err = app.client.AssetUpload(ctx, a)
-	} else {
-		resp.ID = uuid.NewString()
+		return
 	}
-	if err != nil {
-		app.journalAsset(a, logger.SERVER_ERROR, err.Error())
-		return "", err
+	a.SideCar = &sc
+	app.journalAsset(a, logger.INFO, "the GPS position embedded in the file is kept, only the JPEG files can be rewritten")
+}
+
+// completeSideCar adds the description, the people, the rating and the orientation to the sidecar.
+// People are also written as keywords, as Lightroom does. Favorites are rated 5 stars.
+func (app *UpCmd) completeSideCar(a *browser.LocalAssetFile, sc *metadata.SideCar) {
+	sc.Description = a.Description
+	sc.People = a.People
+	sc.Keywords = a.People
+	if a.Favorite {
+		sc.Rating = 5
 	}
-	if !resp.Duplicate {
-		app.journalAsset(a, logger.UPLOADED, a.Title)
-		app.AssetIndex.AddLocalAsset(a, resp.ID)
-		app.mediaUploaded += 1
-		if app.CreateStacks {
-			app.stacks.ProcessAsset(resp.ID, a.FileName, a.DateTaken)
+	if a.FSys != nil {
+		if md, err := metadata.GetFileMetaData(a.FSys, a.FileName); err == nil {
+			sc.Orientation = md.Orientation
 		}
+	}
+}
 
-	} else {
-		app.journalAsset(a, logger.SERVER_DUPLICATE, "already on the server")
+// AddToAlbum records the asset to be added to the album at the end of the run.
+// The local file gives the date and the name used to choose the cover of the album, it can be nil.
+func (app *UpCmd) AddToAlbum(ID string, album string, a *browser.LocalAssetFile) {
+	l := app.updateAlbums[album]
+	if l == nil {
+		l = albumAssets{}
+	}
+	if _, ok := l[ID]; ok {
+		return
+	}
+	if album == app.FavoriteAlbum && a != nil {
+		app.markFavorite(ID, a, false, "added to the album "+album)
 	}
+	app.albumRank++
+	aa := albumAsset{rank: app.albumRank, present: app.AssetIndex.InAlbum(ID, album)}
+	if a != nil {
+		aa.date, aa.name = a.DateTaken, a.FileName
+	}
+	l[ID] = aa
+	app.updateAlbums[album] = l
+}
 
-	return resp.ID, nil
+// addAlbumDescription keeps the description of the album found in the source
+func (app *UpCmd) addAlbumDescription(album string, description string) {
+	if description == "" {
+		return
+	}
+	if app.albumDescs == nil {
+		app.albumDescs = map[string]string{}
+	}
+	app.albumDescs[album] = description
 }
 
-func (app *UpCmd) albumName(al browser.LocalAlbum) string {
-	Name := al.Name
-	if app.GooglePhotos {
-		switch {
-		case app.UseFolderAsAlbumName:
-			Name = path.Base(al.Path)
-		case app.KeepUntitled && Name == "":
-			Name = path.Base(al.Path)
-		}
+// descriptions gives the descriptions of the albums by album key
+func (app *UpCmd) descriptions() map[string]string {
+	r := map[string]string{}
+	for album, d := range app.albumDescs {
+		r[app.albumKey(album)] = d
 	}
-	return Name
+	if app.ImportIntoAlbum != "" && app.AlbumDescription != "" {
+		r[app.albumKey(app.ImportIntoAlbum)] = app.AlbumDescription
+	}
+	return r
 }
 
-func (app *UpCmd) AddToAlbum(ID string, album string) {
-	l := app.updateAlbums[album]
+// AddToTag records the asset to be tagged at the end of the run
+func (app *UpCmd) AddToTag(ID string, tag string) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return
+	}
+	l := app.updateTags[tag]
 	if l == nil {
 		l = map[string]any{}
 	}
 	l[ID] = nil
-	app.updateAlbums[album] = l
+	app.updateTags[tag] = l
+}
+
+// Values of -on-conflict
+const (
+	OnConflictSkip   = "skip"
+	OnConflictUpload = "upload"
+	OnConflictAsk    = "ask"
+)
+
+// onConflict tells if a file that can't be compared with a server's asset must be uploaded.
+// With -on-conflict=ask, the user decides, unless -yes or -dry-run is given.
+func (app *UpCmd) onConflict(ctx context.Context, advice *Advice) (bool, error) {
+	switch app.OnConflict {
+	case OnConflictSkip:
+		return false, nil
+	case OnConflictAsk:
+		if app.AssumeYes || app.DryRun {
+			return true, nil
+		}
+		r, err := confirm(ctx, advice.Message+". Upload it?", "n")
+		return r == "y", err
+	}
+	return true, nil
 }
 
 func (app *UpCmd) DeleteLocalAssets() error {
@@ -589,10 +2493,12 @@ func (app *UpCmd) DeleteLocalAssets() error {
 	for _, a := range app.deleteLocalList {
 		if !app.DryRun {
 			app.Journal.Warning("delete file %q", a.Title)
+			a.Close()
 			err := a.Remove()
 			if err != nil {
 				return err
 			}
+			app.report.LocalDeleted++
 		} else {
 			app.Journal.Warning("file %q not deleted, dry run mode", a.Title)
 		}
@@ -601,72 +2507,408 @@ func (app *UpCmd) DeleteLocalAssets() error {
 	return nil
 }
 
+// moveAsset deletes the local file of an uploaded asset.
+// With -checksum or -verify-uploads, the file is kept when its checksum doesn't match the server's one.
+func (app *UpCmd) moveAsset(ctx context.Context, a *browser.LocalAssetFile, ID string) {
+	if app.DryRun {
+		app.Journal.Warning("file %q not moved, dry run mode", a.FileName)
+		return
+	}
+	if app.CheckSum || app.VerifyUploads.N > 0 {
+		app.mediaVerified++
+		err := app.verifyAsset(ctx, uploadedAsset{ID: ID, a: a})
+		if err != nil {
+			app.mediaMismatch++
+			app.report.addFailure(a.FileName, err.Error())
+			app.Journal.Error("file %q not moved: %s", a.FileName, err)
+			return
+		}
+	}
+	a.Close()
+	err := a.Remove()
+	if err != nil {
+		app.Journal.Error("can't delete the file %q: %s", a.FileName, err)
+		return
+	}
+	app.Journal.Info("file %q moved to the server", a.FileName)
+	app.report.LocalDeleted++
+}
+
+// getServerAssetAlbums gets the albums of a server's asset, when not yet known
+func (app *UpCmd) getServerAssetAlbums(ctx context.Context, sa *immich.Asset) {
+	if sa.Albums != nil {
+		return
+	}
+	albums, err := app.client.GetAssetAlbums(ctx, sa.ID)
+	if err != nil {
+		app.Journal.Warning("can't get the albums of the server's asset %q: %s", sa.OriginalFileName, err)
+		return
+	}
+	sa.Albums = albums
+}
+
+// DeleteServerAssets moves the server's assets to the trash, or deletes them with -permanent
 func (app *UpCmd) DeleteServerAssets(ctx context.Context, ids []string) error {
-	app.Journal.Warning("%d server assets to delete.", len(ids))
+	action := "moved to the trash"
+	if app.Permanent {
+		action = "deleted permanently"
+	}
+	if app.DryRun {
+		app.Journal.Warning("%d server assets not %s, dry run mode", len(ids), action)
+		return nil
+	}
+	app.Journal.Warning("%d server assets %s", len(ids), action)
+	return app.client.DeleteAssets(ctx, ids, app.Permanent)
+}
 
-	if !app.DryRun {
-		err := app.client.DeleteAssets(ctx, ids, false)
-		return err
+// ManageStacks creates the stacks, -concurrent-stacks at a time, and tells the progress.
+// The creation stops when the context is cancelled. The stacks that can't be created are
+// reported at the end, the other ones being created anyway.
+func (app *UpCmd) ManageStacks(ctx context.Context, stacks []stacking.Stack) error {
+	if app.DryRun {
+		for _, s := range stacks {
+			app.Journal.OK("  Stacking %s skipped - dry run mode", strings.Join(s.Names, ", "))
+		}
+		return nil
 	}
-	app.Journal.Warning("%d server assets to delete. skipped dry-run mode", len(ids))
-	return nil
+	workers := max(app.ConcurrentStacks, 1)
+	sem := make(chan struct{}, workers)
+	var errs []error
+	mut := sync.Mutex{} // protects errs and stackCovers
+	wg := sync.WaitGroup{}
+	done := int64(0)
+
+	if app.stackCovers == nil {
+		app.stackCovers = map[string]string{}
+	}
+	for _, s := range stacks {
+		s := s
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			app.Journal.Warning("Stack creation interrupted, %d/%d stacks processed", done, len(stacks))
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := app.callWithRetries(ctx, "Stacking "+s.CoverID, func() error {
+				return app.client.StackAssets(ctx, s.CoverID, s.IDs)
+			})
+			n := atomic.AddInt64(&done, 1)
+			mut.Lock()
+			defer mut.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't stack %s: %w", strings.Join(s.Names, ", "), err))
+				return
+			}
+			for _, id := range s.IDs {
+				app.stackCovers[id] = s.CoverID
+			}
+			app.Journal.OK("  %d/%d stacked %s", n, len(stacks), strings.Join(s.Names, ", "))
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		app.Journal.Warning("%d/%d stacks couldn't be created", len(errs), len(stacks))
+	}
+	return errors.Join(errs...)
 }
 
 func (app *UpCmd) ManageAlbums(ctx context.Context) error {
-	if len(app.updateAlbums) > 0 {
-		serverAlbums, err := app.client.GetAllAlbums(ctx)
-		if err != nil {
-			return fmt.Errorf("can't get the album list from the server: %w", err)
-		}
-		for album, list := range app.updateAlbums {
-
-			found := false
-			for _, sal := range serverAlbums {
-				if sal.AlbumName == album {
-					found = true
-					if !app.DryRun {
-						app.Journal.OK("Update the album %s", album)
-						rr, err := app.client.AddAssetToAlbum(ctx, sal.ID, gen.MapKeys(list))
-						if err != nil {
-							return fmt.Errorf("can't update the album list from the server: %w", err)
-						}
-						added := 0
-						for _, r := range rr {
-							if r.Success {
-								added++
-							}
-							if !r.Success && r.Error != "duplicate" {
-								app.Journal.Warning("%s: %s", r.ID, r.Error)
-							}
-						}
-						if added > 0 {
-							app.Journal.OK("%d asset(s) added to the album %q", added, album)
-						}
-					} else {
-						app.Journal.OK("Update album %s skipped - dry run mode", album)
-					}
+	descriptions := app.descriptions()
+	if len(app.updateAlbums) == 0 && len(descriptions) == 0 {
+		return nil
+	}
+	var serverAlbums []immich.AlbumSimplified
+	err := app.callWithRetries(ctx, "Reading the albums", func() (err error) {
+		serverAlbums, err = app.client.GetAllAlbums(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("can't get the album list from the server: %w", err)
+	}
+	albumIDs := map[string][]string{} // by album key, the server may have several albums of the same name
+	albumNames := map[string]string{} // by album key
+	idNames := map[string]string{}    // by album ID
+	for _, sal := range serverAlbums {
+		k := app.albumKey(sal.AlbumName)
+		albumIDs[k] = append(albumIDs[k], sal.ID)
+		albumNames[k] = sal.AlbumName
+		idNames[sal.ID] = sal.AlbumName
+		if d, ok := descriptions[k]; ok && d != sal.Description {
+			app.setAlbumDescription(ctx, sal.AlbumName, sal.ID, d)
+		} else if d, ok := descriptions[app.albumKey(AlbumIDPrefix+sal.ID)]; ok && d != sal.Description {
+			app.setAlbumDescription(ctx, sal.AlbumName, sal.ID, d)
+		}
+	}
+
+	// The albums having the same key are merged into the server's one, or the first by name
+	updates := map[string]albumAssets{}
+	names := gen.MapKeys(app.updateAlbums)
+	slices.Sort(names)
+	for _, album := range names {
+		list := app.updateAlbums[album]
+		if list == nil {
+			continue
+		}
+		k := app.albumKey(album)
+		if id, ok := albumIDRef(album); ok {
+			// the album given by its ID is updated whatever its name
+			albumIDs[k], albumNames[k] = []string{id}, album
+		}
+		if _, ok := albumNames[k]; !ok {
+			albumNames[k] = album
+		}
+		name := albumNames[k]
+		if updates[name] == nil {
+			updates[name] = albumAssets{}
+		}
+		for id, aa := range list {
+			updates[name][id] = aa
+		}
+	}
+
+	workers := app.ConcurrentAlbums
+	if workers < 1 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	errs := make([]error, 0, len(app.updateAlbums))
+	errMut := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	albums := gen.MapKeys(updates)
+	slices.Sort(albums)
+	for _, album := range albums {
+		list := updates[album]
+		// the assets are added to all the server's albums of the same name
+		ids, exists := albumIDs[app.albumKey(album)]
+		if !exists {
+			ids = []string{""}
+		}
+		for _, albumID := range ids {
+			u := albumUpdate{name: album, id: albumID, exists: exists, description: descriptions[app.albumKey(album)]}
+			if id, ok := albumIDRef(album); ok && idNames[id] != "" {
+				u.name = idNames[id]
+			}
+			var members map[string]bool
+			if u.exists && app.AlbumImportExisting {
+				members, err = app.AssetIndex.AlbumMembers(ctx, app.client, u.id)
+				if err != nil {
+					app.Journal.Warning("can't get the assets of the album %q, all assets are sent: %s", album, err)
 				}
 			}
-			if found {
-				continue
+			// the assets are added in the order of the source, the one of the walk of the folders or the takeout
+			for _, id := range list.byRank() {
+				if list[id].present || members[id] {
+					u.present++
+				} else {
+					u.ids = append(u.ids, id)
+				}
+			}
+			if !u.exists {
+				u.cover = app.albumCover(list)
 			}
-			if list != nil {
-				if !app.DryRun {
-					app.Journal.OK("Create the album %s", album)
 
-					_, err := app.client.CreateAlbum(ctx, album, gen.MapKeys(list))
-					if err != nil {
-						return fmt.Errorf("can't create the album list from the server: %w", err)
-					}
-				} else {
-					app.Journal.OK("Create the album %s skipped - dry run mode", album)
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				err := app.updateAlbum(ctx, u)
+				if err != nil {
+					errMut.Lock()
+					errs = append(errs, err)
+					errMut.Unlock()
 				}
+			}()
+		}
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// albumUpdate is the change of an album at the end of the run
+type albumUpdate struct {
+	name        string
+	id          string // ID of the server's album, when it exists
+	exists      bool
+	ids         []string // Assets to add
+	present     int      // Assets already in the album according to the index of the server's albums
+	cover       string   // Cover of the created album, empty to let the server choose
+	description string   // Description of the created album
+}
+
+// updateAlbum creates the album when needed, and adds the assets by chunks of AlbumBatchSize.
+// The cover, when given, is set once all assets are in the album.
+// The description, when given, is set on the created album.
+func (app *UpCmd) updateAlbum(ctx context.Context, u albumUpdate) error {
+	if app.DryRun {
+		app.previewAlbum(ctx, u)
+		return nil
+	}
+
+	album, id := u.name, u.id
+	chunks := gen.Chunks(u.ids, app.AlbumBatchSize)
+	stats := reportAlbum{Present: u.present}
+	switch {
+	case !u.exists:
+		app.Journal.OK("Create the album %s", album)
+		var first []string
+		if len(chunks) > 0 {
+			first, chunks = chunks[0], chunks[1:]
+		}
+		var al immich.AlbumSimplified
+		err := app.callWithRetries(ctx, "Creation of the album "+album, func() (err error) {
+			al, err = app.client.CreateAlbum(ctx, album, first)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("can't create the album %q on the server: %w", album, err)
+		}
+		app.report.albumCreated()
+		stats.Added = len(first)
+		id = al.ID
+		if u.description != "" {
+			app.setAlbumDescription(ctx, album, id, u.description)
+		}
+		app.shareAlbum(ctx, album, id)
+	case len(u.ids) > 0:
+		app.Journal.OK("Update the album %s", album)
+		app.report.albumUpdated()
+	}
+
+	for _, chunk := range chunks {
+		var rr []immich.UpdateAlbumResult
+		err := app.callWithRetries(ctx, "Update of the album "+album, func() (err error) {
+			rr, err = app.client.AddAssetToAlbum(ctx, id, chunk)
+			return err
+		})
+		if err != nil {
+			app.report.albumAssets(album, stats)
+			return fmt.Errorf("can't update the album %q on the server: %w", album, err)
+		}
+		for _, r := range rr {
+			switch {
+			case r.Success:
+				stats.Added++
+			case r.Error == "duplicate":
+				stats.Present++
+			default:
+				stats.Errors++
+				app.Journal.Warning("%s: %s", r.ID, r.Error)
 			}
 		}
 	}
+	app.Journal.OK("Album %q: %d added, %d already present, %d errors", album, stats.Added, stats.Present, stats.Errors)
+	app.report.albumAssets(album, stats)
+	if u.cover != "" {
+		err := app.callWithRetries(ctx, "Cover of the album "+album, func() error {
+			return app.client.SetAlbumCover(ctx, id, u.cover)
+		})
+		if err != nil {
+			app.Journal.Warning("can't set the cover of the album %q: %s", album, err)
+		}
+	}
 	return nil
 }
 
+// previewAlbum tells what a real run would change in the album.
+// The assets of an existing album are asked to the server when the server's albums aren't indexed.
+func (app *UpCmd) previewAlbum(ctx context.Context, u albumUpdate) {
+	stats := reportAlbum{Added: len(u.ids), Present: u.present}
+	if !u.exists {
+		app.Journal.OK("Dry run: the album %q would be created with %d asset(s)", u.name, stats.Added)
+		app.previewShare(u.name)
+		app.report.albumCreated()
+		app.report.albumAssets(u.name, stats)
+		return
+	}
+	if !app.AssetIndex.albumsIndexed() && !app.AlbumImportExisting {
+		content, err := app.client.GetAlbumInfo(ctx, u.id)
+		if err != nil {
+			app.Journal.Warning("can't get the assets of the album %q: %s", u.name, err)
+		} else {
+			for _, a := range content.Assets {
+				if slices.Contains(u.ids, a.ID) {
+					stats.Added--
+					stats.Present++
+				}
+			}
+		}
+	}
+	app.Journal.OK("Dry run: %d asset(s) would be added to the album %q, %d already present", stats.Added, u.name, stats.Present)
+	if stats.Added > 0 {
+		app.report.albumUpdated()
+	}
+	app.report.albumAssets(u.name, stats)
+}
+
+// setAlbumDescription replaces the description of the album, a failure is only reported
+func (app *UpCmd) setAlbumDescription(ctx context.Context, album string, id string, description string) {
+	if app.DryRun {
+		app.Journal.OK("Set the description of the album %s skipped - dry run mode", album)
+		return
+	}
+	app.Journal.OK("Set the description of the album %s", album)
+	err := app.callWithRetries(ctx, "Description of the album "+album, func() error {
+		return app.client.SetAlbumDescription(ctx, id, description)
+	})
+	if err != nil {
+		app.Journal.Warning("can't set the description of the album %q: %s", album, err)
+	}
+}
+
+// ManageTags applies the tags to the uploaded assets, by chunks of AlbumBatchSize
+func (app *UpCmd) ManageTags(ctx context.Context) error {
+	var errs []error
+	tags := gen.MapKeys(app.updateTags)
+	slices.Sort(tags)
+	for _, tag := range tags {
+		ids := gen.MapKeys(app.updateTags[tag])
+		if app.DryRun {
+			app.Journal.OK("Tag %d asset(s) with %q skipped - dry run mode", len(ids), tag)
+			continue
+		}
+		tagged := 0
+		for _, chunk := range gen.Chunks(ids, app.AlbumBatchSize) {
+			var rr []immich.TagAssetsResult
+			err := app.callWithRetries(ctx, "Tagging with "+tag, func() (err error) {
+				rr, err = app.client.TagAssets(ctx, tag, chunk)
+				return err
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't tag the assets with %q: %w", tag, err))
+				break
+			}
+			for _, r := range rr {
+				if r.Success {
+					tagged++
+				}
+				if !r.Success && r.Error != "duplicate" {
+					app.Journal.Warning("%s: %s", r.AssetID, r.Error)
+				}
+			}
+		}
+		if tagged > 0 {
+			app.Journal.OK("%d asset(s) tagged with %q", tagged, tag)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // - - go:generate stringer -type=AdviceCode
 type AdviceCode int
 
@@ -719,11 +2961,12 @@ func formatBytes(s int) string {
 	return fmt.Sprintf("%.1f %s", roundedSize, suffixes[exp])
 }
 
-func (ai *AssetIndex) adviceIDontKnow(la *browser.LocalAssetFile) *Advice {
+func (ai *AssetIndex) adviceIDontKnow(la *browser.LocalAssetFile, sa *immich.Asset) *Advice {
 	return &Advice{
-		Advice:     IDontKnow,
-		Message:    fmt.Sprintf("Can't decide what to do with %q. Check this file", la.FileName),
-		LocalAsset: la,
+		Advice:      IDontKnow,
+		Message:     fmt.Sprintf("Can't decide if %q is on the server: it has no date of capture, and the server has an asset with the same name, date:%q, size:%s", la.FileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), formatBytes(sa.ExifInfo.FileSizeInByte)),
+		ServerAsset: sa,
+		LocalAsset:  la,
 	}
 }
 
@@ -735,6 +2978,14 @@ func (ai *AssetIndex) adviceSameOnServer(sa *immich.Asset) *Advice {
 		ServerAsset: sa,
 	}
 }
+func (ai *AssetIndex) adviceSameContentOnServer(sa *immich.Asset) *Advice {
+	return &Advice{
+		Advice:      SameOnServer,
+		Message:     fmt.Sprintf("An asset with the same content exists on the server with the name:%q. No need to upload.", sa.OriginalFileName),
+		ServerAsset: sa,
+	}
+}
+
 func (ai *AssetIndex) adviceSmallerOnServer(sa *immich.Asset) *Advice {
 	return &Advice{
 		Advice:      SmallerOnServer,
@@ -742,6 +2993,22 @@ func (ai *AssetIndex) adviceSmallerOnServer(sa *immich.Asset) *Advice {
 		ServerAsset: sa,
 	}
 }
+func (ai *AssetIndex) adviceLowerResolutionOnServer(la *browser.LocalAssetFile, sa *immich.Asset) *Advice {
+	return &Advice{
+		Advice:      SmallerOnServer,
+		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with a lower resolution:%dx%d exists on the server, the file has %dx%d. Replace it.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), sa.ExifInfo.ExifImageWidth, sa.ExifInfo.ExifImageHeight, la.Width, la.Height),
+		ServerAsset: sa,
+	}
+}
+
+func (ai *AssetIndex) adviceOverwriteServer(sa *immich.Asset) *Advice {
+	return &Advice{
+		Advice:      SmallerOnServer,
+		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q exists on the server. Replace it (-overwrite-server).", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime)),
+		ServerAsset: sa,
+	}
+}
+
 func (ai *AssetIndex) adviceBetterOnServer(sa *immich.Asset) *Advice {
 	return &Advice{
 		Advice:      BetterOnServer,
@@ -749,6 +3016,14 @@ func (ai *AssetIndex) adviceBetterOnServer(sa *immich.Asset) *Advice {
 		ServerAsset: sa,
 	}
 }
+func (ai *AssetIndex) adviceHigherResolutionOnServer(la *browser.LocalAssetFile, sa *immich.Asset) *Advice {
+	return &Advice{
+		Advice:      BetterOnServer,
+		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with a higher resolution:%dx%d exists on the server, the file has %dx%d. No need to upload.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), sa.ExifInfo.ExifImageWidth, sa.ExifInfo.ExifImageHeight, la.Width, la.Height),
+		ServerAsset: sa,
+	}
+}
+
 func (ai *AssetIndex) adviceNotOnServer() *Advice {
 	return &Advice{
 		Advice:  NotOnServer,
@@ -756,48 +3031,69 @@ func (ai *AssetIndex) adviceNotOnServer() *Advice {
 	}
 }
 
+// decidedAdvice gives the advice decided by the name, the date and the size of the file, when reading its content
+// for -checksum or -compare-resolution can't change it: the server has the same file, or a bigger copy
+// whose dimensions aren't compared. It returns nil when the content must be read.
+func (app *UpCmd) decidedAdvice(a *browser.LocalAssetFile) (*Advice, error) {
+	if !app.CheckSum && !app.CompareResolution || app.OverwriteServer {
+		return nil, nil
+	}
+	advice, err := app.AssetIndex.ShouldUpload(a, app.DateTolerance)
+	if err != nil {
+		return nil, err
+	}
+	if advice.Advice != SameOnServer && advice.Advice != BetterOnServer {
+		return nil, nil
+	}
+	sa := advice.ServerAsset
+	if app.CompareResolution && sa != app.AssetIndex.byID[a.DeviceAssetID()] && sa.ExifInfo.ExifImageWidth*sa.ExifInfo.ExifImageHeight > 0 {
+		// the dimensions of the file may reveal a better resolution
+		return nil, nil
+	}
+	app.sparedFiles++
+	app.sparedBytes += a.Size()
+	return advice, nil
+}
+
 // ShouldUpload check if the server has this asset
 //
 // The server may have different assets with the same name. This happens with photos produced by digital cameras.
 // The server may have the asset, but in lower resolution. Compare the taken date and resolution
 
-func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error) {
-	filename := la.Title
-	if path.Ext(filename) == "" {
-		filename += path.Ext(la.FileName)
-	}
-	var err error
+// ShouldUpload compares the local file with the server's assets.
+// The dates of capture of a file and a server's asset having the same name must be within the tolerance.
+// When the dimensions of both images are known, the one with the most pixels is the best, whatever its size in bytes.
+// The sizes in bytes decide otherwise.
+func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile, dateTolerance time.Duration) (*Advice, error) {
 	ID := la.DeviceAssetID()
 
-	sa := ai.byID[ID]
+	sa := ai.ByChecksum(la.Checksum)
+	if sa != nil {
+		// the same content exists on the server, whatever its name
+		return ai.adviceSameContentOnServer(sa), nil
+	}
+
+	sa = ai.byID[ID]
 	if sa != nil {
 		// the same ID exist on the server
 		return ai.adviceSameOnServer(sa), nil
 	}
 
-	var l []*immich.Asset
-
 	// check all files with the same name
-
-	n := filepath.Base(filename)
-	l = ai.byName[n]
-	if len(l) == 0 {
-		// n = strings.TrimSuffix(n, filepath.Ext(n))
-		l = ai.byName[n]
-	}
-
+	l := ai.ByName(localName(la))
 	if len(l) > 0 {
 		dateTaken := la.DateTaken
 		size := int(la.Size())
-		if err != nil {
-			return ai.adviceIDontKnow(la), nil
-
-		}
 		for _, sa = range l {
-			compareDate := compareDate(dateTaken, sa.ExifInfo.DateTimeOriginal.Time)
+			compareDate := compareDate(dateTaken, sa.ExifInfo.DateTimeOriginal.Time, dateTolerance)
 			compareSize := size - sa.ExifInfo.FileSizeInByte
+			comparePixels := comparePixels(la, sa)
 
 			switch {
+			case compareDate == 0 && comparePixels > 0:
+				return ai.adviceLowerResolutionOnServer(la, sa), nil
+			case compareDate == 0 && comparePixels < 0:
+				return ai.adviceHigherResolutionOnServer(la, sa), nil
 			case compareDate == 0 && compareSize == 0:
 				return ai.adviceSameOnServer(sa), nil
 			case compareDate == 0 && compareSize > 0:
@@ -806,17 +3102,45 @@ func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error)
 				return ai.adviceBetterOnServer(sa), nil
 			}
 		}
+		if dateTaken.IsZero() {
+			return ai.adviceIDontKnow(la, l[0]), nil
+		}
 	}
 	return ai.adviceNotOnServer(), nil
 }
 
-func compareDate(d1 time.Time, d2 time.Time) int {
-	diff := d1.Sub(d2)
+// localName gives the name of the file with its extension, the title of the takeout files may have none
+func localName(la *browser.LocalAssetFile) string {
+	filename := la.Title
+	if path.Ext(filename) == "" {
+		filename += path.Ext(la.FileName)
+	}
+	return filename
+}
+
+// comparePixels compares the pixel counts of the file and of the server's asset.
+// It returns 0 when one of them is unknown.
+func comparePixels(la *browser.LocalAssetFile, sa *immich.Asset) int {
+	local := la.Width * la.Height
+	server := sa.ExifInfo.ExifImageWidth * sa.ExifInfo.ExifImageHeight
+	if local == 0 || server == 0 {
+		return 0
+	}
+	return local - server
+}
+
+// DefaultDateTolerance is the default difference accepted between the dates of capture of the same asset
+const DefaultDateTolerance = 5 * time.Minute
+
+// compareDate compares the dates at the second, and considers them equal when their difference is within the tolerance.
+// A tolerance of 0 requires the same second.
+func compareDate(d1 time.Time, d2 time.Time, tolerance time.Duration) int {
+	diff := d1.Truncate(time.Second).Sub(d2.Truncate(time.Second))
 
 	switch {
-	case diff < -5*time.Minute:
+	case diff < -tolerance:
 		return -1
-	case diff >= 5*time.Minute:
+	case diff > tolerance:
 		return +1
 	}
 	return 0
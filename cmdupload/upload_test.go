@@ -1,17 +1,40 @@
 package cmdupload
 
 import (
+	"bytes"
 	"cmp"
 	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/ratelimit"
+	"github.com/simulot/immich-go/helpers/shutdown"
+	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
 	"github.com/simulot/immich-go/logger"
 
 	"github.com/kr/pretty"
@@ -38,10 +61,40 @@ func (c *stubIC) AddAssetToAlbum(context.Context, string, []string) ([]immich.Up
 func (c *stubIC) CreateAlbum(context.Context, string, []string) (immich.AlbumSimplified, error) {
 	return immich.AlbumSimplified{}, nil
 }
+func (c *stubIC) GetAlbumInfo(context.Context, string) (immich.AlbumContent, error) {
+	return immich.AlbumContent{}, nil
+}
+func (c *stubIC) GetAlbumAssetIDs(context.Context, string) ([]string, error) {
+	return nil, nil
+}
 func (c *stubIC) UpdateAssets(ctx context.Context, IDs []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentId string) error {
 	return nil
 }
 
+func (c *stubIC) SetAlbumCover(ctx context.Context, albumID string, assetID string) error {
+	return nil
+}
+
+func (c *stubIC) SetAlbumDescription(ctx context.Context, albumID string, description string) error {
+	return nil
+}
+
+func (c *stubIC) AddUsersToAlbum(ctx context.Context, albumID string, userIDs []string) error {
+	return nil
+}
+
+func (c *stubIC) CreateAlbumSharedLink(ctx context.Context, albumID string) (immich.SharedLink, error) {
+	return immich.SharedLink{}, nil
+}
+
+func (c *stubIC) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	return nil, nil
+}
+
+func (c *stubIC) TagAssets(ctx context.Context, tagName string, ids []string) ([]immich.TagAssetsResult, error) {
+	return nil, nil
+}
+
 func (c *stubIC) StackAssets(ctx context.Context, cover string, IDs []string) error {
 	return nil
 }
@@ -49,6 +102,24 @@ func (c *stubIC) StackAssets(ctx context.Context, cover string, IDs []string) er
 func (c *stubIC) UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*immich.Asset, error) {
 	return nil, nil
 }
+func (c *stubIC) SetAssetDescription(ctx context.Context, ID string, description string) error {
+	return nil
+}
+func (c *stubIC) UpdateAssetsMetadata(ctx context.Context, IDs []string, m immich.AssetMetadataUpdate) error {
+	return nil
+}
+
+func (c *stubIC) GetAssetByID(ctx context.Context, ID string) (*immich.Asset, error) {
+	return &immich.Asset{ID: ID}, nil
+}
+
+func (c *stubIC) GetServerCapabilities(ctx context.Context) (immich.ServerCapabilities, error) {
+	return immich.ServerCapabilities{Version: immich.ServerVersion{Major: 1, Minor: 91}}, nil
+}
+
+func (c *stubIC) ImportAsset(ctx context.Context, a *browser.LocalAssetFile, imp immich.AssetImport) (immich.AssetResponse, error) {
+	return immich.AssetResponse{}, nil
+}
 
 // type mockedBrowser struct {
 // 	assets []assets.LocalAssetFile
@@ -70,6 +141,7 @@ type icCatchUploadsAssets struct {
 
 	assets []string
 	albums map[string][]string
+	mut    sync.Mutex
 }
 
 func (c *icCatchUploadsAssets) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
@@ -79,12 +151,17 @@ func (c *icCatchUploadsAssets) AssetUpload(ctx context.Context, a *browser.Local
 	}, nil
 }
 func (c *icCatchUploadsAssets) AddAssetToAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.albums[album] = append(c.albums[album], ids...)
 	return nil, nil
 }
 func (c *icCatchUploadsAssets) CreateAlbum(ctx context.Context, album string, ids []string) (immich.AlbumSimplified, error) {
 	if album == "" {
 		panic("can't create album without name")
 	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if c.albums == nil {
 		c.albums = map[string][]string{}
 	}
@@ -207,6 +284,43 @@ func TestUpload(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Folders, album after folder and file name",
+			args: []string{
+				"-create-album-folder",
+				`-album-from-filename-regex=^PXL_(?P<album>\d{8})_0630[0-2]`,
+				"TEST_DATA/folder/high",
+			},
+			expectedErr: false,
+			expectedAssets: []string{
+				"AlbumA/PXL_20231006_063000139.jpg",
+				"AlbumA/PXL_20231006_063029647.jpg",
+				"AlbumA/PXL_20231006_063108407.jpg",
+				"AlbumA/PXL_20231006_063121958.jpg",
+				"AlbumA/PXL_20231006_063357420.jpg",
+				"AlbumB/PXL_20231006_063528961.jpg",
+				"AlbumB/PXL_20231006_063536303.jpg",
+				"AlbumB/PXL_20231006_063851485.jpg",
+			},
+			expectedAlbums: map[string][]string{
+				"AlbumA": {
+					"AlbumA/PXL_20231006_063000139.jpg",
+					"AlbumA/PXL_20231006_063029647.jpg",
+					"AlbumA/PXL_20231006_063108407.jpg",
+					"AlbumA/PXL_20231006_063121958.jpg",
+					"AlbumA/PXL_20231006_063357420.jpg",
+				},
+				"AlbumB": {
+					"AlbumB/PXL_20231006_063528961.jpg",
+					"AlbumB/PXL_20231006_063536303.jpg",
+					"AlbumB/PXL_20231006_063851485.jpg",
+				},
+				"20231006": {
+					"AlbumA/PXL_20231006_063000139.jpg",
+					"AlbumA/PXL_20231006_063029647.jpg",
+				},
+			},
+		},
 		{
 			name: "google photos, default options",
 			args: []string{
@@ -494,3 +608,3135 @@ func cmpSlices[T cmp.Ordered](a, b []T) bool {
 	slices.Sort(b)
 	return reflect.DeepEqual(a, b)
 }
+
+type icFlakyUploads struct {
+	icCatchUploadsAssets
+	failures int   // number of failures before the success
+	err      error // error returned on failure
+	hang     bool  // the failures wait for the end of the context
+	calls    int
+}
+
+func (c *icFlakyUploads) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.calls++
+	if c.calls <= c.failures && c.hang {
+		<-ctx.Done()
+		return immich.AssetResponse{}, ctx.Err()
+	}
+	if c.calls <= c.failures {
+		return immich.AssetResponse{}, c.err
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestUploadRetries(t *testing.T) {
+	connReset := &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+	testCases := []struct {
+		name           string
+		args           []string
+		failures       int
+		err            error
+		hang           bool
+		expectedCalls  int
+		expectedAssets []string
+		expectedFailed int64
+	}{
+		{
+			name:           "transient error, then success",
+			args:           []string{"-retry-delay=1ms"},
+			failures:       2,
+			err:            connReset,
+			expectedCalls:  3,
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+		{
+			name:           "transient error, retries exhausted",
+			args:           []string{"-retry-delay=1ms", "-upload-retries=1"},
+			failures:       5,
+			err:            connReset,
+			expectedCalls:  2,
+			expectedFailed: 1,
+		},
+		{
+			name:           "definitive error",
+			args:           []string{"-retry-delay=1ms"},
+			failures:       5,
+			err:            errors.New("bad request"),
+			expectedCalls:  1,
+			expectedFailed: 1,
+		},
+		{
+			name:           "server error, then success",
+			args:           []string{"-retry-delay=1ms"},
+			failures:       1,
+			err:            fmt.Errorf("upload: %w", &immich.HTTPError{StatusCode: http.StatusServiceUnavailable}),
+			expectedCalls:  2,
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+		{
+			name:           "client error",
+			args:           []string{"-retry-delay=1ms"},
+			failures:       5,
+			err:            fmt.Errorf("upload: %w", &immich.HTTPError{StatusCode: http.StatusBadRequest}),
+			expectedCalls:  1,
+			expectedFailed: 1,
+		},
+		{
+			name:           "rate limited, then success",
+			args:           []string{"-retry-delay=1ms"},
+			failures:       1,
+			err:            &immich.RateLimitError{HTTPError: immich.HTTPError{StatusCode: http.StatusTooManyRequests}, RetryAfter: 5 * time.Millisecond},
+			expectedCalls:  2,
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+		{
+			name:           "timeout, then success",
+			args:           []string{"-retry-delay=1ms", "-upload-timeout=10ms", "-upload-min-rate=0"},
+			failures:       2,
+			hang:           true,
+			expectedCalls:  3,
+			expectedAssets: []string{"PXL_20231006_063000139.jpg"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icFlakyUploads{
+				failures: tc.failures,
+				err:      tc.err,
+				hang:     tc.hang,
+			}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(tc.args, "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"))
+			if err != nil {
+				t.Errorf("can't instantiate the UploadCmd: %s", err)
+				return
+			}
+			for _, fsys := range app.fsys {
+				err = errors.Join(app.Run(ctx, []fs.FS{fsys}))
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if ic.calls != tc.expectedCalls {
+				t.Errorf("expected %d calls to AssetUpload, got %d", tc.expectedCalls, ic.calls)
+			}
+			if app.mediaFailed != tc.expectedFailed {
+				t.Errorf("expected %d failed uploads, got %d", tc.expectedFailed, app.mediaFailed)
+			}
+			if !cmpSlices(tc.expectedAssets, ic.assets) {
+				t.Errorf("expected upload differs ")
+				pretty.Ldiff(t, tc.expectedAssets, ic.assets)
+			}
+		})
+	}
+}
+
+type icFlakyAlbums struct {
+	icCatchUploadsAssets
+	failures map[string]int // number of failures before the success by album
+	calls    map[string]int
+}
+
+func (c *icFlakyAlbums) CreateAlbum(ctx context.Context, album string, ids []string) (immich.AlbumSimplified, error) {
+	c.mut.Lock()
+	c.calls[album]++
+	failed := c.calls[album] <= c.failures[album]
+	c.mut.Unlock()
+	if failed {
+		return immich.AlbumSimplified{}, &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+	return c.icCatchUploadsAssets.CreateAlbum(ctx, album, ids)
+}
+
+func TestAPIRetries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/PXL_20231006_063000139.jpg": {Data: make([]byte, 10)},
+		"b/PXL_20231006_063001139.jpg": {Data: make([]byte, 20)},
+		"c/PXL_20231006_063002139.jpg": {Data: make([]byte, 30)},
+	}
+	ic := &icFlakyAlbums{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		failures:             map[string]int{"a": 1, "b": 5},
+		calls:                map[string]int{},
+	}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-create-album-folder", "-retry-delay=1ms", "-api-retries=2", "-upload-retries=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the album b fails after its retries, the album c is created anyway
+	expected := map[string]int{"a": 2, "b": 3, "c": 1}
+	if !reflect.DeepEqual(ic.calls, expected) {
+		t.Errorf("expected the calls %v, got %v", expected, ic.calls)
+	}
+	if len(ic.albums["a"]) != 1 || len(ic.albums["c"]) != 1 || ic.albums["b"] != nil {
+		t.Errorf("the albums a and c should be created, got %v", ic.albums)
+	}
+	if app.apiFailed != 1 {
+		t.Errorf("expected 1 failed update, got %d", app.apiFailed)
+	}
+
+	_, err = NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-api-retries=-1"})
+	if err == nil {
+		t.Error("a negative -api-retries should be rejected")
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	for _, tc := range []struct {
+		maxErrors     int
+		expectedCalls int
+	}{
+		{maxErrors: 0, expectedCalls: 8},
+		{maxErrors: 3, expectedCalls: 3},
+	} {
+		ic := &icFlakyUploads{failures: 100, err: errors.New("server down")}
+		ctx := context.Background()
+		report := filepath.Join(t.TempDir(), "report.json")
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-max-errors=" + strconv.Itoa(tc.maxErrors), "-report=" + report, "TEST_DATA/folder/low"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if ic.calls != tc.expectedCalls || app.mediaFailed != int64(tc.expectedCalls) {
+			t.Errorf("-max-errors=%d: expected %d failed uploads, got %d calls and %d failures", tc.maxErrors, tc.expectedCalls, ic.calls, app.mediaFailed)
+		}
+		b, rerr := os.ReadFile(report)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		var r runReport
+		if rerr = json.Unmarshal(b, &r); rerr != nil {
+			t.Fatal(rerr)
+		}
+		aborted := tc.maxErrors > 0
+		if errors.Is(err, errMaxErrors) != aborted || (r.Aborted != "") != aborted {
+			t.Errorf("-max-errors=%d: unexpected end of the run, error: %v, report: %q", tc.maxErrors, err, r.Aborted)
+		}
+	}
+
+	if _, err := NewUpCmd(context.Background(), &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-max-errors=-1", "TEST_DATA/folder/low"}); err == nil {
+		t.Error("a negative -max-errors should be rejected")
+	}
+}
+
+func TestConcurrentFailures(t *testing.T) {
+	aborts := int64(0)
+	app := UpCmd{MaxErrors: 50, abortRun: func(error) { atomic.AddInt64(&aborts, 1) }}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.countFailure()
+		}()
+	}
+	wg.Wait()
+	if app.mediaFailed != 200 || aborts != 151 {
+		t.Errorf("expected 200 failures and 151 calls to abort the run, got %d and %d", app.mediaFailed, aborts)
+	}
+}
+
+func TestUploadTimeout(t *testing.T) {
+	tc := []struct {
+		timeout  time.Duration
+		rate     ratelimit.Rate
+		size     int64
+		expected time.Duration
+	}{
+		{size: 1 << 30, expected: 0},
+		{timeout: time.Minute, size: 1 << 20, expected: time.Minute},
+		{timeout: time.Minute, rate: DefaultUploadMinRate, size: 1 << 20, expected: time.Minute + 10240*time.Millisecond},
+		{timeout: time.Minute, rate: 1 << 20, size: 1 << 30, expected: time.Minute + 1024*time.Second},
+	}
+	for _, c := range tc {
+		app := UpCmd{UploadTimeout: c.timeout, UploadMinRate: c.rate}
+		if got := app.uploadTimeout(c.size); got != c.expected {
+			t.Errorf("timeout %s, rate %s, size %d: expected %s, got %s", c.timeout, c.rate, c.size, c.expected, got)
+		}
+	}
+
+	// the upload deadline doesn't survive the cancellation of the run
+	ic := &icFlakyUploads{failures: 10, hang: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-upload-timeout=1h", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = app.uploadWithRetries(ctx, &browser.LocalAssetFile{FileName: "a.jpg", Title: "a.jpg"})
+	if !errors.Is(err, context.Canceled) || ic.calls != 1 {
+		t.Errorf("expected the upload canceled after 1 call, got %v after %d calls", err, ic.calls)
+	}
+}
+
+type icStacks struct {
+	icCatchUploadsAssets
+	stacks map[string][]string // stacked IDs by cover
+}
+
+func (c *icStacks) StackAssets(ctx context.Context, cover string, IDs []string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.stacks[cover] = append(c.stacks[cover], IDs...)
+	return nil
+}
+
+type icSlowStacks struct {
+	icStacks
+	running, maxRunning int
+	started             chan struct{} // receives each started stack, nil to not report them
+}
+
+func (c *icSlowStacks) StackAssets(ctx context.Context, cover string, IDs []string) error {
+	c.mut.Lock()
+	c.running++
+	c.maxRunning = max(c.maxRunning, c.running)
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		c.running--
+		c.mut.Unlock()
+	}()
+	if c.started != nil {
+		c.started <- struct{}{}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if cover == "bad" {
+		return errors.New("invalid stack")
+	}
+	return c.icStacks.StackAssets(ctx, cover, IDs)
+}
+
+func TestManageStacks(t *testing.T) {
+	stacks := []stacking.Stack{}
+	for i := 0; i < 10; i++ {
+		cover := fmt.Sprintf("c%d", i)
+		stacks = append(stacks, stacking.Stack{CoverID: cover, IDs: []string{cover, fmt.Sprintf("s%d", i)}, Names: []string{cover}})
+	}
+	stacks[3].CoverID = "bad"
+
+	ic := &icSlowStacks{icStacks: icStacks{stacks: map[string][]string{}}}
+	app := UpCmd{client: ic, Journal: logger.NewJournal(logger.NoLogger{}), ConcurrentStacks: 3}
+	err := app.ManageStacks(context.Background(), stacks)
+	if err == nil || !strings.Contains(err.Error(), "invalid stack") {
+		t.Errorf("expected the error of the bad stack, got %v", err)
+	}
+	if len(ic.stacks) != 9 || len(app.stackCovers) != 18 {
+		t.Errorf("expected the 9 other stacks created, got %d stacks and %d covers", len(ic.stacks), len(app.stackCovers))
+	}
+	if ic.maxRunning > 3 {
+		t.Errorf("expected at most 3 stacks created at once, got %d", ic.maxRunning)
+	}
+
+	// the creation stops when the context is cancelled
+	ic = &icSlowStacks{icStacks: icStacks{stacks: map[string][]string{}}, started: make(chan struct{})}
+	app = UpCmd{client: ic, Journal: logger.NewJournal(logger.NoLogger{}), ConcurrentStacks: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-ic.started
+		cancel()
+		for range ic.started {
+		}
+	}()
+	err = app.ManageStacks(ctx, stacks)
+	close(ic.started)
+	if !errors.Is(err, context.Canceled) || len(ic.stacks) > 2 {
+		t.Errorf("expected the creation canceled after the first stacks, got %v after %d stacks", err, len(ic.stacks))
+	}
+}
+
+func TestStackBurstMetadata(t *testing.T) {
+	ic := &icStacks{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, stacks: map[string][]string{}}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"TEST_DATA/bursts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range ic.stacks {
+		slices.Sort(l)
+	}
+	// the Canon photos are stacked by their sub-seconds, the iPhone ones by their burst UUID
+	expected := map[string][]string{
+		"3H2A0101.JPG": {"3H2A0102.JPG", "3H2A0103.JPG"},
+		"IMG_0001.JPG": {"IMG_0005.JPG"},
+	}
+	if !reflect.DeepEqual(ic.stacks, expected) {
+		t.Errorf("expected the stacks %v, got %v", expected, ic.stacks)
+	}
+}
+
+type icAlbumCalls struct {
+	icCatchUploadsAssets
+	calls int
+}
+
+func (c *icAlbumCalls) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "existing", AlbumName: "existing"}}, nil
+}
+
+func (c *icAlbumCalls) AddAssetToAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.mut.Lock()
+	c.calls++
+	c.mut.Unlock()
+	return c.icCatchUploadsAssets.AddAssetToAlbum(ctx, album, ids)
+}
+
+func TestManageAlbumsBatches(t *testing.T) {
+	ic := &icAlbumCalls{}
+	ic.albums = map[string][]string{}
+	app := UpCmd{
+		client:           ic,
+		Journal:          logger.NewJournal(logger.NoLogger{}),
+		AlbumBatchSize:   2,
+		ConcurrentAlbums: 2,
+		updateAlbums: map[string]albumAssets{
+			"existing": {"a": {}, "b": {}, "c": {}},
+			"new":      {"d": {}, "e": {}, "f": {}, "g": {}, "h": {}},
+			"other":    {"i": {}},
+		},
+	}
+
+	err := app.ManageAlbums(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"existing": {"a", "b", "c"},
+		"new":      {"d", "e", "f", "g", "h"},
+		"other":    {"i"},
+	}
+	if !cmpAlbums(expected, ic.albums) {
+		t.Errorf("expected albums differs")
+		pretty.Ldiff(t, expected, ic.albums)
+	}
+	// existing: 2 calls, new: created with 2 assets then 2 calls
+	if ic.calls != 4 {
+		t.Errorf("expected 4 calls to AddAssetToAlbum, got %d", ic.calls)
+	}
+}
+
+// icAlbumResults answers "duplicate" for the assets already in the albums, and an error for "bad"
+type icAlbumResults struct {
+	icAlbumCalls
+}
+
+func (c *icAlbumResults) AddAssetToAlbum(ctx context.Context, album string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	rr := []immich.UpdateAlbumResult{}
+	for _, id := range ids {
+		switch {
+		case id == "bad":
+			rr = append(rr, immich.UpdateAlbumResult{ID: id, Error: "not_found"})
+		case slices.Contains(c.albums[album], id):
+			rr = append(rr, immich.UpdateAlbumResult{ID: id, Error: "duplicate"})
+		default:
+			c.albums[album] = append(c.albums[album], id)
+			rr = append(rr, immich.UpdateAlbumResult{ID: id, Success: true})
+		}
+	}
+	return rr, nil
+}
+
+func TestManageAlbumsSummary(t *testing.T) {
+	ic := &icAlbumResults{}
+	ic.albums = map[string][]string{"existing": {"a", "b"}}
+	app := UpCmd{
+		client:         ic,
+		Journal:        logger.NewJournal(logger.NoLogger{}),
+		AlbumBatchSize: 2,
+		report:         newRunReport(),
+		updateAlbums: map[string]albumAssets{
+			"existing": {"a": {}, "b": {}, "c": {}, "bad": {}},
+			"new":      {"d": {}, "e": {}, "f": {}},
+		},
+	}
+	err := app.ManageAlbums(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]reportAlbum{
+		"existing": {Added: 1, Present: 2, Errors: 1},
+		"new":      {Added: 3},
+	}
+	if !reflect.DeepEqual(app.report.Albums, expected) {
+		t.Errorf("expected the albums %v, got %v", expected, app.report.Albums)
+	}
+}
+
+// icSameNameAlbums has two albums of the same name
+type icSameNameAlbums struct {
+	icAlbumResults
+}
+
+func (c *icSameNameAlbums) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "trip-1", AlbumName: "Trip"}, {ID: "trip-2", AlbumName: "Trip"}}, nil
+}
+
+func TestManageAlbumsSameName(t *testing.T) {
+	ic := &icSameNameAlbums{}
+	ic.albums = map[string][]string{}
+	app := UpCmd{
+		client:         ic,
+		Journal:        logger.NewJournal(logger.NoLogger{}),
+		AlbumBatchSize: 10,
+		report:         newRunReport(),
+		updateAlbums: map[string]albumAssets{
+			"Trip": {"a": {}, "b": {}},
+		},
+	}
+	err := app.ManageAlbums(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"trip-1": {"a", "b"},
+		"trip-2": {"a", "b"},
+	}
+	if !cmpAlbums(expected, ic.albums) {
+		t.Errorf("expected albums differs")
+		pretty.Ldiff(t, expected, ic.albums)
+	}
+	if s := app.report.Albums["Trip"]; s.Added != 4 {
+		t.Errorf("expected 4 assets added to the albums Trip, got %+v", s)
+	}
+}
+
+type icDescriptions struct {
+	icCatchUploadsAssets
+	descriptions map[string]string
+}
+
+func (c *icDescriptions) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "existing", AlbumName: "Existing", Description: "old"}}, nil
+}
+
+func (c *icDescriptions) SetAlbumDescription(ctx context.Context, albumID string, description string) error {
+	c.descriptions[albumID] = description
+	return nil
+}
+
+func TestAlbumDescription(t *testing.T) {
+	fsys := fstest.MapFS{"photo.jpg": {Data: []byte("photo")}}
+	tc := []struct {
+		args     []string
+		expected map[string]string
+	}{
+		{args: []string{"-album", "New", "-album-description", "new"}, expected: map[string]string{"New": "new"}},
+		{args: []string{"-album", "existing", "-album-description", "new"}, expected: map[string]string{"existing": "new"}},
+		{args: []string{"-album", "Existing", "-album-description", "old"}, expected: map[string]string{}},
+		{args: []string{"-album", "Existing"}, expected: map[string]string{}},
+		{args: []string{"-album", "New", "-album-description", "new", "-dry-run"}, expected: map[string]string{}},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icDescriptions{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, descriptions: map[string]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ic.descriptions, c.expected) {
+				t.Errorf("expected the descriptions %v, got %v", c.expected, ic.descriptions)
+			}
+		})
+	}
+}
+
+type icShares struct {
+	icCatchUploadsAssets
+	shares map[string][]string // user IDs by album ID
+	links  []string            // albums shared by a link
+}
+
+func (c *icShares) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "existing", AlbumName: "Existing"}}, nil
+}
+
+func (c *icShares) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	return []immich.User{{ID: "U1", Email: "alice@example.com"}, {ID: "U2", Email: "bob@example.com"}}, nil
+}
+
+func (c *icShares) AddUsersToAlbum(ctx context.Context, albumID string, userIDs []string) error {
+	c.shares[albumID] = append(c.shares[albumID], userIDs...)
+	return nil
+}
+
+func (c *icShares) CreateAlbumSharedLink(ctx context.Context, albumID string) (immich.SharedLink, error) {
+	c.links = append(c.links, albumID)
+	return immich.SharedLink{ID: "L1", Key: "K1", URL: "http://server/share/K1"}, nil
+}
+
+func TestAlbumShare(t *testing.T) {
+	fsys := fstest.MapFS{"photo.jpg": {Data: []byte("photo")}}
+	tc := []struct {
+		args   []string
+		shares map[string][]string
+		links  []string
+	}{
+		{args: []string{"-album", "New"}, shares: map[string][]string{}},
+		{args: []string{"-album", "New", "-album-share-with", "Bob@example.com,U1"}, shares: map[string][]string{"New": {"U2", "U1"}}},
+		{args: []string{"-album", "Existing", "-album-share-with", "bob@example.com", "-album-visibility", "link"}, shares: map[string][]string{}},
+		{args: []string{"-album", "New", "-album-visibility", "LINK"}, shares: map[string][]string{}, links: []string{"New"}},
+		{args: []string{"-album", "New", "-album-share-with", "U2", "-album-visibility", "link", "-dry-run"}, shares: map[string][]string{}},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icShares{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, shares: map[string][]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ic.shares, c.shares) {
+				t.Errorf("expected the shares %v, got %v", c.shares, ic.shares)
+			}
+			if !slices.Equal(ic.links, c.links) {
+				t.Errorf("expected the shared links of %v, got %v", c.links, ic.links)
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"-album", "New", "-album-share-with", "carol@example.com"},
+		{"-album", "New", "-album-visibility", "public"},
+	} {
+		ic := &icShares{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, shares: map[string][]string{}}
+		_, err := NewUpCmd(context.Background(), ic, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+func TestUploadThrottle(t *testing.T) {
+	app := UpCmd{
+		Journal:    logger.NewJournal(logger.NoLogger{}),
+		RetryDelay: time.Second,
+	}
+
+	app.increaseThrottle(0)
+	if app.throttle != time.Second {
+		t.Errorf("expected a pause of 1s, got %s", app.throttle)
+	}
+	app.increaseThrottle(5 * time.Second)
+	if app.throttle != 5*time.Second {
+		t.Errorf("expected the pause requested by the server, got %s", app.throttle)
+	}
+	app.increaseThrottle(0)
+	if app.throttle != 10*time.Second {
+		t.Errorf("expected a pause of 10s, got %s", app.throttle)
+	}
+	for i := 0; i < 10 && app.throttle > 0; i++ {
+		app.releaseThrottle()
+	}
+	if app.throttle != 0 {
+		t.Errorf("expected no more pause after successful uploads, got %s", app.throttle)
+	}
+}
+
+func TestLocationAlbum(t *testing.T) {
+	app, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-album-by-location", "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		a         browser.LocalAssetFile
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "position from metadata",
+			a:         browser.LocalAssetFile{Latitude: 48.8584, Longitude: 2.2945},
+			want:      "Paris, France",
+			wantFound: true,
+		},
+		{
+			name:      "position from the sidecar",
+			a:         browser.LocalAssetFile{SideCar: &metadata.SideCar{Latitude: 41.4036, Longitude: 2.1744}},
+			want:      "Barcelona, Spain",
+			wantFound: true,
+		},
+		{
+			name: "no position",
+			a:    browser.LocalAssetFile{FSys: os.DirFS("TEST_DATA/folder/low"), FileName: "PXL_20231006_063000139.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			al, found := app.locationAlbum(&tt.a)
+			if found != tt.wantFound {
+				t.Fatalf("locationAlbum() found = %v, want %v", found, tt.wantFound)
+			}
+			if al.Name != tt.want {
+				t.Errorf("locationAlbum() = %q, want %q", al.Name, tt.want)
+			}
+		})
+	}
+}
+
+type icDeviceUUID struct {
+	icCatchUploadsAssets
+	uuid           string
+	deviceAssetIDs []string
+}
+
+func (c *icDeviceUUID) SetDeviceUUID(uuid string) *immich.ImmichClient {
+	c.uuid = uuid
+	return nil
+}
+
+func (c *icDeviceUUID) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.deviceAssetIDs = append(c.deviceAssetIDs, c.uuid+"/"+a.DeviceAssetID())
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestDeviceUUID(t *testing.T) {
+	run := func() []string {
+		ic := &icDeviceUUID{uuid: "hostname"}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-device-uuid=my-library", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fsys := range app.fsys {
+			err = errors.Join(err, app.Run(ctx, []fs.FS{fsys}))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ic.deviceAssetIDs
+	}
+
+	first, second := run(), run()
+	if len(first) != 1 {
+		t.Fatalf("expected 1 upload, got %d", len(first))
+	}
+	if !slices.Equal(first, second) {
+		t.Errorf("device asset IDs differ between runs: %v, %v", first, second)
+	}
+	if !strings.HasPrefix(first[0], "my-library/") {
+		t.Errorf("the device UUID isn't used: %s", first[0])
+	}
+}
+
+type icServerAssets struct {
+	stubIC
+	assets []*immich.Asset
+}
+
+func (c *icServerAssets) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.assets {
+		filter(a)
+	}
+	return nil
+}
+
+func TestArchivedServerAssets(t *testing.T) {
+	ic := &icServerAssets{
+		assets: []*immich.Asset{
+			{ID: "1", OriginalFileName: "visible", OriginalPath: "upload/visible.jpg"},
+			{ID: "2", OriginalFileName: "archived", OriginalPath: "upload/archived.jpg", IsArchived: true},
+			{ID: "3", OriginalFileName: "trashed", OriginalPath: "upload/trashed.jpg", IsTrashed: true},
+		},
+	}
+	testCases := []struct {
+		args     []string
+		expected int
+	}{
+		{args: nil, expected: 2},
+		{args: []string{"-include-archived"}, expected: 2},
+		{args: []string{"-include-archived=false"}, expected: 1},
+		{args: []string{"-exclude-archived"}, expected: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(tc.args, "TEST_DATA/folder/low"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.waitAssetIndex(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if app.AssetIndex.Len() != tc.expected {
+				t.Errorf("expected %d server assets, got %d", tc.expected, app.AssetIndex.Len())
+			}
+			if a := app.AssetIndex.byName["archived.jpg"]; (len(a) > 0) != (tc.expected == 2) {
+				t.Errorf("unexpected indexation of the archived asset: %v", a)
+			}
+		})
+	}
+}
+
+type icNoScan struct {
+	icCatchUploadsAssets
+	scanned bool
+}
+
+func (c *icNoScan) GetAllAssetsWithFilter(context.Context, *immich.GetAssetOptions, func(*immich.Asset)) error {
+	c.scanned = true
+	return nil
+}
+
+func TestNoServerScan(t *testing.T) {
+	ic := &icNoScan{}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-no-server-scan", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fsys := range app.fsys {
+		err = errors.Join(err, app.Run(ctx, []fs.FS{fsys}))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ic.scanned {
+		t.Errorf("the server's assets have been scanned")
+	}
+	if !slices.Equal(ic.assets, []string{"PXL_20231006_063000139.jpg"}) {
+		t.Errorf("unexpected uploads: %v", ic.assets)
+	}
+}
+
+func TestReport(t *testing.T) {
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	ctx := context.Background()
+	report := t.TempDir() + "/report.json"
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-report=" + report, "-album=ALBUM", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fsys := range app.fsys {
+		err = errors.Join(err, app.Run(ctx, []fs.FS{fsys}))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r runReport
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.MediaCount != 1 || r.MediaUploaded != 1 || r.MediaFailed != 0 {
+		t.Errorf("unexpected counts: %d media, %d uploaded, %d failed", r.MediaCount, r.MediaUploaded, r.MediaFailed)
+	}
+	if r.Advices[NotOnServer.String()] != 1 {
+		t.Errorf("unexpected advices: %v", r.Advices)
+	}
+	if r.AlbumsCreated != 1 {
+		t.Errorf("expected 1 album created, got %d", r.AlbumsCreated)
+	}
+}
+
+func TestConcurrentMediaCount(t *testing.T) {
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-exclude-types=.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"photo.jpg": {Data: []byte("photo")}}
+
+	const n = 200
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := app.handleAsset(ctx, &browser.LocalAssetFile{FSys: fsys, FileName: "photo.jpg", Title: "photo.jpg"})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if app.mediaCount != n {
+		t.Errorf("expected %d media, got %d", n, app.mediaCount)
+	}
+}
+
+func TestDateFallback(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dated.jpg":   {Data: []byte("dated"), ModTime: d},
+		"old.jpg":     {Data: []byte("old"), ModTime: d.AddDate(-1, 0, 0)},
+		"nodate1.jpg": {Data: []byte("no date")},
+		"nodate2.jpg": {Data: []byte("no date either")},
+	}
+	tc := []struct {
+		args     []string
+		uploaded []string
+		undated  []string
+		err      bool
+	}{
+		{args: nil, uploaded: []string{"dated.jpg"}, undated: []string{"nodate1.jpg", "nodate2.jpg", "old.jpg"}},
+		{args: []string{"-date-fallback", "MODTIME"}, uploaded: []string{"dated.jpg"}, undated: []string{"nodate1.jpg", "nodate2.jpg"}},
+		{args: []string{"-date-fallback", "now"}, err: true},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-date=2023-10"}, c.args...))
+			if c.err {
+				if err == nil {
+					t.Error("the command should be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.waitAssetIndex(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.AssetIndex = &AssetIndex{}
+			app.AssetIndex.ReIndex()
+			for _, name := range []string{"dated.jpg", "nodate1.jpg", "nodate2.jpg", "old.jpg"} {
+				a := &browser.LocalAssetFile{FSys: fsys, FileName: name, Title: name, FileSize: len(fsys[name].Data)}
+				if name == "dated.jpg" {
+					a.DateTaken = d
+				}
+				err = app.handleAsset(ctx, a)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+			slices.Sort(app.undated)
+			if !slices.Equal(app.undated, c.undated) {
+				t.Errorf("expected the files without date %v, got %v", c.undated, app.undated)
+			}
+		})
+	}
+}
+
+func TestHashCache(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"photo.jpg": {Data: []byte("photo"), ModTime: d}}
+	cache := filepath.Join(t.TempDir(), "hashes.json")
+	ctx := context.Background()
+
+	checksum := func() string {
+		app, err := NewUpCmd(ctx, &icCatchUploadsAssets{}, logger.NoLogger{}, []string{"-hash-cache", cache})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := app.checksum(&browser.LocalAssetFile{FSys: fsys, FileName: "photo.jpg", Title: "photo.jpg"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = app.hashCache.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	first := checksum()
+	// the content changes, but neither the size nor the date: the cached checksum is used
+	fsys["photo.jpg"].Data = []byte("PHOTO")
+	if h := checksum(); h != first {
+		t.Errorf("expected the cached checksum %q, got %q", first, h)
+	}
+	fsys["photo.jpg"].ModTime = d.Add(time.Minute)
+	if h := checksum(); h == first {
+		t.Error("the checksum of a modified file should be computed again")
+	}
+}
+
+type icUploadedContent struct {
+	icCatchUploadsAssets
+	content  map[string][]byte
+	sidecars map[string][]byte
+}
+
+func (c *icUploadedContent) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	f, err := a.Open()
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	c.content[a.FileName], err = io.ReadAll(f)
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	if a.SideCar != nil {
+		c.sidecars[a.FileName], err = a.SideCar.Bytes()
+	}
+	return immich.AssetResponse{ID: a.FileName}, err
+}
+
+func TestStripGPS(t *testing.T) {
+	jpg, err := os.ReadFile("../immich/metadata/TEST_DATA/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"photo.jpg": &fstest.MapFile{Data: jpg},
+		"image.png": &fstest.MapFile{Data: []byte("png")},
+	}
+	ic := &icUploadedContent{content: map[string][]byte{}, sidecars: map[string][]byte{}}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-strip-gps", "-force-sidecar", "-checksum", "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := ic.content["photo.jpg"]
+	if len(uploaded) != len(jpg) {
+		t.Fatalf("the size of the file should be kept, got %d bytes instead of %d", len(uploaded), len(jpg))
+	}
+	md, err := metadata.GetFromReader(bytes.NewReader(uploaded), ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Latitude != 0 || md.Longitude != 0 || md.DateTaken.IsZero() {
+		t.Errorf("the GPS position should be removed and the date kept, got %v,%v %s", md.Latitude, md.Longitude, md.DateTaken)
+	}
+	for name, sc := range ic.sidecars {
+		if bytes.Contains(sc, []byte("GPSLatitude")) {
+			t.Errorf("%s: the sidecar shouldn't have a GPS position:\n%s", name, sc)
+		}
+	}
+	if _, ok := ic.sidecars["image.png"]; !ok {
+		t.Error("the files that can't be rewritten should have a sidecar")
+	}
+
+	h := sha1.Sum(uploaded)
+	a := &browser.LocalAssetFile{FSys: fsys, FileName: "photo.jpg", StripGPS: true}
+	if sum, _ := app.checksum(a); sum != base64.StdEncoding.EncodeToString(h[:]) {
+		t.Error("the checksum should be the one of the uploaded content")
+	}
+}
+
+type icImports struct {
+	icCatchUploadsAssets
+	version immich.ServerVersion
+	imports []immich.AssetImport
+}
+
+func (c *icImports) GetServerCapabilities(ctx context.Context) (immich.ServerCapabilities, error) {
+	return immich.ServerCapabilities{Version: c.version}, nil
+}
+
+func (c *icImports) ImportAsset(ctx context.Context, a *browser.LocalAssetFile, imp immich.AssetImport) (immich.AssetResponse, error) {
+	c.imports = append(c.imports, imp)
+	return immich.AssetResponse{ID: a.FileName}, nil
+}
+
+func TestExternalLibrary(t *testing.T) {
+	ctx := context.Background()
+	abs, err := filepath.Abs("TEST_DATA/folder/low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args         []string
+		expectedPath string
+	}{
+		{args: []string{"-external-library=LIB", "-external-path=/mnt/photos", "TEST_DATA/folder/low"}, expectedPath: "/mnt/photos"},
+		{args: []string{"-external-library=LIB", "TEST_DATA/folder/low"}, expectedPath: filepath.ToSlash(abs)},
+	} {
+		ic := &icImports{version: immich.ServerVersion{Major: 1, Minor: 91}}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ic.assets) > 0 {
+			t.Errorf("%v: the files shouldn't be uploaded, got %v", tc.args, ic.assets)
+		}
+		if len(ic.imports) != 8 {
+			t.Fatalf("%v: expected 8 imports, got %d", tc.args, len(ic.imports))
+		}
+		for _, imp := range ic.imports {
+			if imp.LibraryID != "LIB" || !strings.HasPrefix(imp.AssetPath, tc.expectedPath+"/PXL_") {
+				t.Errorf("%v: unexpected import %+v", tc.args, imp)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		version immich.ServerVersion
+		args    []string
+	}{
+		{version: immich.ServerVersion{Major: 1, Minor: 78, Patch: 1}, args: []string{"-external-library=LIB", "TEST_DATA/folder/low"}},
+		{version: immich.ServerVersion{Major: 1, Minor: 91}, args: []string{"-external-library=LIB", "-google-photos", "TEST_DATA/Takeout1"}},
+		{version: immich.ServerVersion{Major: 1, Minor: 91}, args: []string{"-external-library=LIB", "-move", "TEST_DATA/folder/low"}},
+		{version: immich.ServerVersion{Major: 1, Minor: 91}, args: []string{"-external-library=LIB", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"}},
+		{version: immich.ServerVersion{Major: 1, Minor: 91}, args: []string{"-external-path=/mnt/photos", "TEST_DATA/folder/low"}},
+	} {
+		_, err := NewUpCmd(ctx, &icImports{version: tc.version}, logger.NoLogger{}, tc.args)
+		if err == nil {
+			t.Errorf("%v with the server %s: an error is expected", tc.args, tc.version)
+		}
+	}
+}
+
+func TestServerCapabilities(t *testing.T) {
+	ctx := context.Background()
+	old := immich.ServerVersion{Major: 1, Minor: 81}
+	for _, tc := range []struct {
+		version immich.ServerVersion
+		args    []string
+		err     bool
+	}{
+		{version: old, args: []string{"TEST_DATA/folder/low"}},
+		{version: old, args: []string{"-tags=holidays", "TEST_DATA/folder/low"}, err: true},
+		{version: old, args: []string{"-google-photos", "-people-as-tags", "TEST_DATA/Takeout1"}, err: true},
+		{version: old, args: []string{"-patch-metadata", "TEST_DATA/folder/low"}, err: true},
+		{version: immich.TagsVersion, args: []string{"-tags=holidays", "TEST_DATA/folder/low"}},
+		{version: immich.TagsVersion, args: []string{"-patch-metadata", "TEST_DATA/folder/low"}, err: true},
+		{version: immich.AssetsMetadataVersion, args: []string{"-patch-metadata", "-tags=holidays", "TEST_DATA/folder/low"}},
+	} {
+		ic := &icImports{version: tc.version}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, tc.args)
+		if (err != nil) != tc.err {
+			t.Errorf("%v with the server %s: unexpected error %v", tc.args, tc.version, err)
+			continue
+		}
+		if err == nil && app.capabilities.Version != tc.version {
+			t.Errorf("%v: the capabilities of the server should be kept, got %+v", tc.args, app.capabilities)
+		}
+	}
+}
+
+func TestExtensionStats(t *testing.T) {
+	jpg, err := os.ReadFile("TEST_DATA/folder/low/PXL_20231006_063000139.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"photo1.jpg": &fstest.MapFile{Data: jpg},
+		"photo2.JPG": &fstest.MapFile{Data: jpg},
+		"notes.txt":  &fstest.MapFile{Data: []byte("notes")},
+		"meta.json":  &fstest.MapFile{Data: []byte("{}")},
+	}
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]logger.ExtensionStats{
+		".jpg":  {Scanned: 2, Uploaded: 2},
+		".txt":  {Unsupported: 1},
+		".json": {Metadata: 1},
+	}
+	if exts := app.Journal.Extensions(); !reflect.DeepEqual(exts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, exts)
+	}
+}
+
+func TestFileSizeFilters(t *testing.T) {
+	jpg, err := os.ReadFile("TEST_DATA/folder/low/PXL_20231006_063000139.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(jpg)
+	fsys := fstest.MapFS{
+		"small.jpg":  &fstest.MapFile{Data: jpg},
+		"medium.jpg": &fstest.MapFile{Data: append(slices.Clone(jpg), make([]byte, size)...)},
+		"large.jpg":  &fstest.MapFile{Data: append(slices.Clone(jpg), make([]byte, 3*size)...)},
+	}
+	testCases := []struct {
+		args     []string
+		expected []string
+	}{
+		{args: nil, expected: []string{"large.jpg", "medium.jpg", "small.jpg"}},
+		{args: []string{"-min-file-size=" + strconv.Itoa(size+1)}, expected: []string{"large.jpg", "medium.jpg"}},
+		{args: []string{"-max-file-size=" + strconv.Itoa(3*size)}, expected: []string{"medium.jpg", "small.jpg"}},
+		{args: []string{"-min-file-size=" + strconv.Itoa(size+1), "-max-file-size=" + strconv.Itoa(3*size)}, expected: []string{"medium.jpg"}},
+	}
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(tc.args, "TEST_DATA/folder/low"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(ic.assets)
+			if !slices.Equal(ic.assets, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, ic.assets)
+			}
+		})
+	}
+}
+
+type icArchived struct {
+	icCatchUploadsAssets
+	archived []string
+}
+
+func (c *icArchived) UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*immich.Asset, error) {
+	if a.Archived {
+		c.archived = append(c.archived, ID)
+	}
+	return nil, nil
+}
+
+func TestArchivedTakeout(t *testing.T) {
+	testCases := []struct {
+		args             []string
+		expectedAssets   []string
+		expectedArchived []string
+	}{
+		{
+			args: nil,
+			expectedAssets: []string{
+				"Photos from 2023/PXL_20231006_063000139.jpg",
+				"Photos from 2023/PXL_20231006_063029647.jpg",
+			},
+			expectedArchived: []string{"Photos from 2023/PXL_20231006_063029647.jpg"},
+		},
+		{
+			args:           []string{"-keep-archived=false"},
+			expectedAssets: []string{"Photos from 2023/PXL_20231006_063000139.jpg"},
+		},
+		{
+			args:           []string{"-discard-archived"},
+			expectedAssets: []string{"Photos from 2023/PXL_20231006_063000139.jpg"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			ic := &icArchived{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(tc.args, "-google-photos", "TEST_DATA/Takeout4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, fsys := range app.fsys {
+				err = errors.Join(err, app.Run(ctx, []fs.FS{fsys}))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(ic.assets)
+			if !slices.Equal(ic.assets, tc.expectedAssets) {
+				t.Errorf("expected uploads %v, got %v", tc.expectedAssets, ic.assets)
+			}
+			if !slices.Equal(ic.archived, tc.expectedArchived) {
+				t.Errorf("expected archived %v, got %v", tc.expectedArchived, ic.archived)
+			}
+		})
+	}
+}
+
+func TestMove(t *testing.T) {
+	files := map[string]int{"a.jpg": 10, "b.jpg": 20, "c.jpg": 2}
+	run := func(args ...string) ([]string, *icVerify) {
+		t.Helper()
+		dir := t.TempDir()
+		for name, size := range files {
+			err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		ic := &icVerify{
+			icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+			corrupted:            "b.jpg",
+			checksums:            map[string]string{},
+		}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(args, "-move", "-min-file-size=5B", dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fshelper.DirRemoveFS(dir)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []string
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			left = append(left, e.Name())
+		}
+		return left, ic
+	}
+
+	left, _ := run()
+	if !slices.Equal(left, []string{"c.jpg"}) {
+		t.Errorf("expected only the skipped file left, got %v", left)
+	}
+	left, ic := run("-checksum")
+	if !slices.Equal(left, []string{"b.jpg", "c.jpg"}) {
+		t.Errorf("expected the mismatching and the skipped files left, got %v", left)
+	}
+	if len(ic.verified) != 2 {
+		t.Errorf("expected 2 verified uploads, got %v", ic.verified)
+	}
+	left, _ = run("-dry-run")
+	if len(left) != 3 {
+		t.Errorf("expected no file moved in dry run mode, got %v", left)
+	}
+
+	_, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-move", "-google-photos", "TEST_DATA/Takeout1"})
+	if err == nil {
+		t.Error("-move should be rejected with -google-photos")
+	}
+}
+
+func TestDeleteLocal(t *testing.T) {
+	run := func(args ...string) []string {
+		t.Helper()
+		dir := t.TempDir()
+		for name, size := range map[string]int{"a.jpg": 10, "b.jpg": 20, "c.jpg": 2} {
+			err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(args, "-delete-local", "-min-file-size=5B", dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fshelper.DirRemoveFS(dir)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []string
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			left = append(left, e.Name())
+		}
+		return left
+	}
+
+	left := run()
+	if !slices.Equal(left, []string{"c.jpg"}) {
+		t.Errorf("expected only the skipped file left, got %v", left)
+	}
+	left = run("-dry-run")
+	if len(left) != 3 {
+		t.Errorf("expected no file deleted in dry run mode, got %v", left)
+	}
+
+	for _, args := range [][]string{
+		{"-delete-local", "-move", "TEST_DATA/folder/low"},
+		{"-delete-local", "-google-photos", "TEST_DATA/Takeout1"},
+	} {
+		_, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v should be rejected", args)
+		}
+	}
+}
+
+type icTags struct {
+	icCatchUploadsAssets
+	tags map[string][]string
+}
+
+func (c *icTags) TagAssets(ctx context.Context, tagName string, ids []string) ([]immich.TagAssetsResult, error) {
+	c.tags[tagName] = append(c.tags[tagName], ids...)
+	r := []immich.TagAssetsResult{}
+	for _, id := range ids {
+		r = append(r, immich.TagAssetsResult{AssetID: id, Success: true})
+	}
+	return r, nil
+}
+
+func TestTags(t *testing.T) {
+	takeout := fstest.MapFS{
+		"Photos from 2023/a.jpg":      {Data: []byte("a")},
+		"Photos from 2023/a.jpg.json": {Data: []byte(`{"title": "a.jpg", "photoTakenTime": {"timestamp": "1696573800"}, "url": "https://photos.google.com/photo/a", "people": [{"name": "Alice"}, {"name": "Bob"}]}`)},
+		"Photos from 2023/b.jpg":      {Data: []byte("bb")},
+		"Photos from 2023/b.jpg.json": {Data: []byte(`{"title": "b.jpg", "photoTakenTime": {"timestamp": "1696573900"}, "url": "https://photos.google.com/photo/b", "people": [{"name": "Alice"}]}`)},
+	}
+	testCases := []struct {
+		args     []string
+		expected map[string][]string
+	}{
+		{
+			args:     []string{"-google-photos"},
+			expected: map[string][]string{},
+		},
+		{
+			args: []string{"-google-photos", "-tags=holiday,2023"},
+			expected: map[string][]string{
+				"holiday": {"Photos from 2023/a.jpg", "Photos from 2023/b.jpg"},
+				"2023":    {"Photos from 2023/a.jpg", "Photos from 2023/b.jpg"},
+			},
+		},
+		{
+			args: []string{"-google-photos", "-people-as-tags"},
+			expected: map[string][]string{
+				"Alice": {"Photos from 2023/a.jpg", "Photos from 2023/b.jpg"},
+				"Bob":   {"Photos from 2023/a.jpg"},
+			},
+		},
+		{
+			args:     []string{"-google-photos", "-people-as-tags", "-tags=holiday", "-dry-run"},
+			expected: map[string][]string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			ic := &icTags{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, tags: map[string][]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(tc.args, "TEST_DATA/Takeout4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{&takeout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range ic.tags {
+				slices.Sort(l)
+			}
+			if !reflect.DeepEqual(ic.tags, tc.expected) {
+				t.Errorf("expected tags %v, got %v", tc.expected, ic.tags)
+			}
+		})
+	}
+}
+
+func TestTakeoutTimeZone(t *testing.T) {
+	for _, tz := range []string{"America/Los_Angeles", "auto", "AUTO"} {
+		_, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-google-photos", "-takeout-timezone=" + tz, "TEST_DATA/Takeout1"})
+		if err != nil {
+			t.Errorf("-takeout-timezone=%s: %s", tz, err)
+		}
+	}
+	_, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-google-photos", "-takeout-timezone=Mars/Olympus", "TEST_DATA/Takeout1"})
+	if err == nil {
+		t.Error("an unknown time zone should be rejected")
+	}
+}
+
+func TestSideCarZone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &browser.LocalAssetFile{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC).In(tokyo)}
+	app := UpCmd{GooglePhotos: true, TakeoutTimeZone: "auto"}
+	if z := app.sideCarZone(a); z != tokyo {
+		t.Errorf("the sidecar of a takeout should keep the zone given by -takeout-timezone, got %v", z)
+	}
+	for _, app := range []UpCmd{{GooglePhotos: true}, {}} {
+		if z := app.sideCarZone(a); z != nil {
+			t.Errorf("the sidecar should use the local zone without -takeout-timezone, got %v", z)
+		}
+	}
+}
+
+func TestFromAlbums(t *testing.T) {
+	a := &browser.LocalAssetFile{Albums: []browser.LocalAlbum{{Path: "Takeout/Google Photos/holidays", Name: "Holidays, 2023"}}}
+	tc := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"-from-album=Holidays, 2023"}, expected: true},
+		{args: []string{"-from-album=Wedding", "-from-album=Holidays, 2023"}, expected: true},
+		{args: []string{"-from-album=Wedding", "-from-album=holidays, 2023"}, expected: false},
+		{args: []string{"-from-album=Wedding", "-from-album=holidays, 2023", "-album-match-ci"}, expected: true},
+		{args: []string{"-from-album=Holidays"}, expected: false},
+	}
+	for _, c := range tc {
+		app, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, append(c.args, "-google-photos", "TEST_DATA/Takeout1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := app.isInAlbum(a); got != c.expected {
+			t.Errorf("%v: expected %v, got %v", c.args, c.expected, got)
+		}
+	}
+}
+
+type icSidecar struct {
+	icCatchUploadsAssets
+	sidecars map[string]*metadata.SideCar
+}
+
+func (c *icSidecar) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.sidecars[a.FileName] = a.SideCar
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestSidecarFromFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"IMG_0001.jpg":     {Data: []byte("1")},
+		"IMG_0001.jpg.xmp": {Data: []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`)},
+		"IMG_0002.jpg":     {Data: []byte("2")},
+	}
+	tc := []struct {
+		args     []string
+		expected map[string]bool // sidecar read from the file by asset
+	}{
+		{args: []string{"-force-sidecar"}, expected: map[string]bool{"IMG_0001.jpg": true, "IMG_0002.jpg": false}},
+		{args: []string{"-force-sidecar", "-sidecar-from-file=false"}, expected: map[string]bool{"IMG_0001.jpg": false, "IMG_0002.jpg": false}},
+	}
+	for _, c := range tc {
+		ic := &icSidecar{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, sidecars: map[string]*metadata.SideCar{}}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, fromFile := range c.expected {
+			sc := ic.sidecars[name]
+			if sc == nil {
+				t.Errorf("%v: %s uploaded without sidecar", c.args, name)
+				continue
+			}
+			if sc.OnFSsys != fromFile {
+				t.Errorf("%v: %s: expected sidecar from the file %v, got %v", c.args, name, fromFile, sc.OnFSsys)
+			}
+		}
+	}
+}
+
+func TestEmptyFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"PXL_20230801_120000.jpg": {Data: []byte("1")},
+		"PXL_20230801_120001.jpg": {Data: []byte{}},
+	}
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ic.assets, []string{"PXL_20230801_120000.jpg"}) {
+		t.Errorf("the empty file shouldn't be uploaded, got %v", ic.assets)
+	}
+	if n := app.Journal.Count(logger.EMPTY_FILE); n != 1 {
+		t.Errorf("expected 1 empty file, got %d", n)
+	}
+	if !slices.Equal(app.damagedFiles, []string{"PXL_20230801_120001.jpg: empty file"}) {
+		t.Errorf("the empty file should be listed, got %v", app.damagedFiles)
+	}
+}
+
+func TestCopyExifToSidecar(t *testing.T) {
+	jpg, err := os.ReadFile("TEST_DATA/bursts/3H2A0102.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the EXIF of the RAW files is read like the one of a JPEG
+	fsys := fstest.MapFS{
+		"IMG_0001.dng":     {Data: jpg},
+		"IMG_0002.jpg":     {Data: jpg},
+		"IMG_0003.nef":     {Data: jpg},
+		"IMG_0003.nef.xmp": {Data: []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`)},
+	}
+	md, err := metadata.GetFileMetaData(fsys, "IMG_0001.dng")
+	if err != nil || md.DateTaken.IsZero() {
+		t.Fatalf("the test file should have a date: %v", err)
+	}
+	tc := []struct {
+		args     []string
+		expected map[string]bool // sidecar with the EXIF by asset
+		copied   int
+	}{
+		{args: []string{}, expected: map[string]bool{"IMG_0001.dng": false, "IMG_0002.jpg": false, "IMG_0003.nef": false}},
+		{args: []string{"-copy-exif-to-sidecar"}, expected: map[string]bool{"IMG_0001.dng": true, "IMG_0002.jpg": false, "IMG_0003.nef": false}, copied: 1},
+		{args: []string{"-copy-exif-to-sidecar", "-force-sidecar"}, expected: map[string]bool{"IMG_0001.dng": true, "IMG_0003.nef": false}, copied: 1},
+	}
+	for _, c := range tc {
+		ic := &icSidecar{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, sidecars: map[string]*metadata.SideCar{}}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, copied := range c.expected {
+			sc := ic.sidecars[name]
+			got := sc != nil && !sc.OnFSsys && sc.DateTaken.Equal(md.DateTaken) && sc.Orientation == md.Orientation &&
+				sc.Latitude == md.Latitude && sc.Longitude == md.Longitude
+			if got != copied {
+				t.Errorf("%v: %s: expected the EXIF in the sidecar %v, got %+v", c.args, name, copied, sc)
+			}
+		}
+		if sc := ic.sidecars["IMG_0003.nef"]; sc == nil || !sc.OnFSsys {
+			t.Errorf("%v: the sidecar of IMG_0003.nef should be the one of the folder", c.args)
+		}
+		if n := app.Journal.Count(logger.EXIF_SIDECAR); n != c.copied {
+			t.Errorf("%v: expected %d files with their EXIF copied, got %d", c.args, c.copied, n)
+		}
+	}
+}
+
+type icInterrupted struct {
+	icCatchUploadsAssets
+	stop func() bool
+}
+
+func (c *icInterrupted) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.stop()
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestInterruptedUpload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.jpg": {Data: []byte("a")},
+		"b.jpg": {Data: []byte("b")},
+		"c.jpg": {Data: []byte("c")},
+	}
+	ctx, stop := shutdown.WithStop(context.Background())
+	ic := &icInterrupted{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, stop: stop}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-album=Interrupted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, []fs.FS{fsys})
+	if err == nil {
+		t.Error("an interrupted upload should return an error")
+	}
+	if len(ic.assets) != 1 {
+		t.Errorf("expected the upload to stop after the first asset, got %v", ic.assets)
+	}
+	if !slices.Equal(ic.albums["Interrupted"], ic.assets) {
+		t.Errorf("the uploaded assets should be added to the album, got %v", ic.albums["Interrupted"])
+	}
+}
+
+func (c *stubIC) GetAssetAlbums(ctx context.Context, ID string) ([]immich.AlbumSimplified, error) {
+	return nil, nil
+}
+
+type icOverwrite struct {
+	icCatchUploadsAssets
+	server  []*immich.Asset
+	deleted []string
+	forced  bool
+}
+
+func (c *icOverwrite) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	for _, a := range c.server {
+		filter(a)
+	}
+	return nil
+}
+
+func (c *icOverwrite) GetAssetAlbums(ctx context.Context, ID string) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "album-" + ID, AlbumName: "Album of " + ID}}, nil
+}
+
+func (c *icOverwrite) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	c.deleted = append(c.deleted, ids...)
+	c.forced = force
+	return nil
+}
+
+func TestOverwriteServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.jpg":   {Data: make([]byte, 10)},
+		"better.jpg": {Data: make([]byte, 10)},
+		"new.jpg":    {Data: make([]byte, 10)},
+	}
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "s1", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10}},
+			{ID: "s2", OriginalFileName: "better", OriginalPath: "upload/better.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 20}},
+		}
+	}
+	defer func(f func(context.Context, string, string) (string, error)) { confirm = f }(confirm)
+
+	tc := []struct {
+		name     string
+		args     []string
+		answer   string
+		uploaded []string
+		deleted  []string
+		forced   bool
+		albums   map[string][]string
+		err      bool
+	}{
+		{name: "default", uploaded: []string{"new.jpg"}},
+		{
+			name: "overwrite", args: []string{"-overwrite-server", "-yes"},
+			uploaded: []string{"better.jpg", "new.jpg", "same.jpg"},
+			deleted:  []string{"s1", "s2"},
+			albums:   map[string][]string{"Album of s1": {"same.jpg"}, "Album of s2": {"better.jpg"}},
+		},
+		{
+			name: "confirmed", args: []string{"-overwrite-server"}, answer: "y",
+			uploaded: []string{"better.jpg", "new.jpg", "same.jpg"},
+			deleted:  []string{"s1", "s2"},
+		},
+		{name: "refused", args: []string{"-overwrite-server"}, answer: "n", err: true},
+		{name: "dry-run", args: []string{"-overwrite-server", "-dry-run"}},
+		{
+			name: "permanent", args: []string{"-overwrite-server", "-permanent", "-yes"},
+			uploaded: []string{"better.jpg", "new.jpg", "same.jpg"},
+			deleted:  []string{"s1", "s2"}, forced: true,
+		},
+		{
+			name: "permanent confirmed", args: []string{"-permanent"}, answer: "y",
+			uploaded: []string{"new.jpg"},
+		},
+		{name: "permanent refused", args: []string{"-permanent"}, answer: "n", err: true},
+		{name: "permanent dry-run", args: []string{"-overwrite-server", "-permanent", "-yes", "-dry-run"}},
+		{
+			name: "keep server", args: []string{"-overwrite-server", "-yes", "-delete-server=false"},
+			uploaded: []string{"better.jpg", "new.jpg", "same.jpg"},
+		},
+		{name: "permanent without delete", args: []string{"-permanent", "-yes", "-delete-server=false"}, err: true},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			asked := false
+			confirm = func(ctx context.Context, prompt string, defaultAnswer string) (string, error) {
+				asked = true
+				return c.answer, nil
+			}
+			ic := &icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if asked != (c.answer != "") {
+				t.Errorf("unexpected confirmation: %v", asked)
+			}
+			if c.err {
+				if err == nil {
+					t.Error("the command should be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(ic.assets)
+			slices.Sort(ic.deleted)
+			if !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+			if !slices.Equal(ic.deleted, c.deleted) {
+				t.Errorf("expected deleted %v, got %v", c.deleted, ic.deleted)
+			}
+			if ic.forced != c.forced {
+				t.Errorf("expected a permanent deletion %v, got %v", c.forced, ic.forced)
+			}
+			for album, ids := range c.albums {
+				if !slices.Equal(ic.albums[album], ids) {
+					t.Errorf("expected %v in the album %s, got %v", ids, album, ic.albums[album])
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceSmaller(t *testing.T) {
+	fsys := fstest.MapFS{
+		"smaller.jpg": {Data: make([]byte, 10)},
+		"same.jpg":    {Data: make([]byte, 10)},
+	}
+	tc := []struct {
+		name     string
+		args     []string
+		uploaded []string
+		deleted  []string
+		kept     int
+		err      bool
+	}{
+		{name: "default", uploaded: []string{"smaller.jpg"}, deleted: []string{"s1"}},
+		{name: "replace", args: []string{"-replace-smaller"}, uploaded: []string{"smaller.jpg"}, deleted: []string{"s1"}},
+		{name: "report only", args: []string{"-replace-smaller=false"}, kept: 1},
+		{name: "report only dry-run", args: []string{"-replace-smaller=false", "-dry-run"}, kept: 1},
+		{name: "overwrite", args: []string{"-replace-smaller=false", "-overwrite-server", "-yes"}, err: true},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ic := &icOverwrite{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				server: []*immich.Asset{
+					{ID: "s1", OriginalFileName: "smaller", OriginalPath: "upload/smaller.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 5}},
+					{ID: "s2", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10}},
+				},
+			}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if c.err {
+				if err == nil {
+					t.Error("the command should be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = app.Run(ctx, []fs.FS{fsys}); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+			if !slices.Equal(ic.deleted, c.deleted) {
+				t.Errorf("expected deleted %v, got %v", c.deleted, ic.deleted)
+			}
+			if n := app.Journal.Count(logger.SERVER_SMALLER); n != c.kept {
+				t.Errorf("expected %d server's assets kept, got %d", c.kept, n)
+			}
+			if len(ic.albums["Album of s1"]) > 0 && c.kept > 0 {
+				t.Errorf("the kept server's asset shouldn't change of album, got %v", ic.albums)
+			}
+		})
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"same.jpg":     {Data: make([]byte, 10), ModTime: d},
+		"conflict.jpg": {Data: make([]byte, 12)},
+		"new.jpg":      {Data: make([]byte, 10), ModTime: d},
+	}
+	server := []*immich.Asset{
+		{ID: "s1", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10, DateTimeOriginal: immich.ImmichTime{Time: d}}},
+		{ID: "s2", OriginalFileName: "conflict", OriginalPath: "upload/conflict.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10, DateTimeOriginal: immich.ImmichTime{Time: d}}},
+	}
+	defer func(f func(context.Context, string, string) (string, error)) { confirm = f }(confirm)
+
+	// conflict.jpg has no date and another size than the server's asset with the same name
+	tc := []struct {
+		args     []string
+		answer   string
+		uploaded []string
+		err      bool
+	}{
+		{args: nil, uploaded: []string{"conflict.jpg", "new.jpg"}},
+		{args: []string{"-on-conflict", "upload"}, uploaded: []string{"conflict.jpg", "new.jpg"}},
+		{args: []string{"-on-conflict", "SKIP"}, uploaded: []string{"new.jpg"}},
+		{args: []string{"-on-conflict", "ask"}, answer: "y", uploaded: []string{"conflict.jpg", "new.jpg"}},
+		{args: []string{"-on-conflict", "ask"}, answer: "n", uploaded: []string{"new.jpg"}},
+		{args: []string{"-on-conflict", "ask", "-yes"}, uploaded: []string{"conflict.jpg", "new.jpg"}},
+		{args: []string{"-on-conflict", "never"}, err: true},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			asked := false
+			confirm = func(ctx context.Context, prompt string, defaultAnswer string) (string, error) {
+				asked = true
+				return c.answer, nil
+			}
+			ic := &icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if c.err {
+				if err == nil {
+					t.Error("the command should be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if asked != (c.answer != "") {
+				t.Errorf("unexpected confirmation: %v", asked)
+			}
+			slices.Sort(ic.assets)
+			if !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+			if len(ic.deleted) > 0 {
+				t.Errorf("the server's assets should be kept, got %v deleted", ic.deleted)
+			}
+		})
+	}
+}
+
+type icAlbumPreview struct {
+	icOverwrite
+	memberCalls int
+}
+
+func (c *icAlbumPreview) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "existing", AlbumName: "Existing"}}, nil
+}
+
+func (c *icAlbumPreview) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	return immich.AlbumContent{ID: id, AlbumName: "Existing", Assets: []immich.AssetSimplified{{ID: "s1"}}}, nil
+}
+
+func (c *icAlbumPreview) GetAlbumAssetIDs(ctx context.Context, id string) ([]string, error) {
+	c.memberCalls++
+	return []string{"s1"}, nil
+}
+
+func TestAlbumImportExisting(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.jpg": {Data: make([]byte, 10)},
+		"new.jpg":  {Data: make([]byte, 10)},
+	}
+	tc := []struct {
+		args    []string
+		added   []string
+		present int
+		calls   int
+	}{
+		{args: []string{"-album", "Existing"}, added: []string{"new.jpg", "s1"}},
+		{args: []string{"-album", "Existing", "-album-import-existing"}, added: []string{"new.jpg"}, present: 1, calls: 1},
+		{args: []string{"-album", "New", "-album-import-existing"}},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icAlbumPreview{icOverwrite: icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: []*immich.Asset{
+				{ID: "s1", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10}},
+			}}}
+			ctx := context.Background()
+			report := filepath.Join(t.TempDir(), "report.json")
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-report", report}, c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			added := ic.albums["existing"]
+			slices.Sort(added)
+			if !slices.Equal(added, c.added) {
+				t.Errorf("expected %v added to the existing album, got %v", c.added, added)
+			}
+			if ic.memberCalls != c.calls {
+				t.Errorf("expected %d call(s) for the album's assets, got %d", c.calls, ic.memberCalls)
+			}
+			if n := app.report.Albums[c.args[1]].Present; n != c.present {
+				t.Errorf("expected %d asset(s) reported present, got %d", c.present, n)
+			}
+		})
+	}
+}
+
+func TestDryRunAlbums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.jpg": {Data: make([]byte, 10)},
+		"new.jpg":  {Data: make([]byte, 10)},
+	}
+	tc := []struct {
+		args     []string
+		expected map[string]reportAlbum
+		created  int
+		updated  int
+	}{
+		{args: []string{"-album", "New"}, expected: map[string]reportAlbum{"New": {Added: 2}}, created: 1},
+		{args: []string{"-album", "Existing"}, expected: map[string]reportAlbum{"Existing": {Added: 1, Present: 1}}, updated: 1},
+		{args: []string{"-album", "Existing", "-skip-existing-by-album"}, expected: map[string]reportAlbum{"Existing": {Added: 1, Present: 1}}, updated: 1},
+		{args: []string{"-album", "Existing", "-album-import-existing"}, expected: map[string]reportAlbum{"Existing": {Added: 1, Present: 1}}, updated: 1},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icAlbumPreview{icOverwrite: icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: []*immich.Asset{
+				{ID: "s1", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 10}},
+			}}}
+			ctx := context.Background()
+			report := filepath.Join(t.TempDir(), "report.json")
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-dry-run", "-report", report}, c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.Run(ctx, []fs.FS{fsys})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ic.albums) > 0 {
+				t.Errorf("the albums shouldn't change in dry run mode, got %v", ic.albums)
+			}
+			b, err := os.ReadFile(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r runReport
+			err = json.Unmarshal(b, &r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !r.DryRun || r.AlbumsCreated != c.created || r.AlbumsUpdated != c.updated {
+				t.Errorf("unexpected report: dry run %v, %d album(s) created, %d updated", r.DryRun, r.AlbumsCreated, r.AlbumsUpdated)
+			}
+			if !reflect.DeepEqual(r.Albums, c.expected) {
+				t.Errorf("expected the albums %v, got %v", c.expected, r.Albums)
+			}
+		})
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	for i, n := range []string{"IMG_20230801_120000.jpg", "IMG_20230802_120000.jpg"} {
+		err := os.WriteFile(filepath.Join(dir, n), []byte("jpeg content "+strconv.Itoa(i)), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := filepath.Join(t.TempDir(), "server.json")
+	args := []string{"-simulate", "-simulate-state=" + state, "-album=Simulated", dir}
+	ctx := context.Background()
+
+	// the real client is never used
+	err := UploadCommand(ctx, nil, logger.NoLogger{}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := NewUpCmd(ctx, nil, logger.NoLogger{}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := app.simulator.Assets(); len(l) != 2 {
+		t.Fatalf("expected 2 assets in the saved state, got %d", len(l))
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Journal.Count(logger.UPLOADED) != 0 || app.Journal.Count(logger.SERVER_DUPLICATE) != 2 {
+		t.Errorf("the second run should find the assets on the server, got %d uploaded and %d duplicates",
+			app.Journal.Count(logger.UPLOADED), app.Journal.Count(logger.SERVER_DUPLICATE))
+	}
+	albums := app.simulator.Albums()
+	if len(albums) != 1 || albums[0].AlbumName != "Simulated" || len(albums[0].AssetIds) != 2 {
+		t.Errorf("unexpected albums %v", albums)
+	}
+
+	_, err = NewUpCmd(ctx, nil, logger.NoLogger{}, []string{"-simulate-state=" + state, dir})
+	if err == nil {
+		t.Error("-simulate-state without -simulate should be rejected")
+	}
+}
+
+type icFlatten struct {
+	icCatchUploadsAssets
+	server []immich.AlbumSimplified
+}
+
+func (c *icFlatten) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return c.server, nil
+}
+
+func TestFlattenAlbums(t *testing.T) {
+	tc := []struct {
+		args     []string
+		expected map[string][]string
+	}{
+		{
+			args: nil,
+			expected: map[string][]string{
+				"Summer 2023": {"a"}, "Summer 2023 ": {"b"}, "summer 2023": {"c"}, "holidays-id": {"d"}, "holidays ": {"e"},
+			},
+		},
+		{
+			args: []string{"-flatten-albums"},
+			expected: map[string][]string{
+				"Summer 2023": {"a", "b"}, "summer 2023": {"c"}, "holidays-id": {"d"}, "holidays ": {"e"},
+			},
+		},
+		{
+			args: []string{"-flatten-albums", "-flatten-albums-ci"},
+			expected: map[string][]string{
+				"Summer 2023": {"a", "b", "c"}, "holidays-id": {"d", "e"},
+			},
+		},
+	}
+	for _, c := range tc {
+		ic := &icFlatten{
+			icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+			server:               []immich.AlbumSimplified{{ID: "holidays-id", AlbumName: "Holidays"}},
+		}
+		app, err := NewUpCmd(context.Background(), ic, logger.NoLogger{}, append(c.args, "-no-server-scan", "TEST_DATA/folder/low"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, album := range map[string]string{"a": "Summer 2023", "b": "Summer 2023 ", "c": "summer 2023", "d": "Holidays", "e": "holidays "} {
+			app.AddToAlbum(id, album, nil)
+		}
+		err = app.ManageAlbums(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range ic.albums {
+			slices.Sort(l)
+		}
+		if !reflect.DeepEqual(ic.albums, c.expected) {
+			t.Errorf("%v: expected albums %v, got %v", c.args, c.expected, ic.albums)
+		}
+	}
+
+	app, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-flatten-albums", "-no-server-scan", "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := app.albumName(browser.LocalAlbum{Name: "  Summer   2023 "}); got != "Summer 2023" {
+		t.Errorf("expected the album name %q, got %q", "Summer 2023", got)
+	}
+}
+
+type icSync struct {
+	icOverwrite
+}
+
+func (c *icSync) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "trip", AlbumName: "Trip"}}, nil
+}
+
+func (c *icSync) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	return immich.AlbumContent{ID: "trip", AlbumName: "Trip", Assets: []immich.AssetSimplified{{ID: "s1"}, {ID: "s2"}, {ID: "s3"}, {ID: "s5"}}}, nil
+}
+
+func TestSync(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.jpg":     {Data: make([]byte, 10)},
+		"new.jpg":      {Data: make([]byte, 10)},
+		"excluded.mp4": {Data: make([]byte, 10)},
+		// the name gives a date out of -date=2023-10, the server has another date of capture
+		"PXL_20230930_235959.jpg": {Data: make([]byte, 10)},
+	}
+	date := func(s string) immich.ExifInfo {
+		d, _ := time.Parse(time.DateOnly, s)
+		return immich.ExifInfo{FileSizeInByte: 10, DateTimeOriginal: immich.ImmichTime{Time: d}}
+	}
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "s1", DeviceID: "laptop", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: date("2023-10-01")},
+			{ID: "s2", DeviceID: "laptop", OriginalFileName: "gone", OriginalPath: "upload/gone.jpg", ExifInfo: date("2023-10-06")},
+			{ID: "s3", DeviceID: "phone", OriginalFileName: "phone", OriginalPath: "upload/phone.jpg", ExifInfo: date("2023-10-06")},
+			{ID: "s4", DeviceID: "laptop", OriginalFileName: "elsewhere", OriginalPath: "upload/elsewhere.jpg", ExifInfo: date("2023-10-12")},
+			{ID: "s5", DeviceID: "laptop", OriginalFileName: "excluded", OriginalPath: "upload/excluded.mp4", ExifInfo: date("2023-10-06")},
+			{ID: "s6", DeviceID: "laptop", OriginalFileName: "old", OriginalPath: "upload/old.jpg", ExifInfo: date("2022-10-06")},
+			{ID: "s7", DeviceID: "laptop", OriginalFileName: "PXL_20230930_235959", OriginalPath: "upload/PXL_20230930_235959.jpg", ExifInfo: date("2023-10-01")},
+		}
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		args    []string
+		deleted []string
+	}{
+		{args: []string{"-album=Trip"}},
+		{args: []string{"-album=Trip", "-confirm-deletes", "-dry-run"}},
+		{args: []string{"-album=Trip", "-confirm-deletes"}, deleted: []string{"s2"}},
+		{args: []string{"-album=Trip", "-confirm-deletes", "-exclude-types=.mp4"}, deleted: []string{"s2"}},
+		{args: []string{"-date=2023-10", "-confirm-deletes"}, deleted: []string{"s2", "s4"}},
+		{args: []string{"-album=Trip", "-date=2023-10-06", "-confirm-deletes"}, deleted: []string{"s2"}},
+	} {
+		ic := &icSync{icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()}}
+		app, err := NewSyncCmd(ctx, ic, logger.NoLogger{}, append([]string{"-device-uuid=laptop"}, c.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(ic.deleted)
+		if !slices.Equal(ic.deleted, c.deleted) {
+			t.Errorf("%v: expected the deletions %v, got %v", c.args, c.deleted, ic.deleted)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-confirm-deletes"},
+		{"-album=Trip", "-google-photos", "-confirm-deletes"},
+		{"-album=Trip", "-exclude-path=same.jpg", "-confirm-deletes"},
+	} {
+		_, err := NewSyncCmd(ctx, &icSync{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+// readCountFS counts the bytes read in each file
+type readCountFS struct {
+	fs.FS
+	mut  sync.Mutex
+	read map[string]int
+}
+
+type readCountFile struct {
+	fs.File
+	fsys *readCountFS
+	name string
+}
+
+func (fsys *readCountFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readCountFile{File: f, fsys: fsys, name: name}, nil
+}
+
+func (fsys *readCountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(fsys.FS, name)
+}
+
+func (fsys *readCountFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(fsys.FS, name)
+}
+
+func (f *readCountFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.fsys.mut.Lock()
+	f.fsys.read[f.name] += n
+	f.fsys.mut.Unlock()
+	return n, err
+}
+
+func TestDecidedAdvice(t *testing.T) {
+	date := func(s string, size, width int) immich.ExifInfo {
+		d, _ := time.Parse("20060102_150405", s)
+		return immich.ExifInfo{FileSizeInByte: size, DateTimeOriginal: immich.ImmichTime{Time: d}, ExifImageWidth: width, ExifImageHeight: width}
+	}
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "same", OriginalFileName: "PXL_20231001_120000", OriginalPath: "upload/PXL_20231001_120000.jpg", ExifInfo: date("20231001_120000", 100, 1000)},
+			{ID: "better", OriginalFileName: "PXL_20231002_120000", OriginalPath: "upload/PXL_20231002_120000.jpg", ExifInfo: date("20231002_120000", 200, 0)},
+			{ID: "sized", OriginalFileName: "PXL_20231003_120000", OriginalPath: "upload/PXL_20231003_120000.jpg", ExifInfo: date("20231003_120000", 200, 1000)},
+		}
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		args   []string
+		read   []string // files whose content is read
+		spared int
+	}{
+		{args: []string{"-checksum"}, read: []string{"PXL_20231004_120000.jpg"}, spared: 3},
+		{args: []string{"-compare-resolution"}, read: []string{"PXL_20231003_120000.jpg", "PXL_20231004_120000.jpg"}, spared: 2},
+		{args: []string{"-checksum", "-overwrite-server"}, read: []string{"PXL_20231001_120000.jpg", "PXL_20231002_120000.jpg", "PXL_20231003_120000.jpg", "PXL_20231004_120000.jpg"}},
+	} {
+		fsys := &readCountFS{
+			FS: fstest.MapFS{
+				"PXL_20231001_120000.jpg": {Data: make([]byte, 100)},
+				"PXL_20231002_120000.jpg": {Data: make([]byte, 100)},
+				"PXL_20231003_120000.jpg": {Data: make([]byte, 100)},
+				"PXL_20231004_120000.jpg": {Data: make([]byte, 100)},
+			},
+			read: map[string]int{},
+		}
+		ic := &icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-no-exif", "-dry-run"}, c.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read []string
+		for name, n := range fsys.read {
+			if n > 0 {
+				read = append(read, name)
+			}
+		}
+		slices.Sort(read)
+		if !slices.Equal(read, c.read) {
+			t.Errorf("%v: expected the files %v to be read, got %v", c.args, c.read, read)
+		}
+		if app.sparedFiles != c.spared || app.sparedBytes != int64(c.spared*100) {
+			t.Errorf("%v: expected %d files not read, got %d files and %d bytes", c.args, c.spared, app.sparedFiles, app.sparedBytes)
+		}
+	}
+}
+
+func TestOrphanReport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"same.jpg":                {Data: make([]byte, 10)},
+		"PXL_20231008_120000.jpg": {Data: []byte("content of the renamed file")},
+		"excluded.mp4":            {Data: make([]byte, 10)},
+	}
+	la := &browser.LocalAssetFile{FSys: fsys, FileName: "PXL_20231008_120000.jpg"}
+	checksum, err := la.ComputeChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(s string) immich.ExifInfo {
+		d, _ := time.Parse(time.DateOnly, s)
+		return immich.ExifInfo{FileSizeInByte: 10, DateTimeOriginal: immich.ImmichTime{Time: d}}
+	}
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "s1", DeviceID: "laptop", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: date("2023-10-01")},
+			{ID: "s2", DeviceID: "laptop", OriginalFileName: "gone", OriginalPath: "upload/gone.jpg", ExifInfo: date("2023-10-06")},
+			{ID: "s3", DeviceID: "phone", OriginalFileName: "phone", OriginalPath: "upload/phone.jpg", ExifInfo: date("2023-10-06")},
+			{ID: "s4", DeviceID: "laptop", OriginalFileName: "elsewhere", OriginalPath: "upload/elsewhere.jpg", ExifInfo: date("2023-10-12")},
+			{ID: "s5", DeviceID: "laptop", OriginalFileName: "excluded", OriginalPath: "upload/excluded.mp4", ExifInfo: date("2023-10-06")},
+			{ID: "s6", DeviceID: "laptop", OriginalFileName: "old", OriginalPath: "upload/old.jpg", ExifInfo: date("2022-10-06")},
+			{ID: "s7", DeviceID: "phone", OriginalFileName: "IMG_0001", OriginalPath: "upload/IMG_0001.jpg", Checksum: checksum, ExifInfo: date("2023-10-08")},
+		}
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		args     []string
+		expected []string
+	}{
+		{args: []string{"-album=Trip", "-exclude-types=.mp4"}, expected: []string{"s2", "s3"}},
+		{args: []string{"-date=2023-10"}, expected: []string{"s2", "s3", "s4", "s7"}},
+		{args: []string{"-date=2023-10", "-checksum"}, expected: []string{"s2", "s3", "s4"}},
+		{args: []string{"-after=2023-10-02", "-before=2023-10-10", "-dry-run"}, expected: []string{"s2", "s3", "s7"}},
+	} {
+		report := filepath.Join(t.TempDir(), "orphans.csv")
+		ic := &icSync{icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()}}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-orphan-report=" + report}, c.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ic.deleted) > 0 {
+			t.Errorf("%v: nothing should be deleted, got %v", c.args, ic.deleted)
+		}
+		b, err := os.ReadFile(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, l := range lines[1:] {
+			ids = append(ids, l[0])
+		}
+		slices.Sort(ids)
+		if !slices.Equal(ids, c.expected) {
+			t.Errorf("%v: expected the orphans %v, got %v", c.args, c.expected, ids)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-orphan-report=orphans.csv"},
+		{"-orphan-report=orphans.csv", "-album=Trip", "-no-server-scan"},
+	} {
+		_, err := NewUpCmd(ctx, &icSync{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+type icAssetDescriptions struct {
+	icOverwrite
+	descriptions map[string]string
+}
+
+func (c *icAssetDescriptions) SetAssetDescription(ctx context.Context, ID string, description string) error {
+	c.descriptions[ID] = description
+	return nil
+}
+
+func TestPreserveFolderStructure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2023/trip/new.jpg":  {Data: make([]byte, 10)},
+		"2023/same.jpg":      {Data: make([]byte, 20)},
+		"2023/described.jpg": {Data: make([]byte, 30)},
+		"top.jpg":            {Data: make([]byte, 40)},
+	}
+	ctx := context.Background()
+	for _, c := range []struct {
+		args     []string
+		expected map[string]string
+	}{
+		{args: []string{}, expected: map[string]string{}},
+		{
+			args: []string{"-preserve-folder-structure"},
+			expected: map[string]string{
+				"2023/trip/new.jpg": "2023/trip/new.jpg",
+				"s1":                "2023/same.jpg",
+				"top.jpg":           "top.jpg",
+			},
+		},
+		{args: []string{"-preserve-folder-structure", "-dry-run"}, expected: map[string]string{}},
+	} {
+		ic := &icAssetDescriptions{
+			icOverwrite: icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: []*immich.Asset{
+				{ID: "s1", OriginalFileName: "same", OriginalPath: "upload/same.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 20}},
+				{ID: "s2", OriginalFileName: "described", OriginalPath: "upload/described.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 30, Description: "Picnic"}},
+			}},
+			descriptions: map[string]string{},
+		}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, []fs.FS{fsys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ic.descriptions, c.expected) {
+			t.Errorf("%v: expected the descriptions %v, got %v", c.args, c.expected, ic.descriptions)
+		}
+	}
+
+	_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-preserve-folder-structure", "-google-photos", "TEST_DATA/Takeout1"})
+	if err == nil {
+		t.Error("an error is expected with -google-photos")
+	}
+}
+
+func TestAssumeMetadataFromJSONOnly(t *testing.T) {
+	ctx := context.Background()
+	for _, jsonOnly := range []bool{false, true} {
+		ic := &icUploadedContent{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, content: map[string][]byte{}, sidecars: map[string][]byte{}}
+		args := []string{"-google-photos", "-discard-archived", "TEST_DATA/Takeout4"}
+		if jsonOnly {
+			args = append([]string{"-assume-metadata-from-json-only"}, args...)
+		}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc, ok := ic.sidecars["Photos from 2023/PXL_20231006_063000139.jpg"]
+		if ok != jsonOnly {
+			t.Fatalf("JSON only %v: the sidecar should be uploaded only in strict mode, got %v", jsonOnly, ok)
+		}
+		// The date of capture of the JSON, 2023-10-06 06:30:00 UTC
+		if jsonOnly && !strings.Contains(string(sc), time.Unix(1696573800, 0).Format("2006-01-02T15:04:05")) {
+			t.Errorf("the sidecar should give the date of the JSON, got %s", sc)
+		}
+	}
+
+	_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-assume-metadata-from-json-only", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Error("an error is expected without -google-photos")
+	}
+}
+
+func TestSelectAlbumsRegex(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		args     []string
+		expected int
+	}{
+		{args: []string{"-select-albums-regex=^Album test"}, expected: 8},
+		{args: []string{"-select-albums-regex=^Other"}, expected: 0},
+		{args: []string{"-exclude-albums-regex=6/10/23$"}, expected: 0},
+		{args: []string{"-select-albums-regex=^Album", "-exclude-albums-regex=^Other"}, expected: 8},
+	} {
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(c.args, "-google-photos", "TEST_DATA/Takeout1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ic.assets) != c.expected || len(ic.albums["Album test 6/10/23"]) != c.expected {
+			t.Errorf("%v: expected %d assets in the album, got %d assets and the albums %v", c.args, c.expected, len(ic.assets), ic.albums)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-select-albums-regex=(", "-google-photos", "TEST_DATA/Takeout1"},
+		{"-exclude-albums-regex=[a-", "-google-photos", "TEST_DATA/Takeout1"},
+		{"-select-albums-regex=^Album", "TEST_DATA/folder/low"},
+	} {
+		_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+func TestSharedAlbumPrefix(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-google-photos", "-shared-album-prefix=Shared: ", "TEST_DATA/Takeout1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		album    browser.LocalAlbum
+		expected string
+	}{
+		{album: browser.LocalAlbum{Name: "Family", Shared: true}, expected: "Shared: Family"},
+		{album: browser.LocalAlbum{Name: "Family"}, expected: "Family"},
+	} {
+		if name := app.albumName(c.album); name != c.expected {
+			t.Errorf("%+v: expected the album %q, got %q", c.album, c.expected, name)
+		}
+	}
+
+	_, err = NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-shared-album-prefix=Shared: ", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Error("the option -shared-album-prefix should require -google-photos")
+	}
+}
+
+func TestAlbumMergeStrategy(t *testing.T) {
+	ctx := context.Background()
+	album := browser.LocalAlbum{Name: "Trip", Path: "Takeout/Google Photos/Trip to Rome"}
+	for _, c := range []struct {
+		args     []string
+		expected []string
+	}{
+		{args: []string{}, expected: []string{"Trip"}},
+		{args: []string{"-album-merge-strategy=folder"}, expected: []string{"Trip to Rome"}},
+		{args: []string{"-use-album-folder-as-name"}, expected: []string{"Trip to Rome"}},
+		{args: []string{"-album-merge-strategy=BOTH"}, expected: []string{"Trip", "Trip to Rome"}},
+		{args: []string{"-album-merge-strategy=combined"}, expected: []string{"Trip (Trip to Rome)"}},
+	} {
+		app, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, append(append([]string{"-google-photos"}, c.args...), "TEST_DATA/Takeout1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := app.albumNames(album); !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%v: expected the albums %q, got %q", c.args, c.expected, names)
+		}
+		// the album named like its folder keeps a single name
+		same := browser.LocalAlbum{Name: "Rome", Path: "Takeout/Google Photos/Rome"}
+		if names := app.albumNames(same); !reflect.DeepEqual(names, []string{"Rome"}) {
+			t.Errorf("%v: expected the album \"Rome\", got %q", c.args, names)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-album-merge-strategy=both", "TEST_DATA/folder/low"},
+		{"-google-photos", "-use-album-folder-as-name", "-album-merge-strategy=combined", "TEST_DATA/Takeout1"},
+	} {
+		_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+func TestVerifyMime(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-verify-mime=FIX", "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.VerifyMime != VerifyMimeFix {
+		t.Errorf("expected -verify-mime=fix, got %q", app.VerifyMime)
+	}
+	for _, args := range [][]string{
+		{"-verify-mime=yes", "TEST_DATA/folder/low"},
+		{"-google-photos", "-verify-mime=log", "TEST_DATA/Takeout1"},
+	} {
+		_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "plan.json")
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-dump-plan=" + file, "-create-album-folder", "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) > 0 || len(ic.albums) > 0 {
+		t.Fatalf("the server shouldn't be changed when writing the plan, got the uploads %v and the albums %v", ic.assets, ic.albums)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := plan{}
+	if err = json.Unmarshal(b, &p); err != nil {
+		t.Fatal(err)
+	}
+	uploads := 0
+	albums := map[string][]string{}
+	for _, a := range p.Actions {
+		switch a.Action {
+		case PlanUpload:
+			uploads++
+		case PlanAlbum:
+			albums[a.Name] = a.Assets
+		}
+	}
+	if uploads != 8 || len(albums["AlbumA"]) != 5 || len(albums["AlbumB"]) != 3 {
+		t.Fatalf("expected 8 uploads into AlbumA and AlbumB, got %d uploads and the albums %v", uploads, albums)
+	}
+	if albums["AlbumB"][0] != "file:AlbumB/PXL_20231006_063528961.jpg" {
+		t.Errorf("the uploaded files should be referred to by their path, got %q", albums["AlbumB"][0])
+	}
+
+	// the reviewed plan drops a file, and adds a server's asset to an album
+	p.Actions = slices.DeleteFunc(p.Actions, func(a planAction) bool {
+		return a.File == "AlbumA/PXL_20231006_063000139.jpg"
+	})
+	p.Actions = append(p.Actions, planAction{Action: PlanAlbum, Name: "AlbumB", Assets: []string{"server-asset"}})
+	b, _ = json.Marshal(p)
+	if err = os.WriteFile(file, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ic = &icCatchUploadsAssets{albums: map[string][]string{}}
+	app, err = NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-execute-plan=" + file, "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) != 7 || slices.Contains(ic.assets, "AlbumA/PXL_20231006_063000139.jpg") {
+		t.Errorf("expected the 7 files of the plan uploaded, got %v", ic.assets)
+	}
+	expected := map[string][]string{
+		"AlbumA": {"AlbumA/PXL_20231006_063029647.jpg", "AlbumA/PXL_20231006_063108407.jpg", "AlbumA/PXL_20231006_063121958.jpg", "AlbumA/PXL_20231006_063357420.jpg"},
+		"AlbumB": {"AlbumB/PXL_20231006_063528961.jpg", "AlbumB/PXL_20231006_063536303.jpg", "AlbumB/PXL_20231006_063851485.jpg", "server-asset"},
+	}
+	if !reflect.DeepEqual(ic.albums, expected) {
+		t.Errorf("expected the albums %v, got %v", expected, ic.albums)
+	}
+
+	for _, args := range [][]string{
+		{"-dump-plan=" + file, "-execute-plan=" + file, "TEST_DATA/folder/high"},
+		{"-dump-plan=" + file, "-move", "TEST_DATA/folder/high"},
+		{"-execute-plan=" + filepath.Join(t.TempDir(), "missing.json"), "TEST_DATA/folder/high"},
+	} {
+		_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+}
+
+type icTwinAlbums struct {
+	icCatchUploadsAssets
+}
+
+func (c *icTwinAlbums) GetAllAlbums(context.Context) ([]immich.AlbumSimplified, error) {
+	return []immich.AlbumSimplified{{ID: "trip-1", AlbumName: "Trip"}, {ID: "trip-2", AlbumName: "Trip"}}, nil
+}
+
+func TestAlbumByID(t *testing.T) {
+	ctx := context.Background()
+	ic := &icTwinAlbums{icCatchUploadsAssets{albums: map[string][]string{}}}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-album=id:trip-2", "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.albums) != 1 || len(ic.albums["trip-2"]) != 8 {
+		t.Errorf("expected the files added to the album trip-2, got %v", ic.albums)
+	}
+
+	ic = &icTwinAlbums{icCatchUploadsAssets{albums: map[string][]string{}}}
+	app, err = NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-album=id:trip-3", "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.Run(ctx, app.fsys)
+	if err == nil || len(ic.assets) > 0 {
+		t.Errorf("expected an error for the missing album before the upload, got %v and %d uploads", err, len(ic.assets))
+	}
+
+	_, err = NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-album=id:", "TEST_DATA/folder/low"})
+	if err == nil {
+		t.Error("an error is expected for an empty album ID")
+	}
+}
+
+func TestAlbumOrder(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-google-photos", "-album-batch=3", "TEST_DATA/Takeout1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ic.albums["Album test 6/10/23"]
+		if len(got) != 8 || !reflect.DeepEqual(got, ic.assets) {
+			t.Fatalf("the assets should be added in the order of the takeout %v, got %v", ic.assets, got)
+		}
+	}
+}
+
+func TestUseExifTool(t *testing.T) {
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"-exif-tool-path=/usr/bin/exiftool", "TEST_DATA/folder/low"},
+		{"-use-exiftool", "-no-exif", "TEST_DATA/folder/low"},
+	} {
+		_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, args)
+		if err == nil {
+			t.Errorf("%v: an error is expected", args)
+		}
+	}
+
+	// without exiftool, the files are read by immich-go
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-use-exiftool", "-exif-tool-path=" + filepath.Join(t.TempDir(), "exiftool"), "TEST_DATA/folder/low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.exifTool != nil {
+		t.Error("exiftool shouldn't be found")
+	}
+	err = app.Run(ctx, app.fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) == 0 {
+		t.Error("the files should be uploaded without exiftool")
+	}
+}
+
+func TestSinceAfterBefore(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"recent.jpg": {Data: []byte("recent")},
+		"old.jpg":    {Data: []byte("old")},
+		"nodate.jpg": {Data: []byte("no date"), ModTime: now.Add(-2 * time.Hour)},
+	}
+	dates := map[string]time.Time{"recent.jpg": now.AddDate(0, 0, -1), "old.jpg": now.AddDate(0, 0, -30)}
+	tc := []struct {
+		args     []string
+		uploaded []string
+		err      bool
+	}{
+		{args: []string{"-since=7d"}, uploaded: []string{"recent.jpg"}},
+		{args: []string{"-since=168h", "-date-fallback=modtime"}, uploaded: []string{"nodate.jpg", "recent.jpg"}},
+		{args: []string{"-since=1h", "-date-fallback=modtime"}, uploaded: []string{}},
+		{args: []string{"-after=" + now.AddDate(0, 0, -10).Format("2006-01-02")}, uploaded: []string{"recent.jpg"}},
+		{args: []string{"-before=" + now.AddDate(0, 0, -10).Format(time.RFC3339)}, uploaded: []string{"old.jpg"}},
+		{args: []string{"-after=" + now.AddDate(0, 0, -40).Format("2006-01-02"), "-before=" + now.AddDate(0, 0, -10).Format("2006-01-02")}, uploaded: []string{"old.jpg"}},
+		{args: []string{"-since=7d", "-date=2023"}, err: true},
+		{args: []string{"-since=7d", "-before=2023-01-01"}, err: true},
+		{args: []string{"-after=2023-02-01", "-before=2023-01-01"}, err: true},
+		{args: []string{"-after=yesterday"}, err: true},
+	}
+	for _, c := range tc {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, c.args)
+			if c.err {
+				if err == nil {
+					t.Error("the command should be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.waitAssetIndex(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.AssetIndex = &AssetIndex{}
+			app.AssetIndex.ReIndex()
+			for _, name := range []string{"nodate.jpg", "old.jpg", "recent.jpg"} {
+				a := &browser.LocalAssetFile{FSys: fsys, FileName: name, Title: name, FileSize: len(fsys[name].Data), DateTaken: dates[name]}
+				err = app.handleAsset(ctx, a)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(ic.assets) != len(c.uploaded) || len(c.uploaded) > 0 && !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+		})
+	}
+}
+
+// icWatch signals the uploads made while the folders are watched
+type icWatch struct {
+	icCatchUploadsAssets
+	uploads chan string
+}
+
+func (c *icWatch) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.mut.Lock()
+	c.assets = append(c.assets, a.FileName)
+	c.mut.Unlock()
+	c.uploads <- a.FileName
+	return immich.AssetResponse{ID: a.FileName}, nil
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	copyFile := func(src, dst string) {
+		b, err := os.ReadFile(filepath.Join("TEST_DATA/folder/low", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the file is written in two steps, it's uploaded once complete
+		f, err := os.Create(filepath.Join(dir, dst))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, _ = f.Write(b[:len(b)/2])
+		time.Sleep(20 * time.Millisecond)
+		_, _ = f.Write(b[len(b)/2:])
+	}
+	waitUpload := func(ic *icWatch, name string) {
+		select {
+		case n := <-ic.uploads:
+			if n != name {
+				t.Fatalf("expected the upload of %s, got %s", name, n)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s isn't uploaded", name)
+		}
+	}
+	copyFile("PXL_20231006_063000139.jpg", "first.jpg")
+
+	ctx, stop := shutdown.WithStop(context.Background())
+	ic := &icWatch{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, uploads: make(chan string, 10)}
+	app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-watch", "-watch-delay=200ms", "-album=hot folder", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- app.Run(ctx, app.fsys) }()
+	waitUpload(ic, "first.jpg")
+
+	copyFile("PXL_20231006_063029647.jpg", "second.jpg")
+	waitUpload(ic, "second.jpg")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile("PXL_20231006_063108407.jpg", "sub/third.jpg")
+	waitUpload(ic, "sub/third.jpg")
+
+	// the copy of an uploaded file is found in the index of the server's assets
+	copyFile("PXL_20231006_063000139.jpg", "sub/first.jpg")
+	time.Sleep(time.Second)
+
+	stop()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"first.jpg", "second.jpg", "sub/third.jpg"}
+	if !slices.Equal(ic.assets, expected) {
+		t.Errorf("expected the uploads %v, got %v", expected, ic.assets)
+	}
+	// the copy gives again its server's asset to the album
+	album := slices.Clone(ic.albums["hot folder"])
+	slices.Sort(album)
+	if !slices.Equal(slices.Compact(album), expected) {
+		t.Errorf("expected the new files added to the album, got %v", ic.albums)
+	}
+
+	_, err = NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-watch", "-google-photos", dir})
+	if err == nil {
+		t.Error("an error is expected for -watch with -google-photos")
+	}
+}
+
+func TestEncryptedTakeout(t *testing.T) {
+	ctx := context.Background()
+	for _, name := range []string{"encrypted-aes.zip", "encrypted-zipcrypto.zip"} {
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, []string{"-google-photos", "-archive-password=secret", "../helpers/fshelper/TESTDATA_ZIP/" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.Run(ctx, app.fsys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ic.assets, []string{"Takeout/Google Photos/Trip/IMG_0001.jpg"}) || len(ic.albums["Trip"]) != 1 {
+			t.Errorf("%s: expected the photo uploaded into the album Trip, got %v and %v", name, ic.assets, ic.albums)
+		}
+	}
+
+	_, err := NewUpCmd(ctx, &stubIC{}, logger.NoLogger{}, []string{"-google-photos", "-archive-password=wrong", "../helpers/fshelper/TESTDATA_ZIP/encrypted-aes.zip"})
+	if !errors.Is(err, fshelper.ErrArchivePassword) {
+		t.Errorf("expected the error of a wrong password, got %v", err)
+	}
+}
+
+type icPatches struct {
+	icAssetDescriptions
+	updates map[string]immich.AssetMetadataUpdate
+	calls   int
+}
+
+func (c *icPatches) UpdateAssetsMetadata(ctx context.Context, IDs []string, m immich.AssetMetadataUpdate) error {
+	c.calls++
+	for _, id := range IDs {
+		c.updates[id] = m
+	}
+	return nil
+}
+
+func TestPatchMetadata(t *testing.T) {
+	takeout := fstest.MapFS{
+		"Photos from 2023/a.jpg":      {Data: []byte("a")},
+		"Photos from 2023/a.jpg.json": {Data: []byte(`{"title": "a.jpg", "description": "Eiffel tower", "photoTakenTime": {"timestamp": "1696573800"}, "geoDataExif": {"latitude": 48.858, "longitude": 2.294}, "url": "https://photos.google.com/photo/a"}`)},
+		"Photos from 2023/b.jpg":      {Data: []byte("bb")},
+		"Photos from 2023/b.jpg.json": {Data: []byte(`{"title": "b.jpg", "description": "Louvre", "photoTakenTime": {"timestamp": "1696573900"}, "geoDataExif": {"latitude": 48.861, "longitude": 2.336}, "url": "https://photos.google.com/photo/b"}`)},
+		"Photos from 2023/c.jpg":      {Data: []byte("ccc")},
+		"Photos from 2023/c.jpg.json": {Data: []byte(`{"title": "c.jpg", "photoTakenTime": {"timestamp": "1696574000"}, "geoDataExif": {"latitude": 48.858, "longitude": 2.294}, "url": "https://photos.google.com/photo/c"}`)},
+	}
+	la := &browser.LocalAssetFile{FSys: takeout, FileName: "Photos from 2023/c.jpg"}
+	checksum, err := la.ComputeChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exif := func(timestamp int64, size int) immich.ExifInfo {
+		return immich.ExifInfo{FileSizeInByte: size, DateTimeOriginal: immich.ImmichTime{Time: time.Unix(timestamp, 0)}}
+	}
+	server := func() []*immich.Asset {
+		b := exif(1696573900, 2)
+		b.Latitude, b.Longitude, b.Description = 1, 2, "Museum"
+		c := exif(1577836800, 3)
+		c.Latitude, c.Longitude = 48.858, 2.294
+		return []*immich.Asset{
+			{ID: "s1", OriginalFileName: "a", OriginalPath: "upload/a.jpg", ExifInfo: exif(1696573800, 1)},
+			{ID: "s2", OriginalFileName: "b", OriginalPath: "upload/b.jpg", ExifInfo: b},
+			{ID: "s3", OriginalFileName: "renamed", OriginalPath: "upload/renamed.jpg", Checksum: checksum, ExifInfo: c},
+		}
+	}
+	tc := []struct {
+		name         string
+		args         []string
+		updates      map[string]immich.AssetMetadataUpdate
+		descriptions map[string]string
+		uploaded     []string
+		patched      int
+	}{
+		{name: "default", args: []string{"-checksum"}},
+		{name: "without checksum", args: []string{"-patch-metadata"}, uploaded: []string{"Photos from 2023/c.jpg"}, updates: map[string]immich.AssetMetadataUpdate{"s1": {Latitude: 48.858, Longitude: 2.294}}, descriptions: map[string]string{"s1": "Eiffel tower"}, patched: 1},
+		{
+			name: "patch", args: []string{"-checksum", "-patch-metadata"},
+			updates: map[string]immich.AssetMetadataUpdate{
+				"s1": {Latitude: 48.858, Longitude: 2.294},
+				"s3": {DateTimeOriginal: time.Unix(1696574000, 0)},
+			},
+			descriptions: map[string]string{"s1": "Eiffel tower"},
+			patched:      2,
+		},
+		{name: "dry-run", args: []string{"-checksum", "-patch-metadata", "-dry-run"}, patched: 2},
+		{
+			name: "strip-gps", args: []string{"-patch-metadata", "-strip-gps"},
+			uploaded:     []string{"Photos from 2023/c.jpg"},
+			descriptions: map[string]string{"s1": "Eiffel tower"},
+			patched:      1,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ic := &icPatches{
+				icAssetDescriptions: icAssetDescriptions{
+					icOverwrite:  icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()},
+					descriptions: map[string]string{},
+				},
+				updates: map[string]immich.AssetMetadataUpdate{},
+			}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-google-photos"}, c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = app.Run(ctx, []fs.FS{&takeout}); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ic.assets, c.uploaded) {
+				t.Errorf("expected uploads %v, got %v", c.uploaded, ic.assets)
+			}
+			if len(ic.updates) != len(c.updates) {
+				t.Errorf("expected the updates %v, got %v", c.updates, ic.updates)
+			}
+			for id, u := range c.updates {
+				got := ic.updates[id]
+				if !got.DateTimeOriginal.Equal(u.DateTimeOriginal) || got.Latitude != u.Latitude || got.Longitude != u.Longitude {
+					t.Errorf("%s: expected the update %v, got %v", id, u, got)
+				}
+			}
+			if ic.calls > len(c.updates) {
+				t.Errorf("expected at most %d calls, got %d", len(c.updates), ic.calls)
+			}
+			if fmt.Sprint(ic.descriptions) != fmt.Sprint(c.descriptions) && len(ic.descriptions)+len(c.descriptions) > 0 {
+				t.Errorf("expected the descriptions %v, got %v", c.descriptions, ic.descriptions)
+			}
+			if n := app.Journal.Count(logger.METADATA_PATCHED); n != c.patched {
+				t.Errorf("expected %d corrected assets, got %d", c.patched, n)
+			}
+		})
+	}
+
+	if _, err := NewUpCmd(context.Background(), &stubIC{}, logger.NoLogger{}, []string{"-patch-metadata", "-dump-plan=plan.json"}); err == nil {
+		t.Error("-patch-metadata shouldn't be accepted with -dump-plan")
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	takeout := fstest.MapFS{
+		"Photos from 2023/a.jpg":      {Data: []byte("a")},
+		"Photos from 2023/a.jpg.json": {Data: []byte(`{"title": "a.jpg", "favorited": true, "photoTakenTime": {"timestamp": "1696573800"}, "url": "https://photos.google.com/photo/a"}`)},
+		"Photos from 2023/b.jpg":      {Data: []byte("bb")},
+		"Photos from 2023/b.jpg.json": {Data: []byte(`{"title": "b.jpg", "favorited": true, "photoTakenTime": {"timestamp": "1696573900"}, "url": "https://photos.google.com/photo/b"}`)},
+		"Photos from 2023/c.jpg":      {Data: []byte("ccc")},
+		"Photos from 2023/c.jpg.json": {Data: []byte(`{"title": "c.jpg", "favorited": true, "photoTakenTime": {"timestamp": "1696574000"}, "url": "https://photos.google.com/photo/c"}`)},
+		"Photos from 2023/d.jpg":      {Data: []byte("dddd")},
+		"Photos from 2023/d.jpg.json": {Data: []byte(`{"title": "d.jpg", "photoTakenTime": {"timestamp": "1696574100"}, "url": "https://photos.google.com/photo/d"}`)},
+	}
+	exif := func(timestamp int64, size int) immich.ExifInfo {
+		return immich.ExifInfo{FileSizeInByte: size, DateTimeOriginal: immich.ImmichTime{Time: time.Unix(timestamp, 0)}}
+	}
+	server := func() []*immich.Asset {
+		return []*immich.Asset{
+			{ID: "s2", OriginalFileName: "b", OriginalPath: "upload/b.jpg", ExifInfo: exif(1696573900, 2)},
+			{ID: "s3", OriginalFileName: "c", OriginalPath: "upload/c.jpg", ExifInfo: exif(1696574000, 3), IsFavorite: true},
+			{ID: "s4", OriginalFileName: "d", OriginalPath: "upload/d.jpg", ExifInfo: exif(1696574100, 4)},
+		}
+	}
+	tc := []struct {
+		name   string
+		args   []string
+		marked []string
+		count  int
+	}{
+		{name: "default"},
+		{name: "from metadata", args: []string{"-favorite-from-metadata"}, marked: []string{"s2"}, count: 2},
+		{name: "dry-run", args: []string{"-favorite-from-metadata", "-dry-run"}, count: 2},
+		{name: "album", args: []string{"-album=Best", "-favorite-album=Best"}, marked: []string{"Photos from 2023/a.jpg", "s2", "s3", "s4"}, count: 4},
+		{name: "other album", args: []string{"-album=Trip", "-favorite-album=Best"}},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ic := &icPatches{
+				icAssetDescriptions: icAssetDescriptions{
+					icOverwrite:  icOverwrite{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}, server: server()},
+					descriptions: map[string]string{},
+				},
+				updates: map[string]immich.AssetMetadataUpdate{},
+			}
+			ctx := context.Background()
+			app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append([]string{"-google-photos"}, c.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = app.Run(ctx, []fs.FS{&takeout}); err != nil {
+				t.Fatal(err)
+			}
+			marked := gen.MapKeys(ic.updates)
+			slices.Sort(marked)
+			if !slices.Equal(marked, c.marked) {
+				t.Errorf("expected the favorites %v, got %v", c.marked, marked)
+			}
+			for id, u := range ic.updates {
+				if u != (immich.AssetMetadataUpdate{Favorite: true}) {
+					t.Errorf("%s: only the favorite flag should be changed, got %v", id, u)
+				}
+			}
+			if ic.calls > 1 {
+				t.Errorf("the favorites should be marked in one call, got %d", ic.calls)
+			}
+			if n := app.Journal.Count(logger.FAVORITE); n != c.count {
+				t.Errorf("expected %d favorites, got %d", c.count, n)
+			}
+		})
+	}
+}
+
+func TestFavoriteFromRating(t *testing.T) {
+	fsys := fstest.MapFS{
+		"IMG_20231006_063000.jpg": {Data: []byte("a")},
+		"IMG_20231006_063000.xmp": {Data: []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="5"/></rdf:RDF></x:xmpmeta>`)},
+		"IMG_20231006_063100.jpg": {Data: []byte("b")},
+		"IMG_20231006_063100.xmp": {Data: []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="3"/></rdf:RDF></x:xmpmeta>`)},
+	}
+	for _, args := range [][]string{nil, {"-favorite-from-metadata"}} {
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = app.Run(ctx, []fs.FS{fsys}); err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if len(args) > 0 {
+			want = 1
+		}
+		if n := app.Journal.Count(logger.FAVORITE); n != want {
+			t.Errorf("%v: expected %d favorites, got %d", args, want, n)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cmdupload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// uploadJournal keeps track of assets successfully uploaded on the server
+// in a newline-delimited JSON file. It lets a run interrupted by a crash
+// be resumed without checking again the already uploaded files.
+
+type uploadJournal struct {
+	name     string
+	f        *os.File
+	enc      *json.Encoder
+	known    map[string]string // server ID by DeviceAssetID
+	pending  int               // records written since the last sync
+	lastSync time.Time
+
+	truncated bool // the last record is incomplete
+}
+
+type uploadJournalRecord struct {
+	DeviceAssetID string `json:"deviceAssetId"`
+	ID            string `json:"id"`
+}
+
+const (
+	journalSyncEvery    = 10              // sync the file after this number of records
+	journalSyncInterval = 5 * time.Second // or after this delay
+)
+
+// openUploadJournal loads the records of the journal file and opens it for appending new records.
+// When reset is true, the journal is truncated.
+
+func openUploadJournal(name string, reset bool) (*uploadJournal, error) {
+	j := uploadJournal{
+		name:     name,
+		known:    map[string]string{},
+		lastSync: time.Now(),
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if reset {
+		flags |= os.O_TRUNC
+	} else {
+		err := j.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	j.f, err = os.OpenFile(name, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open the journal: %w", err)
+	}
+	if j.truncated {
+		// start the next record on a new line
+		_, err = j.f.Write([]byte{'\n'})
+		if err != nil {
+			j.f.Close()
+			return nil, fmt.Errorf("can't write the journal: %w", err)
+		}
+	}
+	j.enc = json.NewEncoder(j.f)
+	return &j, nil
+}
+
+func (j *uploadJournal) load() error {
+	b, err := os.ReadFile(j.name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("can't read the journal: %w", err)
+	}
+
+	for _, l := range bytes.Split(b, []byte{'\n'}) {
+		var r uploadJournalRecord
+		// The last line can be truncated when the program has been killed. Ignore it.
+		if json.Unmarshal(l, &r) != nil || r.DeviceAssetID == "" {
+			continue
+		}
+		j.known[r.DeviceAssetID] = r.ID
+	}
+	j.truncated = len(b) > 0 && b[len(b)-1] != '\n'
+	return nil
+}
+
+// Has reports whether the asset is recorded in the journal
+func (j *uploadJournal) Has(deviceAssetID string) bool {
+	if j == nil {
+		return false
+	}
+	_, ok := j.known[deviceAssetID]
+	return ok
+}
+
+// Len returns the number of assets recorded in the journal
+func (j *uploadJournal) Len() int {
+	if j == nil {
+		return 0
+	}
+	return len(j.known)
+}
+
+// Record appends the asset to the journal.
+// The file is synced periodically to limit the loss of records in case of crash.
+func (j *uploadJournal) Record(deviceAssetID string, ID string) error {
+	if j == nil {
+		return nil
+	}
+	err := j.enc.Encode(uploadJournalRecord{DeviceAssetID: deviceAssetID, ID: ID})
+	if err != nil {
+		return err
+	}
+	j.known[deviceAssetID] = ID
+	j.pending++
+	if j.pending >= journalSyncEvery || time.Since(j.lastSync) >= journalSyncInterval {
+		return j.sync()
+	}
+	return nil
+}
+
+func (j *uploadJournal) sync() error {
+	j.pending = 0
+	j.lastSync = time.Now()
+	return j.f.Sync()
+}
+
+// Close flushes the pending records and closes the journal
+func (j *uploadJournal) Close() error {
+	if j == nil || j.f == nil {
+		return nil
+	}
+	err := errors.Join(j.sync(), j.f.Close())
+	j.f = nil
+	return err
+}
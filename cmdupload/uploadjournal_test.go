@@ -0,0 +1,68 @@
+package cmdupload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadJournal(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "journal.json")
+
+	j, err := openUploadJournal(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"A.JPG-10", "B.JPG-20", "C.JPG-30"} {
+		if err = j.Record(id, "ID-"+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a record truncated by a crash
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"deviceAssetId":"D.JP`)
+	f.Close()
+
+	j, err = openUploadJournal(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Len() != 3 {
+		t.Errorf("expected 3 records, got %d", j.Len())
+	}
+	if !j.Has("B.JPG-20") {
+		t.Errorf("expected B.JPG-20 in the journal")
+	}
+	if j.Has("D.JPG-40") {
+		t.Errorf("unexpected D.JPG-40 in the journal")
+	}
+	if err = j.Record("E.JPG-50", "ID-E"); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = openUploadJournal(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !j.Has("E.JPG-50") {
+		t.Errorf("expected E.JPG-50 in the journal after a truncated record")
+	}
+	j.Close()
+
+	j, err = openUploadJournal(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if j.Len() != 0 || j.Has("A.JPG-10") {
+		t.Errorf("expected an empty journal after reset")
+	}
+}
@@ -0,0 +1,97 @@
+package cmdupload
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+// SampleSize is the number of uploads to verify: a count like 20, or a percentage like 10%
+type SampleSize struct {
+	N       int
+	Percent bool
+}
+
+func (s *SampleSize) Set(v string) error {
+	v = strings.TrimSpace(v)
+	s.Percent = strings.HasSuffix(v, "%")
+	n, err := strconv.Atoi(strings.TrimSuffix(v, "%"))
+	if err != nil || n < 0 || (s.Percent && n > 100) {
+		return fmt.Errorf("invalid sample size %q, expecting a count like 20 or a percentage like 10%%", v)
+	}
+	s.N = n
+	return nil
+}
+
+func (s SampleSize) String() string {
+	if s.Percent {
+		return strconv.Itoa(s.N) + "%"
+	}
+	return strconv.Itoa(s.N)
+}
+
+// Of gives the size of the sample for a population of n items
+func (s SampleSize) Of(n int) int {
+	if s.Percent {
+		return (n*s.N + 99) / 100
+	}
+	return min(s.N, n)
+}
+
+// uploadedAsset keeps the uploaded files to be verified
+type uploadedAsset struct {
+	ID string
+	a  *browser.LocalAssetFile
+}
+
+// verifyUploads compares the checksum of a sample of uploaded files with the one computed by the server.
+// Local files that don't match aren't deleted.
+func (app *UpCmd) verifyUploads(ctx context.Context) error {
+	n := app.VerifyUploads.Of(len(app.uploaded))
+	if n == 0 {
+		return nil
+	}
+	seed := app.VerifySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	app.Journal.OK("Verifying %d uploaded file(s), use -verify-seed=%d to verify the same sample", n, seed)
+
+	rnd := rand.New(rand.NewSource(seed))
+	for _, i := range rnd.Perm(len(app.uploaded))[:n] {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		u := app.uploaded[i]
+		app.mediaVerified++
+		err := app.verifyAsset(ctx, u)
+		if err != nil {
+			app.mediaMismatch++
+			app.report.addFailure(u.a.FileName, err.Error())
+			app.Journal.Error("Verification of %q failed: %s", u.a.FileName, err)
+			app.deleteLocalList = slices.DeleteFunc(app.deleteLocalList, func(a *browser.LocalAssetFile) bool { return a == u.a })
+		}
+	}
+	return nil
+}
+
+func (app *UpCmd) verifyAsset(ctx context.Context, u uploadedAsset) error {
+	local, err := app.checksum(u.a)
+	if err != nil {
+		return fmt.Errorf("can't compute the local checksum: %w", err)
+	}
+	sa, err := app.client.GetAssetByID(ctx, u.ID)
+	if err != nil {
+		return fmt.Errorf("can't get the server's asset: %w", err)
+	}
+	if sa.Checksum != local {
+		return fmt.Errorf("the server's checksum %q doesn't match the local one %q", sa.Checksum, local)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package cmdupload
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/logger"
+)
+
+func TestSampleSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		n       int
+		want    int
+		wantErr bool
+	}{
+		{value: "20", n: 100, want: 20},
+		{value: "20", n: 5, want: 5},
+		{value: "10%", n: 100, want: 10},
+		{value: "10%", n: 5, want: 1},
+		{value: "100%", n: 7, want: 7},
+		{value: "0", n: 7, want: 0},
+		{value: "150%", wantErr: true},
+		{value: "ten", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var s SampleSize
+			err := s.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && s.Of(tt.n) != tt.want {
+				t.Errorf("Of(%d) = %d, want %d", tt.n, s.Of(tt.n), tt.want)
+			}
+		})
+	}
+}
+
+// icVerify records the checksum of uploaded files, and corrupts one of them
+type icVerify struct {
+	icCatchUploadsAssets
+	corrupted string
+	checksums map[string]string
+	verified  []string
+	lock      sync.Mutex
+}
+
+func (c *icVerify) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	sum, err := a.ComputeChecksum()
+	if err != nil {
+		return immich.AssetResponse{}, err
+	}
+	if a.FileName == c.corrupted {
+		sum = "corrupted"
+	}
+	c.lock.Lock()
+	c.checksums[a.FileName] = sum
+	c.lock.Unlock()
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func (c *icVerify) GetAssetByID(ctx context.Context, ID string) (*immich.Asset, error) {
+	c.verified = append(c.verified, ID)
+	return &immich.Asset{ID: ID, Checksum: c.checksums[ID]}, nil
+}
+
+func TestVerifyUploads(t *testing.T) {
+	run := func(args ...string) (*UpCmd, *icVerify) {
+		t.Helper()
+		ic := &icVerify{
+			icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+			corrupted:            "PXL_20231006_063029647.jpg",
+			checksums:            map[string]string{},
+		}
+		ctx := context.Background()
+		app, err := NewUpCmd(ctx, ic, logger.NoLogger{}, append(args, "TEST_DATA/folder/low"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fsys := range app.fsys {
+			err = errors.Join(err, app.Run(ctx, []fs.FS{fsys}))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return app, ic
+	}
+
+	app, ic := run()
+	if len(ic.verified) != 0 {
+		t.Errorf("uploads verified without -verify-uploads: %v", ic.verified)
+	}
+
+	app, ic = run("-verify-uploads=100%")
+	if app.mediaVerified != len(ic.assets) || app.mediaMismatch != 1 {
+		t.Errorf("expected %d verified and 1 mismatch, got %d verified and %d mismatches", len(ic.assets), app.mediaVerified, app.mediaMismatch)
+	}
+
+	_, ic1 := run("-verify-uploads=3", "-verify-seed=42")
+	_, ic2 := run("-verify-uploads=3", "-verify-seed=42")
+	if len(ic1.verified) != 3 || !slices.Equal(ic1.verified, ic2.verified) {
+		t.Errorf("the same seed should verify the same 3 uploads: %v, %v", ic1.verified, ic2.verified)
+	}
+}
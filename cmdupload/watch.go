@@ -0,0 +1,291 @@
+package cmdupload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/logger"
+)
+
+// DefaultWatchDelay is the time during which a new file must keep the same size before its upload by -watch
+const DefaultWatchDelay = 2 * time.Second
+
+// checkWatchOptions verifies that -watch can be used with the other options
+func (app *UpCmd) checkWatchOptions() error {
+	if !app.Watch {
+		return nil
+	}
+	switch {
+	case app.GooglePhotos:
+		return errors.New("the option -watch can't be used with -google-photos")
+	case app.syncing:
+		return errors.New("the option -watch can't be used with the sync command")
+	case app.DumpPlan != "" || app.ExecutePlan != "":
+		return errors.New("the option -watch can't be used with -dump-plan or -execute-plan")
+	case app.OpenCheck:
+		return errors.New("the option -watch can't be used with -dry-run-open-check")
+	case app.OrphanReport != "":
+		return errors.New("the option -watch can't be used with -orphan-report")
+	case app.WatchDelay <= 0:
+		return errors.New("the option -watch-delay must be positive")
+	}
+	return nil
+}
+
+// fileBrowser browses some files of a file system, like the folder import does for the new files
+type fileBrowser interface {
+	BrowseFiles(ctx context.Context, fsys fs.FS, names []string) chan *browser.LocalAssetFile
+}
+
+// watchedFile is a new file of the source waiting for the end of its writing
+type watchedFile struct {
+	fsys    fs.FS
+	name    string
+	size    int64
+	modTime time.Time
+	changed time.Time // time of the last change of the size or of the modification time
+}
+
+// sourceWatcher follows the changes of the folders of the source.
+// It is started before the first pass, so the files added during the first pass aren't missed.
+type sourceWatcher struct {
+	app     *UpCmd
+	w       *fsnotify.Watcher
+	roots   map[string]fs.FS        // file systems by folder of the disk
+	pending map[string]*watchedFile // new files by path on the disk
+}
+
+// newSourceWatcher watches the folders of the source and their sub-folders, except the excluded ones
+func (app *UpCmd) newSourceWatcher(fsyss []fs.FS) (*sourceWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("can't watch the folders: %w", err)
+	}
+	sw := &sourceWatcher{app: app, w: w, roots: map[string]fs.FS{}, pending: map[string]*watchedFile{}}
+	for _, fsys := range fsyss {
+		root := fshelper.OSPath(fsys, ".")
+		if root == "" {
+			w.Close()
+			return nil, errors.New("the option -watch needs folders of the local disk")
+		}
+		sw.roots[root] = fsys
+		if err = sw.addFolder(fsys, ".", false); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return sw, nil
+}
+
+func (sw *sourceWatcher) Close() error {
+	return sw.w.Close()
+}
+
+// addFolder watches the folder and its sub-folders. With files, the files found in them are new.
+func (sw *sourceWatcher) addFolder(fsys fs.FS, folder string, files bool) error {
+	return fs.WalkDir(fsys, folder, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if files {
+				sw.fileChanged(fsys, name)
+			}
+			return nil
+		}
+		if name != "." && sw.app.BrowserConfig.ExcludePaths.Match(name) {
+			return fs.SkipDir
+		}
+		if err := sw.w.Add(fshelper.OSPath(fsys, name)); err != nil {
+			return fmt.Errorf("can't watch the folder %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// locate gives the file system and the name in it of a path of the disk, nil when it's outside the source.
+// The deepest folder of the source is used when they are nested.
+func (sw *sourceWatcher) locate(p string) (fs.FS, string) {
+	var fsys fs.FS
+	name := ""
+	best := -1
+	for root, rfs := range sw.roots {
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > best {
+			fsys, name, best = rfs, filepath.ToSlash(rel), len(root)
+		}
+	}
+	return fsys, name
+}
+
+// fileChanged records the size of a new or modified file, and the time of its change
+func (sw *sourceWatcher) fileChanged(fsys fs.FS, name string) {
+	s, err := fs.Stat(fsys, name)
+	if err != nil || s.IsDir() {
+		return
+	}
+	p := fshelper.OSPath(fsys, name)
+	f, ok := sw.pending[p]
+	if !ok {
+		f = &watchedFile{fsys: fsys, name: name}
+		sw.pending[p] = f
+	}
+	f.size, f.modTime, f.changed = s.Size(), s.ModTime(), time.Now()
+}
+
+// handleEvent follows a change of a watched folder
+func (sw *sourceWatcher) handleEvent(e fsnotify.Event) {
+	fsys, name := sw.locate(e.Name)
+	if fsys == nil || name == "." {
+		return
+	}
+	switch {
+	case e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename):
+		// the new name of a renamed file comes with a Create event
+		delete(sw.pending, e.Name)
+	case e.Has(fsnotify.Create):
+		s, err := fs.Stat(fsys, name)
+		if err != nil {
+			return
+		}
+		if s.IsDir() {
+			// the files moved with a folder, or written before the folder is watched, have no event
+			if err := sw.addFolder(fsys, name, true); err != nil {
+				sw.app.Journal.Warning("%s", err)
+			}
+			return
+		}
+		sw.fileChanged(fsys, name)
+	case e.Has(fsnotify.Write):
+		sw.fileChanged(fsys, name)
+	}
+}
+
+// stableFiles gives the pending files whose size and modification time haven't changed during -watch-delay,
+// grouped by file system. The files still being written wait for the next check.
+func (sw *sourceWatcher) stableFiles(now time.Time) map[fs.FS][]string {
+	ready := map[fs.FS][]string{}
+	for p, f := range sw.pending {
+		if now.Sub(f.changed) < sw.app.WatchDelay {
+			continue
+		}
+		s, err := fs.Stat(f.fsys, f.name)
+		if err != nil {
+			delete(sw.pending, p)
+			continue
+		}
+		if s.Size() != f.size || !s.ModTime().Equal(f.modTime) {
+			f.size, f.modTime, f.changed = s.Size(), s.ModTime(), now
+			continue
+		}
+		delete(sw.pending, p)
+		ready[f.fsys] = append(ready[f.fsys], f.name)
+	}
+	return ready
+}
+
+// run uploads the files added to the source after the first pass, until the stop request.
+// The server is updated with the albums, stacks and tags of each batch of new files,
+// the files still being written at the stop aren't uploaded.
+func (sw *sourceWatcher) run(ctx context.Context, b browser.Browser, stopping <-chan struct{}) error {
+	app := sw.app
+	fb, ok := b.(fileBrowser)
+	if !ok {
+		return errors.New("the option -watch needs a folder import")
+	}
+	// the updates of the first pass are done
+	for _, srv := range app.servers() {
+		srv.resetServerUpdates()
+	}
+	app.Journal.OK("Watching %d folders for new files, press Ctrl+C to stop", len(sw.w.WatchList()))
+
+	tick := time.NewTicker(max(app.WatchDelay/4, 10*time.Millisecond))
+	defer tick.Stop()
+	for {
+		select {
+		case <-stopping:
+			if len(sw.pending) > 0 {
+				app.Journal.Warning("%d files being written when stopping aren't uploaded", len(sw.pending))
+			}
+			app.Journal.OK("Watching stopped")
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sw.w.Errors:
+			// an overflow of the events loses some new files, they are uploaded by the next run
+			app.Journal.Warning("can't watch the folders: %s", err)
+		case e := <-sw.w.Events:
+			sw.handleEvent(e)
+		case now := <-tick.C:
+			ready := sw.stableFiles(now)
+			if len(ready) == 0 {
+				continue
+			}
+			if err := sw.upload(ctx, fb, ready); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// upload handles a batch of new files like the first pass, then updates the servers
+func (sw *sourceWatcher) upload(ctx context.Context, fb fileBrowser, ready map[fs.FS][]string) error {
+	app := sw.app
+	count := 0
+	for _, fsys := range gen.MapKeys(ready) {
+		names := ready[fsys]
+		slices.Sort(names)
+		count += len(names)
+		for a := range fb.BrowseFiles(ctx, fsys, names) {
+			if a.Err != nil {
+				app.journalAsset(a, logger.ERROR, a.Err.Error())
+				continue
+			}
+			if err := app.handleServersAsset(ctx, a); err != nil {
+				return err
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	app.Journal.OK("%d new files handled", count)
+	for _, srv := range app.servers() {
+		if err := srv.updateServer(ctx); err != nil {
+			return err
+		}
+		srv.resetServerUpdates()
+	}
+	return nil
+}
+
+// resetServerUpdates forgets the albums, stacks, tags and deletions sent to the server,
+// so the next update of the server sends only the ones of the new files.
+// The index of the server's assets keeps the uploaded files for the comparisons of the next files.
+func (app *UpCmd) resetServerUpdates() {
+	app.updateAlbums = map[string]albumAssets{}
+	app.updateTags = map[string]map[string]any{}
+	app.folderDescs = nil
+	app.metadataPatches = nil
+	app.favorites = nil
+	app.deleteServerList = nil
+	app.uploaded = nil
+	app.stackCovers = nil
+	if app.stacks != nil {
+		app.stacks = stacking.NewStackBuilder().SetLivePhotos(app.StackLivePhotos)
+	}
+}
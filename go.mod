@@ -3,6 +3,7 @@ module github.com/simulot/immich-go
 go 1.21
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/google/uuid v1.3.1
 	github.com/joho/godotenv v1.5.1
 	github.com/kr/pretty v0.3.1
@@ -21,5 +22,5 @@ require (
 	github.com/pkg/sftp v1.13.6 // indirect
 	github.com/rogpeppe/go-internal v1.9.0 // indirect
 	golang.org/x/crypto v0.13.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
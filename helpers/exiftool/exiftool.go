@@ -0,0 +1,171 @@
+// Package exiftool reads the metadata of the files with the exiftool command of Phil Harvey,
+// that knows the quirks of many more cameras and RAW formats than the Go readers.
+package exiftool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+// DefaultBatchSize is the number of files read by one run of exiftool
+const DefaultBatchSize = 200
+
+// Tool runs exiftool on batches of files
+type Tool struct {
+	path  string // exiftool executable
+	batch int    // files given to each run
+}
+
+// Info is the metadata read by exiftool. The missing values stay at zero.
+type Info struct {
+	DateTaken                     time.Time
+	Latitude, Longitude, Altitude float64
+	Width, Height                 int
+}
+
+// New checks that the exiftool executable can be found, name being a path or a command of the PATH
+func New(name string) (*Tool, error) {
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("can't find exiftool: %w", err)
+	}
+	return &Tool{path: p, batch: DefaultBatchSize}, nil
+}
+
+// SetBatchSize sets the number of files given to each run of exiftool
+func (t *Tool) SetBatchSize(n int) *Tool {
+	if n > 0 {
+		t.batch = n
+	}
+	return t
+}
+
+// Read gives the metadata of the files, by file name. The files are paths of the local disk.
+// exiftool is started once for each batch of files, the names being given on its standard input.
+// The files unknown to exiftool are missing from the result.
+func (t *Tool) Read(ctx context.Context, files []string) (map[string]Info, error) {
+	infos := map[string]Info{}
+	for start := 0; start < len(files); start += t.batch {
+		end := min(start+t.batch, len(files))
+		err := t.readBatch(ctx, files[start:end], infos)
+		if err != nil {
+			return infos, err
+		}
+	}
+	return infos, nil
+}
+
+// entry is the JSON given by exiftool for a file, the numerical values being given by -n
+type entry struct {
+	SourceFile         string
+	DateTimeOriginal   any
+	CreateDate         any
+	OffsetTimeOriginal any
+	SubSecTimeOriginal any
+	GPSLatitude        any
+	GPSLongitude       any
+	GPSAltitude        any
+	ImageWidth         any
+	ImageHeight        any
+}
+
+var tags = []string{"-DateTimeOriginal", "-CreateDate", "-OffsetTimeOriginal", "-SubSecTimeOriginal", "-GPSLatitude", "-GPSLongitude", "-GPSAltitude", "-ImageWidth", "-ImageHeight"}
+
+func (t *Tool) readBatch(ctx context.Context, files []string, infos map[string]Info) error {
+	args := append([]string{"-json", "-n", "-q", "-q", "-charset", "filename=utf8", "-api", "largefilesupport=1"}, tags...)
+	cmd := exec.CommandContext(ctx, t.path, append(args, "-@", "-")...)
+	// each line of the standard input is an argument, the names starting with a dash would be options
+	names := map[string]string{}
+	in := strings.Builder{}
+	for _, f := range files {
+		arg := f
+		if strings.HasPrefix(arg, "-") {
+			arg = "." + string(filepath.Separator) + arg
+		}
+		names[arg], names[filepath.ToSlash(arg)] = f, f
+		in.WriteString(arg + "\n")
+	}
+	cmd.Stdin = strings.NewReader(in.String())
+	stderr := bytes.NewBuffer(nil)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		// exiftool exits with an error when some files can't be read, the others are given anyway
+		return fmt.Errorf("exiftool: %w %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var entries []entry
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return fmt.Errorf("can't decode the answer of exiftool: %w", err)
+	}
+	local, err := tzone.Local()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if f, ok := names[e.SourceFile]; ok {
+			infos[f] = e.info(local)
+		}
+	}
+	return nil
+}
+
+func (e entry) info(local *time.Location) Info {
+	i := Info{
+		Latitude:  number(e.GPSLatitude),
+		Longitude: number(e.GPSLongitude),
+		Altitude:  number(e.GPSAltitude),
+		Width:     int(number(e.ImageWidth)),
+		Height:    int(number(e.ImageHeight)),
+	}
+	loc := local
+	if off := text(e.OffsetTimeOriginal); off != "" {
+		if t, err := time.Parse("-07:00", off); err == nil {
+			loc = t.Location()
+		}
+	}
+	for _, d := range []any{e.DateTimeOriginal, e.CreateDate} {
+		t, err := time.ParseInLocation("2006:01:02 15:04:05", text(d), loc)
+		if err == nil && t.Year() > 1 {
+			i.DateTaken = t
+			break
+		}
+	}
+	if sub := text(e.SubSecTimeOriginal); !i.DateTaken.IsZero() && sub != "" && len(sub) <= 9 {
+		if ns, err := strconv.Atoi(sub + strings.Repeat("0", 9-len(sub))); err == nil && ns >= 0 {
+			i.DateTaken = i.DateTaken.Add(time.Duration(ns))
+		}
+	}
+	return i
+}
+
+// text gives the value of a tag as a string, exiftool giving numbers for the values looking like numbers
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// number gives the numerical value of a tag, 0 when missing or invalid
+func number(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package exiftool_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/exiftool"
+	"github.com/simulot/immich-go/helpers/exiftool/fake"
+)
+
+func TestMain(m *testing.M) {
+	fake.Run()
+	os.Exit(m.Run())
+}
+
+func TestRead(t *testing.T) {
+	exe, runs := fake.Path(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"IMG_0001.jpg":   `{"DateTimeOriginal":"2023:10:06 08:31:21","OffsetTimeOriginal":"+02:00","SubSecTimeOriginal":"035","GPSLatitude":48.8584,"GPSLongitude":2.2945,"GPSAltitude":35,"ImageWidth":4000,"ImageHeight":3000}`,
+		"-dash.CR3":      `{"DateTimeOriginal":"0000:00:00 00:00:00","CreateDate":"2021:04:30 18:45:12","OffsetTimeOriginal":"-07:00","GPSLatitude":-33.8568,"GPSLongitude":151.2153}`,
+		"unreadable.jpg": "not a photo",
+	}
+	names := []string{}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, p)
+	}
+	// relative names starting with a dash aren't taken as options
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	names = append(names, "-dash.CR3")
+
+	tool, err := exiftool.New(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := tool.SetBatchSize(2).Read(context.Background(), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.Runs(t, runs); n != 2 {
+		t.Errorf("expected 2 runs of exiftool for 4 files by batches of 2, got %d", n)
+	}
+
+	expected := exiftool.Info{
+		DateTaken: time.Date(2023, 10, 6, 8, 31, 21, 35_000_000, time.FixedZone("", 2*3600)),
+		Latitude:  48.8584, Longitude: 2.2945, Altitude: 35,
+		Width: 4000, Height: 3000,
+	}
+	if got := infos[filepath.Join(dir, "IMG_0001.jpg")]; !got.DateTaken.Equal(expected.DateTaken) || got.Latitude != expected.Latitude || got.Longitude != expected.Longitude || got.Altitude != expected.Altitude || got.Width != expected.Width || got.Height != expected.Height {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	// the invalid date of capture is replaced by the date of creation
+	date := time.Date(2021, 4, 30, 18, 45, 12, 0, time.FixedZone("", -7*3600))
+	for _, name := range []string{filepath.Join(dir, "-dash.CR3"), "-dash.CR3"} {
+		if got := infos[name]; !got.DateTaken.Equal(date) || got.Latitude != -33.8568 {
+			t.Errorf("%s: expected the date %s, got %+v", name, date, got)
+		}
+	}
+	if _, ok := infos[filepath.Join(dir, "unreadable.jpg")]; ok {
+		t.Errorf("the file unknown to exiftool should be missing")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	_, err := exiftool.New(filepath.Join(t.TempDir(), "exiftool"))
+	if err == nil {
+		t.Error("an error is expected when exiftool is missing")
+	}
+}
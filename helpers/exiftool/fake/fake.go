@@ -0,0 +1,72 @@
+/*
+Package fake is a test double of exiftool: the test binary runs itself as exiftool.
+
+Call Run at the beginning of TestMain, and give Path to exiftool.New. The fake reads the names of the
+files on its standard input, as given by -@ -, and answers the content of each file as the JSON of its tags.
+The files that aren't JSON objects are ignored, as exiftool does for the files it can't read.
+Each run appends a line to the file given to Path, to count the runs.
+*/
+package fake
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+const envRuns = "IMMICH_GO_FAKE_EXIFTOOL"
+
+// Run acts as exiftool and exits when the test binary is started by the Tool, it returns otherwise
+func Run() {
+	runs := os.Getenv(envRuns)
+	if runs == "" {
+		return
+	}
+	if f, err := os.OpenFile(runs, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600); err == nil {
+		fmt.Fprintln(f, strings.Join(os.Args[1:], " "))
+		f.Close()
+	}
+	entries := []map[string]any{}
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		name := s.Text()
+		b, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		e := map[string]any{}
+		if json.Unmarshal(b, &e) != nil {
+			continue
+		}
+		e["SourceFile"] = name
+		entries = append(entries, e)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(entries)
+	os.Exit(0)
+}
+
+// Path gives the executable to use as exiftool during the test, and the file counting its runs
+func Path(t *testing.T) (exe string, runs string) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs = t.TempDir() + string(os.PathSeparator) + "runs"
+	t.Setenv(envRuns, runs)
+	return exe, runs
+}
+
+// Runs gives the number of runs of the fake exiftool
+func Runs(t *testing.T, runs string) int {
+	b, err := os.ReadFile(runs)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(b), "\n")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/simulot/immich-go/helpers/gen"
 )
@@ -16,6 +17,7 @@ var supportedExtensionsAndMime = map[string][]string{
 	".ari":  {"image/ari", "image/x-arriflex-ari"},
 	".arw":  {"image/arw", "image/x-sony-arw"},
 	".avif": {"image/avif"},
+	".bmp":  {"image/bmp"},
 	".cap":  {"image/cap", "image/x-phaseone-cap"},
 	".cin":  {"image/cin", "image/x-phantom-cin"},
 	".cr2":  {"image/cr2", "image/x-canon-cr2"},
@@ -28,11 +30,13 @@ var supportedExtensionsAndMime = map[string][]string{
 	".gif":  {"image/gif"},
 	".heic": {"image/heic"},
 	".heif": {"image/heif"},
+	".hif":  {"image/heif"},
 	".iiq":  {"image/iiq", "image/x-phaseone-iiq"},
 	".insp": {"image/jpeg"},
 	".jpeg": {"image/jpeg"},
 	".jpg":  {"image/jpeg"},
 	".jpe":  {"image/jpeg"},
+	".jp2":  {"image/jp2"},
 	".jxl":  {"image/jxl"},
 	".k25":  {"image/k25", "image/x-kodak-k25"},
 	".kdc":  {"image/kdc", "image/x-kodak-kdc"},
@@ -45,17 +49,19 @@ var supportedExtensionsAndMime = map[string][]string{
 	".psd":  {"image/psd", "image/vnd.adobe.photoshop"},
 	".raf":  {"image/raf", "image/x-fuji-raf"},
 	".raw":  {"image/raw", "image/x-panasonic-raw"},
-	".rw2":  {"image/rw2', 'image/x-panasonic-rw2"},
+	".rw2":  {"image/rw2", "image/x-panasonic-rw2"},
 	".rwl":  {"image/rwl", "image/x-leica-rwl"},
 	".sr2":  {"image/sr2", "image/x-sony-sr2"},
 	".srf":  {"image/srf", "image/x-sony-srf"},
 	".srw":  {"image/srw", "image/x-samsung-srw"},
+	".svg":  {"image/svg+xml"},
 	".tif":  {"image/tiff"},
 	".tiff": {"image/tiff"},
 	".webp": {"image/webp"},
 	".x3f":  {"image/x3f", "image/x-sigma-x3f"},
 
 	".3gp":  {"video/3gpp"},
+	".3gpp": {"video/3gpp"},
 	".avi":  {"video/avi", "video/msvideo", "video/vnd.avi", "video/x-msvideo"},
 	".flv":  {"video/x-flv"},
 	".insv": {"video/mp4"},
@@ -64,28 +70,66 @@ var supportedExtensionsAndMime = map[string][]string{
 	".mkv":  {"video/x-matroska"},
 	".mov":  {"video/quicktime"},
 	".mp4":  {"video/mp4"},
+	".mpe":  {"video/mpeg"},
+	".mpeg": {"video/mpeg"},
 	".mpg":  {"video/mpeg"},
 	".mts":  {"video/mp2t"},
+	".vob":  {"video/mpeg"},
 	".webm": {"video/webm"},
 	".wmv":  {"video/x-ms-wmv"},
 }
 
-var supportedExtensions = gen.MapKeys(supportedExtensionsAndMime)
+var (
+	supportedExtensions = gen.MapKeys(supportedExtensionsAndMime)
+	extensionsMut       sync.RWMutex
+)
 
 // MimeFromExt return the mime type of the extension. Return an error is the extension is not handled by the server.
 func MimeFromExt(ext string) ([]string, error) {
 	ext = strings.ToLower(ext)
+	extensionsMut.RLock()
+	defer extensionsMut.RUnlock()
 	if l, ok := supportedExtensionsAndMime[ext]; ok {
 		return l, nil
 	}
 	return nil, fmt.Errorf("unsupported extension %s", ext)
 }
 
+// IsKnownExt reports whether the extension is in the list of formats supported by the server
+func IsKnownExt(ext string) bool {
+	_, err := MimeFromExt(ext)
+	return err == nil
+}
+
+// SupportedExtensions gives the sorted list of the extensions accepted
+func SupportedExtensions() []string {
+	extensionsMut.RLock()
+	defer extensionsMut.RUnlock()
+	l := slices.Clone(supportedExtensions)
+	slices.Sort(l)
+	return l
+}
+
+// AddExtension accepts the files having an extension unknown to immich-go.
+// The files are sent as application/octet-stream, and the server decides whether it can store them.
+func AddExtension(ext string) {
+	ext = strings.ToLower(ext)
+	extensionsMut.Lock()
+	defer extensionsMut.Unlock()
+	if _, ok := supportedExtensionsAndMime[ext]; ok {
+		return
+	}
+	supportedExtensionsAndMime[ext] = []string{"application/octet-stream"}
+	supportedExtensions = append(supportedExtensions, ext)
+}
+
 // IsExtensionPrefix
 // Check if the string is first part of an known extension as needed for Google Takeout
 
 func IsExtensionPrefix(ext string) bool {
 	ext = strings.ToLower(ext)
+	extensionsMut.RLock()
+	defer extensionsMut.RUnlock()
 	for _, e := range supportedExtensions {
 		if ext == e[:len(e)-1] {
 			return true
@@ -0,0 +1,48 @@
+package fshelper
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSupportedExtensions(t *testing.T) {
+	images := []string{
+		".3fr", ".ari", ".arw", ".avif", ".bmp", ".cap", ".cin", ".cr2", ".cr3", ".crw", ".dcr", ".dng", ".erf", ".fff",
+		".gif", ".heic", ".heif", ".hif", ".iiq", ".insp", ".jp2", ".jpe", ".jpeg", ".jpg", ".jxl", ".k25", ".kdc", ".mrw",
+		".nef", ".orf", ".ori", ".pef", ".png", ".psd", ".raf", ".raw", ".rw2", ".rwl", ".sr2", ".srf", ".srw", ".svg",
+		".tif", ".tiff", ".webp", ".x3f",
+	}
+	videos := []string{
+		".3gp", ".3gpp", ".avi", ".flv", ".insv", ".m2ts", ".m4v", ".mkv", ".mov", ".mp4", ".mpe", ".mpeg", ".mpg", ".mts",
+		".vob", ".webm", ".wmv",
+	}
+	for kind, l := range map[string][]string{"image": images, "video": videos} {
+		for _, e := range l {
+			m, err := MimeFromExt(strings.ToUpper(e))
+			if err != nil {
+				t.Errorf("%s: %s", e, err)
+				continue
+			}
+			for _, mt := range m {
+				if !strings.HasPrefix(mt, kind+"/") || strings.ContainsAny(mt, "' ,") {
+					t.Errorf("%s: unexpected mime type %q", e, mt)
+				}
+			}
+		}
+	}
+
+	expected := append(slices.Clone(images), videos...)
+	slices.Sort(expected)
+	if got := SupportedExtensions(); !slices.Equal(got, expected) {
+		t.Errorf("unexpected list of extensions\nexpected %v\ngot      %v", expected, got)
+	}
+
+	if _, err := MimeFromExt(".foo"); err == nil {
+		t.Error(".foo should be unknown")
+	}
+	AddExtension(".FOO")
+	if m, err := MimeFromExt(".foo"); err != nil || m[0] != "application/octet-stream" {
+		t.Errorf("the added extension should be accepted, got %v, %v", m, err)
+	}
+}
@@ -0,0 +1,116 @@
+package fshelper
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathPatterns is a list of glob patterns matched against slash separated relative paths.
+// It implements the flag.Value interface, and the flag can be repeated.
+//
+// The syntax is the one of path.Match, plus:
+//   - ** matches any number of folders, ex: **/@eaDir or photos/**/thumbs
+//   - a pattern without / matches a file or a folder at any depth, ex: Trash is the same as **/Trash
+type PathPatterns []string
+
+func (p *PathPatterns) Set(s string) error {
+	pattern := strings.Trim(path.Clean(strings.ReplaceAll(s, "\\", "/")), "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", s, err)
+		}
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+func (p PathPatterns) String() string {
+	return strings.Join(p, ", ")
+}
+
+// Match reports whether the name matches one of the patterns
+func (p PathPatterns) Match(name string) bool {
+	segs := strings.Split(strings.Trim(name, "/"), "/")
+	for _, pattern := range p {
+		if matchSegments(strings.Split(pattern, "/"), segs) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// ** matches zero or more folders
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ExpandGlob gives the files and folders matching the pattern of a command line argument.
+// The syntax is the one of filepath.Glob, plus ** matching any number of folders, ex: /photos/**/2023-*.
+// A trailing separator is ignored. The content of a matching folder isn't searched, the folder being browsed as a whole.
+func ExpandGlob(pattern string) ([]string, error) {
+	pattern = filepath.Clean(pattern)
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(segs) && !HasMagic(segs[i]) {
+		i++
+	}
+	root := strings.Join(segs[:i], "/")
+	switch {
+	case i == 1 && segs[0] == "":
+		root = "/"
+	case root == "":
+		root = "."
+	}
+	rest := segs[i:]
+	for _, seg := range rest {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+	root = filepath.FromSlash(root)
+	matches := []string{}
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// as filepath.Glob, the unreadable folders are ignored
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if matchSegments(rest, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, name)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
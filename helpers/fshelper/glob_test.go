@@ -0,0 +1,115 @@
+package fshelper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPathPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "**/@eaDir", name: "@eaDir", want: true},
+		{pattern: "**/@eaDir", name: "photos/2023/@eaDir", want: true},
+		{pattern: "**/@eaDir", name: "photos/2023/@eaDir2", want: false},
+		{pattern: "@eaDir", name: "photos/@eaDir", want: true},
+		{pattern: ".thumbnails", name: "a/b/.thumbnails", want: true},
+		{pattern: "Trash", name: "Trash", want: true},
+		{pattern: "Trash", name: "Trash/photo.jpg", want: false},
+		{pattern: "*.tmp", name: "photos/file.tmp", want: true},
+		{pattern: "photos/**/thumbs", name: "photos/thumbs", want: true},
+		{pattern: "photos/**/thumbs", name: "photos/2023/08/thumbs", want: true},
+		{pattern: "photos/**/thumbs", name: "other/thumbs", want: false},
+		{pattern: "photos/*/raw", name: "photos/2023/raw", want: true},
+		{pattern: "photos/*/raw", name: "photos/2023/08/raw", want: false},
+		{pattern: "/photos/private/", name: "photos/private", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			var p PathPatterns
+			if err := p.Set(tt.pattern); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Match(tt.name); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var p PathPatterns
+	if err := p.Set("photos/[a-"); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestExpandGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "TESTDATA/*/T/*.jpg", want: []string{"TESTDATA/A/T/10.jpg", "TESTDATA/B/T/20.jpg"}},
+		{pattern: "TESTDATA/*/", want: []string{"TESTDATA/A", "TESTDATA/B"}},
+		{pattern: "TESTDATA/**/*.json", want: []string{"TESTDATA/A/1.json", "TESTDATA/A/2.json", "TESTDATA/A/T/10.json", "TESTDATA/B/4.json", "TESTDATA/B/T/20.json"}},
+		{pattern: "TESTDATA/**/T/", want: []string{"TESTDATA/A/T", "TESTDATA/B/T"}},
+		{pattern: "TESTDATA/**", want: []string{"TESTDATA/A", "TESTDATA/B"}},
+		{pattern: "TESTDATA/**/*.png", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := ExpandGlob(filepath.FromSlash(tt.pattern))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandGlob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ExpandGlob("TESTDATA/**/[a-"); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestParsePathGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"IMG[1].jpg", "2023-01/a.jpg", "2023-02/b.jpg", "2024-01/c.jpg"} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsyss, err := ParsePath([]string{filepath.Join(dir, "2023-*") + string(filepath.Separator)}, false)
+	if err != nil || len(fsyss) != 2 {
+		t.Errorf("expected the 2 folders of 2023, got %d, %v", len(fsyss), err)
+	}
+	fsyss, err = ParsePath([]string{filepath.Join(dir, "**", "*.jpg")}, false)
+	if err != nil || len(fsyss) != 4 {
+		t.Errorf("expected the 4 folders having photos, got %d, %v", len(fsyss), err)
+	}
+
+	// the name containing a wildcard character is found as is
+	fsyss, err = ParsePath([]string{filepath.Join(dir, "IMG[1].jpg")}, false)
+	if err != nil || len(fsyss) != 1 {
+		t.Errorf("expected the file IMG[1].jpg, got %d, %v", len(fsyss), err)
+	}
+
+	_, err = ParsePath([]string{filepath.Join(dir, "2022-*")}, false)
+	if err == nil {
+		t.Errorf("expected an error when nothing matches")
+	}
+}
@@ -1,21 +1,51 @@
 package fshelper
 
 import (
-	"archive/zip"
+	"errors"
+	"io"
 	"io/fs"
 
 	"github.com/yalue/merged_fs"
 )
 
-func multiZip(names ...string) (fs.FS, error) {
+// archivesFS merges the content of several archives.
+// Close releases the archives.
+type archivesFS struct {
+	fs.FS
+	closers []io.Closer
+}
+
+func (a *archivesFS) Close() error {
+	var err error
+	for _, c := range a.closers {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// multiArchive merges the archives, the encrypted zip archives being decrypted with the password
+func multiArchive(zips []string, tars []string, password string) (fs.FS, error) {
 	fss := []fs.FS{}
+	a := archivesFS{}
 
-	for _, p := range names {
-		fsys, err := zip.OpenReader(p)
+	for _, p := range zips {
+		fsys, closer, err := openZip(p, password)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		fss = append(fss, fsys)
+		a.closers = append(a.closers, closer)
+	}
+	for _, p := range tars {
+		fsys, err := openTar(p)
 		if err != nil {
+			a.Close()
 			return nil, err
 		}
 		fss = append(fss, fsys)
+		a.closers = append(a.closers, fsys)
 	}
-	return merged_fs.MergeMultiple(fss...), nil
+	a.FS = merged_fs.MergeMultiple(fss...)
+	return &a, nil
 }
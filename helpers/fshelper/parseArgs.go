@@ -17,11 +17,29 @@ type argParser struct {
 	files        []string
 	paths        map[string][]string
 	zips         []string
+	tars         []string
+	s3           []string
 	unsupported  map[string]any
 	err          error
 }
 
 func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
+	return ParsePathWithOptions(args, googlePhoto, PathOptions{})
+}
+
+// ParsePathWithS3 is ParsePath accepting also s3://bucket/prefix arguments, read with the given options
+func ParsePathWithS3(args []string, googlePhoto bool, s3 S3Options) ([]fs.FS, error) {
+	return ParsePathWithOptions(args, googlePhoto, PathOptions{S3: s3})
+}
+
+// PathOptions are the options of the sources read by ParsePathWithOptions
+type PathOptions struct {
+	S3              S3Options // Access to the s3:// sources
+	ArchivePassword string    // Password of the encrypted zip archives
+}
+
+// ParsePathWithOptions is ParsePath accepting also s3://bucket/prefix arguments and encrypted zip archives
+func ParsePathWithOptions(args []string, googlePhoto bool, opts PathOptions) ([]fs.FS, error) {
 	p := argParser{
 		googlePhotos: googlePhoto,
 		unsupported:  map[string]any{},
@@ -29,11 +47,16 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 	}
 
 	for _, f := range args {
-		if !HasMagic(f) {
+		if isS3URL(f) {
+			p.s3 = append(p.s3, f)
+			continue
+		}
+		if !HasMagic(f) || exists(f) {
+			// a file named with a wildcard character is taken literally
 			p.handleFile(f)
 			continue
 		} else {
-			globs, err := filepath.Glob(f)
+			globs, err := ExpandGlob(f)
 			if err != nil {
 				p.err = errors.Join(err)
 				continue
@@ -44,7 +67,7 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 			}
 
 			for _, g := range globs {
-				if p.googlePhotos && strings.ToLower(path.Ext(g)) != ".zip" {
+				if p.googlePhotos && strings.ToLower(path.Ext(g)) != ".zip" && !isTarName(g) {
 					return nil, fmt.Errorf("wildcard '%s' not allowed with the google-photos options", filepath.Base(f))
 				}
 				p.handleFile(g)
@@ -70,12 +93,25 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 				fsys = append(fsys, f)
 			}
 		} else {
-			fsys = append(fsys, os.DirFS(pa))
+			f, err := newPathFS(pa, nil)
+			if err != nil {
+				p.err = errors.Join(err)
+			} else {
+				fsys = append(fsys, f)
+			}
 		}
 	}
 
-	if len(p.zips) > 0 {
-		f, err := multiZip(p.zips...)
+	if len(p.zips) > 0 || len(p.tars) > 0 {
+		f, err := multiArchive(p.zips, p.tars, opts.ArchivePassword)
+		if err != nil {
+			p.err = errors.Join(err)
+		} else {
+			fsys = append(fsys, f)
+		}
+	}
+	for _, u := range p.s3 {
+		f, err := openS3(u, opts.S3)
 		if err != nil {
 			p.err = errors.Join(err)
 		} else {
@@ -91,6 +127,11 @@ func ParsePath(args []string, googlePhoto bool) ([]fs.FS, error) {
 	return fsys, p.err
 }
 
+func exists(f string) bool {
+	_, err := os.Stat(f)
+	return err == nil
+}
+
 func (p *argParser) handleFile(f string) {
 	i, err := os.Stat(f)
 	if err != nil {
@@ -108,8 +149,8 @@ func (p *argParser) handleFile(f string) {
 		p.zips = append(p.zips, f)
 		return
 	}
-	if ext == ".tgz" {
-		p.unsupported[ext] = nil
+	if isTarName(f) {
+		p.tars = append(p.tars, f)
 		return
 	}
 	if p.googlePhotos {
@@ -45,6 +45,10 @@ func (fsys pathFS) Open(name string) (fs.File, error) {
 	return os.Open(filepath.Join(fsys.dir, name))
 }
 
+func (fsys pathFS) OSPath(name string) string {
+	return filepath.Join(fsys.dir, name)
+}
+
 func (fsys pathFS) Stat(name string) (fs.FileInfo, error) {
 	if name == "." {
 		return os.Stat(fsys.dir)
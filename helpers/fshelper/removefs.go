@@ -22,6 +22,19 @@ func Remove(fsys fs.FS, name string) error {
 	return nil
 }
 
+// OSPather is implemented by the file systems reading a folder of the local disk
+type OSPather interface {
+	OSPath(name string) string
+}
+
+// OSPath gives the path on the local disk of the file of fsys, or "" when the file system isn't a local folder
+func OSPath(fsys fs.FS, name string) string {
+	if fsys, ok := fsys.(OSPather); ok {
+		return fsys.OSPath(name)
+	}
+	return ""
+}
+
 type dirRemoveFS struct {
 	dir string
 	fs.FS
@@ -40,6 +53,10 @@ func (fsys dirRemoveFS) Remove(name string) error {
 	return os.Remove(filepath.Join(fsys.dir, name))
 }
 
+func (fsys dirRemoveFS) OSPath(name string) string {
+	return filepath.Join(fsys.dir, name)
+}
+
 func (fsys dirRemoveFS) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(filepath.Join(fsys.dir, name))
 }
@@ -0,0 +1,418 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options gives the access to the S3 buckets.
+// The empty fields are read from the usual AWS environment variables.
+type S3Options struct {
+	Endpoint     string // URL of an S3 compatible service like http://minio:9000, AWS when empty
+	Region       string // Region of the bucket (Default: us-east-1)
+	AccessKey    string // Access key, the bucket is read anonymously when empty
+	SecretKey    string
+	SessionToken string
+}
+
+// withEnv completes the options with the AWS environment variables
+func (o S3Options) withEnv() S3Options {
+	env := func(v *string, names ...string) {
+		for _, n := range names {
+			if *v != "" {
+				return
+			}
+			*v = os.Getenv(n)
+		}
+	}
+	env(&o.Endpoint, "AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL")
+	env(&o.Region, "AWS_REGION", "AWS_DEFAULT_REGION")
+	env(&o.AccessKey, "AWS_ACCESS_KEY_ID")
+	env(&o.SecretKey, "AWS_SECRET_ACCESS_KEY")
+	env(&o.SessionToken, "AWS_SESSION_TOKEN")
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+	return o
+}
+
+// isS3URL reports whether the argument is an s3://bucket/prefix URL
+func isS3URL(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "s3://")
+}
+
+// s3FS exposes the objects of a bucket as a fs.FS.
+//
+// S3 has no directories, only keys. All the keys under the prefix are listed
+// when the FS is opened, and the directories are deduced from the '/' in the keys.
+// Files are downloaded when they are read.
+type s3FS struct {
+	name    string // s3://bucket/prefix
+	opt     S3Options
+	client  *http.Client
+	base    *url.URL // URL of the bucket
+	prefix  string   // prefix of the keys, ending with a '/' when not empty
+	entries map[string]*s3Entry
+}
+
+type s3Entry struct {
+	name     string
+	key      string
+	info     fs.FileInfo
+	children []string // for directories
+}
+
+// openS3 lists the objects of the bucket given by the s3://bucket/prefix URL
+func openS3(name string, opt S3Options) (*s3FS, error) {
+	u, err := url.Parse(name)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 URL '%s', expecting s3://bucket/prefix", name)
+	}
+	opt = opt.withEnv()
+	t := s3FS{
+		name:    name,
+		opt:     opt,
+		client:  &http.Client{},
+		prefix:  strings.Trim(u.Path, "/"),
+		entries: map[string]*s3Entry{},
+	}
+	if t.prefix != "" {
+		t.prefix += "/"
+	}
+
+	if opt.Endpoint == "" {
+		// virtual-hosted style
+		t.base = &url.URL{Scheme: "https", Host: u.Host + ".s3." + opt.Region + ".amazonaws.com", Path: "/"}
+	} else {
+		// path style, understood by the S3 compatible services
+		t.base, err = url.Parse(strings.TrimSuffix(opt.Endpoint, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint '%s': %w", opt.Endpoint, err)
+		}
+		t.base.Path += "/" + u.Host + "/"
+	}
+
+	err = t.scan()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &t, nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+}
+
+// scan lists the keys of the bucket, page by page
+func (t *s3FS) scan() error {
+	t.entries["."] = &s3Entry{name: ".", info: dirInfo(".", time.Time{})}
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {t.prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := t.get(t.base.Path, q)
+		if err != nil {
+			return err
+		}
+		var r listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&r)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range r.Contents {
+			name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(c.Key, t.prefix)), "/")
+			if name == "" || !fs.ValidPath(name) {
+				continue
+			}
+			if strings.HasSuffix(c.Key, "/") {
+				// folder marker created by the consoles
+				t.addEntry(&s3Entry{name: name, info: dirInfo(name, c.LastModified)})
+				continue
+			}
+			h := tar.Header{Typeflag: tar.TypeReg, Name: name, Size: c.Size, Mode: 0o644, ModTime: c.LastModified}
+			t.addEntry(&s3Entry{name: name, key: c.Key, info: h.FileInfo()})
+		}
+		if !r.IsTruncated || r.NextContinuationToken == "" {
+			break
+		}
+		token = r.NextContinuationToken
+	}
+
+	if len(t.entries) == 1 {
+		return fs.ErrNotExist
+	}
+	for _, e := range t.entries {
+		sort.Strings(e.children)
+	}
+	return nil
+}
+
+// addEntry records the entry and creates missing parent directories
+func (t *s3FS) addEntry(e *s3Entry) {
+	if old, ok := t.entries[e.name]; ok {
+		old.info, old.key = e.info, e.key
+		return
+	}
+	t.entries[e.name] = e
+	for {
+		dir := path.Dir(e.name)
+		p, ok := t.entries[dir]
+		if !ok {
+			p = &s3Entry{name: dir, info: dirInfo(dir, e.info.ModTime())}
+			t.entries[dir] = p
+		}
+		p.children = append(p.children, e.name)
+		if ok {
+			return
+		}
+		e = p
+	}
+}
+
+// get sends a signed GET request for the path of the server
+func (t *s3FS) get(p string, q url.Values) (*http.Response, error) {
+	u := *t.base
+	u.Path = p
+	u.RawPath = s3Escape(p, false)
+	u.RawQuery = canonicalQuery(q)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	t.opt.sign(req, time.Now())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var e struct {
+			Code    string
+			Message string
+		}
+		_ = xml.NewDecoder(resp.Body).Decode(&e)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fs.ErrNotExist
+		}
+		if e.Code != "" {
+			return nil, fmt.Errorf("S3 error %s: %s", e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("S3 error: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func (t *s3FS) Open(name string) (fs.File, error) {
+	e, err := t.entry("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.info.IsDir() {
+		return &s3Dir{fsys: t, entry: e}, nil
+	}
+	return &s3File{fsys: t, entry: e}, nil
+}
+
+func (t *s3FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := t.entry("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e.info, nil
+}
+
+func (t *s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := t.entry("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	d := s3Dir{fsys: t, entry: e}
+	return d.ReadDir(-1)
+}
+
+func (t *s3FS) entry(op string, name string) (*s3Entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (t *s3FS) String() string { return t.name }
+
+// s3File downloads the object at the first read
+type s3File struct {
+	fsys  *s3FS
+	entry *s3Entry
+	body  io.ReadCloser
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) { return f.entry.info, nil }
+
+func (f *s3File) Read(b []byte) (int, error) {
+	if f.body == nil {
+		resp, err := f.fsys.get(f.fsys.base.Path+f.entry.key, nil)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: err}
+		}
+		f.body = resp.Body
+	}
+	return f.body.Read(b)
+}
+
+func (f *s3File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+type s3Dir struct {
+	fsys  *s3FS
+	entry *s3Entry
+	pos   int
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) { return d.entry.info, nil }
+func (d *s3Dir) Close() error               { return nil }
+
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	left := len(d.entry.children) - d.pos
+	if n > 0 && left == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < left {
+		left = n
+	}
+	r := make([]fs.DirEntry, left)
+	for i := range r {
+		r[i] = fs.FileInfoToDirEntry(d.fsys.entries[d.entry.children[d.pos+i]].info)
+	}
+	d.pos += left
+	return r, nil
+}
+
+// emptySHA256 is the hash of an empty payload
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds the AWS signature version 4 to the request.
+// The request is sent anonymously when there isn't any access key.
+func (o S3Options) sign(req *http.Request, now time.Time) {
+	if o.AccessKey == "" {
+		return
+	}
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptySHA256)
+	if o.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", o.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	canonicalHeaders := strings.Builder{}
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := day + "/" + o.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + o.SecretKey)
+	for _, s := range []string{day, o.Region, "s3", "aws4_request", stringToSign} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+o.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+hex.EncodeToString(key))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// canonicalQuery gives the query string sorted and encoded as expected by the signature
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	l := []string{}
+	for _, k := range keys {
+		for _, v := range q[k] {
+			l = append(l, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(l, "&")
+}
+
+// s3Escape encodes all characters but the unreserved ones, and the '/' when it isn't a query
+func s3Escape(s string, query bool) string {
+	b := strings.Builder{}
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !query:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
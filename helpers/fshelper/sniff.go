@@ -0,0 +1,177 @@
+package fshelper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// SniffLen is the number of bytes read at the beginning of a file to recognize its format
+const SniffLen = 512
+
+// contentFormat is a format recognized by the first bytes of the files.
+// exts are the extensions of the files having that format, the first one being the usual one.
+type contentFormat struct {
+	exts  []string
+	match func(head []byte) bool
+}
+
+// isoVideoExts are the extensions of the videos of the ISO base media file format.
+// Cameras and phones use them for the same content, the server accepts any of them.
+var isoVideoExts = []string{".mp4", ".m4v", ".mov", ".3gp", ".3gpp", ".insv"}
+
+// tiffExts are the extensions of the TIFF files, and of the RAW formats built on TIFF
+var tiffExts = []string{".tif", ".tiff", ".dng", ".nef", ".cr2", ".arw", ".sr2", ".srf", ".pef", ".3fr", ".fff", ".erf", ".kdc", ".dcr", ".k25", ".iiq", ".srw", ".rwl"}
+
+// contentFormats are checked in order, the weakest signatures being the last ones
+var contentFormats = []contentFormat{
+	{[]string{".jpg", ".jpeg", ".jpe", ".insp"}, prefix("\xff\xd8\xff")},
+	{[]string{".png"}, prefix("\x89PNG\r\n\x1a\n")},
+	{[]string{".gif"}, prefix("GIF87a", "GIF89a")},
+	{[]string{".webp"}, riff("WEBP")},
+	{[]string{".avi"}, riff("AVI ")},
+	{[]string{".heic", ".heif", ".hif"}, ftyp("heic", "heix", "hevc", "hevx", "heim", "heis", "hevm", "hevs", "mif1", "msf1")},
+	{[]string{".avif"}, ftyp("avif", "avis")},
+	{[]string{".cr3"}, ftyp("crx ")},
+	{append([]string{".mov"}, isoVideoExts...), ftyp("qt  ")},
+	{append([]string{".3gp"}, isoVideoExts...), ftyp("3gp4", "3gp5", "3gp6", "3gp7", "3gg6", "3g2a")},
+	{isoVideoExts, isoVideo},
+	{[]string{".jxl"}, prefix("\xff\x0a", "\x00\x00\x00\x0cJXL \r\n\x87\n")},
+	{[]string{".jp2"}, prefix("\x00\x00\x00\x0cjP  \r\n\x87\n")},
+	{[]string{".raf"}, prefix("FUJIFILMCCD-RAW")},
+	{[]string{".crw"}, func(head []byte) bool { return len(head) >= 14 && string(head[6:14]) == "HEAPCCDR" }},
+	{[]string{".orf", ".ori"}, prefix("IIRO", "IIRS", "MMOR")},
+	{[]string{".rw2", ".raw", ".rwl"}, prefix("IIU\x00")},
+	{[]string{".mrw"}, prefix("\x00MRM")},
+	{[]string{".x3f"}, prefix("FOVb")},
+	{[]string{".psd"}, prefix("8BPS")},
+	{tiffExts, prefix("II*\x00", "MM\x00*")},
+	{[]string{".mkv", ".webm"}, prefix("\x1a\x45\xdf\xa3")},
+	{[]string{".wmv"}, prefix("\x30\x26\xb2\x75\x8e\x66\xcf\x11")},
+	{[]string{".flv"}, prefix("FLV\x01")},
+	{[]string{".mpg", ".mpeg", ".mpe", ".vob"}, prefix("\x00\x00\x01\xba")},
+	{[]string{".mts", ".m2ts"}, transportStream},
+	{[]string{".svg"}, svg},
+	{[]string{".bmp"}, bmp},
+}
+
+func prefix(signatures ...string) func([]byte) bool {
+	return func(head []byte) bool {
+		for _, s := range signatures {
+			if bytes.HasPrefix(head, []byte(s)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// riff matches the RIFF containers of the given type
+func riff(kind string) func([]byte) bool {
+	return func(head []byte) bool {
+		return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == kind
+	}
+}
+
+// ftyp matches the ISO base media files having one of the major brands
+func ftyp(brands ...string) func([]byte) bool {
+	return func(head []byte) bool {
+		return len(head) >= 12 && string(head[4:8]) == "ftyp" && slices.Contains(brands, string(head[8:12]))
+	}
+}
+
+// isoVideo matches the other ISO base media files, and the old QuickTime files starting without ftyp box.
+// The files declaring an image brand in their compatible brands aren't videos.
+func isoVideo(head []byte) bool {
+	if len(head) < 12 {
+		return false
+	}
+	switch string(head[4:8]) {
+	case "ftyp":
+		end := min(int(binary.BigEndian.Uint32(head)), len(head))
+		for i := 16; i+4 <= end; i += 4 {
+			switch string(head[i : i+4]) {
+			case "mif1", "msf1", "heic", "avif":
+				return false
+			}
+		}
+		return true
+	case "moov", "mdat", "wide", "free", "skip", "pnot":
+		return true
+	}
+	return false
+}
+
+// transportStream matches the MPEG transport streams, made of 188 bytes packets,
+// prefixed by a 4 bytes time code in the .m2ts files
+func transportStream(head []byte) bool {
+	for _, start := range []int{0, 4} {
+		if len(head) > start+188 && head[start] == 0x47 && head[start+188] == 0x47 {
+			return true
+		}
+	}
+	return false
+}
+
+// svg matches the SVG images, an XML text having a svg element
+func svg(head []byte) bool {
+	text := strings.ToLower(string(bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))))
+	return strings.HasPrefix(text, "<") && strings.Contains(text, "<svg")
+}
+
+// bmp matches the BMP images, whose reserved bytes of the header are 0
+func bmp(head []byte) bool {
+	return len(head) >= 14 && string(head[:2]) == "BM" && head[6] == 0 && head[7] == 0
+}
+
+// ContentExts gives the extensions of the format recognized in the first bytes of a file,
+// the usual one first. It returns nil when the format isn't recognized.
+func ContentExts(head []byte) []string {
+	for _, f := range contentFormats {
+		if f.match(head) {
+			return f.exts
+		}
+	}
+	return nil
+}
+
+// SniffExt gives the usual extension of the format recognized in the first bytes of a file, "" when unknown
+func SniffExt(head []byte) string {
+	if exts := ContentExts(head); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// ExtMatchesContent reports whether the extension fits the format recognized in the first bytes of a file.
+// It's true when the format isn't recognized, or when the extension isn't one of the recognized formats.
+func ExtMatchesContent(ext string, head []byte) bool {
+	exts := ContentExts(head)
+	if exts == nil {
+		return true
+	}
+	ext = strings.ToLower(ext)
+	if slices.Contains(exts, ext) {
+		return true
+	}
+	return !slices.ContainsFunc(contentFormats, func(f contentFormat) bool { return slices.Contains(f.exts, ext) })
+}
+
+// ReadHead reads the first SniffLen bytes of the file, or the whole file when it's shorter
+func ReadHead(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return head[:n], nil
+}
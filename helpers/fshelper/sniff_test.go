@@ -0,0 +1,77 @@
+package fshelper
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestSniffExt(t *testing.T) {
+	tests := []struct {
+		name  string
+		head  string
+		ext   string
+		match []string // extensions matching the content
+		wrong []string // extensions not matching the content
+	}{
+		{name: "jpeg", head: "\xff\xd8\xff\xe1\x00\x10Exif", ext: ".jpg", match: []string{".JPG", ".jpeg", ".insp"}, wrong: []string{".png", ".heic"}},
+		{name: "png", head: "\x89PNG\r\n\x1a\n\x00\x00", ext: ".png", wrong: []string{".jpg"}},
+		{name: "gif", head: "GIF89a", ext: ".gif"},
+		{name: "webp", head: "RIFF\x00\x00\x00\x00WEBPVP8 ", ext: ".webp"},
+		{name: "avi", head: "RIFF\x00\x00\x00\x00AVI LIST", ext: ".avi", wrong: []string{".webp"}},
+		{name: "heic", head: "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic", ext: ".heic", match: []string{".heif"}, wrong: []string{".mp4"}},
+		{name: "avif", head: "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf", ext: ".avif"},
+		{name: "cr3", head: "\x00\x00\x00\x18ftypcrx \x00\x00\x00\x01crx isom", ext: ".cr3", wrong: []string{".mp4"}},
+		{name: "mp4", head: "\x00\x00\x00\x20ftypisom\x00\x00\x02\x00isomiso2avc1mp41", ext: ".mp4", match: []string{".mov", ".m4v", ".insv"}, wrong: []string{".jpg"}},
+		{name: "mov", head: "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00qt  ", ext: ".mov", match: []string{".mp4"}},
+		{name: "old mov", head: "\x00\x00\x00\x08wide\x00\x00\x00\x00mdat", ext: ".mp4", match: []string{".mov"}},
+		{name: "image brand", head: "\x00\x00\x00\x18ftypXXXX\x00\x00\x00\x00mif1heic", ext: "", match: []string{".heic", ".mp4"}},
+		{name: "tiff", head: "II*\x00\x08\x00\x00\x00", ext: ".tif", match: []string{".dng", ".nef", ".CR2"}, wrong: []string{".jpg"}},
+		{name: "orf", head: "IIRO\x08\x00\x00\x00", ext: ".orf"},
+		{name: "raf", head: "FUJIFILMCCD-RAW 0201", ext: ".raf"},
+		{name: "mkv", head: "\x1a\x45\xdf\xa3\x01\x00", ext: ".mkv", match: []string{".webm"}},
+		{name: "svg", head: "\xef\xbb\xbf<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\">", ext: ".svg"},
+		{name: "text", head: "some notes", ext: "", match: []string{".jpg", ".txt"}},
+		{name: "empty", head: "", ext: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := []byte(tt.head)
+			if got := SniffExt(head); got != tt.ext {
+				t.Errorf("SniffExt() = %q, want %q", got, tt.ext)
+			}
+			for _, e := range append(tt.match, tt.ext) {
+				if !ExtMatchesContent(e, head) {
+					t.Errorf("%s should match the content", e)
+				}
+			}
+			for _, e := range tt.wrong {
+				if ExtMatchesContent(e, head) {
+					t.Errorf("%s shouldn't match the content", e)
+				}
+			}
+			// the extensions without signature can't be checked
+			if !ExtMatchesContent(".ari", head) {
+				t.Error(".ari should match any content")
+			}
+		})
+	}
+}
+
+func TestReadHead(t *testing.T) {
+	fsys := fstest.MapFS{
+		"short": &fstest.MapFile{Data: []byte("short")},
+		"long":  &fstest.MapFile{Data: make([]byte, 2*SniffLen)},
+	}
+	for name, expected := range map[string]int{"short": 5, "long": SniffLen} {
+		head, err := ReadHead(fsys, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(head) != expected {
+			t.Errorf("%s: expected %d bytes, got %d", name, expected, len(head))
+		}
+	}
+	if _, err := ReadHead(fsys, "missing"); err == nil {
+		t.Error("an error is expected for a missing file")
+	}
+}
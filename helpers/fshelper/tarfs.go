@@ -0,0 +1,223 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarFS exposes the content of a tar archive as a fs.FS.
+//
+// A tar archive isn't random-access. The archive is scanned once to record
+// the position of each file, then files are read directly at their position.
+// A compressed archive is first decompressed into a temporary file.
+type tarFS struct {
+	name    string
+	f       *os.File
+	temp    string               // temporary file to be removed on Close
+	entries map[string]*tarEntry // entries by name
+}
+
+type tarEntry struct {
+	name     string
+	info     fs.FileInfo
+	offset   int64
+	children []string // for directories
+}
+
+// isTarName reports whether the file name has a tar archive extension
+func isTarName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// openTar opens a .tar, .tar.gz or .tgz archive
+func openTar(name string) (*tarFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	t := tarFS{
+		name:    name,
+		f:       f,
+		entries: map[string]*tarEntry{},
+	}
+
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		err = t.decompress()
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+
+	err = t.scan()
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return &t, nil
+}
+
+// decompress the archive into a temporary file
+func (t *tarFS) decompress() error {
+	gz, err := gzip.NewReader(t.f)
+	if err != nil {
+		return &fs.PathError{Op: "open", Path: t.name, Err: err}
+	}
+	tmp, err := os.CreateTemp("", "immich-go-*.tar")
+	if err != nil {
+		return err
+	}
+	t.temp = tmp.Name()
+	_, err = io.Copy(tmp, gz)
+	if err != nil {
+		tmp.Close()
+		return &fs.PathError{Op: "open", Path: t.name, Err: err}
+	}
+	t.f.Close()
+	t.f = tmp
+	return nil
+}
+
+// scan reads all headers of the archive and records the position of the files
+func (t *tarFS) scan() error {
+	_, err := t.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	t.entries["."] = &tarEntry{name: ".", info: dirInfo(".", time.Time{})}
+
+	// The tar reader doesn't buffer: after reading the header, the file's position is the one of the entry's data
+	tr := tar.NewReader(t.f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return &fs.PathError{Op: "open", Path: t.name, Err: err}
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name == "" || !fs.ValidPath(name) {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			offset, err := t.f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			t.addEntry(&tarEntry{name: name, info: hdr.FileInfo(), offset: offset})
+		case tar.TypeDir:
+			t.addEntry(&tarEntry{name: name, info: hdr.FileInfo()})
+		}
+	}
+
+	for _, e := range t.entries {
+		sort.Strings(e.children)
+	}
+	return nil
+}
+
+// addEntry records the entry and creates missing parent directories
+func (t *tarFS) addEntry(e *tarEntry) {
+	if old, ok := t.entries[e.name]; ok {
+		// the entry is repeated in the archive, or the directory was already created
+		old.info, old.offset = e.info, e.offset
+		return
+	}
+	t.entries[e.name] = e
+	for {
+		dir := path.Dir(e.name)
+		p, ok := t.entries[dir]
+		if !ok {
+			p = &tarEntry{name: dir, info: dirInfo(dir, e.info.ModTime())}
+			t.entries[dir] = p
+		}
+		p.children = append(p.children, e.name)
+		if ok {
+			return
+		}
+		e = p
+	}
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.info.IsDir() {
+		return &tarDir{fsys: t, entry: e}, nil
+	}
+	return &tarFile{entry: e, SectionReader: io.NewSectionReader(t.f, e.offset, e.info.Size())}, nil
+}
+
+// Close closes the archive and removes the temporary file
+func (t *tarFS) Close() error {
+	err := t.f.Close()
+	if t.temp != "" {
+		err = errors.Join(err, os.Remove(t.temp))
+	}
+	return err
+}
+
+type tarFile struct {
+	entry *tarEntry
+	*io.SectionReader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.info, nil }
+func (f *tarFile) Close() error               { return nil }
+
+type tarDir struct {
+	fsys  *tarFS
+	entry *tarEntry
+	pos   int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry.info, nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	left := len(d.entry.children) - d.pos
+	if n > 0 && left == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < left {
+		left = n
+	}
+	r := make([]fs.DirEntry, left)
+	for i := range r {
+		r[i] = fs.FileInfoToDirEntry(d.fsys.entries[d.entry.children[d.pos+i]].info)
+	}
+	d.pos += left
+	return r, nil
+}
+
+// dirInfo gives the FileInfo of a directory not present in the archive
+func dirInfo(name string, modTime time.Time) fs.FileInfo {
+	h := tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  modTime,
+	}
+	return h.FileInfo()
+}
@@ -0,0 +1,99 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var tarContent = map[string]string{
+	"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg":      "jpeg content",
+	"Takeout/Google Photos/Photos from 2023/PXL_20231006_063000139.jpg.json": `{"title": "PXL_20231006_063000139.jpg"}`,
+	"Takeout/Google Photos/Album/metadata.json":                              `{"title": "Album"}`,
+	"readme.txt": "",
+}
+
+func writeTar(t *testing.T, name string, compress bool) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "Takeout/", Mode: 0o755})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, c := range tarContent {
+		err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: n, Mode: 0o644, Size: int64(len(c))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	for _, name := range []string{"takeout.tar", "takeout.tgz", "takeout.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), name)
+			writeTar(t, name, filepath.Ext(name) != ".tar")
+
+			fsys, err := openTar(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fsys.Close()
+
+			expected := []string{}
+			for n, c := range tarContent {
+				expected = append(expected, n)
+				b, err := fs.ReadFile(fsys, n)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != c {
+					t.Errorf("file %q: expected %q, got %q", n, c, string(b))
+				}
+			}
+			err = fstest.TestFS(fsys, expected...)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestParsePathTar(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "takeout-001.tgz")
+	writeTar(t, name, true)
+
+	fsyss, err := ParsePath([]string{name}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fsyss) != 1 {
+		t.Fatalf("expected 1 file system, got %d", len(fsyss))
+	}
+	defer fsyss[0].(io.Closer).Close()
+	_, err = fs.Stat(fsyss[0], "Takeout/Google Photos/Album/metadata.json")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,342 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+)
+
+var (
+	// ErrArchiveEncrypted is returned for an encrypted zip archive opened without password
+	ErrArchiveEncrypted = errors.New("the archive is encrypted, a password is needed")
+	// ErrArchivePassword is returned when the password doesn't decrypt the archive
+	ErrArchivePassword = errors.New("wrong password for the encrypted archive")
+	// ErrArchiveEncryption is returned for the encryption methods that can't be read
+	ErrArchiveEncryption = errors.New("unsupported encryption method")
+	// ErrArchiveAuthentication is returned when the content of an encrypted file doesn't match its authentication code
+	ErrArchiveAuthentication = errors.New("the encrypted file is corrupted")
+)
+
+const (
+	zipFlagEncrypted       = 0x1  // the file is encrypted
+	zipFlagDataDescriptor  = 0x8  // the CRC is given after the data, the password is checked with the time
+	zipFlagStrongEncrypted = 0x40 // PKWARE's strong encryption
+	zipMethodAES           = 99   // WinZip's AES encryption, the compression method is in the extra field
+	zipExtraAES            = 0x9901
+)
+
+// encryptedZipFS reads a zip archive having encrypted files, with the traditional PKWARE encryption
+// named ZipCrypto, or with the AES encryption of WinZip. The files that aren't encrypted are read as usual.
+type encryptedZipFS struct {
+	*zip.ReadCloser
+	password []byte
+	files    map[string]*zip.File // encrypted files by name
+}
+
+// openZip opens the zip archive. An archive having encrypted files needs the password,
+// which is checked with the first encrypted file.
+func openZip(name string, password string) (fs.FS, io.Closer, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	z := &encryptedZipFS{ReadCloser: r, password: []byte(password), files: map[string]*zip.File{}}
+	for _, f := range r.File {
+		if f.Flags&zipFlagEncrypted != 0 {
+			z.files[f.Name] = f
+		}
+	}
+	if len(z.files) == 0 {
+		return r, r, nil
+	}
+	if password == "" {
+		r.Close()
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrArchiveEncrypted)
+	}
+	checked := false
+	for _, f := range r.File {
+		if f.Flags&zipFlagEncrypted == 0 {
+			continue
+		}
+		if f.Flags&zipFlagStrongEncrypted != 0 {
+			err = fmt.Errorf("%s: PKWARE's strong encryption: %w", f.Name, ErrArchiveEncryption)
+		} else if _, _, err = zipEncryption(f); err == nil && !checked {
+			var rc io.ReadCloser
+			rc, err = decryptZipFile(f, z.password)
+			if err == nil {
+				rc.Close()
+			}
+			checked = true
+		}
+		if err != nil {
+			r.Close()
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return z, r, nil
+}
+
+func (z *encryptedZipFS) Open(name string) (fs.File, error) {
+	f, ok := z.files[name]
+	if !ok {
+		return z.ReadCloser.Open(name)
+	}
+	rc, err := decryptZipFile(f, z.password)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &encryptedZipFile{ReadCloser: rc, info: f.FileInfo()}, nil
+}
+
+// encryptedZipFile is a decrypted file of the archive
+type encryptedZipFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *encryptedZipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// zipEncryption gives the strength of the AES encryption, 0 for ZipCrypto, and the compression method of the content
+func zipEncryption(f *zip.File) (strength int, method uint16, err error) {
+	if f.Method != zipMethodAES {
+		method = f.Method
+	} else {
+		extra := f.Extra
+		for len(extra) >= 4 {
+			id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+			if len(extra) < 4+size {
+				break
+			}
+			if id == zipExtraAES && size >= 7 {
+				strength, method = int(extra[8]), binary.LittleEndian.Uint16(extra[9:])
+				break
+			}
+			extra = extra[4+size:]
+		}
+		if strength < 1 || strength > 3 {
+			return 0, 0, fmt.Errorf("%s: AES strength %d: %w", f.Name, strength, ErrArchiveEncryption)
+		}
+	}
+	if method != zip.Store && method != zip.Deflate {
+		return 0, 0, fmt.Errorf("%s: compression method %d: %w", f.Name, method, ErrArchiveEncryption)
+	}
+	return strength, method, nil
+}
+
+// decryptZipFile opens the encrypted file, the password being checked before reading the content.
+// The CRC of the content, or its authentication code with AES, is checked at the end of the reading.
+func decryptZipFile(f *zip.File, password []byte) (io.ReadCloser, error) {
+	strength, method, err := zipEncryption(f)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	if strength == 0 {
+		r, err = zipCryptoReader(f, raw, password)
+	} else {
+		r, err = zipAESReader(f, raw, password, strength)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rc io.ReadCloser = io.NopCloser(r)
+	if method == zip.Deflate {
+		rc = flate.NewReader(r)
+	}
+	// AE-2 files have no CRC, the authentication code checks the content
+	return &crcReader{ReadCloser: rc, src: r, expected: f.CRC32, hash: crc32.NewIEEE(), check: f.CRC32 != 0 || strength == 0}, nil
+}
+
+// zipCryptoKeys are the keys of the traditional PKWARE encryption
+type zipCryptoKeys [3]uint32
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func newZipCryptoKeys(password []byte) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, b := range password {
+		k.update(b)
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		t := k[2] | 2
+		p := c ^ byte((t*(t^1))>>8)
+		k.update(p)
+		buf[i] = p
+	}
+}
+
+// zipCryptoReader decrypts the content following the 12 bytes header, whose last byte checks the password
+func zipCryptoReader(f *zip.File, raw io.Reader, password []byte) (io.Reader, error) {
+	k := newZipCryptoKeys(password)
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	k.decrypt(header)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != check {
+		return nil, ErrArchivePassword
+	}
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := raw.Read(b)
+		k.decrypt(b[:n])
+		return n, err
+	}), nil
+}
+
+// zipAESReader decrypts the content encrypted by WinZip's AES in counter mode. The salt and the password
+// verifier come before the content, the authentication code of the encrypted content after it.
+func zipAESReader(f *zip.File, raw io.Reader, password []byte, strength int) (io.Reader, error) {
+	keyLen := 8 + 8*strength
+	saltLen := keyLen / 2
+	size := int64(f.CompressedSize64) - int64(saltLen) - 2 - 10
+	if size < 0 {
+		return nil, fmt.Errorf("%s: %w", f.Name, zip.ErrFormat)
+	}
+	header := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	keys := pbkdf2SHA1(password, header[:saltLen], 1000, 2*keyLen+2)
+	if subtle.ConstantTimeCompare(keys[2*keyLen:], header[saltLen:]) != 1 {
+		return nil, ErrArchivePassword
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	return &aesCTRReader{
+		r:     io.LimitReader(raw, size),
+		raw:   raw,
+		block: block,
+		mac:   hmac.New(sha1.New, keys[keyLen:2*keyLen]),
+	}, nil
+}
+
+// aesCTRReader decrypts with AES in the counter mode of WinZip: a little endian counter starting at 1
+type aesCTRReader struct {
+	r       io.Reader // the encrypted content
+	raw     io.Reader // the authentication code follows the content
+	block   cipher.Block
+	mac     hash.Hash
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int // bytes of the stream block already used
+	started bool
+}
+
+func (a *aesCTRReader) Read(b []byte) (int, error) {
+	n, err := a.r.Read(b)
+	a.mac.Write(b[:n])
+	for i := 0; i < n; i++ {
+		if !a.started || a.used == aes.BlockSize {
+			for j := range a.counter {
+				a.counter[j]++
+				if a.counter[j] != 0 {
+					break
+				}
+			}
+			a.block.Encrypt(a.stream[:], a.counter[:])
+			a.used, a.started = 0, true
+		}
+		b[i] ^= a.stream[a.used]
+		a.used++
+	}
+	if errors.Is(err, io.EOF) {
+		code := make([]byte, 10)
+		if _, rerr := io.ReadFull(a.raw, code); rerr != nil {
+			return n, rerr
+		}
+		if !hmac.Equal(a.mac.Sum(nil)[:10], code) {
+			return n, ErrArchiveAuthentication
+		}
+	}
+	return n, err
+}
+
+// pbkdf2SHA1 derives the keys of the password as described by RFC 8018, with HMAC-SHA1
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var dk []byte
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
+
+// crcReader checks the CRC of the content at its end. The decrypted data is read until its end,
+// the decompression stopping before the authentication code is checked.
+type crcReader struct {
+	io.ReadCloser
+	src      io.Reader // the decrypted data
+	hash     hash.Hash32
+	expected uint32
+	check    bool
+}
+
+func (c *crcReader) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.hash.Write(b[:n])
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+	if _, derr := io.Copy(io.Discard, c.src); derr != nil {
+		return n, derr
+	}
+	if c.check && c.hash.Sum32() != c.expected {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
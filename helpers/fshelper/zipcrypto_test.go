@@ -0,0 +1,115 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The archives of TESTDATA_ZIP are encrypted with the password "secret": encrypted-zipcrypto.zip by Info-ZIP,
+// encrypted-aes.zip with AES-256, the photo being AE-1 and the JSON files AE-2.
+const testArchivePassword = "secret"
+
+func TestEncryptedZip(t *testing.T) {
+	photo := strings.Repeat("JPEGDATA", 200)
+	for _, name := range []string{"TESTDATA_ZIP/encrypted-zipcrypto.zip", "TESTDATA_ZIP/encrypted-aes.zip"} {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			fsyss, err := ParsePathWithOptions([]string{name}, true, PathOptions{ArchivePassword: testArchivePassword})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys := fsyss[0]
+			defer fsys.(io.Closer).Close()
+
+			b, err := fs.ReadFile(fsys, "Takeout/Google Photos/Trip/IMG_0001.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != photo {
+				t.Errorf("unexpected content of the photo: %.20q...", b)
+			}
+			b, err = fs.ReadFile(fsys, "Takeout/Google Photos/Trip/metadata.json")
+			if err != nil || !strings.Contains(string(b), `"title": "Trip"`) {
+				t.Errorf("unexpected content of the album's metadata: %q, %v", b, err)
+			}
+			s, err := fs.Stat(fsys, "Takeout/Google Photos/Trip/IMG_0001.jpg")
+			if err != nil || s.Size() != int64(len(photo)) {
+				t.Errorf("unexpected size of the photo: %v", err)
+			}
+			entries, err := fs.ReadDir(fsys, "Takeout/Google Photos/Trip")
+			if err != nil || len(entries) != 3 {
+				t.Errorf("expected the 3 files of the album, got %d, %v", len(entries), err)
+			}
+
+			_, err = ParsePathWithOptions([]string{name}, true, PathOptions{ArchivePassword: "wrong"})
+			if !errors.Is(err, ErrArchivePassword) {
+				t.Errorf("expected the error of a wrong password, got %v", err)
+			}
+			_, err = ParsePath([]string{name}, true)
+			if !errors.Is(err, ErrArchiveEncrypted) {
+				t.Errorf("expected the error of a missing password, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedZipTampered(t *testing.T) {
+	b, err := os.ReadFile("TESTDATA_ZIP/encrypted-aes.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		if f.Name == "Takeout/Google Photos/Trip/IMG_0001.jpg" {
+			offset, _ := f.DataOffset()
+			// a byte of the content after the salt and the password verifier
+			b[offset+16+2+5] ^= 0xff
+		}
+	}
+	name := filepath.Join(t.TempDir(), "tampered.zip")
+	if err = os.WriteFile(name, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsyss, err := ParsePathWithOptions([]string{name}, true, PathOptions{ArchivePassword: testArchivePassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsyss[0].(io.Closer).Close()
+	_, err = fs.ReadFile(fsyss[0], "Takeout/Google Photos/Trip/IMG_0001.jpg")
+	if !errors.Is(err, ErrArchiveAuthentication) {
+		t.Errorf("expected the error of a corrupted file, got %v", err)
+	}
+}
+
+func TestEncryptedZipUnsupported(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "strong.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	fw, err := w.CreateRaw(&zip.FileHeader{Name: "photo.jpg", Method: zip.Deflate, Flags: zipFlagEncrypted | zipFlagStrongEncrypted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte("encrypted by PKWARE"))
+	if err = errors.Join(w.Close(), f.Close()); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParsePathWithOptions([]string{name}, true, PathOptions{ArchivePassword: testArchivePassword})
+	if !errors.Is(err, ErrArchiveEncryption) {
+		t.Errorf("expected the error of an unsupported encryption, got %v", err)
+	}
+	if strings.Contains(err.Error(), testArchivePassword) {
+		t.Errorf("the error gives the password: %s", err)
+	}
+}
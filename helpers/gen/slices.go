@@ -19,3 +19,19 @@ func Filter[T any](s []T, f func(i T) bool) []T {
 	}
 	return r
 }
+
+// Chunks splits the slice into slices of at most size items
+func Chunks[T any](s []T, size int) [][]T {
+	if size <= 0 {
+		return [][]T{s}
+	}
+	r := make([][]T, 0, (len(s)+size-1)/size)
+	for size < len(s) {
+		r = append(r, s[:size:size])
+		s = s[size:]
+	}
+	if len(s) > 0 {
+		r = append(r, s)
+	}
+	return r
+}
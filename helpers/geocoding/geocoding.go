@@ -0,0 +1,157 @@
+// Package geocoding finds the city near a GPS position, without calling any external service.
+//
+// The list of cities is bundled within the program. It contains the capitals and the main cities of the world.
+package geocoding
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	_ "time/tzdata" // the zones of the cities are available even without the zone database of the system
+)
+
+//go:embed cities.csv
+var citiesCSV string
+
+// The time zones are given by country, followed by the cities whose zone differs from the one of their country
+//
+//go:embed timezones.csv
+var timeZonesCSV string
+
+type City struct {
+	Name      string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	TimeZone  string // IANA name of the time zone of the city
+}
+
+func (c City) String() string {
+	return c.Name + ", " + c.Country
+}
+
+// MaxDistance is the distance in km above which a position isn't attached to a city
+const MaxDistance = 150.0
+
+// cacheResolution is the size of the cache cells in degree (around 1 km)
+const cacheResolution = 0.01
+
+var (
+	loadOnce sync.Once
+	cities   []City
+)
+
+func loadCities() {
+	records, err := csv.NewReader(strings.NewReader(citiesCSV)).ReadAll()
+	if err != nil {
+		panic("geocoding: invalid cities database: " + err.Error())
+	}
+	zones := loadTimeZones()
+	for _, r := range records {
+		lat, err1 := strconv.ParseFloat(r[2], 64)
+		lon, err2 := strconv.ParseFloat(r[3], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		c := City{Name: r[0], Country: r[1], Latitude: lat, Longitude: lon}
+		c.TimeZone = zones.of(c)
+		cities = append(cities, c)
+	}
+}
+
+// timeZones are the zones of the countries, and the ones of the cities differing from their country
+type timeZones struct {
+	countries map[string]string
+	cities    map[City]string
+}
+
+func loadTimeZones() timeZones {
+	records, err := csv.NewReader(strings.NewReader(timeZonesCSV)).ReadAll()
+	if err != nil {
+		panic("geocoding: invalid time zones database: " + err.Error())
+	}
+	z := timeZones{countries: map[string]string{}, cities: map[City]string{}}
+	for _, r := range records {
+		if r[1] == "" {
+			z.countries[r[0]] = r[4]
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(r[2], 64)
+		lon, err2 := strconv.ParseFloat(r[3], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		z.cities[City{Name: r[1], Country: r[0], Latitude: lat, Longitude: lon}] = r[4]
+	}
+	return z
+}
+
+// of gives the zone of the city, or the one of its country
+func (z timeZones) of(c City) string {
+	if tz, ok := z.cities[c]; ok {
+		return tz
+	}
+	return z.countries[c.Country]
+}
+
+type cacheKey struct {
+	lat, lon int
+}
+
+type cacheEntry struct {
+	city  City
+	found bool
+}
+
+// Geocoder locates positions and caches the results.
+// Positions close to each other share the same cache entry.
+type Geocoder struct {
+	lock  sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+func NewGeocoder() *Geocoder {
+	loadOnce.Do(loadCities)
+	return &Geocoder{
+		cache: map[cacheKey]cacheEntry{},
+	}
+}
+
+// Locate returns the nearest city of the position.
+// It returns false when no city is close enough.
+func (g *Geocoder) Locate(latitude, longitude float64) (City, bool) {
+	k := cacheKey{
+		lat: int(math.Round(latitude / cacheResolution)),
+		lon: int(math.Round(longitude / cacheResolution)),
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if e, ok := g.cache[k]; ok {
+		return e.city, e.found
+	}
+
+	e := cacheEntry{}
+	best := MaxDistance
+	for _, c := range cities {
+		d := distance(latitude, longitude, c.Latitude, c.Longitude)
+		if d <= best {
+			best = d
+			e.city, e.found = c, true
+		}
+	}
+	g.cache[k] = e
+	return e.city, e.found
+}
+
+// distance returns the great circle distance in km between 2 positions
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
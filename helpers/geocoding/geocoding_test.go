@@ -0,0 +1,51 @@
+package geocoding
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, lon  float64
+		want      string
+		wantFound bool
+	}{
+		{name: "Eiffel tower", lat: 48.8584, lon: 2.2945, want: "Paris, France", wantFound: true},
+		{name: "Versailles", lat: 48.8049, lon: 2.1204, want: "Paris, France", wantFound: true},
+		{name: "Golden Gate", lat: 37.8199, lon: -122.4783, want: "San Francisco, United States", wantFound: true},
+		{name: "Opera house", lat: -33.8568, lon: 151.2153, want: "Sydney, Australia", wantFound: true},
+		{name: "Middle of the Pacific", lat: 0, lon: -140, wantFound: false},
+	}
+	g := NewGeocoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, found := g.Locate(tt.lat, tt.lon)
+			if found != tt.wantFound {
+				t.Fatalf("Locate() found = %v, want %v", found, tt.wantFound)
+			}
+			if found && c.String() != tt.want {
+				t.Errorf("Locate() = %q, want %q", c.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLocateCache(t *testing.T) {
+	g := NewGeocoder()
+	g.Locate(48.8584, 2.2945)
+	g.Locate(48.8586, 2.2947)
+	if len(g.cache) != 1 {
+		t.Errorf("expected 1 cache entry for close positions, got %d", len(g.cache))
+	}
+}
+
+func TestTimeZones(t *testing.T) {
+	NewGeocoder()
+	for _, c := range cities {
+		if _, err := time.LoadLocation(c.TimeZone); c.TimeZone == "" || err != nil {
+			t.Errorf("invalid time zone %q for %s: %v", c.TimeZone, c, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package hashcache keeps the hashes of the files between runs.
+//
+// A hash is reused as long as the size and the modification time of the file are unchanged.
+package hashcache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`
+}
+
+// Cache gives the hashes of the files by their path.
+// A nil Cache keeps nothing, and computes the hashes each time.
+type Cache struct {
+	mut     sync.Mutex
+	name    string
+	entries map[string]entry
+	changed bool
+}
+
+// Open reads the cache kept in the file name. A missing file gives an empty cache.
+func Open(name string) (*Cache, error) {
+	c := &Cache{name: name, entries: map[string]entry{}}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &c.entries)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the hash of the file when its size and modification time are unchanged
+func (c *Cache) Get(key string, size int64, modTime time.Time) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.Size != size || !e.ModTime.Equal(modTime) {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+// Set keeps the hash of the file, replacing the previous one
+func (c *Cache) Set(key string, size int64, modTime time.Time, hash string) {
+	if c == nil {
+		return
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.entries[key] = entry{Size: size, ModTime: modTime, Hash: hash}
+	c.changed = true
+}
+
+// Hash returns the hash of the file name of fsys, taken from the cache or computed by the function compute.
+// The key distinguishes the different hashes of the same file.
+func (c *Cache) Hash(fsys fs.FS, name string, key string, compute func() (string, error)) (string, error) {
+	if c == nil {
+		return compute()
+	}
+	i, err := fs.Stat(fsys, name)
+	if err != nil {
+		return compute()
+	}
+	key = key + ":" + name
+	if h, ok := c.Get(key, i.Size(), i.ModTime()); ok {
+		return h, nil
+	}
+	h, err := compute()
+	if err != nil {
+		return "", err
+	}
+	c.Set(key, i.Size(), i.ModTime(), h)
+	return h, nil
+}
+
+// Save writes the cache when it has changed, replacing the previous file only when complete
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if !c.changed {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(c.name), 0o755)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.name + ".tmp"
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, c.name)
+	if err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
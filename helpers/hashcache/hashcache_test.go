@@ -0,0 +1,85 @@
+package hashcache
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.jpg": {Data: []byte("a content"), ModTime: d},
+	}
+	name := filepath.Join(t.TempDir(), "cache", "hashes.json")
+	calls := 0
+	compute := func() (string, error) {
+		calls++
+		return string(fsys["a.jpg"].Data), nil
+	}
+	hash := func(c *Cache, key string) string {
+		h, err := c.Hash(fsys, "a.jpg", key, compute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	c, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := hash(c, "sha1"); h != "a content" || calls != 1 {
+		t.Errorf("unexpected hash %q after %d computations", h, calls)
+	}
+	hash(c, "sha1")
+	if calls != 1 {
+		t.Errorf("the hash should come from the cache, got %d computations", calls)
+	}
+	hash(c, "other")
+	if calls != 2 {
+		t.Errorf("an other key should compute the hash, got %d computations", calls)
+	}
+	err = c.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash(c, "sha1")
+	if calls != 2 {
+		t.Errorf("the hash should be kept between runs, got %d computations", calls)
+	}
+
+	fsys["a.jpg"].ModTime = d.Add(time.Second)
+	hash(c, "sha1")
+	if calls != 3 {
+		t.Errorf("a modified file should be hashed again, got %d computations", calls)
+	}
+	fsys["a.jpg"].Data = []byte("a new content")
+	if h := hash(c, "sha1"); h != "a new content" || calls != 4 {
+		t.Errorf("a resized file should be hashed again, got %q after %d computations", h, calls)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	fsys := fstest.MapFS{"a.jpg": {Data: []byte("a")}}
+	errHash := errors.New("can't hash")
+	_, err := c.Hash(fsys, "a.jpg", "sha1", func() (string, error) { return "", errHash })
+	if !errors.Is(err, errHash) {
+		t.Errorf("expected the error of the computation, got %v", err)
+	}
+	c.Set("a.jpg", 1, time.Time{}, "a")
+	if _, ok := c.Get("a.jpg", 1, time.Time{}); ok {
+		t.Error("a nil cache should keep nothing")
+	}
+	if err := c.Save(); err != nil {
+		t.Error(err)
+	}
+}
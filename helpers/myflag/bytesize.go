@@ -0,0 +1,56 @@
+package myflag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes. It implements the flag.Value interface
+// and accepts values like 10KB, 2MB, 1.5G
+type ByteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"GB", 1024 * 1024 * 1024},
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+	{"B", 1},
+}
+
+func (b *ByteSize) Set(s string) error {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSuffix(v, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size %q, expecting a value like 10KB or 2MB", s)
+	}
+	*b = ByteSize(f * factor)
+	return nil
+}
+
+func (b ByteSize) String() string {
+	switch {
+	case b == 0:
+		return ""
+	case b >= 1024*1024*1024 && b%(1024*1024*1024) == 0:
+		return fmt.Sprintf("%dGB", b/(1024*1024*1024))
+	case b >= 1024*1024 && b%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", b/(1024*1024))
+	case b >= 1024 && b%1024 == 0:
+		return fmt.Sprintf("%dKB", b/1024)
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
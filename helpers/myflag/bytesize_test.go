@@ -0,0 +1,33 @@
+package myflag
+
+import "testing"
+
+func TestByteSize_Set(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ByteSize
+		wantErr bool
+	}{
+		{value: "10KB", want: 10 * 1024},
+		{value: "10kb", want: 10 * 1024},
+		{value: "2MB", want: 2 * 1024 * 1024},
+		{value: "1.5G", want: 1536 * 1024 * 1024},
+		{value: "2048", want: 2048},
+		{value: "100B", want: 100},
+		{value: "big", wantErr: true},
+		{value: "-5MB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var b ByteSize
+			err := b.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if b != tt.want {
+				t.Errorf("Set() = %d, want %d", b, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package myflag
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration implementing the flag.Value interface.
+// Besides the syntax of time.ParseDuration, it accepts a number of days like 7d.
+type Duration time.Duration
+
+func (d *Duration) Set(s string) error {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid duration %q, expecting a value like 7d or 36h", s)
+		}
+		*d = Duration(n * float64(24*time.Hour))
+		return nil
+	}
+	dd, err := time.ParseDuration(v)
+	if err != nil || dd < 0 {
+		return fmt.Errorf("invalid duration %q, expecting a value like 7d or 36h", s)
+	}
+	*d = Duration(dd)
+	return nil
+}
+
+func (d Duration) String() string {
+	switch {
+	case d == 0:
+		return ""
+	case time.Duration(d)%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", time.Duration(d)/(24*time.Hour))
+	}
+	return time.Duration(d).String()
+}
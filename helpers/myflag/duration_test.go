@@ -0,0 +1,36 @@
+package myflag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuration_Set(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		str     string
+		wantErr bool
+	}{
+		{value: "7d", want: 7 * 24 * time.Hour, str: "7d"},
+		{value: "168h", want: 7 * 24 * time.Hour, str: "7d"},
+		{value: "1.5D", want: 36 * time.Hour, str: "36h0m0s"},
+		{value: "90m", want: 90 * time.Minute, str: "1h30m0s"},
+		{value: "week", wantErr: true},
+		{value: "-2d", wantErr: true},
+		{value: "-5h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var d Duration
+			err := d.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if time.Duration(d) != tt.want || !tt.wantErr && d.String() != tt.str {
+				t.Errorf("Set() = %s, want %s", d, tt.want)
+			}
+		})
+	}
+}
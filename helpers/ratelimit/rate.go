@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rate is a bandwidth in bytes per second. It implements the flag.Value interface
+// and accepts values like 500KB/s, 5MB/s, 1.5M
+type Rate int
+
+var rateUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"GB", 1024 * 1024 * 1024},
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+	{"B", 1},
+}
+
+func (r *Rate) Set(s string) error {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "/S")
+	factor := 1.0
+	for _, u := range rateUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSuffix(v, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid rate %q, expecting a value like 500KB/s or 5MB/s", s)
+	}
+	*r = Rate(f * factor)
+	return nil
+}
+
+func (r Rate) String() string {
+	switch {
+	case r == 0:
+		return ""
+	case r >= 1024*1024 && r%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB/s", r/(1024*1024))
+	case r >= 1024 && r%1024 == 0:
+		return fmt.Sprintf("%dKB/s", r/1024)
+	}
+	return fmt.Sprintf("%dB/s", int(r))
+}
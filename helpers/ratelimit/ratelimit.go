@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by all readers that must respect the same bandwidth.
+// It is safe for concurrent use.
+type Limiter struct {
+	mut    sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // bucket capacity in bytes
+	tokens float64 // available bytes, negative when readers are waiting
+	last   time.Time
+}
+
+// NewLimiter returns a limiter for the given rate in bytes per second.
+// The bucket holds 1/10 of second of data.
+func NewLimiter(bytesPerSecond int) *Limiter {
+	burst := float64(bytesPerSecond) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// WaitN blocks until n bytes can be consumed.
+// The tokens are reserved immediately, concurrent callers wait in turn.
+func (l *Limiter) WaitN(n int) {
+	l.mut.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mut.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+// NewReader returns a reader that doesn't exceed the limiter's rate.
+// The reader is returned as is when the limiter is nil.
+func NewReader(r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r: r, l: l}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	// Read by chunks not bigger than the bucket to smooth the throughput
+	if len(b) > int(r.l.burst) {
+		b = b[:int(r.l.burst)]
+	}
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.l.WaitN(n)
+	}
+	return n, err
+}
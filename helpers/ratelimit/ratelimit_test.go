@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	const (
+		rate = 100 * 1024
+		size = 50 * 1024
+	)
+	l := NewLimiter(rate)
+	// the first burst is served immediately
+	expected := time.Duration(float64(size-rate/10) / rate * float64(time.Second))
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, NewReader(bytes.NewReader(make([]byte, size)), l))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != size {
+		t.Errorf("expected %d bytes, got %d", size, n)
+	}
+	if elapsed < expected*9/10 || elapsed > expected+250*time.Millisecond {
+		t.Errorf("expected a duration around %s, got %s", expected, elapsed)
+	}
+}
+
+func TestReaderShared(t *testing.T) {
+	const (
+		rate    = 100 * 1024
+		size    = 20 * 1024
+		readers = 3
+	)
+	l := NewLimiter(rate)
+	expected := time.Duration(float64(readers*size-rate/10) / rate * float64(time.Second))
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = io.Copy(io.Discard, NewReader(bytes.NewReader(make([]byte, size)), l))
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if elapsed < expected*9/10 || elapsed > expected+250*time.Millisecond {
+		t.Errorf("expected a duration around %s, got %s", expected, elapsed)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	r := bytes.NewReader(nil)
+	if NewReader(r, nil) != io.Reader(r) {
+		t.Errorf("expected the original reader when the limiter is nil")
+	}
+}
+
+func TestRate_Set(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Rate
+		wantErr bool
+	}{
+		{value: "5MB/s", want: 5 * 1024 * 1024},
+		{value: "500KB/s", want: 500 * 1024},
+		{value: "500kb/s", want: 500 * 1024},
+		{value: "1.5M", want: 1536 * 1024},
+		{value: "2048", want: 2048},
+		{value: "100B/s", want: 100},
+		{value: "fast", wantErr: true},
+		{value: "-5MB/s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var r Rate
+			err := r.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if r != tt.want {
+				t.Errorf("Set() = %d, want %d", r, tt.want)
+			}
+		})
+	}
+}
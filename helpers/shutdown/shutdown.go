@@ -0,0 +1,42 @@
+// Package shutdown lets a command finish its work when the user asks to stop.
+//
+// The first Ctrl+C asks the commands to stop gracefully: they stop taking new work, but complete
+// what is started. A command that doesn't watch the request is stopped immediately.
+package shutdown
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type key struct{}
+
+type state struct {
+	stop     chan struct{}
+	once     sync.Once
+	watching atomic.Bool
+}
+
+// WithStop returns a context carrying a stop request.
+// The stop function requests the stop and tells if a command watches the request.
+// When it returns false, the caller should cancel the context.
+func WithStop(ctx context.Context) (context.Context, func() bool) {
+	s := &state{stop: make(chan struct{})}
+	return context.WithValue(ctx, key{}, s), func() bool {
+		s.once.Do(func() { close(s.stop) })
+		return s.watching.Load()
+	}
+}
+
+// Stopping returns a channel closed when the stop is requested.
+// The caller must then stop taking new work and return after completing the started one.
+// The channel is nil when the context doesn't carry a stop request.
+func Stopping(ctx context.Context) <-chan struct{} {
+	s, ok := ctx.Value(key{}).(*state)
+	if !ok {
+		return nil
+	}
+	s.watching.Store(true)
+	return s.stop
+}
@@ -0,0 +1,34 @@
+package shutdown
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStop(t *testing.T) {
+	ctx, stop := WithStop(context.Background())
+	if stop() {
+		t.Error("the stop shouldn't be graceful when nobody watches it")
+	}
+
+	ctx, stop = WithStop(context.Background())
+	c := Stopping(ctx)
+	select {
+	case <-c:
+		t.Fatal("the stop isn't requested yet")
+	default:
+	}
+	if !stop() {
+		t.Error("the stop should be graceful when watched")
+	}
+	stop()
+	select {
+	case <-c:
+	default:
+		t.Error("the channel should be closed")
+	}
+
+	if Stopping(context.Background()) != nil {
+		t.Error("expected a nil channel without stop request")
+	}
+}
@@ -31,16 +31,43 @@ type StackType int
 const (
 	StackRawJpg StackType = iota
 	StackBurst
+	StackLivePhoto
 )
 
+// liveWindow is the maximum difference of capture date between the photo and the video of a live photo
+const liveWindow = 3 * time.Second
+
+// burstGap is the maximum time between two photos of a burst recognized by their dates of capture
+const burstGap = time.Second
+
+// BurstInfo gives what the metadata of a photo tell about a burst
+type BurstInfo struct {
+	ID          string // Identifier of the burst written by the camera, like the BurstUUID of Apple devices
+	Camera      string // Make and model of the camera
+	SubSecond   bool   // The date of capture is precise to the sub-second
+	MotionPhoto bool   // The photo embeds its video, a video having the same name isn't its live part
+}
+
+// frame is a photo with a precise date of capture, grouped with the photos taken just before or after
+type frame struct {
+	ID       string
+	fileName string
+	date     time.Time
+}
+
 type StackBuilder struct {
-	dateRange immich.DateRange // Set capture date range
-	stacks    map[Key]Stack
+	dateRange  immich.DateRange // Set capture date range
+	stacks     map[Key]Stack
+	frames     map[string][]frame // photos with a precise date of capture by camera
+	livePhotos bool               // stack the photo and the video of live photos
+	motion     map[string]bool    // IDs of the motion photos
 }
 
 func NewStackBuilder() *StackBuilder {
 	sb := StackBuilder{
 		stacks: map[Key]Stack{},
+		frames: map[string][]frame{},
+		motion: map[string]bool{},
 	}
 	sb.dateRange.Set("1850-01-04,2030-01-01")
 
@@ -48,6 +75,13 @@ func NewStackBuilder() *StackBuilder {
 
 }
 
+// SetLivePhotos enables the stacking of live photos: a photo and a video with the same base name
+// taken at the same time. The photo is the cover of the stack.
+func (sb *StackBuilder) SetLivePhotos(enable bool) *StackBuilder {
+	sb.livePhotos = enable
+	return sb
+}
+
 func (sb *StackBuilder) ProcessAsset(ID string, fileName string, captureDate time.Time) {
 	if !sb.dateRange.InRange(captureDate) {
 		return
@@ -81,6 +115,16 @@ func (sb *StackBuilder) ProcessAsset(ID string, fileName string, captureDate tim
 		baseName: base,
 	}
 	s, ok := sb.stacks[k]
+	if !ok && !burst && sb.livePhotos {
+		// The video of a live photo starts slightly before the photo, and can fall in the next or previous minute
+		for _, d := range []time.Duration{-time.Minute, time.Minute} {
+			k2 := Key{date: k.date.Add(d), baseName: base}
+			if s2, ok2 := sb.stacks[k2]; ok2 && s2.Date.Sub(captureDate).Abs() <= liveWindow {
+				k, s, ok = k2, s2, true
+				break
+			}
+		}
+	}
 	if !ok {
 		s.CoverID = ID
 		s.Date = captureDate
@@ -98,6 +142,89 @@ func (sb *StackBuilder) ProcessAsset(ID string, fileName string, captureDate tim
 	sb.stacks[k] = s
 }
 
+// ProcessBurstAsset adds an asset using the burst information of its metadata:
+//   - the photos sharing a burst identifier are stacked whatever their names and dates
+//   - the photos named after a known burst pattern are stacked as by ProcessAsset
+//   - the photos of the same camera with sub-second dates taken less than a second apart are stacked,
+//     as done by the cameras shooting 10 frames per second
+//
+// Other assets are processed by ProcessAsset.
+func (sb *StackBuilder) ProcessBurstAsset(ID string, fileName string, captureDate time.Time, info BurstInfo) {
+	if !sb.dateRange.InRange(captureDate) {
+		return
+	}
+	if info.MotionPhoto {
+		sb.motion[ID] = true
+	}
+	switch {
+	case info.ID != "":
+		k := Key{baseName: "burst " + info.ID}
+		s, ok := sb.stacks[k]
+		if !ok || captureDate.Before(s.Date) {
+			// the first photo of the burst is the cover
+			s.CoverID, s.Date = ID, captureDate
+		}
+		s.IDs = append(s.IDs, ID)
+		s.Names = append(s.Names, path.Base(fileName))
+		s.StackType = StackBurst
+		sb.stacks[k] = s
+	case info.SubSecond && info.Camera != "" && !isBurstName(path.Base(fileName)):
+		sb.frames[info.Camera] = append(sb.frames[info.Camera], frame{ID: ID, fileName: fileName, date: captureDate})
+	default:
+		sb.ProcessAsset(ID, fileName, captureDate)
+	}
+}
+
+// groupFrames stacks the photos of each camera taken less than burstGap apart.
+// The photos sharing the same date, like the RAW and the JPEG of a shot, are processed by ProcessAsset.
+func (sb *StackBuilder) groupFrames() {
+	for camera, frames := range sb.frames {
+		sort.SliceStable(frames, func(i, j int) bool {
+			if !frames[i].date.Equal(frames[j].date) {
+				return frames[i].date.Before(frames[j].date)
+			}
+			return frames[i].fileName < frames[j].fileName
+		})
+		for start := 0; start < len(frames); {
+			end := start + 1
+			for end < len(frames) && frames[end].date.Sub(frames[end-1].date) <= burstGap {
+				end++
+			}
+			group := frames[start:end]
+			start = end
+			if !group[len(group)-1].date.After(group[0].date) {
+				for _, f := range group {
+					sb.ProcessAsset(f.ID, f.fileName, f.date)
+				}
+				continue
+			}
+			s := Stack{CoverID: group[0].ID, StackType: StackBurst, Date: group[0].date}
+			cover := false
+			for _, f := range group {
+				s.IDs = append(s.IDs, f.ID)
+				s.Names = append(s.Names, path.Base(f.fileName))
+				// the JPEG of the first shot is preferred to its RAW
+				ext := strings.ToLower(path.Ext(f.fileName))
+				if !cover && f.date.Equal(group[0].date) && slices.Contains([]string{".jpeg", ".jpg", ".jpe"}, ext) {
+					s.CoverID, cover = f.ID, true
+				}
+			}
+			sb.stacks[Key{date: s.Date, baseName: "burst " + camera}] = s
+		}
+	}
+	sb.frames = map[string][]frame{}
+}
+
+// isBurstName tells if the name follows the pattern of a known burst
+func isBurstName(name string) bool {
+	for _, matcherFn := range stackMatchers {
+		if isBurst, _, _ := matcherFn(name); isBurst {
+			return true
+		}
+	}
+	return false
+}
+
 // stackMatcher analyze the name and return
 // bool -> true when name is a part of burst
 // string -> base name of the burst
@@ -147,6 +274,7 @@ func nexusBurst(name string) (bool, string, bool) {
 }
 
 func (sb *StackBuilder) Stacks() []Stack {
+	sb.groupFrames()
 	keys := gen.MapFilterKeys(sb.stacks, func(i Stack) bool {
 		return len(i.IDs) > 1
 	})
@@ -155,27 +283,33 @@ func (sb *StackBuilder) Stacks() []Stack {
 	for _, k := range keys {
 		s := sb.stacks[k]
 
-		// Exclude live photos
+		// Exclude live photos, unless asked
 		hasPhoto := 0
 		hasVideo := 0
+		photoID := ""
 
-		for _, n := range s.Names {
+		for i, n := range s.Names {
 			mime, err := fshelper.MimeFromExt(path.Ext(n))
 			if err != nil {
 				continue
 			}
-			s := strings.Split(mime[0], "/")
-			switch s[0] {
+			m := strings.Split(mime[0], "/")
+			switch m[0] {
 			case "video":
 				hasVideo++
 			case "image":
 				hasPhoto++
+				photoID = s.IDs[i]
 			}
 		}
 
 		if hasPhoto == 1 && hasVideo == 1 {
-			// oh, a live photo!
-			continue
+			// oh, a live photo! Unless the photo already embeds its video
+			if !sb.livePhotos || sb.motion[photoID] {
+				continue
+			}
+			s.StackType = StackLivePhoto
+			s.CoverID = photoID
 		}
 
 		ids := gen.Filter(s.IDs, func(id string) bool {
@@ -219,3 +219,214 @@ func Test_Stack(t *testing.T) {
 
 	}
 }
+
+func Test_StackLivePhotos(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02 15:04:05", s)
+		return d
+	}
+	tc := []struct {
+		name  string
+		input []asset
+		want  []Stack
+	}{
+		{
+			name: "iPhone live photo",
+			input: []asset{
+				{ID: "1", FileName: "IMG_5580.MOV", DateTaken: date("2023-10-01 10:15:00")},
+				{ID: "2", FileName: "IMG_5580.HEIC", DateTaken: date("2023-10-01 10:15:00")},
+			},
+			want: []Stack{
+				{
+					CoverID:   "2",
+					IDs:       []string{"1"},
+					Date:      date("2023-10-01 10:15:00"),
+					Names:     []string{"IMG_5580.MOV", "IMG_5580.HEIC"},
+					StackType: StackLivePhoto,
+				},
+			},
+		},
+		{
+			name: "live photo across a minute",
+			input: []asset{
+				{ID: "1", FileName: "IMG_5581.HEIC", DateTaken: date("2023-10-01 10:15:31")},
+				{ID: "2", FileName: "IMG_5581.MOV", DateTaken: date("2023-10-01 10:15:29")},
+			},
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      date("2023-10-01 10:15:31"),
+					Names:     []string{"IMG_5581.HEIC", "IMG_5581.MOV"},
+					StackType: StackLivePhoto,
+				},
+			},
+		},
+		{
+			name: "same name, taken at different times",
+			input: []asset{
+				{ID: "1", FileName: "IMG_5582.HEIC", DateTaken: date("2023-10-01 10:15:31")},
+				{ID: "2", FileName: "IMG_5582.MOV", DateTaken: date("2023-10-01 10:16:45")},
+			},
+		},
+		{
+			name: "different names",
+			input: []asset{
+				{ID: "1", FileName: "IMG_5583.HEIC", DateTaken: date("2023-10-01 10:15:00")},
+				{ID: "2", FileName: "IMG_5584.MOV", DateTaken: date("2023-10-01 10:15:00")},
+			},
+		},
+		{
+			name: "JPG and MP4",
+			input: []asset{
+				{ID: "1", FileName: "PXL_20231006_063000139.jpg", DateTaken: date("2023-10-06 06:30:00")},
+				{ID: "2", FileName: "PXL_20231006_063000139.mp4", DateTaken: date("2023-10-06 06:30:01")},
+			},
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      date("2023-10-06 06:30:00"),
+					Names:     []string{"PXL_20231006_063000139.jpg", "PXL_20231006_063000139.mp4"},
+					StackType: StackLivePhoto,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := NewStackBuilder().SetLivePhotos(true)
+			for _, a := range tt.input {
+				sb.ProcessAsset(a.ID, a.FileName, a.DateTaken)
+			}
+
+			got := sb.Stacks()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("difference\n")
+				pretty.Ldiff(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_StackMotionPhoto(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	for _, motion := range []bool{false, true} {
+		sb := NewStackBuilder().SetLivePhotos(true)
+		sb.ProcessBurstAsset("1", "PXL_20231006_063000139.MP.jpg", date, BurstInfo{MotionPhoto: motion})
+		sb.ProcessBurstAsset("2", "PXL_20231006_063000139.mp4", date.Add(time.Second), BurstInfo{})
+		got := sb.Stacks()
+		// the motion photo embeds its video, the video having the same name is another clip
+		if motion && len(got) != 0 || !motion && len(got) != 1 {
+			t.Errorf("motion photo %v: unexpected stacks %+v", motion, got)
+		}
+	}
+}
+
+func Test_StackBurstInfo(t *testing.T) {
+	at := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02 15:04:05.000", s)
+		return d
+	}
+	type burstAsset struct {
+		asset
+		info BurstInfo
+	}
+	canon := BurstInfo{Camera: "Canon EOS R5", SubSecond: true}
+	tc := []struct {
+		name  string
+		input []burstAsset
+		want  []Stack
+	}{
+		{
+			name: "Canon at 10 fps, RAW and JPEG",
+			input: []burstAsset{
+				{asset{ID: "3", FileName: "3H2A0102.CR3", DateTaken: at("2023-10-06 08:31:21.100")}, canon},
+				{asset{ID: "1", FileName: "3H2A0101.CR3", DateTaken: at("2023-10-06 08:31:21.000")}, canon},
+				{asset{ID: "2", FileName: "3H2A0101.JPG", DateTaken: at("2023-10-06 08:31:21.000")}, canon},
+				{asset{ID: "4", FileName: "3H2A0102.JPG", DateTaken: at("2023-10-06 08:31:21.100")}, canon},
+				{asset{ID: "5", FileName: "3H2A0103.JPG", DateTaken: at("2023-10-06 08:31:21.200")}, canon},
+				// a photo taken later, and a photo of another camera
+				{asset{ID: "6", FileName: "3H2A0110.JPG", DateTaken: at("2023-10-06 08:31:25.000")}, canon},
+				{asset{ID: "7", FileName: "DSCF0001.JPG", DateTaken: at("2023-10-06 08:31:21.050")}, BurstInfo{Camera: "FUJIFILM X-T4", SubSecond: true}},
+			},
+			want: []Stack{
+				{
+					CoverID:   "2",
+					IDs:       []string{"1", "3", "4", "5"},
+					Date:      at("2023-10-06 08:31:21.000"),
+					Names:     []string{"3H2A0101.CR3", "3H2A0101.JPG", "3H2A0102.CR3", "3H2A0102.JPG", "3H2A0103.JPG"},
+					StackType: StackBurst,
+				},
+			},
+		},
+		{
+			name: "single shot RAW and JPEG",
+			input: []burstAsset{
+				{asset{ID: "1", FileName: "3H2A0101.CR3", DateTaken: at("2023-10-06 08:31:21.000")}, canon},
+				{asset{ID: "2", FileName: "3H2A0101.JPG", DateTaken: at("2023-10-06 08:31:21.000")}, canon},
+			},
+			want: []Stack{
+				{
+					CoverID:   "2",
+					IDs:       []string{"1"},
+					Date:      at("2023-10-06 08:31:21.000"),
+					Names:     []string{"3H2A0101.CR3", "3H2A0101.JPG"},
+					StackType: StackRawJpg,
+				},
+			},
+		},
+		{
+			name: "iPhone burst UUID",
+			input: []burstAsset{
+				{asset{ID: "2", FileName: "IMG_0005.HEIC", DateTaken: at("2023-10-06 09:00:03.900")}, BurstInfo{ID: "A4F3", Camera: "Apple iPhone 12", SubSecond: true}},
+				{asset{ID: "1", FileName: "IMG_0001.HEIC", DateTaken: at("2023-10-06 09:00:00.100")}, BurstInfo{ID: "A4F3", Camera: "Apple iPhone 12", SubSecond: true}},
+				{asset{ID: "3", FileName: "IMG_0009.HEIC", DateTaken: at("2023-10-06 09:00:05.500")}, BurstInfo{ID: "0B1C", Camera: "Apple iPhone 12", SubSecond: true}},
+			},
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      at("2023-10-06 09:00:00.100"),
+					Names:     []string{"IMG_0005.HEIC", "IMG_0001.HEIC"},
+					StackType: StackBurst,
+				},
+			},
+		},
+		{
+			name: "the burst names are preferred to the dates",
+			input: []burstAsset{
+				{asset{ID: "1", FileName: "20231207_101605_001.jpg", DateTaken: at("2023-12-07 10:16:05.000")}, BurstInfo{Camera: "samsung SM-G991B", SubSecond: true}},
+				{asset{ID: "2", FileName: "20231207_101605_002.jpg", DateTaken: at("2023-12-07 10:16:05.100")}, BurstInfo{Camera: "samsung SM-G991B", SubSecond: true}},
+				{asset{ID: "3", FileName: "20231207_101606.jpg", DateTaken: at("2023-12-07 10:16:05.900")}, BurstInfo{Camera: "samsung SM-G991B", SubSecond: true}},
+			},
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      at("2023-12-07 10:16:05.000"),
+					Names:     []string{"20231207_101605_001.jpg", "20231207_101605_002.jpg"},
+					StackType: StackBurst,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := NewStackBuilder()
+			for _, a := range tt.input {
+				sb.ProcessBurstAsset(a.ID, a.FileName, a.DateTaken, a.info)
+			}
+			got := sb.Stacks()
+			sort.Slice(got, func(i, j int) bool {
+				return got[i].CoverID < got[j].CoverID
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("difference\n")
+				pretty.Ldiff(t, tt.want, got)
+			}
+		})
+	}
+}
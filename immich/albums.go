@@ -8,10 +8,11 @@ import (
 type AlbumSimplified struct {
 	ID string `json:"id,omitempty"`
 	// OwnerID                    string    `json:"ownerId"`
-	AlbumName string `json:"albumName"`
+	AlbumName   string `json:"albumName"`
+	Description string `json:"description,omitempty"`
 	// CreatedAt                  time.Time `json:"createdAt"`
 	// UpdatedAt                  time.Time `json:"updatedAt"`
-	// AlbumThumbnailAssetID      string    `json:"albumThumbnailAssetId"`
+	AlbumThumbnailAssetID string `json:"albumThumbnailAssetId,omitempty"`
 	// SharedUsers                []string  `json:"sharedUsers"`
 	// Owner                      User      `json:"owner"`
 	// Shared                     bool      `json:"shared"`
@@ -75,6 +76,24 @@ func (ic *ImmichClient) GetAlbumInfo(ctx context.Context, id string) (AlbumConte
 	return album, err
 }
 
+// GetAlbumAssetIDs gives the IDs of the assets of the album, without decoding their description
+func (ic *ImmichClient) GetAlbumAssetIDs(ctx context.Context, id string) ([]string, error) {
+	var album struct {
+		Assets []struct {
+			ID string `json:"id"`
+		} `json:"assets"`
+	}
+	err := ic.newServerCall(ctx, "GetAlbumAssetIDs").do(get("/album/"+id, setAcceptJSON()), responseJSON(&album))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(album.Assets))
+	for _, a := range album.Assets {
+		ids = append(ids, a.ID)
+	}
+	return ids, nil
+}
+
 func (ic *ImmichClient) GetAssetsAlbums(ctx context.Context, id string) ([]AlbumSimplified, error) {
 	var albums []AlbumSimplified
 	err := ic.newServerCall(ctx, "GetAllAlbums").do(get("/album", setAcceptJSON()), responseJSON(&albums))
@@ -126,6 +145,59 @@ func (ic *ImmichClient) CreateAlbum(ctx context.Context, name string, assets []s
 	return r, nil
 }
 
+// SetAlbumCover sets the asset shown as the thumbnail of the album
+func (ic *ImmichClient) SetAlbumCover(ctx context.Context, albumID string, assetID string) error {
+	body := AlbumSimplified{
+		AlbumThumbnailAssetID: assetID,
+	}
+	return ic.newServerCall(ctx, "SetAlbumCover").do(
+		patch("/album/"+albumID, setAcceptJSON(), setJSONBody(body)))
+}
+
+// SetAlbumDescription replaces the description of the album
+func (ic *ImmichClient) SetAlbumDescription(ctx context.Context, albumID string, description string) error {
+	body := struct {
+		Description string `json:"description"`
+	}{Description: description}
+	return ic.newServerCall(ctx, "SetAlbumDescription").do(
+		patch("/album/"+albumID, setAcceptJSON(), setJSONBody(body)))
+}
+
+// AddUsersToAlbum shares the album with the users given by their ID
+func (ic *ImmichClient) AddUsersToAlbum(ctx context.Context, albumID string, userIDs []string) error {
+	body := struct {
+		SharedUserIDs []string `json:"sharedUserIds"`
+	}{SharedUserIDs: userIDs}
+	return ic.newServerCall(ctx, "AddUsersToAlbum").do(
+		put("/album/"+albumID+"/users", setAcceptJSON(), setJSONBody(body)))
+}
+
+// SharedLink is a link giving access to an album to anyone having it
+type SharedLink struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	URL string `json:"-"` // address of the shared album on the server
+}
+
+// CreateAlbumSharedLink creates a link giving access to the album, with its metadata and the download of its assets
+func (ic *ImmichClient) CreateAlbumSharedLink(ctx context.Context, albumID string) (SharedLink, error) {
+	body := struct {
+		Type          string `json:"type"`
+		AlbumID       string `json:"albumId"`
+		AllowDownload bool   `json:"allowDownload"`
+		ShowMetadata  bool   `json:"showMetadata"`
+	}{Type: "ALBUM", AlbumID: albumID, AllowDownload: true, ShowMetadata: true}
+	var l SharedLink
+	err := ic.newServerCall(ctx, "CreateAlbumSharedLink").do(
+		post("/shared-link", "application/json", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&l))
+	if err != nil {
+		return SharedLink{}, err
+	}
+	l.URL = ic.server + "/share/" + l.Key
+	return l, nil
+}
+
 func (ic *ImmichClient) GetAssetAlbums(ctx context.Context, id string) ([]AlbumSimplified, error) {
 	var r []AlbumSimplified
 	err := ic.newServerCall(ctx, "GetAssetAlbums").do(
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"net/textproto"
 	"net/url"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/ratelimit"
 )
 
 type AssetResponse struct {
@@ -35,13 +37,29 @@ func formatDuration(duration time.Duration) string {
 	return fmt.Sprintf("%02d:%02d:%02d.%06d", hours, minutes, seconds, milliseconds)
 }
 
+// AssetUpload streams the file and its sidecar to the server. The file is closed at the end of the upload.
+// The number of large files uploaded at the same time is limited by SetLargeUploadLimit.
 func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (AssetResponse, error) {
 	var ar AssetResponse
-	mtype, err := fshelper.MimeFromExt(path.Ext(la.FileName))
+	mtype, err := fshelper.MimeFromExt(la.Ext())
 	if err != nil {
 		return ar, err
 	}
 
+	if ic.largeUploads != nil && la.Size() >= ic.largeSize {
+		select {
+		case ic.largeUploads <- struct{}{}:
+		case <-ctx.Done():
+			return ar, ctx.Err()
+		}
+		defer func() { <-ic.largeUploads }()
+	}
+	defer la.Close()
+
+	if ic.useResumableUpload(ctx, la) {
+		return ic.resumableAssetUpload(ctx, la, mtype[0])
+	}
+
 	f, err := la.Open()
 	if err != nil {
 		return ar, (err)
@@ -49,32 +67,21 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 
 	body, pw := io.Pipe()
 	m := multipart.NewWriter(pw)
+	done := make(chan struct{})
 
 	go func() {
 		defer func() {
 			m.Close()
 			pw.Close()
+			close(done)
 		}()
 		s, err := f.Stat()
 		if err != nil {
 			return
 		}
-		assetType := strings.ToUpper(strings.Split(mtype[0], "/")[0])
-		ext := path.Ext(la.Title)
-		if strings.TrimSuffix(la.Title, ext) == "" {
-			la.Title = "No Name" + ext // fix #88, #128
+		for _, fv := range ic.uploadFields(la, s, mtype[0]) {
+			m.WriteField(fv.name, fv.value)
 		}
-
-		m.WriteField("deviceAssetId", fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size()))
-		m.WriteField("deviceId", ic.DeviceUUID)
-		m.WriteField("assetType", assetType)
-		m.WriteField("fileCreatedAt", la.DateTaken.Format(time.RFC3339))
-		m.WriteField("fileModifiedAt", s.ModTime().Format(time.RFC3339))
-		m.WriteField("isFavorite", myBool(la.Favorite).String())
-		m.WriteField("fileExtension", ext)
-		m.WriteField("duration", formatDuration(0))
-		m.WriteField("isReadOnly", "false")
-		// m.WriteField("isArchived", myBool(la.Archived).String()) // Not supported by the api
 		h := textproto.MIMEHeader{}
 		h.Set("Content-Disposition",
 			fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
@@ -85,7 +92,7 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 		if err != nil {
 			return
 		}
-		_, err = io.Copy(part, f)
+		_, err = io.Copy(part, ratelimit.NewReader(f, ic.uploadLimiter))
 		if err != nil {
 			return
 		}
@@ -127,7 +134,7 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 				return
 			}
 			defer sc.Close()
-			_, err = io.Copy(part, sc)
+			_, err = io.Copy(part, ratelimit.NewReader(sc, ic.uploadLimiter))
 			if err != nil {
 				return
 			}
@@ -135,13 +142,43 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 
 	}()
 
-	err = ic.newServerCall(ctx, "AssetUpload").
+	err = ic.newServerCall(ctx, "AssetUpload", setNoTimeout()).
 		do(post("/asset/upload", m.FormDataContentType(), setAcceptJSON(), setBody(body)), responseJSON(&ar))
 
+	// the writer stops when the server hasn't read the whole body, the file can be closed after it
+	body.Close()
+	<-done
 	return ar, err
 
 }
 
+// uploadField is a field of the upload request describing the asset
+type uploadField struct {
+	name  string
+	value string
+}
+
+// uploadFields gives the description of the asset sent with its content, in the order of the upload form
+func (ic *ImmichClient) uploadFields(la *browser.LocalAssetFile, s fs.FileInfo, mtype string) []uploadField {
+	assetType := strings.ToUpper(strings.Split(mtype, "/")[0])
+	ext := path.Ext(la.Title)
+	if strings.TrimSuffix(la.Title, ext) == "" {
+		la.Title = "No Name" + ext // fix #88, #128
+	}
+	return []uploadField{
+		{"deviceAssetId", fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size())},
+		{"deviceId", ic.DeviceUUID},
+		{"assetType", assetType},
+		{"fileCreatedAt", la.DateTaken.Format(time.RFC3339)},
+		{"fileModifiedAt", s.ModTime().Format(time.RFC3339)},
+		{"isFavorite", myBool(la.Favorite).String()},
+		{"fileExtension", ext},
+		{"duration", formatDuration(0)},
+		{"isReadOnly", "false"},
+		// {"isArchived", myBool(la.Archived).String()}, // Not supported by the api
+	}
+}
+
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
 
 func escapeQuotes(s string) string {
@@ -154,18 +191,35 @@ type GetAssetOptions struct {
 	IsArchived    bool
 	WithoutThumbs bool
 	Skip          string
+	UpdatedAfter  time.Time // Only the assets updated after this time, all when zero
+
+	Progress func(pages int, assets int) // Called after each page received with the running totals
 }
 
 func (o *GetAssetOptions) Values() url.Values {
 	if o == nil {
 		return url.Values{}
 	}
+	// Only the options that are set are sent to the server
 	v := url.Values{}
-	v.Add("userId", o.UserId)
-	v.Add("isFavorite", myBool(o.IsFavorite).String())
-	v.Add("isArchived", myBool(o.IsArchived).String())
-	v.Add("withoutThumbs", myBool(o.WithoutThumbs).String())
-	v.Add("skip", o.Skip)
+	if o.UserId != "" {
+		v.Add("userId", o.UserId)
+	}
+	if o.IsFavorite {
+		v.Add("isFavorite", myBool(o.IsFavorite).String())
+	}
+	if o.IsArchived {
+		v.Add("isArchived", myBool(o.IsArchived).String())
+	}
+	if o.WithoutThumbs {
+		v.Add("withoutThumbs", myBool(o.WithoutThumbs).String())
+	}
+	if o.Skip != "" {
+		v.Add("skip", o.Skip)
+	}
+	if !o.UpdatedAfter.IsZero() {
+		v.Add("updatedAfter", o.UpdatedAfter.UTC().Format(time.RFC3339Nano))
+	}
 	return v
 }
 
@@ -200,6 +254,17 @@ func (ic *ImmichClient) GetAllAssets(ctx context.Context, opt *GetAssetOptions)
 //
 // It calls the server for IMAGE, VIDEO, normal item, trashed Items
 func (ic *ImmichClient) GetAllAssetsWithFilter(ctx context.Context, opt *GetAssetOptions, filter func(*Asset)) error {
+	pages, assets := 0, 0
+	counter := func(a *Asset) {
+		assets++
+		filter(a)
+	}
+	onPage := func() {
+		pages++
+		if opt != nil && opt.Progress != nil {
+			opt.Progress(pages, assets)
+		}
+	}
 
 	for _, t := range []string{"IMAGE", "VIDEO", "AUDIO", "OTHER"} {
 		values := opt.Values()
@@ -207,12 +272,12 @@ func (ic *ImmichClient) GetAllAssetsWithFilter(ctx context.Context, opt *GetAsse
 		values.Set("withExif", "true")
 		values.Set("isVisible", "true")
 		values.Del("trashedBefore")
-		err := ic.newServerCall(ctx, "GetAllAssets", setPaginator("page", 1)).do(get("/assets", setUrlValues(values), setAcceptJSON()), responseJSONWithFilter(filter))
+		err := ic.newServerCall(ctx, "GetAllAssets", setPaginator("page", 1), setPageCallback(onPage)).do(get("/assets", setUrlValues(values), setAcceptJSON()), responseJSONWithFilter(counter))
 		if err != nil {
 			return err
 		}
 		values.Set("trashedBefore", "9999-01-01")
-		err = ic.newServerCall(ctx, "GetAllAssets", setPaginator("page", 1)).do(get("/assets", setUrlValues(values), setAcceptJSON()), responseJSONWithFilter(filter))
+		err = ic.newServerCall(ctx, "GetAllAssets", setPaginator("page", 1), setPageCallback(onPage)).do(get("/assets", setUrlValues(values), setAcceptJSON()), responseJSONWithFilter(counter))
 		if err != nil {
 			return err
 		}
@@ -239,6 +304,11 @@ func (ic *ImmichClient) GetAssetByID(ctx context.Context, id string) (*Asset, er
 	return &r, err
 }
 
+// DownloadAsset writes the original file of the asset into w
+func (ic *ImmichClient) DownloadAsset(ctx context.Context, id string, w io.Writer) error {
+	return ic.newServerCall(ctx, "DownloadAsset").do(get("/asset/file/"+id, setHeader("Accept", "application/octet-stream")), responseCopy(w))
+}
+
 func (ic *ImmichClient) UpdateAssets(ctx context.Context, IDs []string,
 	isArchived bool, isFavorite bool,
 	latitude float64, longitude float64,
@@ -265,6 +335,33 @@ func (ic *ImmichClient) UpdateAssets(ctx context.Context, IDs []string,
 	return ic.newServerCall(ctx, "updateAssets").do(put("/asset", setJSONBody(param)))
 }
 
+// AssetMetadataUpdate is the metadata changed by UpdateAssetsMetadata, the zero values leave the server's ones unchanged
+type AssetMetadataUpdate struct {
+	DateTimeOriginal time.Time // Date of capture
+	Latitude         float64   // GPS position, changed when one of the coordinates isn't 0
+	Longitude        float64
+	Favorite         bool // Marks the assets as favorites when true
+}
+
+// UpdateAssetsMetadata changes the date of capture, the GPS position or the favorite flag of the assets in one call,
+// their other properties are unchanged
+func (ic *ImmichClient) UpdateAssetsMetadata(ctx context.Context, IDs []string, m AssetMetadataUpdate) error {
+	param := struct {
+		IDs              []string `json:"ids"`
+		DateTimeOriginal string   `json:"dateTimeOriginal,omitempty"`
+		Latitude         *float64 `json:"latitude,omitempty"`
+		Longitude        *float64 `json:"longitude,omitempty"`
+		IsFavorite       bool     `json:"isFavorite,omitempty"`
+	}{IDs: IDs, IsFavorite: m.Favorite}
+	if !m.DateTimeOriginal.IsZero() {
+		param.DateTimeOriginal = m.DateTimeOriginal.Format(time.RFC3339)
+	}
+	if m.Latitude != 0 || m.Longitude != 0 {
+		param.Latitude, param.Longitude = &m.Latitude, &m.Longitude
+	}
+	return ic.newServerCall(ctx, "UpdateAssetsMetadata").do(put("/asset", setJSONBody(param)))
+}
+
 func (ic *ImmichClient) UpdateAsset(ctx context.Context, ID string, a *browser.LocalAssetFile) (*Asset, error) {
 
 	type updAsset struct {
@@ -286,6 +383,14 @@ func (ic *ImmichClient) UpdateAsset(ctx context.Context, ID string, a *browser.L
 	return &r, err
 }
 
+// SetAssetDescription sets the description of the asset, its other properties are unchanged
+func (ic *ImmichClient) SetAssetDescription(ctx context.Context, ID string, description string) error {
+	body := struct {
+		Description string `json:"description"`
+	}{Description: description}
+	return ic.newServerCall(ctx, "SetAssetDescription").do(put("/asset/"+ID, setJSONBody(body)))
+}
+
 func (ic *ImmichClient) StackAssets(ctx context.Context, coverID string, IDs []string) error {
 	cover, err := ic.GetAssetByID(ctx, coverID)
 	if err != nil {
@@ -0,0 +1,291 @@
+package immich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+// pagedServer serves 2 assets on the first page, and an empty list on the following ones
+type pagedServer struct{}
+
+func (ps *pagedServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	resp.WriteHeader(http.StatusOK)
+	if req.URL.Query().Get("page") == "1" {
+		resp.Write([]byte(`[{"id":"1"},{"id":"2"}]`))
+		return
+	}
+	resp.Write([]byte(`[]`))
+}
+
+func TestGetAllAssetsWithFilterProgress(t *testing.T) {
+	server := httptest.NewServer(&pagedServer{})
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := 0
+	lastPages, lastAssets := 0, 0
+	opt := &GetAssetOptions{
+		Progress: func(pages int, assets int) {
+			lastPages, lastAssets = pages, assets
+		},
+	}
+	err = ic.GetAllAssetsWithFilter(context.Background(), opt, func(*Asset) { received++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 asset types, visible and trashed
+	if lastPages != 8 {
+		t.Errorf("expected 8 pages, got %d", lastPages)
+	}
+	if lastAssets != 16 || received != 16 {
+		t.Errorf("expected 16 assets, got %d reported, %d received", lastAssets, received)
+	}
+}
+
+func TestDownloadAsset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/asset/file/ID1" {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp.Write([]byte("photo content"))
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := bytes.NewBuffer(nil)
+	err = ic.DownloadAsset(context.Background(), "ID1", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "photo content" {
+		t.Errorf("unexpected content %q", b.String())
+	}
+
+	err = ic.DownloadAsset(context.Background(), "ID2", io.Discard)
+	if err == nil {
+		t.Errorf("expected an error for an unknown asset")
+	}
+}
+
+func TestImportAsset(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/server-info/version":
+			resp.Write([]byte(`{"major":1,"minor":88,"patch":2}`))
+		case "/api/asset/import":
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				resp.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			resp.Write([]byte(`{"id":"ID1","duplicate":false}`))
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	v, err := ic.GetServerVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "v1.88.2" || !v.AtLeast(ExternalLibraryVersion) || v.AtLeast(ServerVersion{Major: 1, Minor: 88, Patch: 3}) || !v.AtLeast(ServerVersion{Minor: 99}) {
+		t.Errorf("unexpected comparisons of the version %s", v)
+	}
+
+	la := &browser.LocalAssetFile{FileName: "2023/photo.jpg", Title: "photo.jpg", FileSize: 12, Favorite: true}
+	ar, err := ic.ImportAsset(ctx, la, AssetImport{LibraryID: "LIB", AssetPath: "/mnt/photos/2023/photo.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.ID != "ID1" {
+		t.Errorf("unexpected response %+v", ar)
+	}
+	for k, v := range map[string]any{"libraryId": "LIB", "assetPath": "/mnt/photos/2023/photo.jpg", "deviceAssetId": "photo.jpg-12", "isFavorite": true, "isReadOnly": true} {
+		if body[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, body[k])
+		}
+	}
+	if _, ok := body["sidecarPath"]; ok {
+		t.Error("the sidecar path should be omitted")
+	}
+}
+
+func TestSetAssetDescription(t *testing.T) {
+	var body map[string]any
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		method, path = req.Method, req.URL.Path
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.Write([]byte(`{"id":"ID1"}`))
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ic.SetAssetDescription(context.Background(), "ID1", "2023/trip/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/api/asset/ID1" {
+		t.Errorf("unexpected call %s %s", method, path)
+	}
+	if len(body) != 1 || body["description"] != "2023/trip/photo.jpg" {
+		t.Errorf("only the description should be sent, got %v", body)
+	}
+}
+
+func TestUpdateAssetsMetadata(t *testing.T) {
+	var body map[string]any
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		method, path = req.Method, req.URL.Path
+		body = nil
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	tc := []struct {
+		name string
+		m    AssetMetadataUpdate
+		want map[string]any
+	}{
+		{name: "date", m: AssetMetadataUpdate{DateTimeOriginal: d}, want: map[string]any{"dateTimeOriginal": "2023-10-06T06:30:00Z"}},
+		{name: "gps", m: AssetMetadataUpdate{Latitude: 48.85, Longitude: 0}, want: map[string]any{"latitude": 48.85, "longitude": 0.0}},
+		{name: "favorite", m: AssetMetadataUpdate{Favorite: true}, want: map[string]any{"isFavorite": true}},
+		{name: "both", m: AssetMetadataUpdate{DateTimeOriginal: d, Latitude: 1, Longitude: 2}, want: map[string]any{"dateTimeOriginal": "2023-10-06T06:30:00Z", "latitude": 1.0, "longitude": 2.0}},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			err = ic.UpdateAssetsMetadata(context.Background(), []string{"ID1", "ID2"}, c.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != http.MethodPut || path != "/api/asset" {
+				t.Errorf("unexpected call %s %s", method, path)
+			}
+			if fmt.Sprint(body["ids"]) != "[ID1 ID2]" {
+				t.Errorf("unexpected ids %v", body["ids"])
+			}
+			got := map[string]any{}
+			for k, v := range body {
+				if k != "ids" {
+					got[k] = v
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+// countingFS counts the files open at the same time
+type countingFS struct {
+	fstest.MapFS
+	mut     sync.Mutex
+	open    int
+	maxOpen int
+}
+
+type countedFile struct {
+	fs.File
+	fsys *countingFS
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.open++
+	c.maxOpen = max(c.maxOpen, c.open)
+	return &countedFile{File: f, fsys: c}, nil
+}
+
+func (f *countedFile) Close() error {
+	f.fsys.mut.Lock()
+	f.fsys.open--
+	f.fsys.mut.Unlock()
+	return f.File.Close()
+}
+
+func TestLargeUploadLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = io.Copy(io.Discard, req.Body)
+		resp.Write([]byte(`{"id":"ID"}`))
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.SetLargeUploadLimit(1000, 2)
+
+	fsys := &countingFS{MapFS: fstest.MapFS{}}
+	for i := 0; i < 8; i++ {
+		fsys.MapFS[fmt.Sprintf("large%d.mp4", i)] = &fstest.MapFile{Data: make([]byte, 2000)}
+	}
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("large%d.mp4", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			la := &browser.LocalAssetFile{FSys: fsys, FileName: name, Title: name, FileSize: 2000}
+			_, err := ic.AssetUpload(context.Background(), la)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fsys.maxOpen != 2 || fsys.open != 0 {
+		t.Errorf("expected at most 2 files open and all closed, got %d at most and %d still open", fsys.maxOpen, fsys.open)
+	}
+}
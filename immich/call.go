@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 type TooManyInternalError struct {
@@ -29,6 +32,8 @@ type serverCall struct {
 	err      error
 	ctx      context.Context
 	p        *paginator
+	onPage   func() // called after each page received
+	noLimit  bool   // the call isn't limited by the client's timeout
 }
 
 type serverCallOption func(sc *serverCall) error
@@ -41,6 +46,57 @@ type callError struct {
 	status   int
 	err      error
 	message  *ServerMessage
+	http     error // *HTTPError or *RateLimitError when the server answered with an error status
+}
+
+// HTTPError is returned when the server answers with an error status.
+// It's found in the errors of the client with errors.As.
+type HTTPError struct {
+	StatusCode int
+	Message    *ServerMessage // the explanation given by the server, nil when none
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Transient reports whether the call may succeed when retried: a server error (5xx), or a server too busy (429)
+func (e *HTTPError) Transient() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// RateLimitError is returned when the server rejects the call because it is overloaded (429).
+// errors.As finds its HTTPError too.
+type RateLimitError struct {
+	HTTPError
+	RetryAfter time.Duration // delay requested by the server with the header Retry-After, 0 when not given
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return &e.HTTPError
+}
+
+// newHTTPError gives the error of the server's response, nil when its status isn't an error
+func newHTTPError(resp *http.Response, msg *ServerMessage) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	he := HTTPError{StatusCode: resp.StatusCode, Message: msg}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return &he
+	}
+	return &RateLimitError{HTTPError: he, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+}
+
+// retryAfter reads the header Retry-After, given in seconds or as a date
+func retryAfter(h string) time.Duration {
+	if s, err := strconv.Atoi(h); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t).Round(time.Second), 0)
+	}
+	return 0
 }
 
 type ServerMessage struct {
@@ -54,6 +110,47 @@ func (u callError) Is(target error) bool {
 	return ok
 }
 
+func (ce callError) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{ce.err, ce.http} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// IsTransientError reports whether the error is likely to disappear when the call is retried:
+// a server error (5xx), a server too busy (429), a timeout or a connection broken by the network.
+// Other client errors (4xx) are definitive.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.Transient()
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsTooManyRequests reports whether the server has rejected the call because it is overloaded (429).
+// The delay requested by the server, if any, is returned.
+func IsTooManyRequests(err error) (bool, time.Duration) {
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		return true, rle.RetryAfter
+	}
+	return false, 0
+}
+
 func (ce callError) Error() string {
 	b := strings.Builder{}
 	b.WriteString(ce.endPoint)
@@ -110,6 +207,7 @@ func (sc *serverCall) Err(req *http.Request, resp *http.Response, msg *ServerMes
 	}
 	if resp != nil {
 		ce.status = resp.StatusCode
+		ce.http = newHTTPError(resp, msg)
 	}
 	ce.message = msg
 	return ce
@@ -145,6 +243,21 @@ func setPaginator(pageParameter string, startPage int) serverCallOption {
 	}
 }
 
+func setPageCallback(fn func()) serverCallOption {
+	return func(sc *serverCall) error {
+		sc.onPage = fn
+		return nil
+	}
+}
+
+// setNoTimeout frees the call from the client's timeout, the context limits it
+func setNoTimeout() serverCallOption {
+	return func(sc *serverCall) error {
+		sc.noLimit = true
+		return nil
+	}
+}
+
 type requestFunction func(sc *serverCall) *http.Request
 
 func (sc *serverCall) request(method string, url string, opts ...serverRequestOption) *http.Request {
@@ -196,6 +309,15 @@ func put(url string, opts ...serverRequestOption) requestFunction {
 		return sc.request(http.MethodPut, sc.ic.endPoint+url, opts...)
 	}
 }
+
+func patch(url string, opts ...serverRequestOption) requestFunction {
+	return func(sc *serverCall) *http.Request {
+		if sc.err != nil {
+			return nil
+		}
+		return sc.request(http.MethodPatch, sc.ic.endPoint+url, opts...)
+	}
+}
 func (sc *serverCall) do(fnRequest requestFunction, opts ...serverResponseOption) error {
 	if sc.err != nil || fnRequest == nil {
 		return sc.Err(nil, nil, nil)
@@ -210,6 +332,9 @@ func (sc *serverCall) do(fnRequest requestFunction, opts ...serverResponseOption
 		if err != nil {
 			return err
 		}
+		if sc.onPage != nil && !sc.p.EOF {
+			sc.onPage()
+		}
 		sc.p.nextPage()
 	}
 	return nil
@@ -235,7 +360,13 @@ func (sc *serverCall) _callDo(fnRequest requestFunction, opts ...serverResponseO
 		setTraceJSONRequest()(sc, req)
 	}
 
-	resp, err = sc.ic.client.Do(req)
+	client := sc.ic.client
+	if sc.noLimit && client.Timeout > 0 {
+		c := *client
+		c.Timeout = 0
+		client = &c
+	}
+	resp, err = client.Do(req)
 
 	// any non nil error must be returned
 	if err != nil {
@@ -355,6 +486,17 @@ func responseJSON[T any](object *T) serverResponseOption {
 	}
 }
 
+func responseCopy(w io.Writer) serverResponseOption {
+	return func(sc *serverCall, resp *http.Response) error {
+		if resp != nil && resp.Body != nil {
+			defer resp.Body.Close()
+			_, err := io.Copy(w, resp.Body)
+			return sc.joinError(err)
+		}
+		return errors.New("can't read nil response")
+	}
+}
+
 func responseAccumulateJSON[T any](acc *[]T) serverResponseOption {
 	return func(sc *serverCall, resp *http.Response) error {
 		if sc.p != nil {
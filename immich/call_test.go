@@ -2,9 +2,15 @@ package immich
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type testServer struct {
@@ -90,3 +96,236 @@ func TestCall(t *testing.T) {
 	}
 
 }
+
+func TestIsTransientError(t *testing.T) {
+	tt := []struct {
+		name      string
+		status    int
+		transient bool
+	}{
+		{name: "bad gateway", status: http.StatusBadGateway, transient: true},
+		{name: "internal error", status: http.StatusInternalServerError, transient: true},
+		{name: "bad request", status: http.StatusBadRequest, transient: false},
+		{name: "unauthorized", status: http.StatusUnauthorized, transient: false},
+	}
+
+	for _, tst := range tt {
+		t.Run(tst.name, func(t *testing.T) {
+			server := httptest.NewServer(&testServer{responseStatus: tst.status})
+			defer server.Close()
+			ic, err := NewImmichClient(server.URL, "1234", false)
+			if err != nil {
+				t.Fail()
+				return
+			}
+			r := map[string]string{}
+			err = ic.newServerCall(context.Background(), tst.name).do(get("/assets", setAcceptJSON()), responseJSON(&r))
+			if err == nil {
+				t.Errorf("expected error, but no error")
+				return
+			}
+			if got := IsTransientError(err); got != tst.transient {
+				t.Errorf("IsTransientError() = %v, want %v", got, tst.transient)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		resp.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.SetTimeout(20 * time.Millisecond)
+
+	r := map[string]string{}
+	err = ic.newServerCall(context.Background(), "slow").do(get("/assets", setAcceptJSON()), responseJSON(&r))
+	if err == nil || !IsTransientError(err) {
+		t.Errorf("expected a transient timeout error, got %v", err)
+	}
+	err = ic.newServerCall(context.Background(), "upload", setNoTimeout()).do(get("/assets", setAcceptJSON()), responseJSON(&r))
+	if err != nil {
+		t.Errorf("the call without timeout should succeed, got %v", err)
+	}
+	if ic.Timeout() != 20*time.Millisecond {
+		t.Errorf("the client's timeout has changed: %s", ic.Timeout())
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var newConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte(`{}`))
+	}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const maxConns = 4
+	ic.SetMaxConnsPerHost(maxConns)
+
+	const workers, calls = 16, 20
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				r := map[string]string{}
+				err := ic.newServerCall(context.Background(), "reuse").do(get("/assets", setAcceptJSON()), responseJSON(&r))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := newConns.Load(); n > maxConns {
+		t.Errorf("expected at most %d connections, got %d", maxConns, n)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(resp, `{"proto":%q}`, req.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for _, enabled := range []bool{false, true} {
+		ic, err := NewImmichClient(server.URL, "1234", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ic.EnableHTTP2(enabled)
+		r := map[string]string{}
+		err = ic.newServerCall(context.Background(), "proto").do(get("/assets", setAcceptJSON()), responseJSON(&r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "HTTP/1.1"
+		if enabled {
+			expected = "HTTP/2.0"
+		}
+		if r["proto"] != expected {
+			t.Errorf("HTTP/2 enabled %v: expected %s, got %s", enabled, expected, r["proto"])
+		}
+	}
+}
+
+func TestIsTooManyRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Retry-After", "3")
+		resp.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := map[string]string{}
+	err = ic.newServerCall(context.Background(), "busy").do(get("/assets", setAcceptJSON()), responseJSON(&r))
+	busy, retryAfter := IsTooManyRequests(err)
+	if !busy {
+		t.Errorf("IsTooManyRequests() = false, want true")
+	}
+	if retryAfter != 3*time.Second {
+		t.Errorf("expected a retry after 3s, got %s", retryAfter)
+	}
+	if !IsTransientError(err) {
+		t.Errorf("IsTransientError() = false, want true")
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	tt := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		rateLimit  bool
+		wait       time.Duration
+		transient  bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "bad request", status: http.StatusBadRequest, body: `{"error": "Bad Request", "statusCode": "400", "message": ["ids must be an array"]}`},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "too many requests", status: http.StatusTooManyRequests, rateLimit: true, transient: true},
+		{name: "retry after seconds", status: http.StatusTooManyRequests, retryAfter: "3", rateLimit: true, wait: 3 * time.Second, transient: true},
+		{name: "retry after date", status: http.StatusTooManyRequests, retryAfter: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), rateLimit: true, wait: time.Minute, transient: true},
+		{name: "retry after past date", status: http.StatusTooManyRequests, retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", rateLimit: true, transient: true},
+		{name: "internal error", status: http.StatusInternalServerError, transient: true},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, retryAfter: "3", transient: true},
+	}
+	for _, tst := range tt {
+		t.Run(tst.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if tst.retryAfter != "" {
+					resp.Header().Set("Retry-After", tst.retryAfter)
+				}
+				resp.WriteHeader(tst.status)
+				resp.Write([]byte(tst.body))
+			}))
+			defer server.Close()
+			ic, err := NewImmichClient(server.URL, "1234", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ic.newServerCall(context.Background(), tst.name).do(get("/assets"))
+			var he *HTTPError
+			var rle *RateLimitError
+			if tst.status < 300 {
+				if err != nil || errors.As(err, &he) {
+					t.Errorf("no error expected, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &he) {
+				t.Fatalf("expected an *HTTPError, got %#v", err)
+			}
+			if he.StatusCode != tst.status {
+				t.Errorf("expected the status %d, got %d", tst.status, he.StatusCode)
+			}
+			if tst.body != "" && (he.Message == nil || he.Message.Error != "Bad Request") {
+				t.Errorf("expected the message of the server, got %v", he.Message)
+			}
+			if errors.As(err, &rle) != tst.rateLimit {
+				t.Fatalf("expected a *RateLimitError %v, got %#v", tst.rateLimit, err)
+			}
+			if rle != nil && (rle.RetryAfter < tst.wait-2*time.Second || rle.RetryAfter > tst.wait) {
+				t.Errorf("expected a retry after %s, got %s", tst.wait, rle.RetryAfter)
+			}
+			if he.Transient() != tst.transient || IsTransientError(err) != tst.transient {
+				t.Errorf("expected transient %v, got %v", tst.transient, he.Transient())
+			}
+		})
+	}
+
+	// the network errors have no status
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {}))
+	server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ic.newServerCall(context.Background(), "closed").do(get("/assets"))
+	var he *HTTPError
+	if err == nil || errors.As(err, &he) {
+		t.Errorf("expected a network error, got %#v", err)
+	}
+}
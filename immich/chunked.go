@@ -0,0 +1,365 @@
+package immich
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/ratelimit"
+)
+
+/*
+	The resumable uploads follow the tus protocol v1.0.0 (https://tus.io/protocols/resumable-upload)
+	with its creation extension, on the endpoint /upload of the API.
+
+	They are used only for the files above the threshold, and only when the server advertises
+	the protocol in its answer to OPTIONS /upload. The other servers receive the files in one request.
+	The server gives the ID of the asset in the JSON body of the response to the last chunk.
+*/
+
+// tusVersion is the version of the resumable upload protocol
+const tusVersion = "1.0.0"
+
+// DefaultChunkSize is the size of the chunks of the resumable uploads
+const DefaultChunkSize = 32 * 1024 * 1024
+
+// ChunkedUpload configures the resumable uploads of the large files
+type ChunkedUpload struct {
+	Threshold int64        // Size of the files uploaded by chunks, 0 to always upload the files in one request
+	ChunkSize int64        // Size of each chunk (Default: DefaultChunkSize)
+	State     *UploadState // Uploads in progress, nil to keep them in memory only
+}
+
+// SetChunkedUpload enables the resumable uploads of the files above the threshold,
+// on the servers supporting them
+func (ic *ImmichClient) SetChunkedUpload(c ChunkedUpload) *ImmichClient {
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	if c.State == nil {
+		c.State, _ = OpenUploadState("")
+	}
+	ic.chunked = c
+	return ic
+}
+
+// ChunkedUpload gives the settings of the resumable uploads
+func (ic *ImmichClient) ChunkedUpload() ChunkedUpload {
+	return ic.chunked
+}
+
+// resumableSupport keeps the answer of the server to OPTIONS /upload
+type resumableSupport struct {
+	mut       sync.Mutex
+	checked   bool
+	supported bool
+	maxSize   int64 // Largest upload accepted by the server, 0 when not given
+}
+
+// supportsResumableUpload asks once to the server if it supports the resumable uploads.
+// The question is asked again after an error of the network.
+func (ic *ImmichClient) supportsResumableUpload(ctx context.Context) (bool, int64) {
+	rs := &ic.resumable
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	if rs.checked {
+		return rs.supported, rs.maxSize
+	}
+	var h http.Header
+	err := ic.newServerCall(ctx, "UploadOptions").
+		do(onUpload(http.MethodOptions, ic.endPoint+"/upload"), responseUpload(&h, nil))
+	var he *HTTPError
+	if err != nil && !errors.As(err, &he) {
+		return false, 0
+	}
+	rs.checked = true
+	if err != nil || !headerHasValue(h.Get("Tus-Version"), tusVersion) || !headerHasValue(h.Get("Tus-Extension"), "creation") {
+		return false, 0
+	}
+	rs.supported = true
+	rs.maxSize, _ = strconv.ParseInt(h.Get("Tus-Max-Size"), 10, 64)
+	return rs.supported, rs.maxSize
+}
+
+// headerHasValue tells if the comma separated list of the header contains the value
+func headerHasValue(header string, value string) bool {
+	for _, v := range strings.Split(header, ",") {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// useResumableUpload tells if the file is uploaded by chunks.
+// The files with a sidecar are uploaded in one request with their sidecar.
+func (ic *ImmichClient) useResumableUpload(ctx context.Context, la *browser.LocalAssetFile) bool {
+	if ic.chunked.Threshold <= 0 || la.SideCar != nil || la.Size() < ic.chunked.Threshold {
+		return false
+	}
+	ok, maxSize := ic.supportsResumableUpload(ctx)
+	return ok && (maxSize == 0 || la.Size() <= maxSize)
+}
+
+// resumableAssetUpload uploads the file by chunks. The offset reached is kept in the upload state after each chunk,
+// and the next attempt for the same file resumes the upload from the offset known by the server.
+func (ic *ImmichClient) resumableAssetUpload(ctx context.Context, la *browser.LocalAssetFile, mtype string) (AssetResponse, error) {
+	var ar AssetResponse
+	f, err := la.Open()
+	if err != nil {
+		return ar, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		return ar, err
+	}
+	fields := ic.uploadFields(la, s, mtype)
+	key := fmt.Sprintf("%s|%s|%d", ic.endPoint, fields[0].value, s.ModTime().Unix())
+	state := ic.chunked.State
+
+	up, found, err := ic.resumeUpload(ctx, key)
+	if err != nil {
+		return ar, err
+	}
+	if !found {
+		up, err = ic.createUpload(ctx, la, s, mtype, fields)
+		if err != nil {
+			return ar, err
+		}
+		err = state.set(key, up)
+		if err != nil {
+			return ar, err
+		}
+	}
+
+	if up.Offset > 0 {
+		_, err = io.CopyN(io.Discard, f, up.Offset)
+		if err != nil {
+			return ar, err
+		}
+	}
+
+	for up.Offset < s.Size() {
+		n := min(ic.chunked.ChunkSize, s.Size()-up.Offset)
+		var h http.Header
+		err = ic.newServerCall(ctx, "AssetUploadChunk", setNoTimeout()).
+			do(onUpload(http.MethodPatch, up.URL,
+				setContentType("application/offset+octet-stream"),
+				setHeader("Upload-Offset", strconv.FormatInt(up.Offset, 10)),
+				setContentLength(n),
+				setBody(io.NopCloser(io.LimitReader(ratelimit.NewReader(f, ic.uploadLimiter), n)))),
+				responseUpload(&h, &ar))
+		if err != nil {
+			return ar, err
+		}
+		offset, err := strconv.ParseInt(h.Get("Upload-Offset"), 10, 64)
+		if err != nil || offset != up.Offset+n {
+			// the next attempt asks the offset to the server
+			return ar, fmt.Errorf("resumable upload of %q: the server has received %q bytes, expected %d", la.FileName, h.Get("Upload-Offset"), up.Offset+n)
+		}
+		up.Offset = offset
+		if up.Offset < s.Size() {
+			err = state.set(key, up)
+			if err != nil {
+				return ar, err
+			}
+		}
+	}
+
+	err = state.remove(key)
+	if ar.ID == "" {
+		return ar, errors.Join(fmt.Errorf("resumable upload of %q: the server hasn't given the ID of the asset", la.FileName), err)
+	}
+	return ar, err
+}
+
+// resumeUpload gives the upload of the file in progress, with the offset reached according to the server.
+// An upload unknown by the server is forgotten.
+func (ic *ImmichClient) resumeUpload(ctx context.Context, key string) (resumableUpload, bool, error) {
+	up, found := ic.chunked.State.get(key)
+	if !found {
+		return up, false, nil
+	}
+	var h http.Header
+	err := ic.newServerCall(ctx, "AssetUploadOffset").
+		do(onUpload(http.MethodHead, up.URL), responseUpload(&h, nil))
+	var he *HTTPError
+	if errors.As(err, &he) && (he.StatusCode == http.StatusNotFound || he.StatusCode == http.StatusGone || he.StatusCode == http.StatusForbidden) {
+		return up, false, ic.chunked.State.remove(key)
+	}
+	if err != nil {
+		return up, false, err
+	}
+	up.Offset, err = strconv.ParseInt(h.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return up, false, ic.chunked.State.remove(key)
+	}
+	return up, true, nil
+}
+
+// createUpload registers the upload of the file on the server, and gives the URL receiving its chunks
+func (ic *ImmichClient) createUpload(ctx context.Context, la *browser.LocalAssetFile, s fs.FileInfo, mtype string, fields []uploadField) (resumableUpload, error) {
+	var up resumableUpload
+	metadata := []string{
+		"filename " + base64.StdEncoding.EncodeToString([]byte(path.Base(la.Title))),
+		"filetype " + base64.StdEncoding.EncodeToString([]byte(mtype)),
+	}
+	for _, fv := range fields {
+		metadata = append(metadata, fv.name+" "+base64.StdEncoding.EncodeToString([]byte(fv.value)))
+	}
+
+	var h http.Header
+	u := ic.endPoint + "/upload"
+	err := ic.newServerCall(ctx, "AssetUploadCreate").
+		do(onUpload(http.MethodPost, u,
+			setHeader("Upload-Length", strconv.FormatInt(s.Size(), 10)),
+			setHeader("Upload-Metadata", strings.Join(metadata, ","))),
+			responseUpload(&h, nil))
+	if err != nil {
+		return up, err
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return up, err
+	}
+	location, err := base.Parse(h.Get("Location"))
+	if err != nil || h.Get("Location") == "" {
+		return up, fmt.Errorf("resumable upload of %q: the server hasn't given the upload URL", la.FileName)
+	}
+	up.URL = location.String()
+	return up, nil
+}
+
+// onUpload calls the given URL of the resumable uploads, with the version of the protocol
+func onUpload(method string, u string, opts ...serverRequestOption) requestFunction {
+	return func(sc *serverCall) *http.Request {
+		if sc.err != nil {
+			return nil
+		}
+		if method != http.MethodOptions {
+			opts = append([]serverRequestOption{setHeader("Tus-Resumable", tusVersion)}, opts...)
+		}
+		return sc.request(method, u, opts...)
+	}
+}
+
+func setContentLength(n int64) serverRequestOption {
+	return func(sc *serverCall, req *http.Request) error {
+		req.ContentLength = n
+		return nil
+	}
+}
+
+// responseUpload gives the headers of the response, and decodes the asset given in JSON, if any
+func responseUpload(h *http.Header, ar *AssetResponse) serverResponseOption {
+	return func(sc *serverCall, resp *http.Response) error {
+		if resp == nil {
+			return errors.New("can't read nil response")
+		}
+		*h = resp.Header
+		if resp.Body == nil {
+			return nil
+		}
+		defer resp.Body.Close()
+		if ar != nil && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			return sc.joinError(json.NewDecoder(resp.Body).Decode(ar))
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+}
+
+// resumableUpload is an upload in progress
+type resumableUpload struct {
+	URL    string `json:"url"`    // URL receiving the chunks
+	Offset int64  `json:"offset"` // Bytes received by the server
+}
+
+// UploadState keeps the resumable uploads in progress, to resume them after an error or in the next run.
+// The uploads are identified by the server, the file name, its size and its modification time.
+type UploadState struct {
+	mut     sync.Mutex
+	name    string
+	uploads map[string]resumableUpload
+}
+
+// OpenUploadState reads the uploads in progress kept in the file name.
+// A missing file gives no upload, an empty name keeps the uploads in memory only.
+func OpenUploadState(name string) (*UploadState, error) {
+	s := &UploadState{name: name, uploads: map[string]resumableUpload{}}
+	if name == "" {
+		return s, nil
+	}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &s.uploads)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *UploadState) get(key string) (resumableUpload, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	up, ok := s.uploads[key]
+	return up, ok
+}
+
+func (s *UploadState) set(key string, up resumableUpload) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.uploads[key] = up
+	return s.save()
+}
+
+func (s *UploadState) remove(key string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, ok := s.uploads[key]; !ok {
+		return nil
+	}
+	// the builtin delete is shadowed by the request function of the package
+	maps.DeleteFunc(s.uploads, func(k string, _ resumableUpload) bool { return k == key })
+	return s.save()
+}
+
+// save writes the file, replacing the previous one only when complete
+func (s *UploadState) save() error {
+	if s.name == "" {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(s.name), 0o755)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(s.uploads)
+	if err != nil {
+		return err
+	}
+	tmp := s.name + ".tmp"
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.name)
+}
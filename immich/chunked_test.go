@@ -0,0 +1,170 @@
+package immich
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+// tusServer implements the resumable uploads when supported is set, and the upload in one request
+type tusServer struct {
+	mut       sync.Mutex
+	supported bool
+	failPatch int // number of the PATCH failing with a server error, 0 for none
+	patches   int
+	created   int
+	singles   int
+	length    int64
+	metadata  string
+	data      bytes.Buffer
+}
+
+func (ts *tusServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	ts.mut.Lock()
+	defer ts.mut.Unlock()
+	switch {
+	case req.URL.Path == "/api/asset/upload" && req.Method == http.MethodPost:
+		ts.singles++
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(http.StatusCreated)
+		resp.Write([]byte(`{"id":"single"}`))
+	case !ts.supported:
+		resp.WriteHeader(http.StatusNotFound)
+	case req.URL.Path == "/api/upload" && req.Method == http.MethodOptions:
+		resp.Header().Set("Tus-Resumable", tusVersion)
+		resp.Header().Set("Tus-Version", tusVersion)
+		resp.Header().Set("Tus-Extension", "creation, termination")
+		resp.WriteHeader(http.StatusNoContent)
+	case req.URL.Path == "/api/upload" && req.Method == http.MethodPost:
+		ts.created++
+		ts.length, _ = strconv.ParseInt(req.Header.Get("Upload-Length"), 10, 64)
+		ts.metadata = req.Header.Get("Upload-Metadata")
+		ts.data.Reset()
+		resp.Header().Set("Location", "upload/1")
+		resp.WriteHeader(http.StatusCreated)
+	case req.URL.Path == "/api/upload/1" && req.Method == http.MethodHead:
+		resp.Header().Set("Upload-Offset", strconv.Itoa(ts.data.Len()))
+		resp.WriteHeader(http.StatusOK)
+	case req.URL.Path == "/api/upload/1" && req.Method == http.MethodPatch:
+		ts.patches++
+		b, _ := io.ReadAll(req.Body)
+		if req.Header.Get("Tus-Resumable") != tusVersion || req.Header.Get("Upload-Offset") != strconv.Itoa(ts.data.Len()) {
+			resp.WriteHeader(http.StatusConflict)
+			return
+		}
+		if ts.patches == ts.failPatch {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		ts.data.Write(b)
+		resp.Header().Set("Upload-Offset", strconv.Itoa(ts.data.Len()))
+		if int64(ts.data.Len()) == ts.length {
+			resp.Header().Set("Content-Type", "application/json")
+			resp.Write([]byte(`{"id":"resumed"}`))
+			return
+		}
+		resp.WriteHeader(http.StatusNoContent)
+	default:
+		resp.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10))
+	fsys := fstest.MapFS{
+		"video.mp4": {Data: content},
+		"small.mp4": {Data: content[:20]},
+	}
+	asset := func(name string) *browser.LocalAssetFile {
+		return &browser.LocalAssetFile{FSys: fsys, FileName: name, Title: name, FileSize: len(fsys[name].Data)}
+	}
+	ts := &tusServer{supported: true, failPatch: 3}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	stateFile := filepath.Join(t.TempDir(), "uploads.json")
+	newClient := func() *ImmichClient {
+		ic, err := NewImmichClient(server.URL, "1234", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state, err := OpenUploadState(stateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ic.SetChunkedUpload(ChunkedUpload{Threshold: 50, ChunkSize: 30, State: state})
+	}
+	ctx := context.Background()
+
+	// the third chunk fails, the offset reached is kept for the next run
+	_, err := newClient().AssetUpload(ctx, asset("video.mp4"))
+	if !IsTransientError(err) {
+		t.Fatalf("expected a server error, got %v", err)
+	}
+	b, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"offset":60`) {
+		t.Errorf("the state should keep the offset 60, got %s", b)
+	}
+	if !strings.Contains(ts.metadata, "deviceAssetId "+base64.StdEncoding.EncodeToString([]byte("video.mp4-100"))) {
+		t.Errorf("unexpected metadata %q", ts.metadata)
+	}
+
+	// the upload resumes after the 60 bytes received
+	ar, err := newClient().AssetUpload(ctx, asset("video.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.ID != "resumed" || ts.created != 1 || ts.patches != 5 || !bytes.Equal(ts.data.Bytes(), content) {
+		t.Errorf("unexpected upload: %+v, %d creations, %d chunks, content %q", ar, ts.created, ts.patches, ts.data.String())
+	}
+	b, _ = os.ReadFile(stateFile)
+	if string(b) != "{}" {
+		t.Errorf("the completed upload should be removed from the state, got %s", b)
+	}
+
+	// the small files are uploaded in one request
+	ar, err = newClient().AssetUpload(ctx, asset("small.mp4"))
+	if err != nil || ar.ID != "single" || ts.singles != 1 {
+		t.Errorf("the small file should be uploaded in one request, got %+v, %v", ar, err)
+	}
+}
+
+func TestResumableUploadNotSupported(t *testing.T) {
+	ts := &tusServer{}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic.SetChunkedUpload(ChunkedUpload{Threshold: 10})
+
+	fsys := fstest.MapFS{"video.mp4": {Data: []byte(strings.Repeat("0123456789", 10))}}
+	for i := 0; i < 2; i++ {
+		la := &browser.LocalAssetFile{FSys: fsys, FileName: "video.mp4", Title: "video.mp4", FileSize: 100}
+		ar, err := ic.AssetUpload(context.Background(), la)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ar.ID != "single" {
+			t.Errorf("expected the upload in one request, got %+v", ar)
+		}
+	}
+	if ts.singles != 2 || ts.created != 0 {
+		t.Errorf("unexpected calls: %d uploads in one request, %d resumable uploads", ts.singles, ts.created)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"sync"
 	"time"
+
+	"github.com/simulot/immich-go/helpers/ratelimit"
 )
 
 /*
@@ -17,12 +20,23 @@ Immich API documentation https://documentation.immich.app/docs/api/introduction
 
 type ImmichClient struct {
 	client       *http.Client
+	server       string        // Server url, without the API
 	endPoint     string        // Server API url
 	key          string        // User KEY
 	DeviceUUID   string        // Device
 	Retries      int           // Number of attempts on 500 errors
 	RetriesDelay time.Duration // Duration between retries
 	ApiTrace     bool
+
+	uploadLimiter *ratelimit.Limiter // Limit the upload bandwidth, shared by all uploads
+	largeSize     int64              // Size of the files counted by largeUploads
+	largeUploads  chan struct{}      // Large files being uploaded, nil for no limit
+
+	chunked   ChunkedUpload // Settings of the resumable uploads
+	resumable resumableSupport
+
+	capabilitiesLock sync.Mutex
+	capabilities     *ServerCapabilities // read once by GetServerCapabilities
 }
 
 func (ic *ImmichClient) SetEndPoint(endPoint string) *ImmichClient {
@@ -30,6 +44,11 @@ func (ic *ImmichClient) SetEndPoint(endPoint string) *ImmichClient {
 	return ic
 }
 
+// EndPoint gives the URL of the server's API
+func (ic *ImmichClient) EndPoint() string {
+	return ic.endPoint
+}
+
 func (ic *ImmichClient) SetDeviceUUID(deviceUUID string) *ImmichClient {
 	ic.DeviceUUID = deviceUUID
 	return ic
@@ -40,6 +59,88 @@ func (ic *ImmichClient) EnableAppTrace(state bool) *ImmichClient {
 	return ic
 }
 
+// SetUploadRateLimit limits the bandwidth used by all uploads to the given bytes per second
+func (ic *ImmichClient) SetUploadRateLimit(bytesPerSecond int) *ImmichClient {
+	if bytesPerSecond > 0 {
+		ic.uploadLimiter = ratelimit.NewLimiter(bytesPerSecond)
+	} else {
+		ic.uploadLimiter = nil
+	}
+	return ic
+}
+
+// DefaultLargeUploadSize is the size of the files whose concurrent uploads are limited
+const DefaultLargeUploadSize = 256 * 1024 * 1024
+
+// DefaultLargeUploads is the number of large files uploaded at the same time
+const DefaultLargeUploads = 2
+
+// SetLargeUploadLimit limits to n the files of at least size bytes uploaded at the same time,
+// whatever the number of concurrent calls to AssetUpload. The other uploads wait. 0 for no limit.
+func (ic *ImmichClient) SetLargeUploadLimit(size int64, n int) *ImmichClient {
+	ic.largeSize = size
+	ic.largeUploads = nil
+	if n > 0 {
+		ic.largeUploads = make(chan struct{}, n)
+	}
+	return ic
+}
+
+// SetTimeout limits the duration of the calls to the server, 0 for no limit.
+// The uploads aren't limited, their duration depends on the size of the file.
+func (ic *ImmichClient) SetTimeout(timeout time.Duration) *ImmichClient {
+	ic.client.Timeout = timeout
+	return ic
+}
+
+// Timeout gives the limit of the duration of the calls to the server
+func (ic *ImmichClient) Timeout() time.Duration {
+	return ic.client.Timeout
+}
+
+// DefaultMaxIdleConnsPerHost is the number of idle connections kept open with the server to be reused
+// by the next calls, enough for the uploads and the albums updated in parallel.
+const DefaultMaxIdleConnsPerHost = 16
+
+// SetMaxConnsPerHost limits the number of connections with the server, 0 for no limit.
+// The idle connections are kept up to the limit, so the calls reuse them instead of opening new ones.
+func (ic *ImmichClient) SetMaxConnsPerHost(n int) *ImmichClient {
+	t := ic.transport()
+	t.MaxConnsPerHost = n
+	t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	if n > 0 {
+		t.MaxIdleConnsPerHost = n
+	}
+	return ic
+}
+
+// MaxConnsPerHost gives the limit of the number of connections with the server
+func (ic *ImmichClient) MaxConnsPerHost() int {
+	return ic.transport().MaxConnsPerHost
+}
+
+// EnableHTTP2 lets the client use HTTP/2 with the servers supporting it over TLS.
+// All calls then share the same connection.
+func (ic *ImmichClient) EnableHTTP2(state bool) *ImmichClient {
+	t := ic.transport()
+	t.ForceAttemptHTTP2 = state
+	t.TLSNextProto = nil
+	if !state {
+		// an empty map disables HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return ic
+}
+
+// HTTP2 tells if the client uses HTTP/2 when the server supports it
+func (ic *ImmichClient) HTTP2() bool {
+	return ic.transport().ForceAttemptHTTP2
+}
+
+func (ic *ImmichClient) transport() *http.Transport {
+	return ic.client.Transport.(*http.Transport)
+}
+
 // Create a new ImmichClient
 func NewImmichClient(endPoint string, key string, sslVerify bool) (*ImmichClient, error) {
 	var err error
@@ -49,12 +150,14 @@ func NewImmichClient(endPoint string, key string, sslVerify bool) (*ImmichClient
 	}
 
 	// Create a custom HTTP client with SSL verification disabled
-	transportOptions := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: sslVerify},
-	}
+	transportOptions := http.DefaultTransport.(*http.Transport).Clone()
+	transportOptions.TLSClientConfig = &tls.Config{InsecureSkipVerify: sslVerify}
+	transportOptions.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	transportOptions.ForceAttemptHTTP2 = false
 	tlsClient := &http.Client{Transport: transportOptions}
 
 	ic := ImmichClient{
+		server:       endPoint,
 		endPoint:     endPoint + "/api",
 		key:          key,
 		client:       tlsClient,
@@ -62,6 +165,7 @@ func NewImmichClient(endPoint string, key string, sslVerify bool) (*ImmichClient
 		Retries:      1,
 		RetriesDelay: time.Second * 1,
 	}
+	ic.SetLargeUploadLimit(DefaultLargeUploadSize, DefaultLargeUploads)
 
 	return &ic, nil
 }
@@ -92,6 +196,13 @@ func (ic *ImmichClient) ValidateConnection(ctx context.Context) (User, error) {
 	return user, nil
 }
 
+// GetAllUsers gives the users of the server
+func (ic *ImmichClient) GetAllUsers(ctx context.Context) ([]User, error) {
+	var users []User
+	err := ic.newServerCall(ctx, "GetAllUsers").do(get("/user", setAcceptJSON()), responseJSON(&users))
+	return users, err
+}
+
 type ServerStatistics struct {
 	Photos      int   `json:"photos"`
 	Videos      int   `json:"videos"`
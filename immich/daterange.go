@@ -2,6 +2,7 @@ package immich
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -9,9 +10,20 @@ import (
 type DateRange struct {
 	After, Before         time.Time
 	day, month, year, set bool
+	open                  bool // set by SetBounds, a zero bound isn't checked
 }
 
 func (dr DateRange) String() string {
+	if dr.open {
+		s := ""
+		if !dr.After.IsZero() {
+			s = "after " + dr.After.Format(time.RFC3339)
+		}
+		if !dr.Before.IsZero() {
+			s = strings.TrimSpace(s + " before " + dr.Before.Format(time.RFC3339))
+		}
+		return s
+	}
 	if dr.day {
 		return dr.After.Format("2006-01-02")
 	} else if dr.month {
@@ -64,10 +76,16 @@ func (dr *DateRange) Set(s string) (err error) {
 
 func (dr DateRange) IsSet() bool { return dr.set }
 
+// SetBounds sets the range to the dates from after included to before excluded.
+// A zero date leaves the range open on its side.
+func (dr *DateRange) SetBounds(after, before time.Time) {
+	*dr = DateRange{After: after, Before: before, set: !after.IsZero() || !before.IsZero(), open: true}
+}
+
 func (dr DateRange) InRange(d time.Time) bool {
 	if !dr.set || d.IsZero() {
 		return true
 	}
 	//	--------------After----------d------------Before
-	return (d.Compare(dr.After) >= 0 && dr.Before.Compare(d) > 0)
+	return d.Compare(dr.After) >= 0 && (dr.Before.Compare(d) > 0 || dr.open && dr.Before.IsZero())
 }
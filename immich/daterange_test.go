@@ -166,3 +166,36 @@ func TestDateRange_InRange(t *testing.T) {
 		})
 	}
 }
+
+func TestDateRange_SetBounds(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		after, before time.Time
+		date          time.Time
+		want          bool
+	}{
+		{after: day(10), date: day(9), want: false},
+		{after: day(10), date: day(10), want: true},
+		{after: day(10), date: day(31).AddDate(10, 0, 0), want: true},
+		{before: day(10), date: day(10), want: false},
+		{before: day(10), date: day(1).AddDate(-50, 0, 0), want: true},
+		{after: day(1), before: day(10), date: day(5), want: true},
+		{after: day(1), before: day(10), date: day(10), want: false},
+	}
+	for _, tt := range tests {
+		var dr DateRange
+		dr.SetBounds(tt.after, tt.before)
+		if !dr.IsSet() {
+			t.Errorf("%s: the range should be set", dr)
+		}
+		if got := dr.InRange(tt.date); got != tt.want {
+			t.Errorf("%s: InRange(%s) = %v, want %v", dr, tt.date, got, tt.want)
+		}
+	}
+
+	var dr DateRange
+	dr.SetBounds(time.Time{}, time.Time{})
+	if dr.IsSet() {
+		t.Error("the range without bounds shouldn't be set")
+	}
+}
@@ -0,0 +1,81 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+// ServerVersion is the version of the immich server
+type ServerVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast tells if the version is the version min or a later one
+func (v ServerVersion) AtLeast(min ServerVersion) bool {
+	if v.Major != min.Major {
+		return v.Major > min.Major
+	}
+	if v.Minor != min.Minor {
+		return v.Minor > min.Minor
+	}
+	return v.Patch >= min.Patch
+}
+
+// ExternalLibraryVersion is the first version of the server able to import the assets of an external library one by one
+var ExternalLibraryVersion = ServerVersion{Major: 1, Minor: 79}
+
+// GetServerVersion gives the version of the server
+func (ic *ImmichClient) GetServerVersion(ctx context.Context) (ServerVersion, error) {
+	var v ServerVersion
+	err := ic.newServerCall(ctx, "GetServerVersion").do(get("/server-info/version", setAcceptJSON()), responseJSON(&v))
+	return v, err
+}
+
+// AssetImport gives the paths of the asset's files as seen by the server, and the external library receiving them
+type AssetImport struct {
+	LibraryID   string
+	AssetPath   string
+	SidecarPath string // Empty when the asset has no sidecar file
+}
+
+// ImportAsset registers a file of the server as an asset of an external library, instead of uploading its content.
+// The file stays in place, the server reads it from the given path.
+func (ic *ImmichClient) ImportAsset(ctx context.Context, la *browser.LocalAssetFile, imp AssetImport) (AssetResponse, error) {
+	var ar AssetResponse
+	body := struct {
+		AssetPath      string `json:"assetPath"`
+		SidecarPath    string `json:"sidecarPath,omitempty"`
+		LibraryID      string `json:"libraryId"`
+		DeviceAssetID  string `json:"deviceAssetId"`
+		DeviceID       string `json:"deviceId"`
+		FileCreatedAt  string `json:"fileCreatedAt"`
+		FileModifiedAt string `json:"fileModifiedAt"`
+		IsFavorite     bool   `json:"isFavorite"`
+		IsReadOnly     bool   `json:"isReadOnly"`
+		Duration       string `json:"duration"`
+	}{
+		AssetPath:      imp.AssetPath,
+		SidecarPath:    imp.SidecarPath,
+		LibraryID:      imp.LibraryID,
+		DeviceAssetID:  fmt.Sprintf("%s-%d", path.Base(la.Title), la.Size()),
+		DeviceID:       ic.DeviceUUID,
+		FileCreatedAt:  la.DateTaken.Format(time.RFC3339),
+		FileModifiedAt: la.ModTime().Format(time.RFC3339),
+		IsFavorite:     la.Favorite,
+		IsReadOnly:     true,
+		Duration:       formatDuration(0),
+	}
+	err := ic.newServerCall(ctx, "ImportAsset").
+		do(post("/asset/import", "application/json", setAcceptJSON(), setJSONBody(body)), responseJSON(&ar))
+	return ar, err
+}
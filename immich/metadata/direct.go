@@ -12,6 +12,11 @@ import (
 type MetaData struct {
 	DateTaken                     time.Time
 	Latitude, Longitude, Altitude float64
+	Orientation                   int    // EXIF orientation, 0 when unknown
+	SubSecond                     bool   // DateTaken includes the sub-seconds of the capture
+	Camera                        string // Make and model of the camera
+	BurstID                       string // Identifier shared by the photos of a burst, when the camera writes one
+	Rating                        int    // Rating from 1 to 5 stars given by an XMP file, 0 when unknown
 }
 
 func GetFileMetaData(fsys fs.FS, name string) (MetaData, error) {
@@ -35,45 +40,56 @@ func GetFromReader(rd io.Reader, ext string) (MetaData, error) {
 	r := newSliceReader(rd)
 	meta := MetaData{}
 	var err error
-	var dateTaken time.Time
 	switch strings.ToLower(ext) {
 	case ".heic", ".heif":
-		dateTaken, err = readHEIFDateTaken(r)
-	case ".jpg", ".jpeg", ".dng", ".cr2":
-		dateTaken, err = readExifDateTaken(r)
+		meta, err = readHEIFMetaData(r)
+	case ".jpg", ".jpeg", ".tif", ".tiff", ".dng", ".cr2", ".nef", ".nrw", ".arw", ".sr2", ".srf", ".pef", ".srw", ".erf", ".3fr", ".iiq", ".dcr", ".kdc":
+		meta, err = readExifMetaData(r)
+	case ".raf", ".orf", ".rw2", ".rwl":
+		meta, err = readEmbeddedExifMetaData(r)
 	case ".mp4", ".mov":
-		dateTaken, err = readMP4DateTaken(r)
+		meta.DateTaken, err = readMP4DateTaken(r)
 	case ".cr3":
-		dateTaken, err = readCR3DateTaken(r)
+		meta.DateTaken, err = readCR3DateTaken(r)
 	default:
 		err = fmt.Errorf("can't determine the taken date from metadata (%s)", ext)
 	}
-	meta.DateTaken = dateTaken
 	return meta, err
 }
 
-// readExifDateTaken pase the file for Exif DateTaken
-func readExifDateTaken(r io.Reader) (time.Time, error) {
-
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+// readExifMetaData parse the file for Exif DateTaken and GPS position
+func readExifMetaData(r io.Reader) (MetaData, error) {
+	return getExifFromReader(r)
 }
 
 const searchBufferSize = 32 * 1024
 
-// readHEIFDateTaken locate the Exif part and return the date of capture
-func readHEIFDateTaken(r *sliceReader) (time.Time, error) {
+// readHEIFMetaData locate the Exif part and return the date of capture and the GPS position
+func readHEIFMetaData(r *sliceReader) (MetaData, error) {
 	b := make([]byte, searchBufferSize)
 	r, err := searchPattern(r, []byte{0x45, 0x78, 0x69, 0x66, 0, 0, 0x4d, 0x4d}, b)
 	if err != nil {
-		return time.Time{}, err
+		return MetaData{}, err
 	}
 
 	filler := make([]byte, 6)
 	r.Read(filler)
 
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+	return getExifFromReader(r)
+}
+
+// maxExifSize is the maximum size of an EXIF block embedded in a JPEG APP1 segment
+const maxExifSize = 64 * 1024
+
+// readEmbeddedExifMetaData locate the Exif block of the JPEG preview embedded in some RAW files,
+// and return the date of capture and the GPS position
+func readEmbeddedExifMetaData(r *sliceReader) (MetaData, error) {
+	b := make([]byte, searchBufferSize)
+	r, err := searchPattern(r, []byte{'E', 'x', 'i', 'f', 0, 0}, b)
+	if err != nil {
+		return MetaData{}, err
+	}
+	return getExifFromReader(io.LimitReader(r, maxExifSize))
 }
 
 // readMP4DateTaken locate the mvhd atom and decode the date of capture
@@ -1,9 +1,12 @@
 package metadata
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +30,21 @@ func getExifFromReader(r io.Reader) (MetaData, error) {
 		return md, fmt.Errorf("can't get DateTaken: %w", err)
 	}
 
+	if lat, long, err := x.LatLong(); err == nil {
+		md.Latitude, md.Longitude = lat, long
+	}
+	if t, err := x.Get(exif.Orientation); err == nil {
+		if o, err := t.Int(0); err == nil {
+			md.Orientation = o
+		}
+	}
+	camMake, _ := getTagSting(x, exif.Make)
+	model, _ := getTagSting(x, exif.Model)
+	md.Camera = strings.TrimSpace(camMake + " " + strings.TrimSpace(strings.TrimPrefix(model, camMake)))
+	if t, err := x.Get(exif.MakerNote); err == nil && strings.EqualFold(camMake, "Apple") {
+		md.BurstID = appleBurstID(t.Val)
+	}
+
 	tag, err := getTagSting(x, exif.GPSDateStamp)
 	if err == nil {
 		md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05Z", tag, local)
@@ -36,6 +54,9 @@ func getExifFromReader(r io.Reader) (MetaData, error) {
 		if err == nil {
 			md.DateTaken, err = time.ParseInLocation("2006:01:02 15:04:05", tag, local)
 		}
+		if err == nil {
+			md.DateTaken, md.SubSecond = addSubSeconds(x, md.DateTaken)
+		}
 	}
 	if err != nil {
 		tag, err = getTagSting(x, exif.DateTime)
@@ -47,6 +68,54 @@ func getExifFromReader(r io.Reader) (MetaData, error) {
 	return md, err
 }
 
+// addSubSeconds adds the SubSecTimeOriginal tag to the date of capture.
+// The tag gives the decimals of the second: "35" means 0.35s.
+func addSubSeconds(x *exif.Exif, t time.Time) (time.Time, bool) {
+	s, err := getTagSting(x, exif.SubSecTimeOriginal)
+	s = strings.TrimSpace(s)
+	if err != nil || s == "" || len(s) > 9 {
+		return t, false
+	}
+	ns, err := strconv.Atoi(s + strings.Repeat("0", 9-len(s)))
+	if err != nil || ns < 0 {
+		return t, false
+	}
+	return t.Add(time.Duration(ns)), true
+}
+
+// appleBurstID reads the BurstUUID tag (0x000b) of the Apple maker note.
+// The note starts with "Apple iOS", a version, the byte order, and an IFD
+// whose offsets are relative to the start of the note.
+func appleBurstID(mn []byte) string {
+	if len(mn) < 16 || !bytes.HasPrefix(mn, []byte("Apple iOS\x00")) {
+		return ""
+	}
+	var bo binary.ByteOrder = binary.BigEndian
+	if string(mn[12:14]) == "II" {
+		bo = binary.LittleEndian
+	}
+	n := int(bo.Uint16(mn[14:]))
+	for i := 0; i < n; i++ {
+		e := 16 + 12*i
+		if e+12 > len(mn) {
+			return ""
+		}
+		if bo.Uint16(mn[e:]) != 0x000b || bo.Uint16(mn[e+2:]) != 2 {
+			continue
+		}
+		count := int(bo.Uint32(mn[e+4:]))
+		start := e + 8
+		if count > 4 {
+			start = int(bo.Uint32(mn[e+8:]))
+		}
+		if start < 0 || start+count > len(mn) {
+			return ""
+		}
+		return strings.TrimRight(string(mn[start:start+count]), "\x00")
+	}
+	return ""
+}
+
 func getTagSting(x *exif.Exif, tagName exif.FieldName) (string, error) {
 	t, err := x.Get(tagName)
 	if err != nil {
@@ -0,0 +1,91 @@
+package metadata
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+func TestExifFormats(t *testing.T) {
+	jpg, err := os.ReadFile("TEST_DATA/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff := jpg[bytes.Index(jpg, []byte("II*\x00")) : len(jpg)-2]
+	// the RAF and ORF files contain a JPEG preview with the EXIF of the photo
+	raf := append([]byte("FUJIFILMCCD-RAW 0201FF383501"), make([]byte, 100)...)
+	raf = append(raf, jpg...)
+	orf := append([]byte("IIRO\x08\x00\x00\x00"), make([]byte, 40000)...)
+	orf = append(orf, jpg...)
+
+	os.Setenv("TZ", "Europe/Paris")
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2023, 10, 6, 8, 31, 21, 0, local)
+
+	tests := []struct {
+		ext  string
+		data []byte
+	}{
+		{ext: ".jpg", data: jpg},
+		{ext: ".tif", data: tiff},
+		{ext: ".NEF", data: tiff},
+		{ext: ".arw", data: tiff},
+		{ext: ".raf", data: raf},
+		{ext: ".orf", data: orf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			md, err := GetFromReader(bytes.NewReader(tt.data), tt.ext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !md.DateTaken.Equal(want) {
+				t.Errorf("expected date %s, got %s", want, md.DateTaken)
+			}
+			if math.Abs(md.Latitude-48.8584) > 1e-3 || math.Abs(md.Longitude-2.2945) > 1e-3 {
+				t.Errorf("unexpected GPS position %f,%f", md.Latitude, md.Longitude)
+			}
+		})
+	}
+}
+
+func TestExifBurst(t *testing.T) {
+	os.Setenv("TZ", "Europe/Paris")
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		file    string
+		camera  string
+		date    time.Time
+		burstID string
+	}{
+		{file: "TEST_DATA/burst_canon.jpg", camera: "Canon EOS R5", date: time.Date(2023, 10, 6, 8, 31, 21, 350_000_000, local)},
+		{file: "TEST_DATA/burst_iphone.jpg", camera: "Apple iPhone 12", date: time.Date(2023, 10, 6, 8, 31, 21, 604_000_000, local), burstID: "A4F3B5C8-2E1D-4C5B-9E3A-7F6D8C9B0A1E"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			md, err := GetFileMetaData(os.DirFS("."), tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !md.DateTaken.Equal(tt.date) || !md.SubSecond {
+				t.Errorf("expected the date %s, got %s (sub-second %v)", tt.date, md.DateTaken, md.SubSecond)
+			}
+			if md.Camera != tt.camera {
+				t.Errorf("expected the camera %q, got %q", tt.camera, md.Camera)
+			}
+			if md.BurstID != tt.burstID {
+				t.Errorf("expected the burst ID %q, got %q", tt.burstID, md.BurstID)
+			}
+		})
+	}
+}
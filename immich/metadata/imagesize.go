@@ -0,0 +1,35 @@
+package metadata
+
+import (
+	"image"
+	_ "image/gif"  // register the GIF decoder for image.DecodeConfig
+	_ "image/jpeg" // register the JPEG decoder for image.DecodeConfig
+	_ "image/png"  // register the PNG decoder for image.DecodeConfig
+	"io"
+	"strings"
+)
+
+// CanReadImageSize tells if ImageSize can read the dimensions of the files with the extension ext
+func CanReadImageSize(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// ImageSize gives the dimensions in pixels of the image read from r.
+// Only the header of the image is read.
+func ImageSize(r io.Reader) (width, height int, err error) {
+	c, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return c.Width, c.Height, nil
+}
+
+// DecodeImage decodes the whole image read from r. A truncated image gives io.ErrUnexpectedEOF.
+func DecodeImage(r io.Reader) error {
+	_, _, err := image.Decode(r)
+	return err
+}
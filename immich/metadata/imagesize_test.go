@@ -0,0 +1,28 @@
+package metadata
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestImageSize(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	err := png.Encode(b, image.NewGray(image.Rect(0, 0, 40, 30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h, err := ImageSize(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 40 || h != 30 {
+		t.Errorf("ImageSize() = %dx%d, want 40x30", w, h)
+	}
+
+	_, _, err = ImageSize(bytes.NewReader([]byte("not an image")))
+	if err == nil {
+		t.Error("ImageSize() should fail on a file that isn't an image")
+	}
+}
@@ -0,0 +1,34 @@
+package metadata
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// motionPhotoHead is the part of the file searched for the XMP packet of a motion photo.
+// The XMP segment of a JPEG follows the EXIF one, each of them being at most 64KB long.
+const motionPhotoHead = 256 * 1024
+
+// motionPhotoRE matches the XMP properties written by the Google and Samsung cameras in the
+// motion photos, as attribute or as element. The value 0 tells the video has been removed.
+var motionPhotoRE = regexp.MustCompile(`(?:MotionPhoto|MicroVideo)(?:="|>)1\b`)
+
+// CanBeMotionPhoto tells if the files with the extension ext can embed a video
+func CanBeMotionPhoto(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg", ".heic", ".heif":
+		return true
+	}
+	return false
+}
+
+// IsMotionPhoto tells if the photo read from r embeds a video, like the motion photos of
+// the Pixel and Samsung phones. Only the beginning of the file is read.
+func IsMotionPhoto(r io.Reader) (bool, error) {
+	b, err := io.ReadAll(io.LimitReader(r, motionPhotoHead))
+	if err != nil {
+		return false, err
+	}
+	return motionPhotoRE.Match(b), nil
+}
@@ -0,0 +1,31 @@
+package metadata
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsMotionPhoto(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected bool
+	}{
+		{name: "TEST_DATA/motion_google.MP.jpg", expected: true},
+		{name: "TEST_DATA/motion_samsung.jpg", expected: true},
+		{name: "TEST_DATA/motion_off.jpg", expected: false},
+		{name: "TEST_DATA/exif.jpg", expected: false},
+	} {
+		f, err := os.Open(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := IsMotionPhoto(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expected {
+			t.Errorf("IsMotionPhoto(%s) = %v, want %v", c.name, got, c.expected)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/fs"
@@ -11,14 +12,23 @@ import (
 )
 
 // SideCar
+// The GPS position is written only when known, a position at 0,0 is omitted.
 type SideCar struct {
 	FileName string
 	OnFSsys  bool
 
 	DateTaken time.Time
+	TimeZone  *time.Location // Zone of the date of capture written in the sidecar, the local zone when nil
 	Latitude  float64
 	Longitude float64
 	Elevation float64
+
+	// Optional fields, written only when known
+	Description string
+	Rating      int      // 1 to 5 stars
+	Keywords    []string // keywords or tags
+	People      []string // names of the persons in the image
+	Orientation int      // EXIF orientation, 1 to 8
 }
 
 func cmpFloats(a, b float64) int {
@@ -57,16 +67,72 @@ func (sc *SideCar) Bytes() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-var sidecarTemplate = template.Must(template.New("xmp").Parse(`<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.56'>
+// wallClock gives the date of capture in the zone of the sidecar
+func wallClock(sc *SideCar) time.Time {
+	if sc.TimeZone != nil {
+		return sc.DateTaken.In(sc.TimeZone)
+	}
+	return sc.DateTaken.Local()
+}
+
+// xmlText escapes the text for XML
+func xmlText(s string) (string, error) {
+	b := bytes.NewBuffer(nil)
+	err := xml.EscapeText(b, []byte(s))
+	return b.String(), err
+}
+
+var sidecarTemplate = template.Must(template.New("xmp").Funcs(template.FuncMap{"xml": xmlText, "wallClock": wallClock}).Parse(`<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.56'>
 <rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
  <rdf:Description rdf:about=''
   xmlns:exif='http://ns.adobe.com/exif/1.0/'>
   <exif:ExifVersion>0232</exif:ExifVersion>
-  <exif:DateTimeOriginal>{{((.DateTaken).Local).Format "2006-01-02T15:04:05"}}</exif:DateTimeOriginal>
+  <exif:DateTimeOriginal>{{(wallClock .).Format "2006-01-02T15:04:05"}}</exif:DateTimeOriginal>
+{{- if or .Latitude .Longitude}}
   <exif:GPSAltitude>{{.Elevation}}</exif:GPSAltitude>
   <exif:GPSLatitude>{{.Latitude}}</exif:GPSLatitude>
-  <exif:GPSLongitude>{{.Longitude}}</exif:GPSLongitude>  
+  <exif:GPSLongitude>{{.Longitude}}</exif:GPSLongitude>
+{{- end}}
   <exif:GPSTimeStamp>{{((.DateTaken).UTC).Format "2006-01-02T15:04:05+0000"}}</exif:GPSTimeStamp>
  </rdf:Description>
+{{- if or .Description .Rating .Keywords .People .Orientation}}
+ <rdf:Description rdf:about=''
+  xmlns:dc='http://purl.org/dc/elements/1.1/'
+  xmlns:xmp='http://ns.adobe.com/xap/1.0/'
+  xmlns:tiff='http://ns.adobe.com/tiff/1.0/'
+  xmlns:Iptc4xmpExt='http://iptc.org/std/Iptc4xmpExt/2008-02-29/'>
+{{- if .Description}}
+  <dc:description>
+   <rdf:Alt>
+    <rdf:li xml:lang='x-default'>{{xml .Description}}</rdf:li>
+   </rdf:Alt>
+  </dc:description>
+{{- end}}
+{{- if .Keywords}}
+  <dc:subject>
+   <rdf:Bag>
+{{- range .Keywords}}
+    <rdf:li>{{xml .}}</rdf:li>
+{{- end}}
+   </rdf:Bag>
+  </dc:subject>
+{{- end}}
+{{- if .People}}
+  <Iptc4xmpExt:PersonInImage>
+   <rdf:Bag>
+{{- range .People}}
+    <rdf:li>{{xml .}}</rdf:li>
+{{- end}}
+   </rdf:Bag>
+  </Iptc4xmpExt:PersonInImage>
+{{- end}}
+{{- if .Rating}}
+  <xmp:Rating>{{.Rating}}</xmp:Rating>
+{{- end}}
+{{- if .Orientation}}
+  <tiff:Orientation>{{.Orientation}}</tiff:Orientation>
+{{- end}}
+ </rdf:Description>
+{{- end}}
 </rdf:RDF>
 </x:xmpmeta>`))
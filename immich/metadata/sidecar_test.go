@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkXML decodes the whole document to check it is well formed
+func checkXML(t *testing.T, b []byte) {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("invalid XML: %s\n%s", err, b)
+		}
+	}
+}
+
+func TestSideCarMinimal(t *testing.T) {
+	sc := SideCar{
+		DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC),
+		Latitude:  48.8583736,
+		Longitude: 2.291901,
+		Elevation: 82.09,
+	}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXML(t, b)
+	if bytes.Count(b, []byte("<rdf:Description")) != 1 {
+		t.Errorf("unexpected content in the minimal sidecar:\n%s", b)
+	}
+}
+
+func TestSideCarNoGPS(t *testing.T) {
+	sc := SideCar{DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXML(t, b)
+	for _, tag := range []string{"GPSLatitude", "GPSLongitude", "GPSAltitude"} {
+		if bytes.Contains(b, []byte(tag)) {
+			t.Errorf("the unknown position shouldn't be written, got %s:\n%s", tag, b)
+		}
+	}
+}
+
+func TestSideCarFull(t *testing.T) {
+	sc := SideCar{
+		DateTaken:   time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC),
+		Description: "Dinner with <friends> & family",
+		Rating:      5,
+		Keywords:    []string{"Alice", "Bob"},
+		People:      []string{"Alice", "Bob"},
+		Orientation: 6,
+	}
+	b, err := sc.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXML(t, b)
+	s := string(b)
+	for _, expected := range []string{
+		"<rdf:li xml:lang='x-default'>Dinner with &lt;friends&gt; &amp; family</rdf:li>",
+		"<dc:subject>",
+		"<Iptc4xmpExt:PersonInImage>",
+		"<rdf:li>Alice</rdf:li>",
+		"<xmp:Rating>5</xmp:Rating>",
+		"<tiff:Orientation>6</tiff:Orientation>",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("expected %q in the sidecar:\n%s", expected, s)
+		}
+	}
+}
+
+func TestSideCarTimeZone(t *testing.T) {
+	d := time.Date(2023, 10, 6, 8, 30, 0, 0, time.UTC)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("no zone database:", err)
+	}
+	for _, c := range []struct {
+		zone     *time.Location
+		expected string
+	}{
+		{zone: nil, expected: d.Local().Format("2006-01-02T15:04:05")},
+		{zone: tokyo, expected: "2023-10-06T17:30:00"},
+	} {
+		sc := SideCar{DateTaken: d, TimeZone: c.zone}
+		b, err := sc.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "<exif:DateTimeOriginal>" + c.expected + "</exif:DateTimeOriginal>"; !strings.Contains(string(b), expected) {
+			t.Errorf("expected %q in the sidecar:\n%s", expected, b)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CanStripGPS tells if StripGPS can remove the GPS position embedded in the files with the extension ext
+func CanStripGPS(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// StripGPS returns a reader on the JPEG file read from r, without the GPS position of its EXIF.
+//
+// The GPS entries giving the position are erased in place: the size of the file
+// and the position of the other data are unchanged. Only the metadata segments placed before
+// the image data are read in memory, the rest of r is read on demand.
+// found tells if the file had a GPS position.
+func StripGPS(r io.Reader) (stripped io.Reader, found bool, err error) {
+	head := bytes.NewBuffer(nil)
+	b := make([]byte, 4)
+	_, err = io.ReadFull(r, b[:2])
+	if err != nil {
+		return nil, false, err
+	}
+	if b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, false, errors.New("not a JPEG file")
+	}
+	head.Write(b[:2])
+
+	for {
+		_, err = io.ReadFull(r, b[:2])
+		if err != nil {
+			return nil, false, err
+		}
+		// The APPn and COM segments hold the metadata, the other segments belong to the image
+		if b[0] != 0xFF || (b[1] < 0xE0 || b[1] > 0xEF) && b[1] != 0xFE {
+			head.Write(b[:2])
+			break
+		}
+		_, err = io.ReadFull(r, b[2:4])
+		if err != nil {
+			return nil, false, err
+		}
+		l := int(binary.BigEndian.Uint16(b[2:4]))
+		if l < 2 {
+			return nil, false, fmt.Errorf("invalid length of the JPEG segment %X", b[1])
+		}
+		segment := make([]byte, l-2)
+		_, err = io.ReadFull(r, segment)
+		if err != nil {
+			return nil, false, err
+		}
+		if b[1] == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			found = eraseGPS(segment[6:]) || found
+		}
+		head.Write(b[:4])
+		head.Write(segment)
+	}
+	return io.MultiReader(head, r), found, nil
+}
+
+// eraseGPS removes the entries of the GPS IFD of the TIFF structure of an EXIF block, and zeroes their values.
+// The version, the date and the time of the GPS are kept, the date of capture may come from them.
+func eraseGPS(tiff []byte) bool {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(tiff, []byte("II")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(tiff, []byte("MM")):
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	if len(tiff) < 8 {
+		return false
+	}
+	gps := 0
+	ifd := int(order.Uint32(tiff[4:]))
+	entries, ok := ifdEntries(tiff, ifd, order)
+	if !ok {
+		return false
+	}
+	for i := 0; i < entries; i++ {
+		e := tiff[ifd+2+12*i:]
+		if order.Uint16(e) == 0x8825 {
+			gps = int(order.Uint32(e[8:]))
+		}
+	}
+	entries, ok = ifdEntries(tiff, gps, order)
+	if gps == 0 || !ok {
+		return false
+	}
+	kept := 0
+	for i := 0; i < entries; i++ {
+		e := tiff[gps+2+12*i : gps+2+12*(i+1)]
+		switch order.Uint16(e) {
+		case 0x0000, 0x0007, 0x001D: // GPSVersionID, GPSTimeStamp, GPSDateStamp
+			copy(tiff[gps+2+12*kept:], e)
+			kept++
+			continue
+		}
+		size := uint64(tiffTypeSize(order.Uint16(e[2:]))) * uint64(order.Uint32(e[4:]))
+		if size > 4 {
+			offset := uint64(order.Uint32(e[8:]))
+			if offset+size <= uint64(len(tiff)) {
+				clear(tiff[offset : offset+size])
+			}
+		}
+	}
+	if kept == entries {
+		return false
+	}
+	// The kept entries are moved in front, followed by the offset of the next IFD, always 0 for the GPS IFD
+	order.PutUint16(tiff[gps:], uint16(kept))
+	clear(tiff[gps+2+12*kept : gps+2+12*entries+4])
+	return true
+}
+
+// ifdEntries gives the number of entries of the IFD at the offset, and false when the IFD is out of the data
+func ifdEntries(tiff []byte, offset int, order binary.ByteOrder) (int, bool) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	if offset+2+12*n+4 > len(tiff) {
+		return 0, false
+	}
+	return n, true
+}
+
+// tiffTypeSize gives the size in bytes of a value of the TIFF type t
+func tiffTypeSize(t uint16) int {
+	switch t {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
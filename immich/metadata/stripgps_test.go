@@ -0,0 +1,102 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// jpegWithGPS builds a JPEG file whose EXIF gives the position 48°51'N 2°21'E
+func jpegWithGPS() []byte {
+	be := binary.BigEndian
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	entry := func(tag, typ uint16, count, value uint32) {
+		tiff = be.AppendUint16(tiff, tag)
+		tiff = be.AppendUint16(tiff, typ)
+		tiff = be.AppendUint32(tiff, count)
+		tiff = be.AppendUint32(tiff, value)
+	}
+	// IFD0 at 8, pointing to the GPS IFD at 26
+	tiff = be.AppendUint16(tiff, 1)
+	entry(0x8825, 4, 1, 26)
+	tiff = be.AppendUint32(tiff, 0)
+	// GPS IFD at 26, its rationals at 80
+	tiff = be.AppendUint16(tiff, 4)
+	entry(1, 2, 2, uint32('N')<<24)
+	entry(2, 5, 3, 80)
+	entry(3, 2, 2, uint32('E')<<24)
+	entry(4, 5, 3, 104)
+	tiff = be.AppendUint32(tiff, 0)
+	for _, v := range []uint32{48, 51, 0, 2, 21, 0} {
+		tiff = be.AppendUint32(tiff, v)
+		tiff = be.AppendUint32(tiff, 1)
+	}
+
+	jpg := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	jpg = be.AppendUint16(jpg, uint16(2+6+len(tiff)))
+	jpg = append(jpg, "Exif\x00\x00"...)
+	jpg = append(jpg, tiff...)
+	jpg = append(jpg, 0xFF, 0xDB, 0x00, 0x04, 0x01, 0x02)
+	jpg = append(jpg, "image data"...)
+	return append(jpg, 0xFF, 0xD9)
+}
+
+func TestStripGPS(t *testing.T) {
+	exifJPG, err := os.ReadFile("TEST_DATA/exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strip := func(jpg []byte) ([]byte, bool) {
+		r, found, err := StripGPS(bytes.NewReader(jpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stripped, found
+	}
+
+	for name, jpg := range map[string][]byte{"big endian": jpegWithGPS(), "exif.jpg": exifJPG} {
+		x, err := exif.Decode(bytes.NewReader(jpg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lat, long, err := x.LatLong(); err != nil || lat == 0 || long == 0 {
+			t.Fatalf("%s: the test file should have a GPS position, got %v,%v: %v", name, lat, long, err)
+		}
+
+		stripped, found := strip(jpg)
+		if !found {
+			t.Errorf("%s: the GPS position should be found", name)
+		}
+		if len(stripped) != len(jpg) || !bytes.HasPrefix(stripped, jpg[:24]) {
+			t.Errorf("%s: only the GPS entries should change", name)
+		}
+		x, err = exif.Decode(bytes.NewReader(stripped))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lat, long, err := x.LatLong(); err == nil {
+			t.Errorf("%s: the GPS position should be removed, got %v,%v", name, lat, long)
+		}
+		if _, err := x.Get(exif.DateTime); err != nil && name == "exif.jpg" {
+			t.Errorf("%s: the other tags should be kept: %s", name, err)
+		}
+
+		again, found := strip(stripped)
+		if found || !bytes.Equal(again, stripped) {
+			t.Errorf("%s: a file without GPS position should be unchanged", name)
+		}
+	}
+
+	_, _, err = StripGPS(bytes.NewReader([]byte("not a jpeg")))
+	if err == nil {
+		t.Error("an error is expected for a file that is not a JPEG")
+	}
+}
@@ -0,0 +1,142 @@
+package metadata
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+// xmpDateTags are the XMP properties giving the date of capture, by order of preference
+var xmpDateTags = []string{"DateTimeOriginal", "DateCreated", "CreateDate"}
+
+// ReadXMP gets the date of capture, the GPS position and the rating of an XMP sidecar file.
+// The properties can be given as elements or as attributes.
+func ReadXMP(r io.Reader) (MetaData, error) {
+	values := map[string]string{}
+	var current string
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return MetaData{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+			for _, a := range t.Attr {
+				if _, ok := values[a.Name.Local]; !ok {
+					values[a.Name.Local] = a.Value
+				}
+			}
+		case xml.CharData:
+			if s := strings.TrimSpace(string(t)); current != "" && s != "" {
+				if _, ok := values[current]; !ok {
+					values[current] = s
+				}
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+
+	md := MetaData{}
+	for _, tag := range xmpDateTags {
+		if v, ok := values[tag]; ok {
+			if t, err := parseXMPDate(v); err == nil {
+				md.DateTaken = t
+				break
+			}
+		}
+	}
+	lat, err1 := parseXMPCoordinate(values["GPSLatitude"])
+	long, err2 := parseXMPCoordinate(values["GPSLongitude"])
+	if err1 == nil && err2 == nil {
+		md.Latitude, md.Longitude = lat, long
+		if alt, err := parseXMPRational(values["GPSAltitude"]); err == nil {
+			md.Altitude = alt
+		}
+	}
+	// the percentages of MicrosoftPhoto:Rating aren't stars
+	if r, err := strconv.Atoi(values["Rating"]); err == nil && r > 0 && r <= 5 {
+		md.Rating = r
+	}
+	return md, nil
+}
+
+var xmpDateLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006:01:02 15:04:05",
+}
+
+// parseXMPDate parses the XMP dates, in the local time zone when the date hasn't any
+func parseXMPDate(s string) (time.Time, error) {
+	local, err := tzone.Local()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, l := range xmpDateLayouts {
+		t, err := time.ParseInLocation(l, s, local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid XMP date: " + s)
+}
+
+// parseXMPCoordinate parses the decimal coordinates, and the XMP ones like 48,51.504N
+func parseXMPCoordinate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("no coordinate")
+	}
+	sign := 1.0
+	switch s[len(s)-1] {
+	case 'S', 's', 'W', 'w':
+		sign = -1
+		s = s[:len(s)-1]
+	case 'N', 'n', 'E', 'e':
+		s = s[:len(s)-1]
+	}
+	v := 0.0
+	for i, p := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || i > 2 {
+			return 0, errors.New("invalid XMP coordinate: " + s)
+		}
+		switch i {
+		case 0:
+			v = f
+		case 1:
+			v += f / 60
+		case 2:
+			v += f / 3600
+		}
+	}
+	return sign * v, nil
+}
+
+// parseXMPRational parses the rational values like 8209/100, and the decimal ones
+func parseXMPRational(s string) (float64, error) {
+	n, d, found := strings.Cut(strings.TrimSpace(s), "/")
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || !found {
+		return v, err
+	}
+	dv, err := strconv.ParseFloat(d, 64)
+	if err != nil || dv == 0 {
+		return 0, errors.New("invalid XMP rational: " + s)
+	}
+	return v / dv, nil
+}
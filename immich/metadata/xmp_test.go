@@ -0,0 +1,89 @@
+package metadata
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/tzone"
+)
+
+func TestReadXMP(t *testing.T) {
+	os.Setenv("TZ", "Europe/Paris")
+	local, err := tzone.Local()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := (&SideCar{
+		DateTaken: time.Date(2023, 10, 6, 8, 30, 0, 0, local),
+		Latitude:  48.8583736,
+		Longitude: 2.291901,
+		Elevation: 82.09,
+		Rating:    5,
+	}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		xmp      string
+		date     time.Time
+		lat, lon float64
+		alt      float64
+		rating   int
+	}{
+		{
+			name: "generated",
+			xmp:  string(generated),
+			date: time.Date(2023, 10, 6, 8, 30, 0, 0, local),
+			lat:  48.8583736, lon: 2.291901, alt: 82.09, rating: 5,
+		},
+		{
+			name: "attributes",
+			xmp: `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+ xmp:CreateDate="2021-05-01T10:00:00" exif:DateTimeOriginal="2021-04-30T18:45:12.50-07:00"
+ exif:GPSLatitude="37,46.794N" exif:GPSLongitude="122,25.2W" exif:GPSAltitude="12/10" xmp:Rating="3"/>
+</rdf:RDF></x:xmpmeta>`,
+			date: time.Date(2021, 4, 30, 18, 45, 12, 500_000_000, time.FixedZone("", -7*3600)),
+			lat:  37.7799, lon: -122.42, alt: 1.2, rating: 3,
+		},
+		{
+			name: "create date only",
+			xmp: `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:CreateDate>2020-01-02</xmp:CreateDate></rdf:Description>
+</rdf:RDF></x:xmpmeta>`,
+			date: time.Date(2020, 1, 2, 0, 0, 0, 0, local),
+		},
+		{
+			name: "no date",
+			xmp:  `<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := ReadXMP(strings.NewReader(tt.xmp))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !md.DateTaken.Equal(tt.date) {
+				t.Errorf("expected date %s, got %s", tt.date, md.DateTaken)
+			}
+			if math.Abs(md.Latitude-tt.lat) > 1e-4 || math.Abs(md.Longitude-tt.lon) > 1e-4 || math.Abs(md.Altitude-tt.alt) > 1e-4 {
+				t.Errorf("expected position %f,%f,%f, got %f,%f,%f", tt.lat, tt.lon, tt.alt, md.Latitude, md.Longitude, md.Altitude)
+			}
+			if md.Rating != tt.rating {
+				t.Errorf("expected rating %d, got %d", tt.rating, md.Rating)
+			}
+		})
+	}
+
+	_, err = ReadXMP(bytes.NewReader([]byte("<x:xmpmeta><rdf:RDF>")))
+	if err == nil {
+		t.Error("an invalid XMP file should give an error")
+	}
+}
@@ -0,0 +1,551 @@
+/*
+Package mock simulates an immich server in memory.
+
+The Client implements the calls used by the commands, records them, and answers like the server would:
+the uploaded assets are kept, a file uploaded twice is reported as a duplicate, the albums and the tags are tracked.
+The state of the simulated server can be saved into a file, to be reloaded by the next run.
+*/
+package mock
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich"
+)
+
+// Call is a call received by the simulated server
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// state is the content of the simulated server
+type state struct {
+	Assets []*immich.Asset           `json:"assets"`
+	Albums []*immich.AlbumSimplified `json:"albums"`
+	Tags   map[string][]string       `json:"tags"` // asset IDs by tag name
+	LastID int                       `json:"lastId"`
+}
+
+// Client is an in-memory immich server. It is safe for concurrent use.
+type Client struct {
+	mut   sync.Mutex
+	state state
+	calls []Call
+}
+
+func New() *Client {
+	return &Client{state: state{Tags: map[string][]string{}}}
+}
+
+// LoadFile restores the state saved by SaveFile
+func (c *Client) LoadFile(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	s := state{}
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("can't read the simulated server's state %s: %w", name, err)
+	}
+	if s.Tags == nil {
+		s.Tags = map[string][]string{}
+	}
+	c.state = s
+	return nil
+}
+
+// SaveFile writes the state of the simulated server
+func (c *Client) SaveFile(name string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	b, err := json.MarshalIndent(c.state, "", " ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, b, 0o644)
+}
+
+// Calls gives the calls received so far
+func (c *Client) Calls() []Call {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return slices.Clone(c.calls)
+}
+
+// Assets gives the assets of the server, trashed ones included
+func (c *Client) Assets() []*immich.Asset {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return slices.Clone(c.state.Assets)
+}
+
+// Albums gives the albums of the server
+func (c *Client) Albums() []immich.AlbumSimplified {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	r := []immich.AlbumSimplified{}
+	for _, al := range c.state.Albums {
+		r = append(r, *al)
+	}
+	return r
+}
+
+// record must be called with the lock held
+func (c *Client) record(method string, args ...any) {
+	c.calls = append(c.calls, Call{Method: method, Args: args})
+}
+
+// EndPoint gives a fake address for the simulated server
+func (c *Client) EndPoint() string {
+	return "simulator"
+}
+
+func (c *Client) ValidateConnection(ctx context.Context) (immich.User, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("ValidateConnection")
+	return immich.User{ID: "simulator", Email: "simulator@localhost"}, nil
+}
+
+// GetAllUsers gives the only user of the simulated server
+func (c *Client) GetAllUsers(ctx context.Context) ([]immich.User, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAllUsers")
+	return []immich.User{{ID: "simulator", Email: "simulator@localhost"}}, nil
+}
+
+// touch sets the update time of the asset
+func touch(a *immich.Asset) {
+	a.UpdatedAt = immich.ImmichTime{Time: time.Now()}
+}
+
+func (c *Client) newID() string {
+	c.state.LastID++
+	return fmt.Sprintf("sim-%06d", c.state.LastID)
+}
+
+func (c *Client) asset(id string) (*immich.Asset, error) {
+	for _, a := range c.state.Assets {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("asset %s not found", id)
+}
+
+func (c *Client) album(id string) (*immich.AlbumSimplified, error) {
+	for _, al := range c.state.Albums {
+		if al.ID == id {
+			return al, nil
+		}
+	}
+	return nil, fmt.Errorf("album %s not found", id)
+}
+
+func (c *Client) GetAllAssetsWithFilter(ctx context.Context, opt *immich.GetAssetOptions, filter func(*immich.Asset)) error {
+	c.mut.Lock()
+	c.record("GetAllAssetsWithFilter")
+	assets := slices.Clone(c.state.Assets)
+	c.mut.Unlock()
+	for _, a := range assets {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if opt != nil && !a.UpdatedAt.After(opt.UpdatedAfter) {
+			continue
+		}
+		cp := *a
+		filter(&cp)
+	}
+	if opt != nil && opt.Progress != nil {
+		opt.Progress(1, len(assets))
+	}
+	return nil
+}
+
+// AssetUpload reads the file and keeps its description. The file is a duplicate when its checksum is known.
+func (c *Client) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	return c.addAsset("AssetUpload", la, "upload/library/"+path.Base(la.Title))
+}
+
+// Version is the version of the simulated server
+var Version = immich.ServerVersion{Major: 1, Minor: 91}
+
+// GetServerVersion gives the version of the simulated server
+func (c *Client) GetServerVersion(ctx context.Context) (immich.ServerVersion, error) {
+	return Version, nil
+}
+
+// GetServerCapabilities gives the version of the simulated server, having the trash enabled
+func (c *Client) GetServerCapabilities(ctx context.Context) (immich.ServerCapabilities, error) {
+	return immich.ServerCapabilities{Version: Version, Features: map[string]bool{immich.FeatureTrash: true}}, nil
+}
+
+// ImportAsset adds the asset, read from the local file, with the path given for the server
+func (c *Client) ImportAsset(ctx context.Context, la *browser.LocalAssetFile, imp immich.AssetImport) (immich.AssetResponse, error) {
+	return c.addAsset("ImportAsset", la, imp.AssetPath)
+}
+
+// addAsset adds the asset unless an asset with the same checksum is present
+func (c *Client) addAsset(method string, la *browser.LocalAssetFile, originalPath string) (immich.AssetResponse, error) {
+	var ar immich.AssetResponse
+	mtype, err := fshelper.MimeFromExt(la.Ext())
+	if err != nil {
+		return ar, err
+	}
+	f, err := la.Open()
+	if err != nil {
+		return ar, err
+	}
+	h := sha1.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return ar, err
+	}
+	checksum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record(method, la.FileName)
+	for _, a := range c.state.Assets {
+		if a.Checksum == checksum && !a.IsTrashed {
+			return immich.AssetResponse{ID: a.ID, Duplicate: true}, nil
+		}
+	}
+	ext := path.Ext(la.Title)
+	a := &immich.Asset{
+		ID:               c.newID(),
+		DeviceAssetID:    fmt.Sprintf("%s-%d", path.Base(la.Title), size),
+		Type:             strings.ToUpper(strings.Split(mtype[0], "/")[0]),
+		OriginalPath:     originalPath,
+		OriginalFileName: strings.TrimSuffix(path.Base(la.Title), ext),
+		FileCreatedAt:    immich.ImmichTime{Time: la.DateTaken},
+		FileModifiedAt:   immich.ImmichTime{Time: la.DateTaken},
+		IsFavorite:       la.Favorite,
+		Checksum:         checksum,
+		ExifInfo: immich.ExifInfo{
+			FileSizeInByte:   int(size),
+			DateTimeOriginal: immich.ImmichTime{Time: la.DateTaken},
+			Latitude:         la.Latitude,
+			Longitude:        la.Longitude,
+			Description:      la.Description,
+		},
+	}
+	touch(a)
+	c.state.Assets = append(c.state.Assets, a)
+	return immich.AssetResponse{ID: a.ID}, nil
+}
+
+// DeleteAssets moves the assets to the trash, or removes them when forced
+func (c *Client) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("DeleteAssets", ids, force)
+	c.state.Assets = slices.DeleteFunc(c.state.Assets, func(a *immich.Asset) bool {
+		if !slices.Contains(ids, a.ID) {
+			return false
+		}
+		a.IsTrashed = true
+		touch(a)
+		return force
+	})
+	return nil
+}
+
+func (c *Client) GetAssetByID(ctx context.Context, id string) (*immich.Asset, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAssetByID", id)
+	a, err := c.asset(id)
+	if err != nil {
+		return nil, err
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (c *Client) UpdateAssets(ctx context.Context, ids []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentId string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("UpdateAssets", ids, isArchived, isFavorite, latitude, longitude, removeParent, stackParentId)
+	for _, id := range ids {
+		a, err := c.asset(id)
+		if err != nil {
+			return err
+		}
+		a.IsArchived, a.IsFavorite = isArchived, isFavorite
+		a.ExifInfo.Latitude, a.ExifInfo.Longitude = latitude, longitude
+		switch {
+		case removeParent:
+			a.StackParentId = ""
+		case stackParentId != "":
+			a.StackParentId = stackParentId
+		}
+		touch(a)
+	}
+	return nil
+}
+
+func (c *Client) UpdateAssetsMetadata(ctx context.Context, ids []string, m immich.AssetMetadataUpdate) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("UpdateAssetsMetadata", ids, m)
+	for _, id := range ids {
+		a, err := c.asset(id)
+		if err != nil {
+			return err
+		}
+		if !m.DateTimeOriginal.IsZero() {
+			a.ExifInfo.DateTimeOriginal = immich.ImmichTime{Time: m.DateTimeOriginal}
+		}
+		if m.Latitude != 0 || m.Longitude != 0 {
+			a.ExifInfo.Latitude, a.ExifInfo.Longitude = m.Latitude, m.Longitude
+		}
+		if m.Favorite {
+			a.IsFavorite = true
+		}
+		touch(a)
+	}
+	return nil
+}
+
+func (c *Client) UpdateAsset(ctx context.Context, id string, la *browser.LocalAssetFile) (*immich.Asset, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("UpdateAsset", id, la.FileName)
+	a, err := c.asset(id)
+	if err != nil {
+		return nil, err
+	}
+	a.IsArchived, a.IsFavorite = la.Archived, la.Favorite
+	if la.Latitude != 0 || la.Longitude != 0 {
+		a.ExifInfo.Latitude, a.ExifInfo.Longitude = la.Latitude, la.Longitude
+	}
+	if la.Description != "" {
+		a.ExifInfo.Description = la.Description
+	}
+	touch(a)
+	cp := *a
+	return &cp, nil
+}
+
+func (c *Client) StackAssets(ctx context.Context, cover string, ids []string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("StackAssets", cover, ids)
+	if _, err := c.asset(cover); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		a, err := c.asset(id)
+		if err != nil {
+			return err
+		}
+		if id != cover {
+			a.StackParentId = cover
+			touch(a)
+		}
+	}
+	return nil
+}
+
+func (c *Client) GetAllAlbums(ctx context.Context) ([]immich.AlbumSimplified, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAllAlbums")
+	r := []immich.AlbumSimplified{}
+	for _, al := range c.state.Albums {
+		r = append(r, immich.AlbumSimplified{ID: al.ID, AlbumName: al.AlbumName, Description: al.Description})
+	}
+	return r, nil
+}
+
+func (c *Client) GetAlbumAssetIDs(ctx context.Context, id string) ([]string, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAlbumAssetIDs", id)
+	al, err := c.album(id)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, aid := range al.AssetIds {
+		if _, err := c.asset(aid); err == nil {
+			ids = append(ids, aid)
+		}
+	}
+	return ids, nil
+}
+
+func (c *Client) GetAlbumInfo(ctx context.Context, id string) (immich.AlbumContent, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAlbumInfo", id)
+	al, err := c.album(id)
+	if err != nil {
+		return immich.AlbumContent{}, err
+	}
+	r := immich.AlbumContent{ID: al.ID, AlbumName: al.AlbumName}
+	for _, aid := range al.AssetIds {
+		if a, err := c.asset(aid); err == nil {
+			r.Assets = append(r.Assets, immich.AssetSimplified{ID: a.ID, DeviceAssetID: a.DeviceAssetID})
+		}
+	}
+	return r, nil
+}
+
+func (c *Client) CreateAlbum(ctx context.Context, name string, ids []string) (immich.AlbumSimplified, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("CreateAlbum", name, ids)
+	for _, id := range ids {
+		if _, err := c.asset(id); err != nil {
+			return immich.AlbumSimplified{}, err
+		}
+	}
+	al := &immich.AlbumSimplified{ID: c.newID(), AlbumName: name, AssetIds: slices.Clone(ids)}
+	c.state.Albums = append(c.state.Albums, al)
+	return immich.AlbumSimplified{ID: al.ID, AlbumName: al.AlbumName}, nil
+}
+
+func (c *Client) AddAssetToAlbum(ctx context.Context, id string, ids []string) ([]immich.UpdateAlbumResult, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("AddAssetToAlbum", id, ids)
+	al, err := c.album(id)
+	if err != nil {
+		return nil, err
+	}
+	r := []immich.UpdateAlbumResult{}
+	for _, aid := range ids {
+		switch _, err := c.asset(aid); {
+		case err != nil:
+			r = append(r, immich.UpdateAlbumResult{ID: aid, Error: "not_found"})
+		case slices.Contains(al.AssetIds, aid):
+			r = append(r, immich.UpdateAlbumResult{ID: aid, Error: "duplicate"})
+		default:
+			al.AssetIds = append(al.AssetIds, aid)
+			r = append(r, immich.UpdateAlbumResult{ID: aid, Success: true})
+		}
+	}
+	return r, nil
+}
+
+// SetAlbumDescription replaces the description of the album
+func (c *Client) SetAlbumDescription(ctx context.Context, albumID string, description string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("SetAlbumDescription", albumID, description)
+	al, err := c.album(albumID)
+	if err != nil {
+		return err
+	}
+	al.Description = description
+	return nil
+}
+
+// AddUsersToAlbum shares the album with the users
+func (c *Client) AddUsersToAlbum(ctx context.Context, albumID string, userIDs []string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("AddUsersToAlbum", albumID, userIDs)
+	_, err := c.album(albumID)
+	return err
+}
+
+// CreateAlbumSharedLink gives a link to the album
+func (c *Client) CreateAlbumSharedLink(ctx context.Context, albumID string) (immich.SharedLink, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("CreateAlbumSharedLink", albumID)
+	if _, err := c.album(albumID); err != nil {
+		return immich.SharedLink{}, err
+	}
+	key := c.newID()
+	return immich.SharedLink{ID: key, Key: key, URL: "simulator/share/" + key}, nil
+}
+
+// SetAssetDescription sets the description of the asset
+func (c *Client) SetAssetDescription(ctx context.Context, id string, description string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("SetAssetDescription", id, description)
+	a, err := c.asset(id)
+	if err != nil {
+		return err
+	}
+	a.ExifInfo.Description = description
+	touch(a)
+	return nil
+}
+
+// SetAlbumCover sets the thumbnail of the album
+func (c *Client) SetAlbumCover(ctx context.Context, albumID string, assetID string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("SetAlbumCover", albumID, assetID)
+	al, err := c.album(albumID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(al.AssetIds, assetID) {
+		return fmt.Errorf("the asset %s isn't in the album %s", assetID, albumID)
+	}
+	al.AlbumThumbnailAssetID = assetID
+	return nil
+}
+
+func (c *Client) GetAssetAlbums(ctx context.Context, id string) ([]immich.AlbumSimplified, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("GetAssetAlbums", id)
+	r := []immich.AlbumSimplified{}
+	for _, al := range c.state.Albums {
+		if slices.Contains(al.AssetIds, id) {
+			r = append(r, immich.AlbumSimplified{ID: al.ID, AlbumName: al.AlbumName})
+		}
+	}
+	return r, nil
+}
+
+// TagAssets applies the tag to the assets, the tag is created when needed
+func (c *Client) TagAssets(ctx context.Context, tagName string, ids []string) ([]immich.TagAssetsResult, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.record("TagAssets", tagName, ids)
+	if tagName == "" {
+		return nil, errors.New("empty tag name")
+	}
+	r := []immich.TagAssetsResult{}
+	for _, id := range ids {
+		switch _, err := c.asset(id); {
+		case err != nil:
+			r = append(r, immich.TagAssetsResult{AssetID: id, Error: "not_found"})
+		case slices.Contains(c.state.Tags[tagName], id):
+			r = append(r, immich.TagAssetsResult{AssetID: id, Error: "duplicate"})
+		default:
+			c.state.Tags[tagName] = append(c.state.Tags[tagName], id)
+			r = append(r, immich.TagAssetsResult{AssetID: id, Success: true})
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,96 @@
+package immich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TagsVersion is the first version of the server able to tag the assets
+var TagsVersion = ServerVersion{Major: 1, Minor: 82}
+
+// AssetsMetadataVersion is the first version of the server able to change the date and the GPS position of the assets
+var AssetsMetadataVersion = ServerVersion{Major: 1, Minor: 86}
+
+// FeatureTrash is the feature of the server moving the deleted assets to the trash
+const FeatureTrash = "trash"
+
+// ServerCapabilities are the version of the server and the features enabled by its administrator
+type ServerCapabilities struct {
+	Version  ServerVersion
+	Features map[string]bool // empty when the server doesn't give its features
+}
+
+// FeatureDisabled tells if the server reports the feature as disabled. An unknown feature isn't disabled.
+func (c ServerCapabilities) FeatureDisabled(name string) bool {
+	enabled, ok := c.Features[name]
+	return ok && !enabled
+}
+
+// GetServerCapabilities gives the version and the features of the server.
+// They are read once, the next calls give the same capabilities for the lifetime of the client.
+func (ic *ImmichClient) GetServerCapabilities(ctx context.Context) (ServerCapabilities, error) {
+	ic.capabilitiesLock.Lock()
+	defer ic.capabilitiesLock.Unlock()
+	if ic.capabilities != nil {
+		return *ic.capabilities, nil
+	}
+	v, err := ic.GetServerVersion(ctx)
+	if err != nil {
+		return ServerCapabilities{}, err
+	}
+	c := ServerCapabilities{Version: v, Features: map[string]bool{}}
+	features := map[string]any{}
+	err = ic.newServerCall(ctx, "GetServerFeatures").do(get("/server-info/features", setAcceptJSON()), responseJSON(&features))
+	var he *HTTPError
+	if err != nil && !(errors.As(err, &he) && he.StatusCode == http.StatusNotFound) {
+		return ServerCapabilities{}, err
+	}
+	for name, f := range features {
+		if enabled, ok := f.(bool); ok {
+			c.Features[name] = enabled
+		}
+	}
+	ic.capabilities = &c
+	return c, nil
+}
+
+// DiscoverEndPoint reads the URL of the API in the file .well-known/immich of the server,
+// for the servers whose API isn't at the usual /api. The end point isn't changed when the server
+// doesn't give it.
+func (ic *ImmichClient) DiscoverEndPoint(ctx context.Context) error {
+	var wk struct {
+		API struct {
+			EndPoint string `json:"endpoint"`
+		} `json:"api"`
+	}
+	base, err := url.Parse(ic.server + "/")
+	if err != nil {
+		return err
+	}
+	wellKnown := base.JoinPath(".well-known", "immich").String()
+	err = ic.newServerCall(ctx, "DiscoverEndPoint").do(
+		func(sc *serverCall) *http.Request {
+			return sc.request(http.MethodGet, wellKnown, setAcceptJSON())
+		},
+		responseJSON(&wk))
+	var he *HTTPError
+	if errors.As(err, &he) && he.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wk.API.EndPoint == "" {
+		return fmt.Errorf("%s doesn't give the end point of the API", wellKnown)
+	}
+	endPoint, err := base.Parse(wk.API.EndPoint)
+	if err != nil {
+		return fmt.Errorf("%s gives an invalid end point: %w", wellKnown, err)
+	}
+	ic.SetEndPoint(strings.TrimSuffix(endPoint.String(), "/"))
+	return nil
+}
@@ -0,0 +1,112 @@
+package immich
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetServerCapabilities(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		calls++
+		switch req.URL.Path {
+		case "/api/server-info/version":
+			resp.Write([]byte(`{"major":1,"minor":88,"patch":2}`))
+		case "/api/server-info/features":
+			resp.Write([]byte(`{"trash":false,"search":true,"map":true,"oauthButtonText":"Login"}`))
+		default:
+			resp.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		c, err := ic.GetServerCapabilities(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != (ServerVersion{Major: 1, Minor: 88, Patch: 2}) {
+			t.Errorf("unexpected version %s", c.Version)
+		}
+		if !c.FeatureDisabled(FeatureTrash) || c.FeatureDisabled("search") || c.FeatureDisabled("unknown") {
+			t.Errorf("unexpected features %v", c.Features)
+		}
+		if len(c.Features) != 3 {
+			t.Errorf("only the boolean features are expected, got %v", c.Features)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("the capabilities should be read once, got %d calls", calls)
+	}
+}
+
+func TestGetServerCapabilitiesWithoutFeatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/server-info/version" {
+			resp.Write([]byte(`{"major":1,"minor":78,"patch":0}`))
+			return
+		}
+		resp.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	ic, err := NewImmichClient(server.URL, "1234", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ic.GetServerCapabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version.Minor != 78 || len(c.Features) != 0 || c.FeatureDisabled(FeatureTrash) {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+}
+
+func TestDiscoverEndPoint(t *testing.T) {
+	tc := []struct {
+		name     string
+		status   int
+		body     string
+		expected string
+		err      bool
+	}{
+		{name: "relative", status: http.StatusOK, body: `{"api":{"endpoint":"/immich/api"}}`, expected: "/immich/api"},
+		{name: "absolute", status: http.StatusOK, body: `{"api":{"endpoint":"http://api.example.com/api/"}}`, expected: "http://api.example.com/api"},
+		{name: "not found", status: http.StatusNotFound, expected: "/api"},
+		{name: "no end point", status: http.StatusOK, body: `{}`, expected: "/api", err: true},
+		{name: "not JSON", status: http.StatusOK, body: `<html></html>`, expected: "/api", err: true},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/.well-known/immich" {
+					t.Errorf("unexpected call %s", req.URL.Path)
+				}
+				resp.WriteHeader(c.status)
+				resp.Write([]byte(c.body))
+			}))
+			defer server.Close()
+			ic, err := NewImmichClient(server.URL, "1234", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ic.DiscoverEndPoint(context.Background())
+			if (err != nil) != c.err {
+				t.Errorf("unexpected error %v", err)
+			}
+			expected := c.expected
+			if expected[0] == '/' {
+				expected = server.URL + expected
+			}
+			if ic.EndPoint() != expected {
+				t.Errorf("expected the end point %s, got %s", expected, ic.EndPoint())
+			}
+		})
+	}
+}
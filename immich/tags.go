@@ -0,0 +1,77 @@
+package immich
+
+import (
+	"context"
+	"fmt"
+)
+
+type Tag struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (ic *ImmichClient) GetAllTags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	err := ic.newServerCall(ctx, "GetAllTags").do(get("/tag", setAcceptJSON()), responseJSON(&tags))
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (ic *ImmichClient) CreateTag(ctx context.Context, name string) (Tag, error) {
+	body := Tag{
+		Name: name,
+		Type: "CUSTOM",
+	}
+	var r Tag
+	err := ic.newServerCall(ctx, "CreateTag").do(
+		post("/tag", "application/json", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return Tag{}, err
+	}
+	return r, nil
+}
+
+type TagAssetsResult struct {
+	AssetID string `json:"assetId"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// TagAssets applies the tag to the assets. The tag is created when it doesn't exist.
+func (ic *ImmichClient) TagAssets(ctx context.Context, tagName string, ids []string) ([]TagAssetsResult, error) {
+	tags, err := ic.GetAllTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tag Tag
+	for _, t := range tags {
+		if t.Name == tagName {
+			tag = t
+			break
+		}
+	}
+	if tag.ID == "" {
+		tag, err = ic.CreateTag(ctx, tagName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var r []TagAssetsResult
+	body := struct {
+		AssetIDs []string `json:"assetIds"`
+	}{
+		AssetIDs: ids,
+	}
+	err = ic.newServerCall(ctx, "TagAssets").do(
+		put(fmt.Sprintf("/tag/%s/assets", tag.ID), setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"path"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -8,9 +10,20 @@ import (
 type Journal struct {
 	mut    sync.Mutex
 	counts map[Action]int
+	exts   map[string]*ExtensionStats // counts by file extension
 	Logger
 }
 
+// ExtensionStats counts what happened to the files of an extension
+type ExtensionStats struct {
+	Scanned     int `json:"scanned"`     // photos and videos found in the input
+	Uploaded    int `json:"uploaded"`    // uploaded or upgraded on the server
+	Skipped     int `json:"skipped"`     // discarded by options, duplicates...
+	Metadata    int `json:"metadata"`    // metadata files
+	Unsupported int `json:"unsupported"` // files having a type not supported
+	Errors      int `json:"errors"`      // errors
+}
+
 type Action string
 
 const (
@@ -33,7 +46,17 @@ const (
 	ASSOCIATED_META  Action = "Associated with metadata"
 	INFO             Action = "Info"
 	NOT_SELECTED     Action = "Not selected because options"
+	SIZE_FILTERED    Action = "Not selected because of the size"
 	SERVER_ERROR     Action = "Server error"
+	CONFLICT         Action = "Can't compare with the server"
+	MIME_MISMATCH    Action = "Content not matching the extension"
+	NAME_SANITIZED   Action = "Name changed for the server"
+	SERVER_SMALLER   Action = "Server's asset is smaller, kept"
+	METADATA_PATCHED Action = "Server's metadata corrected"
+	FAVORITE         Action = "Marked as favorite"
+	EXIF_SIDECAR     Action = "EXIF copied to a sidecar"
+	EMPTY_FILE       Action = "Empty file"
+	TRUNCATED        Action = "Truncated file"
 )
 
 func NewJournal(log Logger) *Journal {
@@ -41,6 +64,7 @@ func NewJournal(log Logger) *Journal {
 		// files:  map[string]Entries{},
 		Logger: log,
 		counts: map[Action]int{},
+		exts:   map[string]*ExtensionStats{},
 	}
 }
 
@@ -51,12 +75,14 @@ func (j *Journal) AddEntry(file string, action Action, comment ...string) {
 	c := strings.Join(comment, ", ")
 	if j.Logger != nil {
 		switch action {
-		case ERROR, SERVER_ERROR:
+		case ERROR, SERVER_ERROR, TRUNCATED:
 			j.Logger.Error("%-25s: %s: %s", action, file, c)
 		case DISCOVERED_FILE:
 			j.Logger.Debug("%-25s: %s: %s", action, file, c)
 		case UPLOADED:
 			j.Logger.OK("%-25s: %s: %s", action, file, c)
+		case CONFLICT, MIME_MISMATCH, UPGRADED, SERVER_SMALLER, EMPTY_FILE:
+			j.Logger.Warning("%-25s: %s: %s", action, file, c)
 		default:
 			j.Logger.Info("%-25s: %s: %s", action, file, c)
 		}
@@ -66,34 +92,129 @@ func (j *Journal) AddEntry(file string, action Action, comment ...string) {
 	if action == UPGRADED {
 		j.counts[UPLOADED]--
 	}
+	j.countExtension(file, action)
 	j.mut.Unlock()
 }
+
+// countExtension updates the counts of the file's extension. The journal must be locked.
+func (j *Journal) countExtension(file string, action Action) {
+	ext := strings.ToLower(path.Ext(file))
+	s := j.exts[ext]
+	if s == nil {
+		s = &ExtensionStats{}
+		j.exts[ext] = s
+	}
+	switch action {
+	case SCANNED_IMAGE, SCANNED_VIDEO:
+		s.Scanned++
+	case UPLOADED:
+		s.Uploaded++
+	case NOT_SELECTED, SIZE_FILTERED, LOCAL_DUPLICATE, SERVER_DUPLICATE, SERVER_BETTER, SERVER_SMALLER, DISCARDED, FAILED_VIDEO, CONFLICT, EMPTY_FILE:
+		s.Skipped++
+	case METADATA:
+		s.Metadata++
+	case UNSUPPORTED:
+		s.Unsupported++
+	case ERROR, SERVER_ERROR, TRUNCATED:
+		s.Errors++
+	}
+}
+
+// Count returns the number of entries of the action
+func (j *Journal) Count(action Action) int {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	return j.counts[action]
+}
+
+// Extensions returns the counts by file extension
+func (j *Journal) Extensions() map[string]ExtensionStats {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	r := map[string]ExtensionStats{}
+	for ext, s := range j.exts {
+		if *s != (ExtensionStats{}) {
+			r[ext] = *s
+		}
+	}
+	return r
+}
+
+// ReportExtensions displays the counts by file extension
+func (j *Journal) ReportExtensions() {
+	exts := j.Extensions()
+	if len(exts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(exts))
+	for ext := range exts {
+		keys = append(keys, ext)
+	}
+	sort.Strings(keys)
+
+	j.Logger.Summary("Files by extension:")
+	j.Logger.Summary("%-10s %8s %8s %8s %8s %11s %8s", "extension", "scanned", "uploaded", "skipped", "metadata", "unsupported", "errors")
+	for _, ext := range keys {
+		s := exts[ext]
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		j.Logger.Summary("%-10s %8d %8d %8d %8d %11d %8d", name, s.Scanned, s.Uploaded, s.Skipped, s.Metadata, s.Unsupported, s.Errors)
+	}
+}
 func (j *Journal) Report() {
 
 	checkFiles := j.counts[SCANNED_IMAGE] + j.counts[SCANNED_VIDEO] + j.counts[METADATA] + j.counts[UNSUPPORTED] + j.counts[FAILED_VIDEO] + j.counts[DISCARDED]
-	handledFiles := j.counts[NOT_SELECTED] + j.counts[LOCAL_DUPLICATE] + j.counts[SERVER_DUPLICATE] + j.counts[SERVER_BETTER] + j.counts[UPLOADED] + j.counts[UPGRADED] + j.counts[SERVER_ERROR]
-	j.Logger.OK("Scan of the sources:")
-	j.Logger.OK("%6d files in the input", j.counts[DISCOVERED_FILE])
-	j.Logger.OK("--------------------------------------------------------")
-	j.Logger.OK("%6d photos", j.counts[SCANNED_IMAGE])
-	j.Logger.OK("%6d videos", j.counts[SCANNED_VIDEO])
-	j.Logger.OK("%6d metadata files", j.counts[METADATA])
-	j.Logger.OK("%6d files with metadata", j.counts[ASSOCIATED_META])
-	j.Logger.OK("%6d discarded files", j.counts[DISCARDED])
-	j.Logger.OK("%6d files having a type not supported", j.counts[UNSUPPORTED])
-	j.Logger.OK("%6d discarded files because in folder failed videos", j.counts[FAILED_VIDEO])
-
-	j.Logger.OK("%6d input total (difference %d)", checkFiles, j.counts[DISCOVERED_FILE]-checkFiles)
-	j.Logger.OK("--------------------------------------------------------")
-
-	j.Logger.OK("%6d uploaded files on the server", j.counts[UPLOADED])
-	j.Logger.OK("%6d upgraded files on the server", j.counts[UPGRADED])
-	j.Logger.OK("%6d files already on the server", j.counts[SERVER_DUPLICATE])
-	j.Logger.OK("%6d discarded files because of options", j.counts[NOT_SELECTED])
-	j.Logger.OK("%6d discarded files because duplicated in the input", j.counts[LOCAL_DUPLICATE])
-	j.Logger.OK("%6d discarded files because server has a better image", j.counts[SERVER_BETTER])
-	j.Logger.OK("%6d errors when uploading", j.counts[SERVER_ERROR])
-
-	j.Logger.OK("%6d handled total (difference %d)", handledFiles, j.counts[SCANNED_IMAGE]+j.counts[SCANNED_VIDEO]-handledFiles)
+	handledFiles := j.counts[NOT_SELECTED] + j.counts[SIZE_FILTERED] + j.counts[LOCAL_DUPLICATE] + j.counts[SERVER_DUPLICATE] + j.counts[SERVER_BETTER] + j.counts[SERVER_SMALLER] + j.counts[UPLOADED] + j.counts[UPGRADED] + j.counts[SERVER_ERROR] + j.counts[CONFLICT] + j.counts[EMPTY_FILE]
+	j.Logger.Summary("Scan of the sources:")
+	j.Logger.Summary("%6d files in the input", j.counts[DISCOVERED_FILE])
+	j.Logger.Summary("--------------------------------------------------------")
+	j.Logger.Summary("%6d photos", j.counts[SCANNED_IMAGE])
+	j.Logger.Summary("%6d videos", j.counts[SCANNED_VIDEO])
+	j.Logger.Summary("%6d metadata files", j.counts[METADATA])
+	j.Logger.Summary("%6d files with metadata", j.counts[ASSOCIATED_META])
+	j.Logger.Summary("%6d discarded files", j.counts[DISCARDED])
+	j.Logger.Summary("%6d files having a type not supported", j.counts[UNSUPPORTED])
+	j.Logger.Summary("%6d discarded files because in folder failed videos", j.counts[FAILED_VIDEO])
+	if j.counts[MIME_MISMATCH] > 0 {
+		j.Logger.Summary("%6d files whose content doesn't match the extension", j.counts[MIME_MISMATCH])
+	}
+	if j.counts[NAME_SANITIZED] > 0 {
+		j.Logger.Summary("%6d files whose name is changed for the server", j.counts[NAME_SANITIZED])
+	}
+
+	j.Logger.Summary("%6d input total (difference %d)", checkFiles, j.counts[DISCOVERED_FILE]-checkFiles)
+	j.Logger.Summary("--------------------------------------------------------")
+
+	j.Logger.Summary("%6d uploaded files on the server", j.counts[UPLOADED])
+	j.Logger.Summary("%6d upgraded files on the server", j.counts[UPGRADED])
+	j.Logger.Summary("%6d files already on the server", j.counts[SERVER_DUPLICATE])
+	j.Logger.Summary("%6d discarded files because of options", j.counts[NOT_SELECTED])
+	j.Logger.Summary("%6d discarded files because of their size", j.counts[SIZE_FILTERED])
+	j.Logger.Summary("%6d discarded files because duplicated in the input", j.counts[LOCAL_DUPLICATE])
+	j.Logger.Summary("%6d discarded files because server has a better image", j.counts[SERVER_BETTER])
+	if j.counts[EMPTY_FILE] > 0 {
+		j.Logger.Summary("%6d discarded empty files", j.counts[EMPTY_FILE])
+	}
+	if j.counts[TRUNCATED] > 0 {
+		j.Logger.Summary("%6d truncated files", j.counts[TRUNCATED])
+	}
+	if j.counts[EXIF_SIDECAR] > 0 {
+		j.Logger.Summary("%6d RAW files uploaded with a sidecar of their EXIF", j.counts[EXIF_SIDECAR])
+	}
+	if j.counts[FAVORITE] > 0 {
+		j.Logger.Summary("%6d assets marked as favorites", j.counts[FAVORITE])
+	}
+	if j.counts[METADATA_PATCHED] > 0 {
+		j.Logger.Summary("%6d server's assets with corrected metadata", j.counts[METADATA_PATCHED])
+	}
+	if j.counts[SERVER_SMALLER] > 0 {
+		j.Logger.Summary("%6d discarded files smaller on the server, kept by -replace-smaller=false", j.counts[SERVER_SMALLER])
+	}
+	j.Logger.Summary("%6d discarded files because they can't be compared with the server's assets", j.counts[CONFLICT])
+	j.Logger.Summary("%6d errors when uploading", j.counts[SERVER_ERROR])
+
+	j.Logger.Summary("%6d handled total (difference %d)", handledFiles, j.counts[SCANNED_IMAGE]+j.counts[SCANNED_VIDEO]-handledFiles)
 
 }
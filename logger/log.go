@@ -3,10 +3,12 @@ package logger
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/ttacon/chalk"
 )
@@ -67,7 +69,10 @@ type Log struct {
 	noColors     bool
 	colorStrings map[Level]string
 	debug        bool
+	quiet        bool
 	out          io.WriteCloser
+	file         io.WriteCloser  // Receives all the messages whatever the level, nil when not used
+	pending      strings.Builder // Beginning of the line written by MessageContinue, for the file
 }
 
 func NewLogger(DisplayLevel Level, noColors bool, debug bool) *Log {
@@ -85,10 +90,14 @@ func NewLogger(DisplayLevel Level, noColors bool, debug bool) *Log {
 }
 
 func (l *Log) Close() error {
+	var err error
+	if l.file != nil {
+		err = l.file.Close()
+	}
 	if l.out != os.Stdout {
-		return l.out.Close()
+		err = errors.Join(err, l.out.Close())
 	}
-	return nil
+	return err
 }
 
 func (l *Log) SetDebugFlag(flag bool) {
@@ -99,6 +108,14 @@ func (l *Log) SetLevel(level Level) {
 	l.displayLevel = level
 }
 
+// SetQuiet limits the messages to the warnings, the errors and the summary, and hides the progression
+func (l *Log) SetQuiet(flag bool) {
+	l.quiet = flag
+	if flag && l.displayLevel > Warning {
+		l.displayLevel = Warning
+	}
+}
+
 func (l *Log) SetColors(flag bool) {
 	if l.out != os.Stdout {
 		flag = false
@@ -121,6 +138,30 @@ func (l *Log) SetWriter(w io.WriteCloser) *Log {
 	return l
 }
 
+// SetLogFile tees the messages of all levels into w, with their time and their level.
+// The progression isn't written.
+func (l *Log) SetLogFile(w io.WriteCloser) *Log {
+	if l != nil {
+		l.file = w
+	}
+	return l
+}
+
+// writeFile writes the message in the log file, each line starting with the time and the level
+func (l *Log) writeFile(level Level, f string, v ...any) {
+	if l.file == nil {
+		return
+	}
+	prefix := fmt.Sprintf("%s %-7s ", time.Now().Format("2006-01-02T15:04:05.000Z07:00"), strings.ToUpper(level.String()))
+	b := strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(fmt.Sprintf(f, v...), "\n"), "\n") {
+		b.WriteString(prefix)
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	_, _ = io.WriteString(l.file, b.String())
+}
+
 func (l *Log) Debug(f string, v ...any) {
 	if l == nil || l.out == nil {
 		return
@@ -132,8 +173,10 @@ type DebugObject interface {
 	DebugObject() any
 }
 
+// DebugObject displays the object in JSON with the -debug flag or the debug level.
+// The object isn't encoded otherwise.
 func (l *Log) DebugObject(name string, v any) {
-	if l == nil || !l.debug {
+	if l == nil || !l.debug && l.displayLevel < Debug {
 		return
 	}
 	if l.out == nil {
@@ -150,6 +193,7 @@ func (l *Log) DebugObject(name string, v any) {
 		l.Error("can't display object %s: %s", name, err)
 		return
 	}
+	l.writeFile(Debug, "%s:\n%s", name, b.String())
 	if l.needCR {
 		fmt.Println()
 		l.needCR = false
@@ -193,13 +237,30 @@ func (l *Log) Fatal(f string, v ...any) {
 	l.Message(Fatal, f, v...)
 }
 
+// Summary displays a line of the summary of the run, at the OK level. The quiet mode keeps it.
+func (l *Log) Summary(f string, v ...any) {
+	if l == nil || l.out == nil {
+		return
+	}
+	l.writeFile(OK, f, v...)
+	if OK > l.displayLevel && !l.quiet {
+		return
+	}
+	l.print(OK, f, v...)
+}
+
 func (l *Log) Message(level Level, f string, v ...any) {
 	if l == nil || l.out == nil {
 		return
 	}
+	l.writeFile(level, f, v...)
 	if level > l.displayLevel {
 		return
 	}
+	l.print(level, f, v...)
+}
+
+func (l *Log) print(level Level, f string, v ...any) {
 	if l.needCR {
 		fmt.Fprintln(l.out)
 		l.needCR = false
@@ -213,11 +274,9 @@ func (l *Log) Message(level Level, f string, v ...any) {
 	fmt.Fprintln(l.out)
 }
 
+// Progress updates the progression line in place. It is displayed whatever the level, but not in quiet mode.
 func (l *Log) Progress(level Level, f string, v ...any) {
-	if l == nil || l.out == nil {
-		return
-	}
-	if level > l.displayLevel {
+	if l == nil || l.out == nil || l.quiet {
 		return
 	}
 	fmt.Fprintf(l.out, "\r\033[2K"+f, v...)
@@ -228,6 +287,12 @@ func (l *Log) MessageContinue(level Level, f string, v ...any) {
 	if l == nil || l.out == nil {
 		return
 	}
+	if l.file != nil {
+		if l.pending.Len() > 0 {
+			l.pending.WriteString(" ")
+		}
+		fmt.Fprintf(&l.pending, f, v...)
+	}
 	if level > l.displayLevel {
 		return
 	}
@@ -248,6 +313,10 @@ func (l *Log) MessageTerminate(level Level, f string, v ...any) {
 	if l == nil || l.out == nil {
 		return
 	}
+	if l.file != nil {
+		l.writeFile(level, "%s%s", l.pending.String(), fmt.Sprintf(f, v...))
+		l.pending.Reset()
+	}
 	if level > l.displayLevel {
 		return
 	}
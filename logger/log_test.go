@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+type nopCloser struct {
+	strings.Builder
+}
+
+func (nopCloser) Close() error { return nil }
+
+// debugCounter counts the calls of DebugObject
+type debugCounter int
+
+func (d *debugCounter) DebugObject() any {
+	*d++
+	return "object"
+}
+
+func TestLevels(t *testing.T) {
+	for _, c := range []struct {
+		level    Level
+		quiet    bool
+		debug    bool
+		expected []string
+		encoded  bool
+	}{
+		{level: OK, expected: []string{"warning", "ok", "summary", "progress"}},
+		{level: Error, expected: []string{"progress"}},
+		{level: Info, expected: []string{"warning", "ok", "info", "summary", "progress"}},
+		{level: Debug, expected: []string{"warning", "ok", "info", "debug", "object", "summary", "progress"}, encoded: true},
+		{level: OK, debug: true, expected: []string{"warning", "ok", "object", "summary", "progress"}, encoded: true},
+		{level: Info, quiet: true, expected: []string{"warning", "summary"}},
+		{level: Error, quiet: true, expected: []string{"summary"}},
+	} {
+		w := &nopCloser{}
+		l := NewLogger(c.level, true, c.debug).SetWriter(w)
+		l.SetQuiet(c.quiet)
+		var d debugCounter
+		l.Warning("warning")
+		l.OK("ok")
+		l.Info("info")
+		l.Debug("debug")
+		l.DebugObject("object", &d)
+		l.Summary("summary")
+		l.Progress(OK, "progress")
+
+		// The object is displayed as its name followed by its JSON encoding
+		out := strings.NewReplacer("\r\033[2K", "", "object:\n\"object\"", "object").Replace(w.String())
+		got := strings.Fields(out)
+		if !slices.Equal(got, c.expected) {
+			t.Errorf("level %s, quiet %v, debug %v: expected %v, got %v", c.level, c.quiet, c.debug, c.expected, got)
+		}
+		if (d > 0) != c.encoded {
+			t.Errorf("level %s, debug %v: the object should be encoded only when displayed", c.level, c.debug)
+		}
+	}
+}
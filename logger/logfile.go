@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// LogFileBackups is the number of previous log files kept by the rotation
+const LogFileBackups = 3
+
+// RotatingFile is a log file rotated when it reaches its maximum size.
+// The current file is renamed with the suffix .1, the previous ones are shifted up to
+// .LogFileBackups, and the oldest one is removed.
+type RotatingFile struct {
+	mut     sync.Mutex
+	name    string
+	maxSize int64 // 0 for no rotation
+	size    int64
+	f       *os.File
+}
+
+// OpenRotatingFile opens the log file, the new lines are appended to the file
+func OpenRotatingFile(name string, maxSize int64) (*RotatingFile, error) {
+	r := &RotatingFile{name: name, maxSize: maxSize}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, s.Size()
+	return nil
+}
+
+// Write writes p in the current file, after a rotation when p doesn't fit in it
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		return err
+	}
+	for i := LogFileBackups - 1; i > 0; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", r.name, i), fmt.Sprintf("%s.%d", r.name, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Rename(r.name, r.name+".1")
+	if err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *RotatingFile) Close() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLogFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "run.log")
+	f, err := OpenRotatingFile(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := &nopCloser{}
+	l := NewLogger(Warning, true, false).SetWriter(console).SetLogFile(f)
+	l.Info("%s: %s", "Uploaded", "photo.jpg")
+	l.Error("can't read\nthe file")
+	l.MessageContinue(OK, "Get server's assets...")
+	l.MessageTerminate(OK, " %d received", 12)
+	l.Progress(OK, "progress")
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	expected := []string{
+		"INFO    Uploaded: photo.jpg",
+		"ERROR   can't read",
+		"ERROR   the file",
+		"OK      Get server's assets... 12 received",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), lines)
+	}
+	timestamp := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}(Z|[+-]\d\d:\d\d) `)
+	for i, line := range lines {
+		if !timestamp.MatchString(line) || timestamp.ReplaceAllString(line, "") != expected[i] {
+			t.Errorf("expected the line %q with a timestamp, got %q", expected[i], line)
+		}
+	}
+	if strings.Contains(console.String(), "Uploaded") || !strings.Contains(console.String(), "the file") {
+		t.Errorf("the console should display the messages of its level only, got %q", console.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "run.log")
+	err := os.WriteFile(name, []byte("previous run\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRotatingFile(name, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n", "line 5\n", "line 6\n", "line 7\n", "line 8\n", "line 9\n", "line 10\n"} {
+		_, err = f.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each file holds up to 20 bytes, and the oldest ones are removed
+	for suffix, expected := range map[string]string{
+		"":   "line 10\n",
+		".1": "line 8\nline 9\n",
+		".2": "line 6\nline 7\n",
+		".3": "line 4\nline 5\n",
+	} {
+		b, err := os.ReadFile(name + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("run.log%s: expected %q, got %q", suffix, expected, string(b))
+		}
+	}
+	if _, err := os.Stat(name + ".4"); !os.IsNotExist(err) {
+		t.Errorf("only %d previous files should be kept", LogFileBackups)
+	}
+}
@@ -8,6 +8,7 @@ type Logger interface {
 	Warning(f string, v ...any)
 	Error(f string, v ...any)
 	Fatal(f string, v ...any)
+	Summary(f string, v ...any)
 	Message(level Level, f string, v ...any)
 	Progress(level Level, f string, v ...any)
 	MessageContinue(level Level, f string, v ...any)
@@ -9,6 +9,7 @@ func (NoLogger) OK(f string, v ...any)                            {}
 func (NoLogger) Warning(f string, v ...any)                       {}
 func (NoLogger) Error(f string, v ...any)                         {}
 func (NoLogger) Fatal(f string, v ...any)                         {}
+func (NoLogger) Summary(f string, v ...any)                       {}
 func (NoLogger) Message(level Level, f string, v ...any)          {}
 func (NoLogger) Progress(level Level, f string, v ...any)         {}
 func (NoLogger) MessageContinue(level Level, f string, v ...any)  {}
@@ -8,14 +8,20 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/simulot/immich-go/cmddedupe"
+	"github.com/simulot/immich-go/cmddownload"
 	"github.com/simulot/immich-go/cmdduplicate"
 	"github.com/simulot/immich-go/cmdmetadata"
 	"github.com/simulot/immich-go/cmdstack"
 	"github.com/simulot/immich-go/cmdtool"
 	"github.com/simulot/immich-go/cmdupload"
 	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/helpers/ratelimit"
+	"github.com/simulot/immich-go/helpers/shutdown"
 	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/logger"
@@ -35,6 +41,7 @@ func main() {
 
 	// Create a context with cancel function to gracefully handle Ctrl+C events
 	ctx, cancel := context.WithCancel(context.Background())
+	ctx, stop := shutdown.WithStop(ctx)
 
 	// Handle Ctrl+C signal (SIGINT)
 	signalChannel := make(chan os.Signal, 1)
@@ -42,6 +49,11 @@ func main() {
 
 	go func() {
 		<-signalChannel
+		// The first Ctrl+C lets the command finish its current work
+		if stop() {
+			fmt.Println("\nCtrl+C received. Finishing the current work, press Ctrl+C again to abort...")
+			<-signalChannel
+		}
 		fmt.Println("\nCtrl+C received. Shutting down...")
 		cancel() // Cancel the context when Ctrl+C is received
 	}()
@@ -67,13 +79,22 @@ type Application struct {
 	ApiTrace    bool   // Enable API call traces
 	NoLogColors bool   // Disable log colors
 	LogLevel    string // Idicate the log level
+	Quiet       bool   // Display only the warnings, the errors and the summary
 	Debug       bool   // Enable the debug mode
 	TimeZone    string // Override default TZ
 	SkipSSL     bool   // Skip SSL Verification
 
-	Immich  *immich.ImmichClient // Immich client
-	Logger  *logger.Log          // Program's logger
-	LogFile string               //Log file
+	RateLimit     ratelimit.Rate // Upload bandwidth limit
+	ServerTimeout time.Duration  // Limit of the calls to the server, uploads excepted
+
+	MaxConnsPerHost int  // Limit of the connections with the server, 0 for no limit
+	HTTP2           bool // Use HTTP/2 with the servers supporting it
+
+	Immich *immich.ImmichClient // Immich client
+	Logger *logger.Log          // Program's logger
+
+	LogFile    string          // Log file receiving the messages of all levels
+	LogMaxSize myflag.ByteSize // Size of the log file triggering its rotation, 0 for no rotation
 
 }
 
@@ -87,12 +108,18 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 	flag.StringVar(&app.Key, "key", "", "API Key")
 	flag.StringVar(&app.DeviceUUID, "device-uuid", "", "Set a device UUID")
 	flag.BoolFunc("no-colors-log", "Disable colors on logs", myflag.BoolFlagFn(&app.NoLogColors, runtime.GOOS == "windows"))
-	flag.StringVar(&app.LogLevel, "log-level", "ok", "Log level (Error|Warning|OK|Info), default OK")
-	flag.StringVar(&app.LogFile, "log-file", "", "Write log messages into the file")
+	flag.StringVar(&app.LogLevel, "log-level", "ok", "Log level (Error|Warning|OK|Info|Debug), default OK")
+	flag.BoolFunc("quiet", "Display only the warnings, the errors and the summary of the run, without the progression", myflag.BoolFlagFn(&app.Quiet, false))
+	flag.StringVar(&app.LogFile, "log-file", "", "Write the messages of all levels into the file, with their time and level, whatever the -log-level")
+	flag.Var(&app.LogMaxSize, "log-max-size", "Rotate the log file when it reaches this size, ex: 10MB. The 3 previous files are kept with the suffixes .1, .2 and .3 (default: no rotation)")
 	flag.BoolFunc("api-trace", "enable api call traces", myflag.BoolFlagFn(&app.ApiTrace, false))
 	flag.BoolFunc("debug", "enable debug messages", myflag.BoolFlagFn(&app.Debug, false))
 	flag.StringVar(&app.TimeZone, "time-zone", "", "Override the system time zone")
 	flag.BoolFunc("skip-verify-ssl", "Skip SSL verification", myflag.BoolFlagFn(&app.SkipSSL, false))
+	flag.Var(&app.RateLimit, "rate-limit", "Limit the upload bandwidth, ex: 500KB/s, 5MB/s")
+	flag.DurationVar(&app.ServerTimeout, "server-timeout", 0, "Abort the calls to the server lasting longer, ex: 2m. The uploads are limited by the -upload-timeout option of the upload command (default: no limit)")
+	flag.IntVar(&app.MaxConnsPerHost, "max-conns-per-host", 0, "Limit the number of connections with the server. The idle connections are kept to be reused (default: no limit, 16 idle connections)")
+	flag.BoolFunc("http2", "Use HTTP/2 with the servers supporting it over TLS, all calls share the same connection", myflag.BoolFlagFn(&app.HTTP2, false))
 	flag.Parse()
 
 	app.Server = strings.TrimSuffix(app.Server, "/")
@@ -103,34 +130,39 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 	}
 
 	if len(app.LogFile) > 0 {
-		flog, err := os.Create(app.LogFile)
+		flog, err := logger.OpenRotatingFile(app.LogFile, int64(app.LogMaxSize))
 		if err != nil {
 			return log, fmt.Errorf("can't open the log file: %w", err)
 		}
-		log.SetWriter(flog)
+		log.SetLogFile(flog)
 		log.OK("immich-go  %s, commit %s, built at %s\n", version, commit, date)
+	} else if app.LogMaxSize > 0 {
+		return log, errors.New("the option -log-max-size requires -log-file")
 	}
 
+	simulate := simulated(flag.Args())
 	switch {
+	case simulate:
 	case len(app.Server) == 0 && len(app.API) == 0:
 		err = errors.Join(err, errors.New("missing -server, Immich server address (http://<your-ip>:2283 or https://<your-domain>)"))
 	case len(app.Server) > 0 && len(app.API) > 0:
 		err = errors.Join(err, errors.New("give either the -server or the -api option"))
 	}
-	if len(app.Key) == 0 {
+	if len(app.Key) == 0 && !simulate {
 		err = errors.Join(err, errors.New("missing -key"))
 	}
 
 	logLevel, e := logger.StringToLevel(app.LogLevel)
-	if err != nil {
+	if e != nil {
 		err = errors.Join(err, e)
 	}
 
 	if len(flag.Args()) == 0 {
-		err = errors.Join(err, errors.New("missing command upload|duplicate|stack"))
+		err = errors.Join(err, errors.New("missing command upload|sync|download|duplicate|dedupe|stack"))
 	}
 
 	log.SetLevel(logLevel)
+	log.SetQuiet(app.Quiet)
 	log.SetColors(!app.NoLogColors)
 	log.SetDebugFlag(app.Debug)
 
@@ -140,6 +172,11 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 		return app.Logger, err
 	}
 
+	if simulate {
+		// the upload command replaces the client by the simulated server
+		return app.Logger, cmdupload.UploadCommand(ctx, nil, app.Logger, flag.Args()[1:])
+	}
+
 	app.Immich, err = immich.NewImmichClient(app.Server, app.Key, app.SkipSSL)
 	if err != nil {
 		return app.Logger, err
@@ -153,7 +190,21 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 	if app.DeviceUUID != "" {
 		app.Immich.SetDeviceUUID(app.DeviceUUID)
 	}
+	if app.RateLimit > 0 {
+		app.Immich.SetUploadRateLimit(int(app.RateLimit))
+	}
+	if app.ServerTimeout > 0 {
+		app.Immich.SetTimeout(app.ServerTimeout)
+	}
+	app.Immich.SetMaxConnsPerHost(app.MaxConnsPerHost)
+	app.Immich.EnableHTTP2(app.HTTP2)
 
+	if app.API == "" {
+		err = app.Immich.DiscoverEndPoint(ctx)
+		if err != nil {
+			app.Logger.Warning("can't discover the API of the server, %s is used: %s", app.Immich.EndPoint(), err)
+		}
+	}
 	err = app.Immich.PingServer(ctx)
 	if err != nil {
 		return app.Logger, err
@@ -166,16 +217,28 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 	}
 	app.Logger.Info("Connected, user: %s", user.Email)
 
+	capabilities, err := app.Immich.GetServerCapabilities(ctx)
+	if err != nil {
+		return app.Logger, err
+	}
+	app.Logger.Info("Server version: %s", capabilities.Version)
+
 	cmd := flag.Args()[0]
 	switch cmd {
 	case "upload":
 		err = cmdupload.UploadCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
+	case "sync":
+		err = cmdupload.SyncCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
+	case "download":
+		err = cmddownload.DownloadCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
+	case "dedupe":
+		err = cmddedupe.DedupeCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
 	case "duplicate":
 		err = cmdduplicate.DuplicateCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
 	case "metadata":
 		err = cmdmetadata.MetadataCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
 	case "stack":
-		err = cmdstack.NewStackCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
+		err = cmdstack.StackCommand(ctx, app.Immich, app.Logger, flag.Args()[1:])
 	case "tool":
 		err = cmdtool.CommandTool(ctx, app.Immich, app.Logger, flag.Args()[1:])
 	default:
@@ -183,3 +246,22 @@ func Run(ctx context.Context, log *logger.Log) (*logger.Log, error) {
 	}
 	return app.Logger, err
 }
+
+// simulated reports whether the command is an upload with the -simulate option, which doesn't need any server
+func simulated(args []string) bool {
+	if len(args) == 0 || args[0] != "upload" {
+		return false
+	}
+	for _, a := range args[1:] {
+		name, v, found := strings.Cut(a, "=")
+		if strings.TrimLeft(name, "-") != "simulate" || !strings.HasPrefix(name, "-") {
+			continue
+		}
+		if !found {
+			return true
+		}
+		b, _ := strconv.ParseBool(strings.ToLower(v))
+		return b
+	}
+	return false
+}